@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"moneyget/internal/domain/service"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	storageSQLite   = "sqlite"
+	storagePostgres = "postgres"
+	storageMemory   = "memory"
+)
+
+// config is read from command-line flags, which default to environment
+// variables so the same binary can be configured either way.
+type config struct {
+	Storage     string
+	SQLitePath  string
+	DatabaseURL string
+	// SnapshotEvery is the number of events after which a portfolio
+	// snapshot is taken (0 disables periodic snapshots).
+	SnapshotEvery int
+	// AdminUserIDs are the users who may read the whole audit log.
+	AdminUserIDs []string
+}
+
+func loadConfig(args []string) (config, []string, error) {
+	var cfg config
+	var adminUserIDs string
+
+	fs := flag.NewFlagSet("moneyget", flag.ContinueOnError)
+	fs.StringVar(&cfg.Storage, "storage", envOr("MONEYGET_STORAGE", storageSQLite), "storage backend: sqlite, postgres or memory (demo data, nothing is persisted)")
+	fs.StringVar(&cfg.SQLitePath, "sqlite-path", envOr("MONEYGET_SQLITE_PATH", "moneyget.db"), "SQLite database file")
+	fs.StringVar(&cfg.DatabaseURL, "database-url", os.Getenv("DATABASE_URL"), "PostgreSQL connection string")
+	fs.IntVar(&cfg.SnapshotEvery, "snapshot-every", envIntOr("MONEYGET_SNAPSHOT_EVERY", service.DefaultSnapshotInterval), "take a portfolio snapshot every N events (0 disables)")
+	fs.StringVar(&adminUserIDs, "admin-user-ids", os.Getenv("MONEYGET_ADMIN_USER_IDS"), "comma-separated IDs of the users who may read the audit log")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: moneyget [flags] [migrate <command> | replay [-apply] | snapshot [portfolio-id...]]\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	for _, id := range strings.Split(adminUserIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			cfg.AdminUserIDs = append(cfg.AdminUserIDs, id)
+		}
+	}
+
+	if cfg.SnapshotEvery < 0 {
+		return cfg, nil, fmt.Errorf("--snapshot-every must not be negative")
+	}
+
+	switch cfg.Storage {
+	case storageSQLite, storageMemory:
+	case storagePostgres:
+		if cfg.DatabaseURL == "" {
+			return cfg, nil, fmt.Errorf("--database-url (or DATABASE_URL) is required for --storage=%s", storagePostgres)
+		}
+	default:
+		return cfg, nil, fmt.Errorf("unknown storage %q", cfg.Storage)
+	}
+
+	return cfg, fs.Args(), nil
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envIntOr(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+type CashTransactionType string
+
+const (
+	CashDeposit    CashTransactionType = "DEPOSIT"
+	CashWithdrawal CashTransactionType = "WITHDRAWAL"
+	CashInvestment CashTransactionType = "INVESTMENT" // 投資による出金
+	CashSale       CashTransactionType = "SALE"       // 売却代金の入金
+	CashDividend   CashTransactionType = "DIVIDEND"   // 配当金の入金
+)
+
+// IsDebit reports whether the transaction type takes money out of the cash balance.
+func (t CashTransactionType) IsDebit() bool {
+	return t == CashWithdrawal || t == CashInvestment
+}
+
+// IsLiquidation reports whether the transaction type turns holdings into cash
+// or takes cash out. Archived portfolios still accept these so that they can
+// be emptied and deleted.
+func (t CashTransactionType) IsLiquidation() bool {
+	return t == CashSale || t == CashWithdrawal
+}
+
+func isValidCashTransactionType(t CashTransactionType) bool {
+	switch t {
+	case CashDeposit, CashWithdrawal, CashInvestment, CashSale, CashDividend:
+		return true
+	default:
+		return false
+	}
+}
+
+// CashTransaction is a single entry in a portfolio's cash ledger.
+// Amount is always positive; the direction is given by Type.
+type CashTransaction struct {
+	ID           string
+	Type         CashTransactionType
+	Amount       Money
+	InvestmentID InvestmentID // 投資に紐づかない入出金ではゼロ値
+	OccurredAt   time.Time
+}
+
+func NewCashTransaction(id string, typeVal CashTransactionType, amount Money, investmentID InvestmentID) (*CashTransaction, error) {
+	if !isValidCashTransactionType(typeVal) {
+		return nil, ErrInvalidCashTransaction
+	}
+	if amount.Amount <= 0 || amount.Currency == "" {
+		return nil, ErrInvalidCashAmount
+	}
+	return &CashTransaction{
+		ID:           id,
+		Type:         typeVal,
+		Amount:       amount,
+		InvestmentID: investmentID,
+		OccurredAt:   time.Now(),
+	}, nil
+}
+
+// signedAmount returns the effect of the transaction on the balance of its currency.
+func (t *CashTransaction) signedAmount() float64 {
+	if t.Type.IsDebit() {
+		return -t.Amount.Amount
+	}
+	return t.Amount.Amount
+}
+
+// cashBalances folds a ledger into one balance per currency.
+func cashBalances(ledger []*CashTransaction) map[string]float64 {
+	balances := make(map[string]float64)
+	for _, tx := range ledger {
+		balances[tx.Amount.Currency] += tx.signedAmount()
+	}
+	return balances
+}
+
+func sortedCurrencies(balances map[string]float64) []string {
+	currencies := make([]string, 0, len(balances))
+	for currency := range balances {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
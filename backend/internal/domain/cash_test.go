@@ -0,0 +1,124 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestNewCashTransaction(t *testing.T) {
+	tests := []struct {
+		name        string
+		typeVal     CashTransactionType
+		amount      float64
+		expectError error
+	}{
+		{
+			name:        "valid deposit",
+			typeVal:     CashDeposit,
+			amount:      1000,
+			expectError: nil,
+		},
+		{
+			name:        "zero amount",
+			typeVal:     CashDeposit,
+			amount:      0,
+			expectError: ErrInvalidCashAmount,
+		},
+		{
+			name:        "invalid type",
+			typeVal:     "INVALID",
+			amount:      1000,
+			expectError: ErrInvalidCashTransaction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			money, _ := NewMoney(tt.amount, "JPY")
+			tx, err := NewCashTransaction("tx-1", tt.typeVal, money, InvestmentID{})
+
+			if err != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if tt.expectError == nil && tx.Amount != money {
+				t.Errorf("Expected amount %v, got %v", money, tx.Amount)
+			}
+		})
+	}
+}
+
+func TestPortfolio_RecordCashTransaction(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+
+	record := func(id string, typeVal CashTransactionType, amount float64, currency string) error {
+		money, _ := NewMoney(amount, currency)
+		tx, err := NewCashTransaction(id, typeVal, money, InvestmentID{})
+		if err != nil {
+			t.Fatalf("Failed to create cash transaction: %v", err)
+		}
+		return portfolio.RecordCashTransaction(tx)
+	}
+
+	if err := record("deposit-jpy", CashDeposit, 100000, "JPY"); err != nil {
+		t.Fatalf("Unexpected error depositing JPY: %v", err)
+	}
+	if err := record("deposit-usd", CashDeposit, 500, "USD"); err != nil {
+		t.Fatalf("Unexpected error depositing USD: %v", err)
+	}
+	if err := record("withdraw-jpy", CashWithdrawal, 30000, "JPY"); err != nil {
+		t.Fatalf("Unexpected error withdrawing JPY: %v", err)
+	}
+
+	// 他通貨の残高は引き出しに使えない
+	if err := record("withdraw-eur", CashWithdrawal, 1, "EUR"); err != ErrInsufficientFunds {
+		t.Errorf("Expected ErrInsufficientFunds for EUR withdrawal, got %v", err)
+	}
+	if err := record("overdraw-usd", CashWithdrawal, 501, "USD"); err != ErrInsufficientFunds {
+		t.Errorf("Expected ErrInsufficientFunds for USD overdraw, got %v", err)
+	}
+
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 70000 {
+		t.Errorf("Expected JPY balance 70000, got %f", balance.Amount)
+	}
+	if balance := portfolio.CashBalance("USD"); balance.Amount != 500 {
+		t.Errorf("Expected USD balance 500, got %f", balance.Amount)
+	}
+
+	balances := portfolio.CashBalances()
+	if len(balances) != 2 || balances[0].Currency != "JPY" || balances[1].Currency != "USD" {
+		t.Errorf("Expected JPY and USD balances in order, got %v", balances)
+	}
+
+	if len(portfolio.CashTransactions) != 3 {
+		t.Errorf("Expected 3 ledger entries, got %d", len(portfolio.CashTransactions))
+	}
+}
+
+func TestPortfolio_CalculateTotalAmountWithCash(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+
+	deposit, _ := NewMoney(500000, "JPY")
+	depositTx, _ := NewCashTransaction("deposit", CashDeposit, deposit, InvestmentID{})
+	_ = portfolio.RecordCashTransaction(depositTx)
+
+	foreign, _ := NewMoney(100, "USD")
+	foreignTx, _ := NewCashTransaction("deposit-usd", CashDeposit, foreign, InvestmentID{})
+	_ = portfolio.RecordCashTransaction(foreignTx)
+
+	money, _ := NewMoney(200000, "JPY")
+	investment, _ := NewInvestment(NewInvestmentID("test-investment"), money, Stock, Conservative)
+	debit, _ := NewCashTransaction("debit", CashInvestment, money, investment.ID())
+	if err := portfolio.RecordCashTransaction(debit); err != nil {
+		t.Fatalf("Failed to debit cash: %v", err)
+	}
+	if err := portfolio.AddInvestment(investment); err != nil {
+		t.Fatalf("Failed to add investment: %v", err)
+	}
+
+	// 投資 200,000 + 現金 300,000（USDの現金は換算しない）
+	if total := portfolio.CalculateTotalAmount(); total.Amount != 500000 || total.Currency != "JPY" {
+		t.Errorf("Expected total 500000 JPY, got %f %s", total.Amount, total.Currency)
+	}
+	if invested := portfolio.CalculateInvestedAmount(); invested.Amount != 200000 {
+		t.Errorf("Expected invested amount 200000, got %f", invested.Amount)
+	}
+}
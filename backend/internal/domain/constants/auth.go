@@ -5,6 +5,8 @@ import "time"
 const (
 	// JWT Settings
 	JWTTokenExpiration = time.Hour * 24
+	JWTIssuer          = "moneyget"
+	JWTAudience        = "moneyget-api"
 
 	// Auth Related Messages
 	InvalidCredentials = "Invalid credentials"
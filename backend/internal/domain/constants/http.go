@@ -2,7 +2,11 @@ package constants
 
 const (
 	// Content Type Headers
-	ContentTypeJSON = "application/json"
+	ContentTypeJSON        = "application/json"
+	ContentTypeProblemJSON = "application/problem+json"
+
+	// Request ID Header (correlation ID of a request)
+	RequestIDHeader = "X-Request-ID"
 
 	// Authorization Headers
 	AuthorizationHeader = "Authorization"
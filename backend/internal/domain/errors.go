@@ -29,6 +29,23 @@ var (
 	ErrInternal     = errors.New("internal error")
 )
 
+// 同時実行制御のエラー
+var (
+	// ErrConcurrentModification is returned by repositories when the aggregate
+	// was changed by someone else since it was loaded.
+	ErrConcurrentModification = &DomainError{
+		Code:    "CONCURRENT_MODIFICATION",
+		Message: "the resource was modified concurrently",
+	}
+
+	// ErrVersionMismatch is returned when the caller expected a version of the
+	// aggregate other than the current one (e.g. a stale If-Match header).
+	ErrVersionMismatch = &DomainError{
+		Code:    "VERSION_MISMATCH",
+		Message: "the resource has changed since it was retrieved",
+	}
+)
+
 // 投資関連のエラー
 var (
 	ErrInvalidInvestmentAmount = &DomainError{
@@ -67,8 +84,111 @@ var (
 	}
 )
 
+// 現金関連のエラー
+var (
+	ErrInsufficientFunds = &DomainError{
+		Code:    "INSUFFICIENT_FUNDS",
+		Message: "insufficient cash balance",
+	}
+
+	ErrInvalidCashAmount = &DomainError{
+		Code:    "INVALID_CASH_AMOUNT",
+		Message: "cash amount must be greater than zero",
+	}
+
+	ErrInvalidCashTransaction = &DomainError{
+		Code:    "INVALID_CASH_TRANSACTION",
+		Message: "cash transaction is invalid",
+	}
+)
+
 // ポートフォリオ関連のエラー
 var (
 	ErrPortfolioNotFound    = errors.New("portfolio not found")
 	ErrInvalidPortfolioData = errors.New("invalid portfolio data")
+	ErrInvalidEventStream   = errors.New("invalid event stream")
+
+	ErrInvalidPortfolioName = &DomainError{
+		Code:    "INVALID_PORTFOLIO_NAME",
+		Message: "portfolio name must be between 1 and 100 characters",
+	}
+
+	ErrDuplicatePortfolioName = &DomainError{
+		Code:    "DUPLICATE_PORTFOLIO_NAME",
+		Message: "a portfolio with this name already exists",
+	}
+
+	ErrPortfolioArchived = &DomainError{
+		Code:    "PORTFOLIO_ARCHIVED",
+		Message: "portfolio is archived",
+	}
+
+	ErrPortfolioNotEmpty = &DomainError{
+		Code:    "PORTFOLIO_NOT_EMPTY",
+		Message: "portfolio still holds investments",
+	}
+)
+
+// 共有・権限関連のエラー
+var (
+	ErrForbidden = &DomainError{
+		Code:    "FORBIDDEN",
+		Message: "you do not have permission to perform this action",
+	}
+
+	ErrInvalidPortfolioRole = &DomainError{
+		Code:    "INVALID_PORTFOLIO_ROLE",
+		Message: "portfolio role is invalid",
+	}
+
+	ErrInvitationNotFound = &DomainError{
+		Code:    "INVITATION_NOT_FOUND",
+		Message: "invitation not found",
+	}
+
+	ErrInvitationNotPending = &DomainError{
+		Code:    "INVITATION_NOT_PENDING",
+		Message: "invitation has already been accepted",
+	}
+
+	ErrAlreadyMember = &DomainError{
+		Code:    "ALREADY_MEMBER",
+		Message: "user already has access to this portfolio",
+	}
+)
+
+// Webhook関連のエラー
+var (
+	ErrWebhookNotFound = &DomainError{
+		Code:    "WEBHOOK_NOT_FOUND",
+		Message: "webhook subscription not found",
+	}
+
+	ErrWebhookDeliveryNotFound = &DomainError{
+		Code:    "WEBHOOK_DELIVERY_NOT_FOUND",
+		Message: "webhook delivery not found",
+	}
+
+	ErrInvalidWebhookURL = &DomainError{
+		Code:    "INVALID_WEBHOOK_URL",
+		Message: "webhook URL must be an absolute http or https URL of a public host",
+	}
+
+	ErrInvalidWebhookEventType = &DomainError{
+		Code:    "INVALID_WEBHOOK_EVENT_TYPE",
+		Message: "webhook event types must be known event types",
+	}
+
+	ErrInvalidWebhookSecret = &DomainError{
+		Code:    "INVALID_WEBHOOK_SECRET",
+		Message: "webhook secret must not be empty",
+	}
+)
+
+// 監査ログ関連のエラー
+var (
+	ErrInvalidAuditQuery = &DomainError{
+		Code:    "INVALID_AUDIT_QUERY",
+		Message: "audit query is invalid",
+	}
 )
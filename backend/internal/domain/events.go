@@ -1,50 +1,565 @@
 package domain
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 )
 
+// DomainEvent is a change of one aggregate. Events are stored in the stream
+// of their aggregate, identified by AggregateType and AggregateID, and
+// marshal their full payload to JSON.
 type DomainEvent interface {
+	AggregateID() string
+	AggregateType() string
 	OccurredAt() time.Time
 }
 
+// 集約の種類（イベントストリームの識別に使う）
+const (
+	AggregatePortfolio = "Portfolio"
+)
+
+// portfolioEvent is the part shared by the events of the portfolio stream.
+type portfolioEvent struct {
+	portfolioID PortfolioID
+	occurredAt  time.Time
+}
+
+// newPortfolioEvent keeps the time in UTC so that an event decoded from its
+// payload equals the original.
+func newPortfolioEvent(portfolioID PortfolioID, occurredAt time.Time) portfolioEvent {
+	return portfolioEvent{portfolioID: portfolioID, occurredAt: occurredAt.UTC()}
+}
+
+func (e portfolioEvent) PortfolioID() PortfolioID {
+	return e.portfolioID
+}
+
+func (e portfolioEvent) AggregateID() string {
+	return e.portfolioID.Value
+}
+
+func (e portfolioEvent) AggregateType() string {
+	return AggregatePortfolio
+}
+
+func (e portfolioEvent) OccurredAt() time.Time {
+	return e.occurredAt
+}
+
+// PortfolioCreatedEvent starts the stream of a portfolio.
+type PortfolioCreatedEvent struct {
+	portfolioEvent
+	userID string
+	name   string
+}
+
+func NewPortfolioCreatedEvent(portfolioID PortfolioID, userID string, name string, occurredAt time.Time) PortfolioCreatedEvent {
+	return PortfolioCreatedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		userID:         userID,
+		name:           name,
+	}
+}
+
+func (e PortfolioCreatedEvent) UserID() string {
+	return e.userID
+}
+
+func (e PortfolioCreatedEvent) Name() string {
+	return e.name
+}
+
+type portfolioCreatedPayload struct {
+	PortfolioID string    `json:"portfolio_id"`
+	UserID      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+func (e PortfolioCreatedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portfolioCreatedPayload{
+		PortfolioID: e.portfolioID.Value,
+		UserID:      e.userID,
+		Name:        e.name,
+		OccurredAt:  e.occurredAt,
+	})
+}
+
+func (e *PortfolioCreatedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioCreatedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewPortfolioCreatedEvent(NewPortfolioID(payload.PortfolioID), payload.UserID, payload.Name, payload.OccurredAt)
+	return nil
+}
+
+// PortfolioRenamedEvent records a new name.
+type PortfolioRenamedEvent struct {
+	portfolioEvent
+	name string
+}
+
+func NewPortfolioRenamedEvent(portfolioID PortfolioID, name string, occurredAt time.Time) PortfolioRenamedEvent {
+	return PortfolioRenamedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		name:           name,
+	}
+}
+
+func (e PortfolioRenamedEvent) Name() string {
+	return e.name
+}
+
+type portfolioRenamedPayload struct {
+	PortfolioID string    `json:"portfolio_id"`
+	Name        string    `json:"name"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+func (e PortfolioRenamedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portfolioRenamedPayload{
+		PortfolioID: e.portfolioID.Value,
+		Name:        e.name,
+		OccurredAt:  e.occurredAt,
+	})
+}
+
+func (e *PortfolioRenamedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioRenamedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewPortfolioRenamedEvent(NewPortfolioID(payload.PortfolioID), payload.Name, payload.OccurredAt)
+	return nil
+}
+
+// PortfolioArchivedEvent records that the portfolio became read-only.
+type PortfolioArchivedEvent struct {
+	portfolioEvent
+}
+
+func NewPortfolioArchivedEvent(portfolioID PortfolioID, occurredAt time.Time) PortfolioArchivedEvent {
+	return PortfolioArchivedEvent{portfolioEvent: newPortfolioEvent(portfolioID, occurredAt)}
+}
+
+// PortfolioDeletedEvent ends the stream of a portfolio.
+type PortfolioDeletedEvent struct {
+	portfolioEvent
+}
+
+func NewPortfolioDeletedEvent(portfolioID PortfolioID, occurredAt time.Time) PortfolioDeletedEvent {
+	return PortfolioDeletedEvent{portfolioEvent: newPortfolioEvent(portfolioID, occurredAt)}
+}
+
+// portfolioOnlyPayload is the payload of events without data of their own.
+type portfolioOnlyPayload struct {
+	PortfolioID string    `json:"portfolio_id"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+func (e PortfolioArchivedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portfolioOnlyPayload{PortfolioID: e.portfolioID.Value, OccurredAt: e.occurredAt})
+}
+
+func (e *PortfolioArchivedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioOnlyPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewPortfolioArchivedEvent(NewPortfolioID(payload.PortfolioID), payload.OccurredAt)
+	return nil
+}
+
+func (e PortfolioDeletedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portfolioOnlyPayload{PortfolioID: e.portfolioID.Value, OccurredAt: e.occurredAt})
+}
+
+func (e *PortfolioDeletedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioOnlyPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewPortfolioDeletedEvent(NewPortfolioID(payload.PortfolioID), payload.OccurredAt)
+	return nil
+}
+
+// InvestmentCreatedEvent records an investment bought by a portfolio.
+// OccurredAt is the creation time of the investment.
 type InvestmentCreatedEvent struct {
-	investmentID InvestmentID
-	amount       Money
-	occurredAt   time.Time
+	portfolioEvent
+	investmentID   InvestmentID
+	amount         Money
+	investmentType InvestmentType
+	strategy       InvestmentStrategy
 }
 
-func NewInvestmentCreatedEvent(investmentID InvestmentID, amount Money) InvestmentCreatedEvent {
+func NewInvestmentCreatedEvent(portfolioID PortfolioID, investment *Investment) InvestmentCreatedEvent {
 	return InvestmentCreatedEvent{
-		investmentID: investmentID,
-		amount:       amount,
-		occurredAt:   time.Now(),
+		portfolioEvent: newPortfolioEvent(portfolioID, investment.CreatedAt),
+		investmentID:   investment.ID(),
+		amount:         investment.Amount(),
+		investmentType: investment.Type(),
+		strategy:       investment.Strategy(),
 	}
 }
 
-func (e InvestmentCreatedEvent) OccurredAt() time.Time {
-	return e.occurredAt
+func (e InvestmentCreatedEvent) InvestmentID() InvestmentID {
+	return e.investmentID
+}
+
+func (e InvestmentCreatedEvent) Amount() Money {
+	return e.amount
+}
+
+func (e InvestmentCreatedEvent) InvestmentType() InvestmentType {
+	return e.investmentType
+}
+
+func (e InvestmentCreatedEvent) Strategy() InvestmentStrategy {
+	return e.strategy
+}
+
+type investmentCreatedPayload struct {
+	PortfolioID  string             `json:"portfolio_id"`
+	InvestmentID string             `json:"investment_id"`
+	Amount       moneyPayload       `json:"amount"`
+	Type         InvestmentType     `json:"type"`
+	Strategy     InvestmentStrategy `json:"strategy"`
+	OccurredAt   time.Time          `json:"occurred_at"`
+}
+
+func (e InvestmentCreatedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(investmentCreatedPayload{
+		PortfolioID:  e.portfolioID.Value,
+		InvestmentID: e.investmentID.Value,
+		Amount:       newMoneyPayload(e.amount),
+		Type:         e.investmentType,
+		Strategy:     e.strategy,
+		OccurredAt:   e.occurredAt,
+	})
+}
+
+func (e *InvestmentCreatedEvent) UnmarshalJSON(data []byte) error {
+	var payload investmentCreatedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = InvestmentCreatedEvent{
+		portfolioEvent: newPortfolioEvent(NewPortfolioID(payload.PortfolioID), payload.OccurredAt),
+		investmentID:   NewInvestmentID(payload.InvestmentID),
+		amount:         payload.Amount.money(),
+		investmentType: payload.Type,
+		strategy:       payload.Strategy,
+	}
+	return nil
+}
+
+// InvestmentAmountChangedEvent records a revaluation of one investment.
+type InvestmentAmountChangedEvent struct {
+	portfolioEvent
+	investmentID   InvestmentID
+	previousAmount Money
+	amount         Money
 }
 
+func NewInvestmentAmountChangedEvent(portfolioID PortfolioID, investmentID InvestmentID, previousAmount Money, amount Money, occurredAt time.Time) InvestmentAmountChangedEvent {
+	return InvestmentAmountChangedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		investmentID:   investmentID,
+		previousAmount: previousAmount,
+		amount:         amount,
+	}
+}
+
+func (e InvestmentAmountChangedEvent) InvestmentID() InvestmentID {
+	return e.investmentID
+}
+
+func (e InvestmentAmountChangedEvent) PreviousAmount() Money {
+	return e.previousAmount
+}
+
+func (e InvestmentAmountChangedEvent) Amount() Money {
+	return e.amount
+}
+
+type investmentAmountChangedPayload struct {
+	PortfolioID    string       `json:"portfolio_id"`
+	InvestmentID   string       `json:"investment_id"`
+	PreviousAmount moneyPayload `json:"previous_amount"`
+	Amount         moneyPayload `json:"amount"`
+	OccurredAt     time.Time    `json:"occurred_at"`
+}
+
+func (e InvestmentAmountChangedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(investmentAmountChangedPayload{
+		PortfolioID:    e.portfolioID.Value,
+		InvestmentID:   e.investmentID.Value,
+		PreviousAmount: newMoneyPayload(e.previousAmount),
+		Amount:         newMoneyPayload(e.amount),
+		OccurredAt:     e.occurredAt,
+	})
+}
+
+func (e *InvestmentAmountChangedEvent) UnmarshalJSON(data []byte) error {
+	var payload investmentAmountChangedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewInvestmentAmountChangedEvent(
+		NewPortfolioID(payload.PortfolioID),
+		NewInvestmentID(payload.InvestmentID),
+		payload.PreviousAmount.money(),
+		payload.Amount.money(),
+		payload.OccurredAt,
+	)
+	return nil
+}
+
+// InvestmentRemovedEvent records an investment leaving the portfolio. The
+// proceeds of a sale are a separate cash transaction.
+type InvestmentRemovedEvent struct {
+	portfolioEvent
+	investmentID InvestmentID
+}
+
+func NewInvestmentRemovedEvent(portfolioID PortfolioID, investmentID InvestmentID, occurredAt time.Time) InvestmentRemovedEvent {
+	return InvestmentRemovedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		investmentID:   investmentID,
+	}
+}
+
+func (e InvestmentRemovedEvent) InvestmentID() InvestmentID {
+	return e.investmentID
+}
+
+type investmentRemovedPayload struct {
+	PortfolioID  string    `json:"portfolio_id"`
+	InvestmentID string    `json:"investment_id"`
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+func (e InvestmentRemovedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(investmentRemovedPayload{
+		PortfolioID:  e.portfolioID.Value,
+		InvestmentID: e.investmentID.Value,
+		OccurredAt:   e.occurredAt,
+	})
+}
+
+func (e *InvestmentRemovedEvent) UnmarshalJSON(data []byte) error {
+	var payload investmentRemovedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewInvestmentRemovedEvent(NewPortfolioID(payload.PortfolioID), NewInvestmentID(payload.InvestmentID), payload.OccurredAt)
+	return nil
+}
+
+// RebalanceChange is the new amount of one investment in a rebalance.
+type RebalanceChange struct {
+	InvestmentID InvestmentID
+	Amount       Money
+}
+
+// PortfolioRebalancedEvent records new amounts for several investments,
+// applied together.
+type PortfolioRebalancedEvent struct {
+	portfolioEvent
+	changes []RebalanceChange
+}
+
+func NewPortfolioRebalancedEvent(portfolioID PortfolioID, changes []RebalanceChange, occurredAt time.Time) PortfolioRebalancedEvent {
+	return PortfolioRebalancedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		changes:        append([]RebalanceChange(nil), changes...),
+	}
+}
+
+func (e PortfolioRebalancedEvent) Changes() []RebalanceChange {
+	return append([]RebalanceChange(nil), e.changes...)
+}
+
+type rebalanceChangePayload struct {
+	InvestmentID string       `json:"investment_id"`
+	Amount       moneyPayload `json:"amount"`
+}
+
+type portfolioRebalancedPayload struct {
+	PortfolioID string                   `json:"portfolio_id"`
+	Changes     []rebalanceChangePayload `json:"changes"`
+	OccurredAt  time.Time                `json:"occurred_at"`
+}
+
+func (e PortfolioRebalancedEvent) MarshalJSON() ([]byte, error) {
+	payload := portfolioRebalancedPayload{
+		PortfolioID: e.portfolioID.Value,
+		Changes:     make([]rebalanceChangePayload, 0, len(e.changes)),
+		OccurredAt:  e.occurredAt,
+	}
+	for _, change := range e.changes {
+		payload.Changes = append(payload.Changes, rebalanceChangePayload{
+			InvestmentID: change.InvestmentID.Value,
+			Amount:       newMoneyPayload(change.Amount),
+		})
+	}
+	return json.Marshal(payload)
+}
+
+func (e *PortfolioRebalancedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioRebalancedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	changes := make([]RebalanceChange, 0, len(payload.Changes))
+	for _, change := range payload.Changes {
+		changes = append(changes, RebalanceChange{
+			InvestmentID: NewInvestmentID(change.InvestmentID),
+			Amount:       change.Amount.money(),
+		})
+	}
+	*e = NewPortfolioRebalancedEvent(NewPortfolioID(payload.PortfolioID), changes, payload.OccurredAt)
+	return nil
+}
+
+// CashTransactionRecordedEvent records an entry of the cash ledger.
+// OccurredAt is the time of the transaction.
+type CashTransactionRecordedEvent struct {
+	portfolioEvent
+	transaction CashTransaction
+}
+
+func NewCashTransactionRecordedEvent(portfolioID PortfolioID, tx *CashTransaction) CashTransactionRecordedEvent {
+	event := CashTransactionRecordedEvent{
+		portfolioEvent: newPortfolioEvent(portfolioID, tx.OccurredAt),
+		transaction:    *tx,
+	}
+	event.transaction.OccurredAt = event.occurredAt
+	return event
+}
+
+// Transaction returns a copy of the recorded ledger entry.
+func (e CashTransactionRecordedEvent) Transaction() *CashTransaction {
+	tx := e.transaction
+	return &tx
+}
+
+type cashTransactionRecordedPayload struct {
+	PortfolioID   string              `json:"portfolio_id"`
+	TransactionID string              `json:"transaction_id"`
+	Type          CashTransactionType `json:"type"`
+	Amount        moneyPayload        `json:"amount"`
+	InvestmentID  string              `json:"investment_id,omitempty"`
+	OccurredAt    time.Time           `json:"occurred_at"`
+}
+
+func (e CashTransactionRecordedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cashTransactionRecordedPayload{
+		PortfolioID:   e.portfolioID.Value,
+		TransactionID: e.transaction.ID,
+		Type:          e.transaction.Type,
+		Amount:        newMoneyPayload(e.transaction.Amount),
+		InvestmentID:  e.transaction.InvestmentID.Value,
+		OccurredAt:    e.occurredAt,
+	})
+}
+
+func (e *CashTransactionRecordedEvent) UnmarshalJSON(data []byte) error {
+	var payload cashTransactionRecordedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = NewCashTransactionRecordedEvent(NewPortfolioID(payload.PortfolioID), &CashTransaction{
+		ID:           payload.TransactionID,
+		Type:         payload.Type,
+		Amount:       payload.Amount.money(),
+		InvestmentID: NewInvestmentID(payload.InvestmentID),
+		OccurredAt:   payload.OccurredAt,
+	})
+	return nil
+}
+
+// PortfolioUpdatedEvent reports the total amount of a portfolio after a
+// change. It is a notification for subscribers and does not change state.
 type PortfolioUpdatedEvent struct {
-	portfolioID PortfolioID
+	portfolioEvent
 	totalAmount Money
-	occurredAt  time.Time
 }
 
-func NewPortfolioUpdatedEvent(portfolioID PortfolioID, totalAmount Money) PortfolioUpdatedEvent {
+func NewPortfolioUpdatedEvent(portfolioID PortfolioID, totalAmount Money, occurredAt time.Time) PortfolioUpdatedEvent {
 	return PortfolioUpdatedEvent{
-		portfolioID: portfolioID,
-		totalAmount: totalAmount,
-		occurredAt:  time.Now(),
+		portfolioEvent: newPortfolioEvent(portfolioID, occurredAt),
+		totalAmount:    totalAmount,
 	}
 }
 
-func (e PortfolioUpdatedEvent) OccurredAt() time.Time {
-	return e.occurredAt
+func (e PortfolioUpdatedEvent) TotalAmount() Money {
+	return e.totalAmount
+}
+
+type portfolioUpdatedPayload struct {
+	PortfolioID string       `json:"portfolio_id"`
+	TotalAmount moneyPayload `json:"total_amount"`
+	OccurredAt  time.Time    `json:"occurred_at"`
+}
+
+func (e PortfolioUpdatedEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portfolioUpdatedPayload{
+		PortfolioID: e.portfolioID.Value,
+		TotalAmount: newMoneyPayload(e.totalAmount),
+		OccurredAt:  e.occurredAt,
+	})
+}
+
+func (e *PortfolioUpdatedEvent) UnmarshalJSON(data []byte) error {
+	var payload portfolioUpdatedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*e = PortfolioUpdatedEvent{
+		portfolioEvent: newPortfolioEvent(NewPortfolioID(payload.PortfolioID), payload.OccurredAt),
+		totalAmount:    payload.TotalAmount.money(),
+	}
+	return nil
 }
 
+// moneyPayload is the JSON form of Money in event payloads.
+type moneyPayload struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func newMoneyPayload(m Money) moneyPayload {
+	return moneyPayload{Amount: m.Amount, Currency: m.Currency}
+}
+
+func (p moneyPayload) money() Money {
+	return Money{Amount: p.Amount, Currency: p.Currency}
+}
+
+// DomainEventPublisher delivers events to the subscribed handlers. Publish
+// fails when the event could not be handed to them.
 type DomainEventPublisher interface {
 	Publish(event DomainEvent) error
-	Subscribe(handler func(DomainEvent)) error
+	Subscribe(handler func(DomainEvent) error) error
+}
+
+// EventOutbox records events in the transaction of the context, together
+// with the aggregates they describe. They are published once committed.
+type EventOutbox interface {
+	Add(ctx context.Context, events ...DomainEvent) error
 }
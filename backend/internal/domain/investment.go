@@ -34,6 +34,7 @@ type Investment struct {
 	amount    Money
 	typeVal   InvestmentType
 	strategy  InvestmentStrategy
+	Version   int       // エクスポート（楽観的ロック用、未保存なら0）
 	CreatedAt time.Time // エクスポート
 	UpdatedAt time.Time // エクスポート
 }
@@ -56,6 +57,29 @@ func NewInvestment(id InvestmentID, amount Money, typeVal InvestmentType, strate
 	}, nil
 }
 
+// ReconstituteInvestment rebuilds an investment from persisted state. Unlike
+// NewInvestment it performs no validation and keeps the stored version and
+// timestamps; it is meant for repositories only.
+func ReconstituteInvestment(
+	id InvestmentID,
+	amount Money,
+	typeVal InvestmentType,
+	strategy InvestmentStrategy,
+	version int,
+	createdAt time.Time,
+	updatedAt time.Time,
+) *Investment {
+	return &Investment{
+		id:        id,
+		amount:    amount,
+		typeVal:   typeVal,
+		strategy:  strategy,
+		Version:   version,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}
+}
+
 func (i *Investment) ID() InvestmentID {
 	return i.id
 }
@@ -73,11 +97,15 @@ func (i *Investment) Strategy() InvestmentStrategy {
 }
 
 func (i *Investment) UpdateAmount(newAmount Money) error {
-	i.amount = newAmount
-	i.UpdatedAt = time.Now()
+	i.setAmount(newAmount, time.Now())
 	return nil
 }
 
+func (i *Investment) setAmount(amount Money, at time.Time) {
+	i.amount = amount
+	i.UpdatedAt = at
+}
+
 func isValidInvestmentType(t InvestmentType) bool {
 	switch t {
 	case Stock, Bond, RealEstate:
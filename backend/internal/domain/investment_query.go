@@ -0,0 +1,268 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// ページサイズ
+const (
+	DefaultInvestmentPageSize = 20
+	MaxInvestmentPageSize     = 100
+)
+
+type InvestmentSortField string
+
+const (
+	SortInvestmentsByCreatedAt InvestmentSortField = "created_at"
+	SortInvestmentsByAmount    InvestmentSortField = "amount"
+)
+
+var (
+	ErrInvalidInvestmentQuery = &DomainError{
+		Code:    "INVALID_INVESTMENT_QUERY",
+		Message: "investment query is invalid",
+	}
+
+	ErrInvalidCursor = &DomainError{
+		Code:    "INVALID_CURSOR",
+		Message: "cursor is invalid or does not match the query",
+	}
+)
+
+// InvestmentQuery selects one page of investments. Zero values do not
+// filter. Pages are ordered by SortBy and then by ID, and the next page
+// starts after the investment encoded in Cursor.
+type InvestmentQuery struct {
+	// PortfolioIDs limits the result to investments held by these
+	// portfolios. Empty means all portfolios.
+	PortfolioIDs []PortfolioID
+	Types        []InvestmentType
+	Strategies   []InvestmentStrategy
+	Currency     string
+	MinAmount    *float64
+	MaxAmount    *float64
+	CreatedFrom  *time.Time // inclusive
+	CreatedTo    *time.Time // exclusive
+
+	SortBy     InvestmentSortField
+	Descending bool
+	Cursor     string
+	Limit      int
+}
+
+// InvestmentPage is one page of results. NextCursor is empty on the last page.
+type InvestmentPage struct {
+	Investments []*Investment
+	NextCursor  string
+}
+
+// Page builds the page from up to Limit+1 investments in query order; the
+// extra one only tells that there is a next page.
+func (q InvestmentQuery) Page(investments []*Investment) *InvestmentPage {
+	page := &InvestmentPage{Investments: investments}
+	if len(investments) > q.Limit {
+		page.Investments = investments[:q.Limit]
+		page.NextCursor = q.NextCursor(page.Investments[q.Limit-1])
+	}
+	if page.Investments == nil {
+		page.Investments = []*Investment{}
+	}
+	return page
+}
+
+// Normalize validates the query and fills in the default sort order and
+// page size.
+func (q InvestmentQuery) Normalize() (InvestmentQuery, error) {
+	if q.SortBy == "" {
+		q.SortBy = SortInvestmentsByCreatedAt
+	}
+	if q.SortBy != SortInvestmentsByCreatedAt && q.SortBy != SortInvestmentsByAmount {
+		return q, ErrInvalidInvestmentQuery
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultInvestmentPageSize
+	}
+	if q.Limit < 1 || q.Limit > MaxInvestmentPageSize {
+		return q, ErrInvalidInvestmentQuery
+	}
+
+	for _, t := range q.Types {
+		if !isValidInvestmentType(t) {
+			return q, ErrInvalidInvestmentType
+		}
+	}
+	for _, s := range q.Strategies {
+		if !isValidInvestmentStrategy(s) {
+			return q, ErrInvalidInvestmentStrategy
+		}
+	}
+
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MinAmount > *q.MaxAmount {
+		return q, ErrInvalidInvestmentQuery
+	}
+	if q.CreatedFrom != nil && q.CreatedTo != nil && !q.CreatedFrom.Before(*q.CreatedTo) {
+		return q, ErrInvalidInvestmentQuery
+	}
+
+	if _, err := q.DecodeCursor(); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+// Matches reports whether the investment passes the filters of the query,
+// not counting PortfolioIDs and the cursor.
+func (q InvestmentQuery) Matches(investment *Investment) bool {
+	if len(q.Types) > 0 && !containsType(q.Types, investment.Type()) {
+		return false
+	}
+	if len(q.Strategies) > 0 && !containsStrategy(q.Strategies, investment.Strategy()) {
+		return false
+	}
+
+	amount := investment.Amount()
+	if q.Currency != "" && amount.Currency != q.Currency {
+		return false
+	}
+	if q.MinAmount != nil && amount.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && amount.Amount > *q.MaxAmount {
+		return false
+	}
+
+	if q.CreatedFrom != nil && investment.CreatedAt.Before(*q.CreatedFrom) {
+		return false
+	}
+	if q.CreatedTo != nil && !investment.CreatedAt.Before(*q.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+func containsType(types []InvestmentType, t InvestmentType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStrategy(strategies []InvestmentStrategy, s InvestmentStrategy) bool {
+	for _, v := range strategies {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// InvestmentCursor is the position after which the next page starts: the
+// sort key and ID of the last investment of the previous page.
+type InvestmentCursor struct {
+	SortBy     InvestmentSortField `json:"s"`
+	Descending bool                `json:"d,omitempty"`
+	Amount     float64             `json:"a,omitempty"`
+	CreatedAt  time.Time           `json:"t"`
+	ID         string              `json:"id"`
+}
+
+// NextCursor returns the cursor of the page following last.
+func (q InvestmentQuery) NextCursor(last *Investment) string {
+	data, _ := json.Marshal(q.cursorOf(last))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (q InvestmentQuery) cursorOf(investment *Investment) InvestmentCursor {
+	cursor := InvestmentCursor{
+		SortBy:     q.SortBy,
+		Descending: q.Descending,
+		CreatedAt:  investment.CreatedAt,
+		ID:         investment.ID().Value,
+	}
+	if q.SortBy == SortInvestmentsByAmount {
+		cursor.Amount = investment.Amount().Amount
+	}
+	return cursor
+}
+
+// Less reports whether a comes before b in the sort order of the query.
+func (q InvestmentQuery) Less(a, b *Investment) bool {
+	ca := q.cursorOf(a)
+	return ca.compare(q.cursorOf(b)) < 0
+}
+
+// DecodeCursor returns the cursor of the query, nil for the first page. A
+// cursor issued for another sort order is rejected.
+func (q InvestmentQuery) DecodeCursor() (*InvestmentCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor InvestmentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.SortBy != q.SortBy || cursor.Descending != q.Descending {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// After reports whether the investment comes after the cursor in the sort
+// order of the query.
+func (c *InvestmentCursor) After(investment *Investment) bool {
+	query := InvestmentQuery{SortBy: c.SortBy, Descending: c.Descending}
+	return query.cursorOf(investment).compare(*c) > 0
+}
+
+// compare orders two positions in the same sort order.
+func (c InvestmentCursor) compare(other InvestmentCursor) int {
+	cmp := 0
+	switch c.SortBy {
+	case SortInvestmentsByAmount:
+		cmp = compareFloat(c.Amount, other.Amount)
+	default:
+		cmp = c.CreatedAt.Compare(other.CreatedAt)
+	}
+	if cmp == 0 {
+		// 同じ値の場合はIDで順序を決める
+		cmp = compareString(c.ID, other.ID)
+	}
+
+	if c.Descending {
+		return -cmp
+	}
+	return cmp
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareString(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
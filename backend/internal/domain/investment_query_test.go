@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvestmentQuery_Normalize(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+	minAmount, maxAmount := 200.0, 100.0
+
+	tests := []struct {
+		name        string
+		query       InvestmentQuery
+		expectError error
+	}{
+		{"defaults", InvestmentQuery{}, nil},
+		{"unknown sort field", InvestmentQuery{SortBy: "name"}, ErrInvalidInvestmentQuery},
+		{"negative limit", InvestmentQuery{Limit: -1}, ErrInvalidInvestmentQuery},
+		{"limit too large", InvestmentQuery{Limit: MaxInvestmentPageSize + 1}, ErrInvalidInvestmentQuery},
+		{"invalid type", InvestmentQuery{Types: []InvestmentType{"GOLD"}}, ErrInvalidInvestmentType},
+		{"invalid strategy", InvestmentQuery{Strategies: []InvestmentStrategy{"RECKLESS"}}, ErrInvalidInvestmentStrategy},
+		{"inverted amount range", InvestmentQuery{MinAmount: &minAmount, MaxAmount: &maxAmount}, ErrInvalidInvestmentQuery},
+		{"inverted date range", InvestmentQuery{CreatedFrom: &from, CreatedTo: &to}, ErrInvalidInvestmentQuery},
+		{"malformed cursor", InvestmentQuery{Cursor: "%%%"}, ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := tt.query.Normalize()
+			if err != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if err == nil && (query.SortBy != SortInvestmentsByCreatedAt || query.Limit != DefaultInvestmentPageSize) {
+				t.Errorf("Expected defaults, got sort %q and limit %d", query.SortBy, query.Limit)
+			}
+		})
+	}
+}
+
+func TestInvestmentQuery_Page(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	investments := []*Investment{
+		ReconstituteInvestment(NewInvestmentID("a"), Money{Amount: 100, Currency: "JPY"}, Stock, Moderate, 1, at, at),
+		ReconstituteInvestment(NewInvestmentID("b"), Money{Amount: 100, Currency: "JPY"}, Stock, Moderate, 1, at, at),
+		ReconstituteInvestment(NewInvestmentID("c"), Money{Amount: 50, Currency: "JPY"}, Stock, Moderate, 1, at, at),
+	}
+
+	query, _ := InvestmentQuery{SortBy: SortInvestmentsByAmount, Descending: true, Limit: 2}.Normalize()
+	page := query.Page(investments)
+	if len(page.Investments) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected 2 investments and a cursor, got %d and %q", len(page.Investments), page.NextCursor)
+	}
+
+	query.Cursor = page.NextCursor
+	cursor, err := query.DecodeCursor()
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if cursor.ID != "b" || cursor.Amount != 100 {
+		t.Errorf("Expected cursor at b/100, got %+v", cursor)
+	}
+
+	// 降順では同じ金額ならIDの大きい方が先に来る
+	if !cursor.After(investments[0]) || cursor.After(investments[1]) || !cursor.After(investments[2]) {
+		t.Errorf("Unexpected positions relative to the cursor")
+	}
+	if !query.Less(investments[1], investments[0]) || query.Less(investments[2], investments[0]) {
+		t.Errorf("Unexpected order")
+	}
+
+	if last := query.Page(investments[:1]); last.NextCursor != "" || len(last.Investments) != 1 {
+		t.Errorf("Expected the last page, got %+v", last)
+	}
+	if empty := query.Page(nil); empty.Investments == nil {
+		t.Errorf("Expected an empty slice on an empty page")
+	}
+
+	query.SortBy = SortInvestmentsByCreatedAt
+	if _, err := query.DecodeCursor(); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for another sort field, got %v", err)
+	}
+}
@@ -114,3 +114,31 @@ func TestInvestment_UpdateAmount(t *testing.T) {
 		t.Error("UpdatedAt time was not changed")
 	}
 }
+
+func TestReconstituteInvestment(t *testing.T) {
+	createdAt := time.Date(2023, 4, 1, 9, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(time.Hour)
+
+	investment := ReconstituteInvestment(
+		NewInvestmentID("test-investment"),
+		Money{Amount: 1234.5, Currency: "USD"},
+		RealEstate,
+		Moderate,
+		3,
+		createdAt,
+		updatedAt,
+	)
+
+	if investment.ID().Value != "test-investment" {
+		t.Errorf("Expected ID test-investment, got %s", investment.ID().Value)
+	}
+	if investment.Amount() != (Money{Amount: 1234.5, Currency: "USD"}) {
+		t.Errorf("Unexpected amount %+v", investment.Amount())
+	}
+	if investment.Type() != RealEstate || investment.Strategy() != Moderate {
+		t.Errorf("Unexpected type/strategy %s/%s", investment.Type(), investment.Strategy())
+	}
+	if investment.Version != 3 || !investment.CreatedAt.Equal(createdAt) || !investment.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected version and timestamps to be kept, got %d %v %v", investment.Version, investment.CreatedAt, investment.UpdatedAt)
+	}
+}
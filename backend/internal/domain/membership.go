@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+type PortfolioRole string
+
+const (
+	RoleOwner   PortfolioRole = "OWNER"
+	RoleEditor  PortfolioRole = "EDITOR"
+	RoleViewer  PortfolioRole = "VIEWER"
+	RoleAdvisor PortfolioRole = "ADVISOR"
+)
+
+type PortfolioPermission string
+
+const (
+	PermissionView       PortfolioPermission = "VIEW"        // ポートフォリオ・投資・現金の参照
+	PermissionAnalyze    PortfolioPermission = "ANALYZE"     // リスク分析・リバランス提案
+	PermissionTrade      PortfolioPermission = "TRADE"       // 投資の作成・売却・リバランス
+	PermissionManageCash PortfolioPermission = "MANAGE_CASH" // 入金・出金
+	PermissionManage     PortfolioPermission = "MANAGE"      // 名前変更・アーカイブ・メンバー管理
+)
+
+var rolePermissions = map[PortfolioRole][]PortfolioPermission{
+	RoleOwner:   {PermissionView, PermissionAnalyze, PermissionTrade, PermissionManageCash, PermissionManage},
+	RoleEditor:  {PermissionView, PermissionAnalyze, PermissionTrade, PermissionManageCash},
+	RoleAdvisor: {PermissionView, PermissionAnalyze},
+	RoleViewer:  {PermissionView},
+}
+
+func (r PortfolioRole) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// IsInvitable reports whether members can be invited with the role. The
+// owner recorded on the portfolio is its only owner, so OWNER is not one.
+func (r PortfolioRole) IsInvitable() bool {
+	return r.IsValid() && r != RoleOwner
+}
+
+func (r PortfolioRole) Can(permission PortfolioPermission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type MembershipStatus string
+
+const (
+	MembershipPending MembershipStatus = "PENDING"
+	MembershipActive  MembershipStatus = "ACTIVE"
+)
+
+// PortfolioMembership grants a user other than the portfolio's owner access
+// to it. It starts as a pending invitation addressed to an email and becomes
+// active once the user with that email accepts it.
+type PortfolioMembership struct {
+	ID           string
+	PortfolioID  PortfolioID
+	InviteeEmail string
+	UserID       string // 承認されるまでは空
+	Role         PortfolioRole
+	Status       MembershipStatus
+	InvitedBy    string
+	CreatedAt    time.Time
+	AcceptedAt   *time.Time
+}
+
+func NewPortfolioInvitation(id string, portfolioID PortfolioID, email string, role PortfolioRole, invitedBy string) (*PortfolioMembership, error) {
+	if !role.IsInvitable() {
+		return nil, ErrInvalidPortfolioRole
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, ErrInvalidEmail
+	}
+
+	return &PortfolioMembership{
+		ID:           id,
+		PortfolioID:  portfolioID,
+		InviteeEmail: email,
+		Role:         role,
+		Status:       MembershipPending,
+		InvitedBy:    invitedBy,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+func (m *PortfolioMembership) IsActive() bool {
+	return m.Status == MembershipActive
+}
+
+// Accept activates a pending invitation for the user who owns the invited email.
+func (m *PortfolioMembership) Accept(userID string, email string) error {
+	if m.Status != MembershipPending {
+		return ErrInvitationNotPending
+	}
+	if !strings.EqualFold(strings.TrimSpace(email), m.InviteeEmail) {
+		return ErrInvitationNotFound
+	}
+
+	now := time.Now()
+	m.UserID = userID
+	m.Status = MembershipActive
+	m.AcceptedAt = &now
+	return nil
+}
@@ -0,0 +1,64 @@
+package domain
+
+import "testing"
+
+func TestPortfolioRole_Can(t *testing.T) {
+	tests := []struct {
+		role    PortfolioRole
+		allowed []PortfolioPermission
+	}{
+		{RoleOwner, []PortfolioPermission{PermissionView, PermissionAnalyze, PermissionTrade, PermissionManageCash, PermissionManage}},
+		{RoleEditor, []PortfolioPermission{PermissionView, PermissionAnalyze, PermissionTrade, PermissionManageCash}},
+		{RoleAdvisor, []PortfolioPermission{PermissionView, PermissionAnalyze}},
+		{RoleViewer, []PortfolioPermission{PermissionView}},
+		{PortfolioRole("ADMIN"), nil},
+	}
+
+	all := []PortfolioPermission{PermissionView, PermissionAnalyze, PermissionTrade, PermissionManageCash, PermissionManage}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			allowed := make(map[PortfolioPermission]bool)
+			for _, p := range tt.allowed {
+				allowed[p] = true
+			}
+			for _, p := range all {
+				if got := tt.role.Can(p); got != allowed[p] {
+					t.Errorf("%s.Can(%s) = %v, want %v", tt.role, p, got, allowed[p])
+				}
+			}
+		})
+	}
+}
+
+func TestPortfolioMembership_Accept(t *testing.T) {
+	if _, err := NewPortfolioInvitation("id", NewPortfolioID("p"), "a@example.com", PortfolioRole("ADMIN"), "owner"); err != ErrInvalidPortfolioRole {
+		t.Errorf("Expected ErrInvalidPortfolioRole, got %v", err)
+	}
+	if _, err := NewPortfolioInvitation("id", NewPortfolioID("p"), "a@example.com", RoleOwner, "owner"); err != ErrInvalidPortfolioRole {
+		t.Errorf("Expected ErrInvalidPortfolioRole for OWNER, got %v", err)
+	}
+	if _, err := NewPortfolioInvitation("id", NewPortfolioID("p"), " ", RoleViewer, "owner"); err != ErrInvalidEmail {
+		t.Errorf("Expected ErrInvalidEmail, got %v", err)
+	}
+
+	invitation, err := NewPortfolioInvitation("id", NewPortfolioID("p"), " Advisor@Example.com ", RoleAdvisor, "owner")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if invitation.InviteeEmail != "advisor@example.com" || invitation.IsActive() {
+		t.Errorf("Unexpected invitation: %+v", invitation)
+	}
+
+	if err := invitation.Accept("someone", "someone@example.com"); err != ErrInvitationNotFound {
+		t.Errorf("Expected ErrInvitationNotFound for other email, got %v", err)
+	}
+	if err := invitation.Accept("advisor", "ADVISOR@example.com"); err != nil {
+		t.Fatalf("Unexpected error accepting: %v", err)
+	}
+	if !invitation.IsActive() || invitation.UserID != "advisor" || invitation.AcceptedAt == nil {
+		t.Errorf("Expected active membership, got %+v", invitation)
+	}
+	if err := invitation.Accept("advisor", "advisor@example.com"); err != ErrInvitationNotPending {
+		t.Errorf("Expected ErrInvitationNotPending, got %v", err)
+	}
+}
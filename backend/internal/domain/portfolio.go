@@ -2,7 +2,11 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type PortfolioID struct {
@@ -13,46 +17,273 @@ func NewPortfolioID(id string) PortfolioID {
 	return PortfolioID{Value: id}
 }
 
+// DefaultPortfolioName is used for portfolios created without an explicit name.
+const DefaultPortfolioName = "Main"
+
+const maxPortfolioNameLength = 100
+
+// investmentLimit is the maximum invested amount of a portfolio.
+const investmentLimit = 10000000 // 1000万円の投資上限
+
 type Portfolio struct {
-	id          PortfolioID
-	UserID      string                       // エクスポート
-	Investments map[InvestmentID]*Investment // エクスポート
-	CreatedAt   time.Time                    // エクスポート
-	UpdatedAt   time.Time                    // エクスポート
+	id               PortfolioID
+	UserID           string                       // エクスポート
+	Name             string                       // エクスポート
+	Investments      map[InvestmentID]*Investment // エクスポート
+	CashTransactions []*CashTransaction           // エクスポート（現金台帳、古い順）
+	ArchivedAt       *time.Time                   // エクスポート（アーカイブされていなければnil）
+	Version          int                          // エクスポート（楽観的ロック用、未保存なら0）
+	CreatedAt        time.Time                    // エクスポート
+	UpdatedAt        time.Time                    // エクスポート
+
+	events    []DomainEvent // 記録済みで未発行のイベント
+	savedCash int           // 保存済みの現金台帳の件数（先頭からこの件数まで）
 }
 
 func NewPortfolio(id PortfolioID, userID string) *Portfolio {
-	now := time.Now()
-	return &Portfolio{
+	p := &Portfolio{
 		id:          id,
-		UserID:      userID,
 		Investments: make(map[InvestmentID]*Investment),
-		CreatedAt:   now,
-		UpdatedAt:   now,
 	}
+	p.record(NewPortfolioCreatedEvent(id, userID, DefaultPortfolioName, time.Now()))
+	return p
+}
+
+// PortfolioState is the persisted state of a portfolio, used to rebuild it
+// with ReconstitutePortfolio.
+type PortfolioState struct {
+	ID               PortfolioID
+	UserID           string
+	Name             string
+	Investments      []*Investment
+	CashTransactions []*CashTransaction
+	ArchivedAt       *time.Time
+	Version          int
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// ReconstitutePortfolio rebuilds a portfolio from persisted state. It bypasses
+// the rules applied to new changes (investment limit, archived check, ...)
+// so that stored data is always loaded as is; it is meant for repositories only.
+func ReconstitutePortfolio(state PortfolioState) *Portfolio {
+	investments := make(map[InvestmentID]*Investment, len(state.Investments))
+	for _, investment := range state.Investments {
+		investments[investment.ID()] = investment
+	}
+
+	return &Portfolio{
+		id:               state.ID,
+		UserID:           state.UserID,
+		Name:             state.Name,
+		Investments:      investments,
+		CashTransactions: state.CashTransactions,
+		ArchivedAt:       state.ArchivedAt,
+		Version:          state.Version,
+		CreatedAt:        state.CreatedAt,
+		UpdatedAt:        state.UpdatedAt,
+		savedCash:        len(state.CashTransactions),
+	}
+}
+
+// RebuildPortfolio reconstitutes a portfolio by applying the events of its
+// stream in order. Like ReconstitutePortfolio it applies no business rules.
+// A stream that is empty or ends with the deletion of the portfolio yields
+// ErrPortfolioNotFound.
+func RebuildPortfolio(events []DomainEvent) (*Portfolio, error) {
+	if len(events) == 0 {
+		return nil, ErrPortfolioNotFound
+	}
+
+	created, ok := events[0].(PortfolioCreatedEvent)
+	if !ok {
+		return nil, fmt.Errorf("%w: stream starts with %T", ErrInvalidEventStream, events[0])
+	}
+
+	p := &Portfolio{
+		id:          created.PortfolioID(),
+		Investments: make(map[InvestmentID]*Investment),
+	}
+	if err := p.applyStream(events); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// applyStream applies events of the portfolio's stream in order.
+func (p *Portfolio) applyStream(events []DomainEvent) error {
+	for _, event := range events {
+		if event.AggregateType() != AggregatePortfolio || event.AggregateID() != p.id.Value {
+			return fmt.Errorf("%w: event of %s %s", ErrInvalidEventStream, event.AggregateType(), event.AggregateID())
+		}
+		if _, deleted := event.(PortfolioDeletedEvent); deleted {
+			return ErrPortfolioNotFound
+		}
+		p.apply(event)
+	}
+	return nil
 }
 
 func (p *Portfolio) ID() PortfolioID {
 	return p.id
 }
 
+// Events returns the events recorded by changes since the portfolio was
+// created or loaded, oldest first.
+func (p *Portfolio) Events() []DomainEvent {
+	return append([]DomainEvent(nil), p.events...)
+}
+
+// CreationEvents describes the current state as the stream that would have
+// built it: the creation, its investments and cash ledger, and the archival.
+// Portfolios stored before their changes were recorded as events get their
+// stream from it, so that RebuildPortfolio gives the stored state.
+func (p *Portfolio) CreationEvents() []DomainEvent {
+	events := []DomainEvent{NewPortfolioCreatedEvent(p.id, p.UserID, p.Name, p.CreatedAt)}
+
+	investments := p.GetInvestments()
+	sort.SliceStable(investments, func(i, j int) bool {
+		if !investments[i].CreatedAt.Equal(investments[j].CreatedAt) {
+			return investments[i].CreatedAt.Before(investments[j].CreatedAt)
+		}
+		return investments[i].ID().Value < investments[j].ID().Value
+	})
+	for _, investment := range investments {
+		events = append(events, NewInvestmentCreatedEvent(p.id, investment))
+	}
+	for _, tx := range p.CashTransactions {
+		events = append(events, NewCashTransactionRecordedEvent(p.id, tx))
+	}
+	if p.ArchivedAt != nil {
+		events = append(events, NewPortfolioArchivedEvent(p.id, *p.ArchivedAt))
+	}
+	return events
+}
+
+// record applies a new event and keeps it for Events.
+func (p *Portfolio) record(event DomainEvent) {
+	p.apply(event)
+	p.events = append(p.events, event)
+}
+
+// apply changes the state as described by an event. All state changes go
+// through apply so that replaying a stream gives the same portfolio.
+func (p *Portfolio) apply(event DomainEvent) {
+	switch e := event.(type) {
+	case PortfolioCreatedEvent:
+		p.UserID = e.UserID()
+		p.Name = e.Name()
+		p.CreatedAt = e.OccurredAt()
+	case PortfolioRenamedEvent:
+		p.Name = e.Name()
+	case PortfolioArchivedEvent:
+		archivedAt := e.OccurredAt()
+		p.ArchivedAt = &archivedAt
+	case PortfolioDeletedEvent:
+		// 削除後の状態はない（ストリームの終端）
+	case InvestmentCreatedEvent:
+		p.Investments[e.InvestmentID()] = ReconstituteInvestment(
+			e.InvestmentID(),
+			e.Amount(),
+			e.InvestmentType(),
+			e.Strategy(),
+			0,
+			e.OccurredAt(),
+			e.OccurredAt(),
+		)
+	case InvestmentAmountChangedEvent:
+		if investment, ok := p.Investments[e.InvestmentID()]; ok {
+			investment.setAmount(e.Amount(), e.OccurredAt())
+		}
+	case InvestmentRemovedEvent:
+		delete(p.Investments, e.InvestmentID())
+	case PortfolioRebalancedEvent:
+		for _, change := range e.Changes() {
+			if investment, ok := p.Investments[change.InvestmentID]; ok {
+				investment.setAmount(change.Amount, e.OccurredAt())
+			}
+		}
+	case CashTransactionRecordedEvent:
+		p.CashTransactions = append(p.CashTransactions, e.Transaction())
+	default:
+		// 通知用のイベント（PortfolioUpdatedなど）は状態を変えない
+		return
+	}
+	p.UpdatedAt = event.OccurredAt()
+}
+
+func (p *Portfolio) Rename(name string) error {
+	name, err := NormalizePortfolioName(name)
+	if err != nil {
+		return err
+	}
+
+	if name == p.Name {
+		return nil
+	}
+
+	p.record(NewPortfolioRenamedEvent(p.id, name, time.Now()))
+	return nil
+}
+
+// Archive makes the portfolio read-only. Archived portfolios keep their
+// history and accept no new investments, revaluations or deposits; holdings
+// can still be sold and cash withdrawn so that the portfolio can be emptied.
+func (p *Portfolio) Archive() error {
+	if p.IsArchived() {
+		return ErrPortfolioArchived
+	}
+
+	p.record(NewPortfolioArchivedEvent(p.id, time.Now()))
+	return nil
+}
+
+// Delete records the end of the portfolio. Only portfolios without
+// investments can be deleted; its cash ledger goes with it.
+func (p *Portfolio) Delete() error {
+	if len(p.Investments) > 0 {
+		return ErrPortfolioNotEmpty
+	}
+
+	p.record(NewPortfolioDeletedEvent(p.id, time.Now()))
+	return nil
+}
+
+func (p *Portfolio) IsArchived() bool {
+	return p.ArchivedAt != nil
+}
+
+// NormalizePortfolioName trims the name and validates its length.
+func NormalizePortfolioName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxPortfolioNameLength {
+		return "", ErrInvalidPortfolioName
+	}
+	return name, nil
+}
+
 func (p *Portfolio) AddInvestment(investment *Investment) error {
 	if investment == nil {
 		return errors.New("investment cannot be nil")
 	}
 
+	if p.IsArchived() {
+		return ErrPortfolioArchived
+	}
+
 	if _, exists := p.Investments[investment.ID()]; exists {
 		return ErrDuplicateInvestment
 	}
 
-	totalAmount := p.CalculateTotalAmount()
-	newAmount := totalAmount.Amount + investment.Amount().Amount
-	if newAmount > 10000000 { // 1000万円の投資上限を設定
+	investedAmount := p.CalculateInvestedAmount()
+	newAmount := investedAmount.Amount + investment.Amount().Amount
+	if newAmount > investmentLimit {
 		return ErrPortfolioLimitExceeded
 	}
 
+	p.record(NewInvestmentCreatedEvent(p.id, investment))
+	// 呼び出し元のインスタンスをそのまま保持する
 	p.Investments[investment.ID()] = investment
-	p.UpdatedAt = time.Now()
 	return nil
 }
 
@@ -61,8 +292,74 @@ func (p *Portfolio) RemoveInvestment(investmentID InvestmentID) error {
 		return ErrInvestmentNotFound
 	}
 
-	delete(p.Investments, investmentID)
-	p.UpdatedAt = time.Now()
+	p.record(NewInvestmentRemovedEvent(p.id, investmentID, time.Now()))
+	return nil
+}
+
+// UpdateInvestmentAmount revalues an investment held by the portfolio. The
+// currency cannot change and the portfolio limit still applies; no cash
+// moves.
+func (p *Portfolio) UpdateInvestmentAmount(investmentID InvestmentID, amount Money) error {
+	if p.IsArchived() {
+		return ErrPortfolioArchived
+	}
+
+	investment, exists := p.Investments[investmentID]
+	if !exists {
+		return ErrInvestmentNotFound
+	}
+
+	if amount.Amount < 0 || amount.Currency != investment.Amount().Currency {
+		return ErrInvalidInvestmentAmount
+	}
+
+	investedAmount := p.CalculateInvestedAmount()
+	if investedAmount.Amount-investment.Amount().Amount+amount.Amount > investmentLimit {
+		return ErrPortfolioLimitExceeded
+	}
+
+	p.record(NewInvestmentAmountChangedEvent(p.id, investmentID, investment.Amount(), amount, time.Now()))
+	return nil
+}
+
+// Rebalance revalues several investments at once. Each change follows the
+// rules of UpdateInvestmentAmount and the limit applies to the result, not
+// to the intermediate states.
+func (p *Portfolio) Rebalance(changes map[InvestmentID]Money) error {
+	if p.IsArchived() {
+		return ErrPortfolioArchived
+	}
+
+	ids := make([]InvestmentID, 0, len(changes))
+	for investmentID := range changes {
+		ids = append(ids, investmentID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Value < ids[j].Value })
+
+	investedAmount := p.CalculateInvestedAmount().Amount
+	rebalance := make([]RebalanceChange, 0, len(ids))
+	for _, investmentID := range ids {
+		investment, exists := p.Investments[investmentID]
+		if !exists {
+			return ErrInvestmentNotFound
+		}
+
+		amount := changes[investmentID]
+		if amount.Amount < 0 || amount.Currency != investment.Amount().Currency {
+			return ErrInvalidInvestmentAmount
+		}
+
+		investedAmount += amount.Amount - investment.Amount().Amount
+		rebalance = append(rebalance, RebalanceChange{InvestmentID: investmentID, Amount: amount})
+	}
+
+	if investedAmount > investmentLimit {
+		return ErrPortfolioLimitExceeded
+	}
+
+	if len(rebalance) > 0 {
+		p.record(NewPortfolioRebalancedEvent(p.id, rebalance, time.Now()))
+	}
 	return nil
 }
 
@@ -82,7 +379,18 @@ func (p *Portfolio) GetInvestments() []*Investment {
 	return investments
 }
 
+// CalculateTotalAmount returns the value of all investments plus the cash
+// position held in the same currency. Cash in other currencies is not
+// converted and is only reported through CashBalances.
 func (p *Portfolio) CalculateTotalAmount() Money {
+	invested := p.CalculateInvestedAmount()
+	cash := p.CashBalance(invested.Currency)
+	money, _ := NewMoney(invested.Amount+cash.Amount, invested.Currency)
+	return money
+}
+
+// CalculateInvestedAmount returns the value of all investments, excluding cash.
+func (p *Portfolio) CalculateInvestedAmount() Money {
 	var total float64
 	currency := "JPY" // デフォルト通貨を設定
 	for _, inv := range p.Investments {
@@ -93,6 +401,61 @@ func (p *Portfolio) CalculateTotalAmount() Money {
 	return money
 }
 
+// CashBalance returns the cash held in the given currency.
+func (p *Portfolio) CashBalance(currency string) Money {
+	balance := cashBalances(p.CashTransactions)[currency]
+	return Money{Amount: balance, Currency: currency}
+}
+
+// CashBalances returns the cash position per currency, ordered by currency code.
+func (p *Portfolio) CashBalances() []Money {
+	balances := cashBalances(p.CashTransactions)
+	result := make([]Money, 0, len(balances))
+	for _, currency := range sortedCurrencies(balances) {
+		result = append(result, Money{Amount: balances[currency], Currency: currency})
+	}
+	return result
+}
+
+// RecordCashTransaction appends an entry to the cash ledger. Debits that would
+// take the balance of their currency below zero are rejected, and archived
+// portfolios only accept liquidations.
+func (p *Portfolio) RecordCashTransaction(tx *CashTransaction) error {
+	if tx == nil {
+		return ErrInvalidCashTransaction
+	}
+
+	if p.IsArchived() && !tx.Type.IsLiquidation() {
+		return ErrPortfolioArchived
+	}
+
+	if tx.Type.IsDebit() {
+		balance := p.CashBalance(tx.Amount.Currency)
+		if tx.Amount.Amount > balance.Amount {
+			return ErrInsufficientFunds
+		}
+	}
+
+	p.record(NewCashTransactionRecordedEvent(p.id, tx))
+	return nil
+}
+
+// UnsavedCashTransactions returns the ledger entries recorded since the
+// portfolio was loaded or last saved. Portfolios built from events or in
+// memory have no saved entries.
+func (p *Portfolio) UnsavedCashTransactions() []*CashTransaction {
+	if p.savedCash > len(p.CashTransactions) {
+		return nil
+	}
+	return p.CashTransactions[p.savedCash:]
+}
+
+// MarkCashTransactionsSaved records that the whole ledger is stored. Repositories
+// call it after a successful write.
+func (p *Portfolio) MarkCashTransactionsSaved() {
+	p.savedCash = len(p.CashTransactions)
+}
+
 func (p *Portfolio) CalculateStrategyAmount(strategy InvestmentStrategy) Money {
 	var total float64
 	var currency string
@@ -108,7 +471,7 @@ func (p *Portfolio) CalculateStrategyAmount(strategy InvestmentStrategy) Money {
 
 func (p *Portfolio) ValidateRiskDistribution() error {
 	var aggressiveTotal float64
-	totalAmount := p.CalculateTotalAmount()
+	totalAmount := p.CalculateInvestedAmount()
 
 	if totalAmount.Amount == 0 {
 		return nil
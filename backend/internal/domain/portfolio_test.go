@@ -1,7 +1,10 @@
 package domain
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewPortfolio(t *testing.T) {
@@ -117,6 +120,45 @@ func TestPortfolio_RemoveInvestment(t *testing.T) {
 	}
 }
 
+func TestPortfolio_UpdateInvestmentAmount(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+	money, _ := NewMoney(1000000, "JPY")
+	investment, _ := NewInvestment(NewInvestmentID("test-investment"), money, Stock, Conservative)
+	_ = portfolio.AddInvestment(investment)
+
+	tests := []struct {
+		name        string
+		id          InvestmentID
+		amount      Money
+		expectError error
+	}{
+		{"valid amount", investment.ID(), Money{Amount: 2000000, Currency: "JPY"}, nil},
+		{"unknown investment", NewInvestmentID("non-existent"), Money{Amount: 1000, Currency: "JPY"}, ErrInvestmentNotFound},
+		{"negative amount", investment.ID(), Money{Amount: -1, Currency: "JPY"}, ErrInvalidInvestmentAmount},
+		{"other currency", investment.ID(), Money{Amount: 1000, Currency: "USD"}, ErrInvalidInvestmentAmount},
+		{"exceeds limit", investment.ID(), Money{Amount: 10000001, Currency: "JPY"}, ErrPortfolioLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := portfolio.UpdateInvestmentAmount(tt.id, tt.amount)
+			if err != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+
+	// 失敗した変更は反映されない
+	if amount := investment.Amount(); amount.Amount != 2000000 {
+		t.Errorf("Expected amount 2000000, got %f", amount.Amount)
+	}
+
+	_ = portfolio.Archive()
+	if err := portfolio.UpdateInvestmentAmount(investment.ID(), money); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived, got %v", err)
+	}
+}
+
 func TestPortfolio_CalculateTotalAmount(t *testing.T) {
 	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
 
@@ -151,3 +193,302 @@ func TestPortfolio_CalculateTotalAmount(t *testing.T) {
 		t.Errorf("Expected currency JPY, got %s", totalAmount.Currency)
 	}
 }
+
+func TestPortfolio_RenameAndArchive(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+
+	if portfolio.Name != DefaultPortfolioName {
+		t.Errorf("Expected default name %q, got %q", DefaultPortfolioName, portfolio.Name)
+	}
+
+	if err := portfolio.Rename("  NISA  "); err != nil {
+		t.Fatalf("Unexpected error renaming portfolio: %v", err)
+	}
+	if portfolio.Name != "NISA" {
+		t.Errorf("Expected trimmed name %q, got %q", "NISA", portfolio.Name)
+	}
+
+	if err := portfolio.Rename(""); err != ErrInvalidPortfolioName {
+		t.Errorf("Expected ErrInvalidPortfolioName, got %v", err)
+	}
+	if err := portfolio.Rename(strings.Repeat("あ", 101)); err != ErrInvalidPortfolioName {
+		t.Errorf("Expected ErrInvalidPortfolioName for long name, got %v", err)
+	}
+
+	if err := portfolio.Archive(); err != nil {
+		t.Fatalf("Unexpected error archiving portfolio: %v", err)
+	}
+	if !portfolio.IsArchived() {
+		t.Error("Expected portfolio to be archived")
+	}
+	if err := portfolio.Archive(); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived, got %v", err)
+	}
+
+	// アーカイブ後は投資も入金もできない
+	money, _ := NewMoney(1000, "JPY")
+	investment, _ := NewInvestment(NewInvestmentID("test-investment"), money, Stock, Conservative)
+	if err := portfolio.AddInvestment(investment); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived when adding investment, got %v", err)
+	}
+	deposit, _ := NewCashTransaction("deposit", CashDeposit, money, InvestmentID{})
+	if err := portfolio.RecordCashTransaction(deposit); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived when depositing, got %v", err)
+	}
+	dividend, _ := NewCashTransaction("dividend", CashDividend, money, investment.ID())
+	if err := portfolio.RecordCashTransaction(dividend); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived for a dividend, got %v", err)
+	}
+
+	// 売却代金の入金と出金は空にするためにできる
+	sale, _ := NewCashTransaction("sale", CashSale, money, investment.ID())
+	if err := portfolio.RecordCashTransaction(sale); err != nil {
+		t.Errorf("Expected a sale to be recorded, got %v", err)
+	}
+	withdrawal, _ := NewCashTransaction("withdrawal", CashWithdrawal, money, InvestmentID{})
+	if err := portfolio.RecordCashTransaction(withdrawal); err != nil {
+		t.Errorf("Expected a withdrawal to be recorded, got %v", err)
+	}
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 0 {
+		t.Errorf("Expected an empty cash balance, got %v", balance)
+	}
+}
+
+func TestReconstitutePortfolio(t *testing.T) {
+	createdAt := time.Date(2023, 4, 1, 9, 0, 0, 0, time.UTC)
+	updatedAt := createdAt.Add(48 * time.Hour)
+	archivedAt := updatedAt.Add(time.Hour)
+
+	// 上限を超える保存済みの投資もそのまま復元できる
+	first := ReconstituteInvestment(NewInvestmentID("first"), Money{Amount: 8000000, Currency: "JPY"}, Stock, Aggressive, 2, createdAt, updatedAt)
+	second := ReconstituteInvestment(NewInvestmentID("second"), Money{Amount: 7000000, Currency: "JPY"}, Bond, Conservative, 1, createdAt, createdAt)
+
+	portfolio := ReconstitutePortfolio(PortfolioState{
+		ID:          NewPortfolioID("test-portfolio"),
+		UserID:      "test-user",
+		Name:        "NISA",
+		Investments: []*Investment{first, second},
+		ArchivedAt:  &archivedAt,
+		Version:     5,
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	})
+
+	if portfolio.ID().Value != "test-portfolio" || portfolio.UserID != "test-user" || portfolio.Name != "NISA" {
+		t.Errorf("Unexpected identity: %+v", portfolio)
+	}
+	if len(portfolio.GetInvestments()) != 2 {
+		t.Errorf("Expected 2 investments, got %d", len(portfolio.GetInvestments()))
+	}
+	if total := portfolio.CalculateInvestedAmount(); total.Amount != 15000000 {
+		t.Errorf("Expected invested amount 15000000, got %f", total.Amount)
+	}
+	if !portfolio.IsArchived() || !portfolio.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("Expected archived at %v, got %v", archivedAt, portfolio.ArchivedAt)
+	}
+	if portfolio.Version != 5 || !portfolio.CreatedAt.Equal(createdAt) || !portfolio.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected version and timestamps to be kept, got %d %v %v", portfolio.Version, portfolio.CreatedAt, portfolio.UpdatedAt)
+	}
+
+	// 新しい変更には通常どおりルールが適用される
+	money, _ := NewMoney(1000, "JPY")
+	investment, _ := NewInvestment(NewInvestmentID("third"), money, Stock, Conservative)
+	if err := portfolio.AddInvestment(investment); err != ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived, got %v", err)
+	}
+}
+
+func TestPortfolio_UnsavedCashTransactions(t *testing.T) {
+	money, _ := NewMoney(1000, "JPY")
+	stored, _ := NewCashTransaction("stored", CashDeposit, money, InvestmentID{})
+	portfolio := ReconstitutePortfolio(PortfolioState{
+		ID:               NewPortfolioID("test-portfolio"),
+		UserID:           "test-user",
+		CashTransactions: []*CashTransaction{stored},
+		Version:          1,
+	})
+
+	// 読み込んだ台帳は保存済み
+	if unsaved := portfolio.UnsavedCashTransactions(); len(unsaved) != 0 {
+		t.Errorf("Expected no unsaved entries, got %d", len(unsaved))
+	}
+
+	withdrawal, _ := NewCashTransaction("new", CashWithdrawal, money, InvestmentID{})
+	if err := portfolio.RecordCashTransaction(withdrawal); err != nil {
+		t.Fatalf("RecordCashTransaction failed: %v", err)
+	}
+	if unsaved := portfolio.UnsavedCashTransactions(); len(unsaved) != 1 || unsaved[0].ID != "new" {
+		t.Errorf("Expected the new entry only, got %v", unsaved)
+	}
+
+	portfolio.MarkCashTransactionsSaved()
+	if unsaved := portfolio.UnsavedCashTransactions(); len(unsaved) != 0 {
+		t.Errorf("Expected no unsaved entries after saving, got %d", len(unsaved))
+	}
+
+	// イベントから組み立てたポートフォリオには保存済みの台帳がない
+	created := NewPortfolio(NewPortfolioID("other"), "test-user")
+	deposit, _ := NewCashTransaction("deposit", CashDeposit, money, InvestmentID{})
+	if err := created.RecordCashTransaction(deposit); err != nil {
+		t.Fatalf("RecordCashTransaction failed: %v", err)
+	}
+	rebuilt, err := RebuildPortfolio(created.Events())
+	if err != nil {
+		t.Fatalf("RebuildPortfolio failed: %v", err)
+	}
+	if unsaved := rebuilt.UnsavedCashTransactions(); len(unsaved) != 1 {
+		t.Errorf("Expected the rebuilt ledger to be unsaved, got %d", len(unsaved))
+	}
+}
+
+func TestPortfolio_Rebalance(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+	first, _ := NewInvestment(NewInvestmentID("inv-1"), Money{Amount: 6000000, Currency: "JPY"}, Stock, Conservative)
+	second, _ := NewInvestment(NewInvestmentID("inv-2"), Money{Amount: 3000000, Currency: "JPY"}, Bond, Conservative)
+	portfolio.AddInvestment(first)
+	portfolio.AddInvestment(second)
+
+	// 上限の判定は途中ではなく結果に対して行う
+	err := portfolio.Rebalance(map[InvestmentID]Money{
+		first.ID():  {Amount: 3000000, Currency: "JPY"},
+		second.ID(): {Amount: 6500000, Currency: "JPY"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Amount().Amount != 3000000 || second.Amount().Amount != 6500000 {
+		t.Errorf("Expected amounts 3000000 and 6500000, got %f and %f", first.Amount().Amount, second.Amount().Amount)
+	}
+
+	events := portfolio.Events()
+	rebalanced, ok := events[len(events)-1].(PortfolioRebalancedEvent)
+	if !ok || len(rebalanced.Changes()) != 2 || rebalanced.Changes()[0].InvestmentID != first.ID() {
+		t.Errorf("Expected one rebalance event with both changes, got %+v", events[len(events)-1])
+	}
+
+	if err := portfolio.Rebalance(map[InvestmentID]Money{second.ID(): {Amount: 8000000, Currency: "JPY"}}); err != ErrPortfolioLimitExceeded {
+		t.Errorf("Expected ErrPortfolioLimitExceeded, got %v", err)
+	}
+	if err := portfolio.Rebalance(map[InvestmentID]Money{first.ID(): {Amount: 1, Currency: "USD"}}); err != ErrInvalidInvestmentAmount {
+		t.Errorf("Expected ErrInvalidInvestmentAmount, got %v", err)
+	}
+	if err := portfolio.Rebalance(map[InvestmentID]Money{NewInvestmentID("missing"): {Amount: 1, Currency: "JPY"}}); err != ErrInvestmentNotFound {
+		t.Errorf("Expected ErrInvestmentNotFound, got %v", err)
+	}
+	if len(portfolio.Events()) != len(events) {
+		t.Error("Rejected changes should record no event")
+	}
+}
+
+func TestRebuildPortfolio(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+	portfolio.Rename("Savings")
+
+	deposit, _ := NewCashTransaction("cash-1", CashDeposit, Money{Amount: 5000, Currency: "JPY"}, InvestmentID{})
+	if err := portfolio.RecordCashTransaction(deposit); err != nil {
+		t.Fatalf("RecordCashTransaction failed: %v", err)
+	}
+	kept, _ := NewInvestment(NewInvestmentID("inv-1"), Money{Amount: 1000, Currency: "JPY"}, Stock, Moderate)
+	removed, _ := NewInvestment(NewInvestmentID("inv-2"), Money{Amount: 2000, Currency: "JPY"}, Bond, Conservative)
+	portfolio.AddInvestment(kept)
+	portfolio.AddInvestment(removed)
+	portfolio.UpdateInvestmentAmount(kept.ID(), Money{Amount: 1500, Currency: "JPY"})
+	portfolio.Rebalance(map[InvestmentID]Money{kept.ID(): {Amount: 1200, Currency: "JPY"}})
+	portfolio.RemoveInvestment(removed.ID())
+	portfolio.Archive()
+
+	rebuilt, err := RebuildPortfolio(portfolio.Events())
+	if err != nil {
+		t.Fatalf("RebuildPortfolio failed: %v", err)
+	}
+
+	if rebuilt.ID() != portfolio.ID() || rebuilt.UserID != "test-user" || rebuilt.Name != "Savings" {
+		t.Errorf("Unexpected portfolio %s of %s named %q", rebuilt.ID().Value, rebuilt.UserID, rebuilt.Name)
+	}
+	if rebuilt.ArchivedAt == nil || !rebuilt.ArchivedAt.Equal(*portfolio.ArchivedAt) {
+		t.Errorf("Expected archived at %v, got %v", portfolio.ArchivedAt, rebuilt.ArchivedAt)
+	}
+	if !rebuilt.CreatedAt.Equal(portfolio.CreatedAt) || !rebuilt.UpdatedAt.Equal(portfolio.UpdatedAt) {
+		t.Errorf("Expected times %v and %v, got %v and %v", portfolio.CreatedAt, portfolio.UpdatedAt, rebuilt.CreatedAt, rebuilt.UpdatedAt)
+	}
+	if len(rebuilt.Investments) != 1 {
+		t.Fatalf("Expected 1 investment, got %d", len(rebuilt.Investments))
+	}
+	investment, _ := rebuilt.GetInvestment(kept.ID())
+	if investment.Amount() != (Money{Amount: 1200, Currency: "JPY"}) || investment.Type() != Stock || investment.Strategy() != Moderate {
+		t.Errorf("Unexpected investment %+v", investment)
+	}
+	if rebuilt.CashBalance("JPY").Amount != 5000 || len(rebuilt.CashTransactions) != 1 {
+		t.Errorf("Expected the deposit in the ledger, got %+v", rebuilt.CashTransactions)
+	}
+	if len(rebuilt.Events()) != 0 {
+		t.Error("A rebuilt portfolio should have no new events")
+	}
+
+	// 削除で終わるストリームや作成で始まらないストリーム
+	if err := portfolio.Delete(); err != ErrPortfolioNotEmpty {
+		t.Errorf("Expected ErrPortfolioNotEmpty, got %v", err)
+	}
+	portfolio.RemoveInvestment(kept.ID())
+	if err := portfolio.Delete(); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := RebuildPortfolio(portfolio.Events()); err != ErrPortfolioNotFound {
+		t.Errorf("Expected ErrPortfolioNotFound for a deleted portfolio, got %v", err)
+	}
+	if _, err := RebuildPortfolio(portfolio.Events()[1:]); !errors.Is(err, ErrInvalidEventStream) {
+		t.Errorf("Expected ErrInvalidEventStream, got %v", err)
+	}
+}
+
+func TestPortfolio_CreationEvents(t *testing.T) {
+	createdAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	archivedAt := createdAt.Add(48 * time.Hour)
+	first := ReconstituteInvestment(NewInvestmentID("inv-1"), Money{Amount: 1500, Currency: "JPY"}, Stock, Moderate, 3, createdAt, createdAt.Add(time.Hour))
+	second := ReconstituteInvestment(NewInvestmentID("inv-2"), Money{Amount: 2000, Currency: "USD"}, Bond, Conservative, 1, createdAt.Add(time.Hour), createdAt.Add(time.Hour))
+	deposit := &CashTransaction{ID: "cash-1", Type: CashDeposit, Amount: Money{Amount: 5000, Currency: "JPY"}, OccurredAt: createdAt}
+
+	// イベントを記録する前から保存されていたポートフォリオ
+	stored := ReconstitutePortfolio(PortfolioState{
+		ID:               NewPortfolioID("legacy"),
+		UserID:           "test-user",
+		Name:             "Legacy",
+		Investments:      []*Investment{second, first},
+		CashTransactions: []*CashTransaction{deposit},
+		ArchivedAt:       &archivedAt,
+		Version:          4,
+		CreatedAt:        createdAt,
+		UpdatedAt:        archivedAt,
+	})
+
+	events := stored.CreationEvents()
+	if _, ok := events[0].(PortfolioCreatedEvent); !ok || len(events) != 5 {
+		t.Fatalf("Expected the creation and 4 more events, got %+v", events)
+	}
+	if created, ok := events[1].(InvestmentCreatedEvent); !ok || created.InvestmentID() != first.ID() {
+		t.Errorf("Expected the oldest investment first, got %+v", events[1])
+	}
+
+	rebuilt, err := RebuildPortfolio(events)
+	if err != nil {
+		t.Fatalf("RebuildPortfolio failed: %v", err)
+	}
+	if rebuilt.UserID != "test-user" || rebuilt.Name != "Legacy" || !rebuilt.CreatedAt.Equal(createdAt) {
+		t.Errorf("Unexpected portfolio %s named %q created at %v", rebuilt.UserID, rebuilt.Name, rebuilt.CreatedAt)
+	}
+	if rebuilt.ArchivedAt == nil || !rebuilt.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("Expected archived at %v, got %v", archivedAt, rebuilt.ArchivedAt)
+	}
+	for _, investment := range stored.GetInvestments() {
+		got, err := rebuilt.GetInvestment(investment.ID())
+		if err != nil || got.Amount() != investment.Amount() || got.Type() != investment.Type() || got.Strategy() != investment.Strategy() {
+			t.Errorf("Expected investment %+v, got %+v", investment, got)
+		}
+	}
+	if len(rebuilt.CashTransactions) != 1 || rebuilt.CashTransactions[0].ID != "cash-1" {
+		t.Errorf("Expected the ledger, got %+v", rebuilt.CashTransactions)
+	}
+	if len(stored.Events()) != 0 {
+		t.Error("CreationEvents should not record events")
+	}
+}
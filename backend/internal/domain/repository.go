@@ -1,6 +1,9 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type UserRepository interface {
 	Create(user *User) error
@@ -17,18 +20,57 @@ type InvestmentRepository interface {
 	FindAllByPortfolioID(ctx context.Context, portfolioID PortfolioID) ([]*Investment, error)
 	Delete(ctx context.Context, id InvestmentID) error
 	FindAll(ctx context.Context) ([]*Investment, error)
+	// Find returns one page of the investments selected by query.
+	Find(ctx context.Context, query InvestmentQuery) (*InvestmentPage, error)
 }
 
 type PortfolioRepository interface {
 	Create(ctx context.Context, portfolio *Portfolio) error
 	Save(ctx context.Context, portfolio *Portfolio) error
 	FindByID(ctx context.Context, id PortfolioID) (*Portfolio, error)
-	FindByUserID(ctx context.Context, userID string) (*Portfolio, error)
+	// FindByIDs loads several portfolios at once, in the order of ids.
+	// Unknown ids are skipped.
+	FindByIDs(ctx context.Context, ids []PortfolioID) ([]*Portfolio, error)
+	FindByUserID(ctx context.Context, userID string) ([]*Portfolio, error)
+	// FindAll returns every portfolio, archived ones included.
+	FindAll(ctx context.Context) ([]*Portfolio, error)
 	FindByInvestmentID(ctx context.Context, investmentID InvestmentID) (*Portfolio, error)
-	Delete(ctx context.Context, id PortfolioID) error
+	// Delete removes a loaded portfolio. Like Save it only applies if the
+	// stored version still matches, otherwise ErrConcurrentModification is
+	// returned.
+	Delete(ctx context.Context, portfolio *Portfolio) error
 	Update(ctx context.Context, portfolio *Portfolio) error
 }
 
+type MembershipRepository interface {
+	Save(ctx context.Context, membership *PortfolioMembership) error
+	FindByID(ctx context.Context, id string) (*PortfolioMembership, error)
+	FindByPortfolioID(ctx context.Context, portfolioID PortfolioID) ([]*PortfolioMembership, error)
+	FindActiveByUserID(ctx context.Context, userID string) ([]*PortfolioMembership, error)
+	FindPendingByEmail(ctx context.Context, email string) ([]*PortfolioMembership, error)
+	Delete(ctx context.Context, id string) error
+}
+
 type TransactionManager interface {
 	RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
+
+type WebhookRepository interface {
+	SaveSubscription(ctx context.Context, subscription *WebhookSubscription) error
+	FindSubscriptionByID(ctx context.Context, id string) (*WebhookSubscription, error)
+	FindSubscriptionsByUserID(ctx context.Context, userID string) ([]*WebhookSubscription, error)
+	// DeleteSubscription removes a subscription together with its deliveries.
+	DeleteSubscription(ctx context.Context, id string) error
+
+	// SaveDelivery inserts a delivery, and does nothing when one with its ID
+	// is already stored.
+	SaveDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// UpdateDelivery stores the state of a stored delivery.
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	FindDeliveryByID(ctx context.Context, id string) (*WebhookDelivery, error)
+	// FindDeliveriesBySubscriptionID returns up to limit deliveries, newest first.
+	FindDeliveriesBySubscriptionID(ctx context.Context, subscriptionID string, limit int) ([]*WebhookDelivery, error)
+	// FindDueDeliveries returns up to limit pending deliveries whose next
+	// attempt is due at now, oldest first.
+	FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*WebhookDelivery, error)
+}
@@ -0,0 +1,35 @@
+package service
+
+import "context"
+
+// Actor is who caused a change: the authenticated user and the request.
+type Actor struct {
+	UserID    string
+	RequestID string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose stored events are attributed to actor.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of the context; changes made outside of a
+// request, e.g. by a migration, have none.
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
+
+// stampActor records the actor of the context on events about to be stored.
+func stampActor(ctx context.Context, events []StoredEvent) {
+	actor, ok := ActorFrom(ctx)
+	if !ok {
+		return
+	}
+	for i := range events {
+		events[i].ActorID = actor.UserID
+		events[i].RequestID = actor.RequestID
+	}
+}
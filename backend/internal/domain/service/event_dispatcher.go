@@ -1,34 +1,247 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
 	"moneyget/internal/domain"
+	"runtime/debug"
 	"sync"
 )
 
+var (
+	ErrDispatcherClosed = errors.New("event dispatcher is closed")
+	ErrSubscriberBusy   = errors.New("event subscriber queue is full")
+)
+
+// Subscription configures how a handler receives events.
+type Subscription struct {
+	Name      string // ログに出す購読者の名前
+	QueueSize int    // ワーカーごとのキューの長さ
+	Workers   int
+}
+
+// DefaultSubscription is used by Subscribe.
+var DefaultSubscription = Subscription{
+	Name:      "subscriber",
+	QueueSize: 256,
+	Workers:   1,
+}
+
+// EventDispatcher delivers events asynchronously. Every subscriber has its
+// own bounded queues and worker goroutines, so a slow or panicking handler
+// only holds back itself. The events of one aggregate go to the same worker
+// and are handled in the order they were published. Publish does not wait
+// for the handlers; Dispatch does and reports their failures.
 type EventDispatcher struct {
-	handlers []func(domain.DomainEvent)
-	mu       sync.RWMutex
+	mu          sync.Mutex
+	subscribers []*subscriber
+	closed      bool
+	workers     sync.WaitGroup
+}
+
+type subscriber struct {
+	Subscription
+	matches func(domain.DomainEvent) bool
+	handler func(domain.DomainEvent) error
+	queues  []chan delivery
+}
+
+// delivery is a queued event. results receives the outcome of the handler
+// when someone waits for it.
+type delivery struct {
+	event   domain.DomainEvent
+	results chan<- error
 }
 
 func NewEventDispatcher() *EventDispatcher {
-	return &EventDispatcher{
-		handlers: make([]func(domain.DomainEvent), 0),
-	}
+	return &EventDispatcher{}
 }
 
-func (d *EventDispatcher) Subscribe(handler func(domain.DomainEvent)) error {
+// Subscribe registers a handler for every event.
+func (d *EventDispatcher) Subscribe(handler func(domain.DomainEvent) error) error {
+	return d.SubscribeWith(DefaultSubscription, nil, handler)
+}
+
+// SubscribeWith registers a handler for the events accepted by matches (all
+// events when it is nil). Zero fields of the subscription take their
+// defaults.
+func (d *EventDispatcher) SubscribeWith(subscription Subscription, matches func(domain.DomainEvent) bool, handler func(domain.DomainEvent) error) error {
+	if subscription.Name == "" {
+		subscription.Name = DefaultSubscription.Name
+	}
+	if subscription.QueueSize <= 0 {
+		subscription.QueueSize = DefaultSubscription.QueueSize
+	}
+	if subscription.Workers <= 0 {
+		subscription.Workers = DefaultSubscription.Workers
+	}
+	if matches == nil {
+		matches = func(domain.DomainEvent) bool { return true }
+	}
+
 	d.mu.Lock()
 	defer d.mu.Unlock()
-	d.handlers = append(d.handlers, handler)
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	s := &subscriber{
+		Subscription: subscription,
+		matches:      matches,
+		handler:      handler,
+		queues:       make([]chan delivery, subscription.Workers),
+	}
+	for i := range s.queues {
+		s.queues[i] = make(chan delivery, subscription.QueueSize)
+		d.workers.Add(1)
+		go d.work(s, s.queues[i])
+	}
+	d.subscribers = append(d.subscribers, s)
 	return nil
 }
 
+// SubscribeTo registers a handler for the events of type E only, e.g.
+//
+//	SubscribeTo(d, sub, func(e domain.InvestmentCreatedEvent) error { ... })
+func SubscribeTo[E domain.DomainEvent](d *EventDispatcher, subscription Subscription, handler func(E) error) error {
+	return d.SubscribeWith(subscription,
+		func(event domain.DomainEvent) bool {
+			_, ok := event.(E)
+			return ok
+		},
+		func(event domain.DomainEvent) error {
+			return handler(event.(E))
+		},
+	)
+}
+
+// Publish queues the event for the subscribers that accept it and returns
+// without waiting for them. The event is queued for all of them or, when a
+// queue is full, for none and ErrSubscriberBusy is returned. Failures of the
+// handlers are only logged.
 func (d *EventDispatcher) Publish(event domain.DomainEvent) error {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+	_, _, err := d.enqueue(event, false)
+	return err
+}
 
-	for _, handler := range d.handlers {
-		handler(event)
+// Dispatch queues the event like Publish and waits until every subscriber
+// that accepts it has handled it. It returns the failures of the handlers,
+// or the error of ctx when it is done first; the handlers still run then.
+// The outbox relay uses it to keep events until they have been handled.
+func (d *EventDispatcher) Dispatch(ctx context.Context, event domain.DomainEvent) error {
+	results, queued, err := d.enqueue(event, true)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	var errs []error
+	for i := 0; i < queued; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enqueue queues the event for the subscribers that accept it and returns
+// how many did. With wait, their handlers report to the returned channel.
+func (d *EventDispatcher) enqueue(event domain.DomainEvent, wait bool) (<-chan error, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil, 0, ErrDispatcherClosed
+	}
+
+	// キューに入れられるのはenqueueだけなので、空きを確かめてから入れれば溢れない
+	var targets []chan delivery
+	for _, s := range d.subscribers {
+		if !s.matches(event) {
+			continue
+		}
+		queue := s.queues[worker(event, len(s.queues))]
+		if len(queue) == cap(queue) {
+			return nil, 0, fmt.Errorf("%w: %s", ErrSubscriberBusy, s.Name)
+		}
+		targets = append(targets, queue)
+	}
+
+	// 待つのをやめても、ワーカーが結果を書き込めるだけの容量を取っておく
+	var results chan error
+	if wait {
+		results = make(chan error, len(targets))
+	}
+	for _, queue := range targets {
+		queue <- delivery{event: event, results: results}
+	}
+	return results, len(targets), nil
+}
+
+// Close stops accepting events and waits until the queued ones are handled,
+// or until ctx is done.
+func (d *EventDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, s := range d.subscribers {
+			for _, queue := range s.queues {
+				close(queue)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *EventDispatcher) work(s *subscriber, queue chan delivery) {
+	defer d.workers.Done()
+	for delivery := range queue {
+		err := s.handle(delivery.event)
+		if err != nil {
+			log.Printf("Subscriber %s failed to handle %s event: %v\n", s.Name, GetEventType(delivery.event), err)
+			err = fmt.Errorf("%s: %w", s.Name, err)
+		}
+		if delivery.results != nil {
+			delivery.results <- err
+		}
+	}
+}
+
+// handle runs the handler, turning a panic into an error.
+func (s *subscriber) handle(event domain.DomainEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v\n%s", p, debug.Stack())
+		}
+	}()
+	return s.handler(event)
+}
+
+// worker picks the worker of an event from its aggregate.
+func worker(event domain.DomainEvent, workers int) int {
+	if workers == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(event.AggregateType() + "/" + event.AggregateID()))
+	return int(h.Sum32() % uint32(workers))
 }
@@ -1,7 +1,10 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"moneyget/internal/domain"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
@@ -18,21 +21,36 @@ func (e testEvent) Name() string {
 	return "TestEvent"
 }
 
+func (e testEvent) AggregateID() string {
+	return e.data
+}
+
+func (e testEvent) AggregateType() string {
+	return "Test"
+}
+
 func (e testEvent) OccurredAt() time.Time {
 	return e.occurredAt
 }
 
-func TestEventDispatcher(t *testing.T) {
-	dispatcher := NewEventDispatcher()
+// closeDispatcher drains the queues so that the handlers have run.
+func closeDispatcher(t *testing.T, dispatcher *EventDispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, dispatcher.Close(ctx))
+}
 
+func TestEventDispatcher(t *testing.T) {
 	t.Run("Subscribe and Publish", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
 		receivedEvents := make([]domain.DomainEvent, 0)
 		var mu sync.Mutex
 
-		err := dispatcher.Subscribe(func(event domain.DomainEvent) {
+		err := dispatcher.Subscribe(func(event domain.DomainEvent) error {
 			mu.Lock()
 			receivedEvents = append(receivedEvents, event)
 			mu.Unlock()
+			return nil
 		})
 		assert.NoError(t, err)
 
@@ -50,20 +68,23 @@ func TestEventDispatcher(t *testing.T) {
 		err = dispatcher.Publish(testEvent2)
 		assert.NoError(t, err)
 
+		closeDispatcher(t, dispatcher)
 		assert.Equal(t, 2, len(receivedEvents))
 		assert.Equal(t, testEvent1, receivedEvents[0])
 		assert.Equal(t, testEvent2, receivedEvents[1])
 	})
 
 	t.Run("Multiple Subscribers", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
 		counter := 0
 		var mu sync.Mutex
 
 		for i := 0; i < 3; i++ {
-			err := dispatcher.Subscribe(func(event domain.DomainEvent) {
+			err := dispatcher.Subscribe(func(event domain.DomainEvent) error {
 				mu.Lock()
 				counter++
 				mu.Unlock()
+				return nil
 			})
 			assert.NoError(t, err)
 		}
@@ -75,6 +96,178 @@ func TestEventDispatcher(t *testing.T) {
 		err := dispatcher.Publish(event)
 		assert.NoError(t, err)
 
+		closeDispatcher(t, dispatcher)
 		assert.Equal(t, 3, counter)
 	})
+
+	t.Run("Typed subscription", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		var received []domain.InvestmentCreatedEvent
+
+		err := SubscribeTo(dispatcher, Subscription{Name: "investments"}, func(event domain.InvestmentCreatedEvent) error {
+			received = append(received, event)
+			return nil
+		})
+		assert.NoError(t, err)
+
+		portfolioID := domain.NewPortfolioID("portfolio-id")
+		created := domain.NewInvestmentCreatedEvent(portfolioID, newTestInvestment(t))
+		assert.NoError(t, dispatcher.Publish(domain.NewPortfolioRenamedEvent(portfolioID, "Savings", time.Now())))
+		assert.NoError(t, dispatcher.Publish(created))
+		assert.NoError(t, dispatcher.Publish(testEvent{data: "test", occurredAt: time.Now()}))
+
+		closeDispatcher(t, dispatcher)
+		assert.Equal(t, []domain.InvestmentCreatedEvent{created}, received)
+	})
+
+	t.Run("Failing and panicking subscribers are isolated", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		handled := 0
+		calls := 0
+
+		dispatcher.SubscribeWith(Subscription{Name: "panicking"}, nil, func(event domain.DomainEvent) error {
+			calls++
+			if calls == 1 {
+				panic("boom")
+			}
+			return errors.New("handler failed")
+		})
+		dispatcher.Subscribe(func(event domain.DomainEvent) error {
+			handled++
+			return nil
+		})
+
+		// 失敗しても発行は成功し、他の購読者と後続のイベントは処理される
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, dispatcher.Publish(testEvent{data: "test", occurredAt: time.Now()}))
+		}
+
+		closeDispatcher(t, dispatcher)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, 3, handled)
+	})
+
+	t.Run("A slow subscriber does not block Publish", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		release := make(chan struct{})
+		started := make(chan struct{}, 1)
+		fast := 0
+
+		dispatcher.SubscribeWith(Subscription{Name: "slow", QueueSize: 1}, nil, func(event domain.DomainEvent) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+		dispatcher.Subscribe(func(event domain.DomainEvent) error {
+			fast++
+			return nil
+		})
+
+		assert.NoError(t, dispatcher.Publish(testEvent{data: "1"}))
+		<-started
+		assert.NoError(t, dispatcher.Publish(testEvent{data: "2"}))
+
+		// キューが満杯なら、どの購読者にも渡さずにエラーを返す
+		err := dispatcher.Publish(testEvent{data: "3"})
+		assert.ErrorIs(t, err, ErrSubscriberBusy)
+
+		close(release)
+		closeDispatcher(t, dispatcher)
+		assert.Equal(t, 2, fast)
+	})
+
+	t.Run("Dispatch waits for the handlers and returns their failures", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		handled := make(chan string, 2)
+		failure := errors.New("handler failed")
+
+		dispatcher.SubscribeWith(Subscription{Name: "good"}, nil, func(event domain.DomainEvent) error {
+			handled <- "good"
+			return nil
+		})
+		dispatcher.SubscribeWith(Subscription{Name: "bad"}, nil, func(event domain.DomainEvent) error {
+			handled <- "bad"
+			return failure
+		})
+
+		err := dispatcher.Dispatch(context.Background(), testEvent{data: "1"})
+		assert.ErrorIs(t, err, failure)
+		assert.ErrorContains(t, err, "bad: handler failed")
+		// 戻った時にはどちらの購読者も処理を終えている
+		assert.Len(t, handled, 2)
+
+		closeDispatcher(t, dispatcher)
+	})
+
+	t.Run("Dispatch stops waiting when the context is done", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		release := make(chan struct{})
+
+		dispatcher.Subscribe(func(event domain.DomainEvent) error {
+			<-release
+			return nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, dispatcher.Dispatch(ctx, testEvent{data: "1"}), context.DeadlineExceeded)
+
+		close(release)
+		closeDispatcher(t, dispatcher)
+	})
+
+	t.Run("Events of one aggregate are handled in order", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		received := make(map[string][]int)
+		var mu sync.Mutex
+
+		dispatcher.SubscribeWith(Subscription{Name: "ordered", Workers: 4}, nil, func(event domain.DomainEvent) error {
+			test := event.(testEvent)
+			seq, _ := strconv.Atoi(test.occurredAt.Format("05"))
+			mu.Lock()
+			received[test.data] = append(received[test.data], seq)
+			mu.Unlock()
+			return nil
+		})
+
+		for seq := 0; seq < 50; seq++ {
+			for _, id := range []string{"a", "b", "c", "d", "e"} {
+				occurredAt := time.Date(2024, 1, 1, 0, 0, seq, 0, time.UTC)
+				assert.NoError(t, dispatcher.Publish(testEvent{data: id, occurredAt: occurredAt}))
+			}
+		}
+
+		closeDispatcher(t, dispatcher)
+		for id, seqs := range received {
+			assert.Len(t, seqs, 50, id)
+			for i := range seqs {
+				assert.Equal(t, i, seqs[i], id)
+			}
+		}
+	})
+
+	t.Run("Close drains the queues", func(t *testing.T) {
+		dispatcher := NewEventDispatcher()
+		release := make(chan struct{})
+		handled := 0
+
+		dispatcher.Subscribe(func(event domain.DomainEvent) error {
+			<-release
+			handled++
+			return nil
+		})
+		assert.NoError(t, dispatcher.Publish(testEvent{data: "1"}))
+		assert.NoError(t, dispatcher.Publish(testEvent{data: "2"}))
+
+		// 処理が終わらなければ期限で諦める
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, dispatcher.Close(ctx), context.DeadlineExceeded)
+
+		assert.ErrorIs(t, dispatcher.Publish(testEvent{data: "3"}), ErrDispatcherClosed)
+
+		close(release)
+		closeDispatcher(t, dispatcher)
+		assert.Equal(t, 2, handled)
+	})
 }
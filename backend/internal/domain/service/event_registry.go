@@ -0,0 +1,191 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"moneyget/internal/domain"
+	"reflect"
+)
+
+// Upcaster converts the payload of an event from one schema version to the
+// next. Upcasters only see JSON, so they keep working after the Go type
+// has moved on.
+type Upcaster func(data json.RawMessage) (json.RawMessage, error)
+
+// registeredEvent is how one kind of event is stored.
+type registeredEvent struct {
+	name      string
+	version   int              // 書き込む時のスキーマバージョン
+	upcasters map[int]Upcaster // 元のバージョンごと
+	decode    func(data []byte) (domain.DomainEvent, error)
+}
+
+// EventRegistry maps event types to the names they are stored under, and
+// upgrades the payloads written by older builds when they are read.
+type EventRegistry struct {
+	byName map[string]*registeredEvent
+	byType map[reflect.Type]*registeredEvent
+	names  []string // 登録順
+}
+
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{
+		byName: make(map[string]*registeredEvent),
+		byType: make(map[reflect.Type]*registeredEvent),
+	}
+}
+
+// RegisterEvent stores events of type E under name, at schema version 1
+// until upcasters are registered. Like the other registration functions it
+// panics on a name or type that is already registered, as that is a
+// programming error.
+func RegisterEvent[E domain.DomainEvent](r *EventRegistry, name string) {
+	goType := reflect.TypeOf((*E)(nil)).Elem()
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("event type %s is registered twice", name))
+	}
+	if _, ok := r.byType[goType]; ok {
+		panic(fmt.Sprintf("event %v is registered twice", goType))
+	}
+
+	event := &registeredEvent{
+		name:      name,
+		version:   1,
+		upcasters: make(map[int]Upcaster),
+		decode: func(data []byte) (domain.DomainEvent, error) {
+			var event E
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil, err
+			}
+			return event, nil
+		},
+	}
+	r.byName[name] = event
+	r.byType[goType] = event
+	r.names = append(r.names, name)
+}
+
+// RegisterUpcaster upgrades payloads of the event from version from to
+// from+1, which becomes the version new events are written with. Upcasters
+// are registered in version order, starting from 1.
+func (r *EventRegistry) RegisterUpcaster(name string, from int, upcaster Upcaster) {
+	event, ok := r.byName[name]
+	if !ok {
+		panic(fmt.Sprintf("event type %s is not registered", name))
+	}
+	if from != event.version {
+		panic(fmt.Sprintf("event type %s is at version %d, not %d", name, event.version, from))
+	}
+
+	event.upcasters[from] = upcaster
+	event.version = from + 1
+}
+
+// Name returns the name the event is stored under.
+func (r *EventRegistry) Name(event domain.DomainEvent) (string, bool) {
+	registered, ok := r.byType[reflect.TypeOf(event)]
+	if !ok {
+		return "", false
+	}
+	return registered.name, true
+}
+
+// Names lists the registered event types in the order they were registered.
+func (r *EventRegistry) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+// Has reports whether name is a registered event type.
+func (r *EventRegistry) Has(name string) bool {
+	_, ok := r.byName[name]
+	return ok
+}
+
+// Version returns the schema version new events of the type are written
+// with, or 0 for an unknown type.
+func (r *EventRegistry) Version(name string) int {
+	if event, ok := r.byName[name]; ok {
+		return event.version
+	}
+	return 0
+}
+
+// Encode converts an event to its stored form at the current schema
+// version. The sequence is left to the store.
+func (r *EventRegistry) Encode(event domain.DomainEvent) (StoredEvent, error) {
+	registered, ok := r.byType[reflect.TypeOf(event)]
+	if !ok {
+		return StoredEvent{}, fmt.Errorf("%w: %T", ErrUnknownEventType, event)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return StoredEvent{}, err
+	}
+
+	return StoredEvent{
+		AggregateID:   event.AggregateID(),
+		AggregateType: event.AggregateType(),
+		EventType:     registered.name,
+		SchemaVersion: registered.version,
+		EventData:     data,
+		OccurredAt:    event.OccurredAt(),
+	}, nil
+}
+
+// Upcast returns the stored event with its payload upgraded to the current
+// schema version of its type.
+func (r *EventRegistry) Upcast(stored StoredEvent) (StoredEvent, error) {
+	registered, ok := r.byName[stored.EventType]
+	if !ok {
+		return stored, fmt.Errorf("%w: %s", ErrUnknownEventType, stored.EventType)
+	}
+	if stored.SchemaVersion < 1 || stored.SchemaVersion > registered.version {
+		return stored, fmt.Errorf("event %d: unsupported schema version %d of %s", stored.ID, stored.SchemaVersion, stored.EventType)
+	}
+
+	// 元の行は書き換えず、読むたびに順に変換する
+	for stored.SchemaVersion < registered.version {
+		data, err := registered.upcasters[stored.SchemaVersion](stored.EventData)
+		if err != nil {
+			return stored, fmt.Errorf("event %d: upcasting %s from version %d: %w", stored.ID, stored.EventType, stored.SchemaVersion, err)
+		}
+		stored.EventData = data
+		stored.SchemaVersion++
+	}
+	return stored, nil
+}
+
+// Decode restores an event from its stored form, upcasting older payloads.
+func (r *EventRegistry) Decode(stored StoredEvent) (domain.DomainEvent, error) {
+	upcasted, err := r.Upcast(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := r.byName[upcasted.EventType].decode(upcasted.EventData)
+	if err != nil {
+		return nil, fmt.Errorf("event %d: %w", stored.ID, err)
+	}
+	return event, nil
+}
+
+// DefaultEventRegistry knows the events of the domain package.
+var DefaultEventRegistry = newDomainEventRegistry()
+
+// 新しいフィールドを足す時は、型の登録はそのままでアップキャスターを追加し、
+// testdata/events に新しいバージョンのゴールデンファイルを置く
+func newDomainEventRegistry() *EventRegistry {
+	r := NewEventRegistry()
+	RegisterEvent[domain.PortfolioCreatedEvent](r, "PortfolioCreated")
+	RegisterEvent[domain.PortfolioRenamedEvent](r, "PortfolioRenamed")
+	RegisterEvent[domain.PortfolioArchivedEvent](r, "PortfolioArchived")
+	RegisterEvent[domain.PortfolioDeletedEvent](r, "PortfolioDeleted")
+	RegisterEvent[domain.PortfolioRebalancedEvent](r, "PortfolioRebalanced")
+	RegisterEvent[domain.InvestmentCreatedEvent](r, "InvestmentCreated")
+	RegisterEvent[domain.InvestmentAmountChangedEvent](r, "InvestmentAmountChanged")
+	RegisterEvent[domain.InvestmentRemovedEvent](r, "InvestmentRemoved")
+	RegisterEvent[domain.CashTransactionRecordedEvent](r, "CashTransactionRecorded")
+	RegisterEvent[domain.PortfolioUpdatedEvent](r, "PortfolioUpdated")
+	return r
+}
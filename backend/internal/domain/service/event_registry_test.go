@@ -0,0 +1,239 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"moneyget/internal/domain"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "write the golden files of the current event schema versions")
+
+// pricedEvent is an event whose payload changed twice: v1 had a bare
+// amount, v2 added the currency and v3 renamed the amount to price.
+type pricedEvent struct {
+	ID    string       `json:"id"`
+	Price domain.Money `json:"price"`
+	At    time.Time    `json:"at"`
+}
+
+func (e pricedEvent) AggregateID() string   { return e.ID }
+func (e pricedEvent) AggregateType() string { return "Test" }
+func (e pricedEvent) OccurredAt() time.Time { return e.At }
+
+func newPricedRegistry() *EventRegistry {
+	r := NewEventRegistry()
+	RegisterEvent[pricedEvent](r, "Priced")
+	r.RegisterUpcaster("Priced", 1, func(data json.RawMessage) (json.RawMessage, error) {
+		var v1 map[string]interface{}
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, err
+		}
+		amount, ok := v1["amount"].(float64)
+		if !ok {
+			return nil, errors.New("amount is missing")
+		}
+		v1["amount"] = map[string]interface{}{"amount": amount, "currency": "JPY"}
+		return json.Marshal(v1)
+	})
+	r.RegisterUpcaster("Priced", 2, func(data json.RawMessage) (json.RawMessage, error) {
+		var v2 map[string]json.RawMessage
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, err
+		}
+		v2["price"] = v2["amount"]
+		delete(v2, "amount")
+		return json.Marshal(v2)
+	})
+	return r
+}
+
+func TestEventRegistry(t *testing.T) {
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := pricedEvent{ID: "priced-1", Price: domain.Money{Amount: 100, Currency: "JPY"}, At: at}
+
+	t.Run("Encodes at the current version", func(t *testing.T) {
+		r := newPricedRegistry()
+
+		stored, err := r.Encode(expected)
+		assert.NoError(t, err)
+		assert.Equal(t, "Priced", stored.EventType)
+		assert.Equal(t, 3, stored.SchemaVersion)
+		assert.Equal(t, 3, r.Version("Priced"))
+		assert.Equal(t, []string{"Priced"}, r.Names())
+	})
+
+	t.Run("Upcasts older payloads in order", func(t *testing.T) {
+		r := newPricedRegistry()
+
+		payloads := map[int]string{
+			1: `{"id":"priced-1","amount":100,"at":"2024-01-01T00:00:00Z"}`,
+			2: `{"id":"priced-1","amount":{"amount":100,"currency":"JPY"},"at":"2024-01-01T00:00:00Z"}`,
+			3: `{"id":"priced-1","price":{"amount":100,"currency":"JPY"},"at":"2024-01-01T00:00:00Z"}`,
+		}
+		for version, payload := range payloads {
+			stored := StoredEvent{ID: 1, EventType: "Priced", SchemaVersion: version, EventData: []byte(payload)}
+
+			decoded, err := r.Decode(stored)
+			assert.NoError(t, err, "version %d", version)
+			assert.Equal(t, expected, decoded, "version %d", version)
+
+			upcasted, err := r.Upcast(stored)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, upcasted.SchemaVersion)
+			// 元の行は変わらない
+			assert.Equal(t, payload, string(stored.EventData))
+		}
+	})
+
+	t.Run("Rejects unknown types and versions", func(t *testing.T) {
+		r := newPricedRegistry()
+
+		_, err := r.Decode(StoredEvent{EventType: "Unheard", SchemaVersion: 1, EventData: []byte(`{}`)})
+		assert.ErrorIs(t, err, ErrUnknownEventType)
+		_, err = r.Encode(testEvent{data: "a"})
+		assert.ErrorIs(t, err, ErrUnknownEventType)
+
+		for _, version := range []int{0, 4} {
+			_, err := r.Decode(StoredEvent{EventType: "Priced", SchemaVersion: version, EventData: []byte(`{}`)})
+			assert.Error(t, err, "version %d", version)
+		}
+
+		_, err = r.Decode(StoredEvent{ID: 7, EventType: "Priced", SchemaVersion: 1, EventData: []byte(`{"id":"priced-1"}`)})
+		assert.EqualError(t, err, "event 7: upcasting Priced from version 1: amount is missing")
+	})
+
+	t.Run("Registration mistakes panic", func(t *testing.T) {
+		assert.Panics(t, func() { RegisterEvent[pricedEvent](newPricedRegistry(), "Other") })
+		assert.Panics(t, func() { RegisterEvent[testEvent](newPricedRegistry(), "Priced") })
+		assert.Panics(t, func() { newPricedRegistry().RegisterUpcaster("Priced", 1, nil) })
+		assert.Panics(t, func() { newPricedRegistry().RegisterUpcaster("Unheard", 1, nil) })
+	})
+}
+
+// goldenDir holds the stored payload of every registered event at every
+// schema version, named <type>.v<version>.json. Files of older versions are
+// never rewritten: they are what the rows written by older builds look like.
+// All versions of a type describe the same event, so upcasting any of them
+// must give the current file.
+var goldenDir = filepath.Join("testdata", "events")
+
+var goldenName = regexp.MustCompile(`^(\w+)\.v(\d+)\.json$`)
+
+// goldenSamples are the events the golden files describe, built with the
+// current types. They write the file of each new version, so that the
+// upcasted older files are checked against what the code encodes today.
+func goldenSamples() []domain.DomainEvent {
+	at := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	portfolioID := domain.NewPortfolioID("portfolio-1")
+
+	investment, _ := domain.NewInvestment(domain.NewInvestmentID("investment-1"), domain.Money{Amount: 100000, Currency: "JPY"}, domain.Stock, domain.Moderate)
+	investment.CreatedAt = at
+	tx, _ := domain.NewCashTransaction("cash-1", domain.CashDividend, domain.Money{Amount: 1200, Currency: "JPY"}, investment.ID())
+	tx.OccurredAt = at
+
+	return []domain.DomainEvent{
+		domain.NewPortfolioCreatedEvent(portfolioID, "user-1", "Savings", at),
+		domain.NewPortfolioRenamedEvent(portfolioID, "Old savings", at),
+		domain.NewPortfolioArchivedEvent(portfolioID, at),
+		domain.NewPortfolioDeletedEvent(portfolioID, at),
+		domain.NewPortfolioRebalancedEvent(portfolioID, []domain.RebalanceChange{
+			{InvestmentID: investment.ID(), Amount: domain.Money{Amount: 80000, Currency: "JPY"}},
+		}, at),
+		domain.NewInvestmentCreatedEvent(portfolioID, investment),
+		domain.NewInvestmentAmountChangedEvent(portfolioID, investment.ID(), investment.Amount(), domain.Money{Amount: 80000, Currency: "JPY"}, at),
+		domain.NewInvestmentRemovedEvent(portfolioID, investment.ID(), at),
+		domain.NewCashTransactionRecordedEvent(portfolioID, tx),
+		domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1000000, Currency: "JPY"}, at),
+	}
+}
+
+func goldenPath(eventType string, version int) string {
+	return filepath.Join(goldenDir, fmt.Sprintf("%s.v%d.json", eventType, version))
+}
+
+func TestEventGoldenFiles(t *testing.T) {
+	registry := DefaultEventRegistry
+
+	if *updateGolden {
+		writeGoldenFiles(t, registry)
+	}
+
+	for _, eventType := range registry.Names() {
+		t.Run(eventType, func(t *testing.T) {
+			current := registry.Version(eventType)
+			want, err := os.ReadFile(goldenPath(eventType, current))
+			if !assert.NoError(t, err, "run go test with -update to write the golden file of a new version") {
+				return
+			}
+
+			for version := 1; version <= current; version++ {
+				data, err := os.ReadFile(goldenPath(eventType, version))
+				if !assert.NoError(t, err, "every version needs a golden file") {
+					continue
+				}
+
+				decoded, err := registry.Decode(StoredEvent{EventType: eventType, SchemaVersion: version, EventData: data})
+				if !assert.NoError(t, err, "version %d", version) {
+					continue
+				}
+				encoded, err := registry.Encode(decoded)
+				assert.NoError(t, err)
+				assert.Equal(t, current, encoded.SchemaVersion)
+				// 現行の形が変わったのにバージョンを上げていなければここで気付く
+				assert.JSONEq(t, string(want), string(encoded.EventData), "version %d", version)
+			}
+		})
+	}
+
+	// 登録を外した型や未来のバージョンのファイルを残さない
+	files, err := os.ReadDir(goldenDir)
+	assert.NoError(t, err)
+	for _, file := range files {
+		match := goldenName.FindStringSubmatch(file.Name())
+		if !assert.NotNil(t, match, "unexpected file %s", file.Name()) {
+			continue
+		}
+		version, _ := strconv.Atoi(match[2])
+		assert.True(t, version >= 1 && version <= registry.Version(match[1]), "no registered version for %s", file.Name())
+	}
+}
+
+// writeGoldenFiles writes the missing file of the current version of each
+// event type from its sample.
+func writeGoldenFiles(t *testing.T, registry *EventRegistry) {
+	samples := make(map[string]domain.DomainEvent)
+	for _, event := range goldenSamples() {
+		samples[GetEventType(event)] = event
+	}
+
+	assert.NoError(t, os.MkdirAll(goldenDir, 0o755))
+	for _, eventType := range registry.Names() {
+		current := registry.Version(eventType)
+		path := goldenPath(eventType, current)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		event := samples[eventType]
+		if event == nil {
+			t.Errorf("no golden sample for %s", eventType)
+			continue
+		}
+
+		stored, err := registry.Encode(event)
+		assert.NoError(t, err)
+		data, err := json.MarshalIndent(stored.EventData, "", "  ")
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, append(data, '\n'), 0o644))
+	}
+}
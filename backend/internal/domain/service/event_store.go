@@ -1,26 +1,110 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"moneyget/internal/domain"
 	"time"
 )
 
+// AnyVersion appends to a stream without checking its version.
+const AnyVersion = -1
+
+var (
+	ErrUnknownEventType = errors.New("unknown event type")
+	ErrMixedStreams     = errors.New("events of one append must belong to the same aggregate")
+)
+
 type EventStore struct {
 	db EventStoreDB
 }
 
+// EventStoreDB persists event streams. Streams are identified by aggregate
+// type and ID, and the events of a stream are numbered from 1 without gaps.
 type EventStoreDB interface {
-	Store(event domain.DomainEvent) error
+	// Append stores events at the end of their stream and returns the new
+	// version (the sequence of the last event). Unless expectedVersion is
+	// AnyVersion, the stream must be at that version, otherwise
+	// domain.ErrConcurrentModification is returned and nothing is stored.
+	// The events must belong to one stream; their Sequence is assigned.
+	Append(ctx context.Context, expectedVersion int, events []StoredEvent) (int, error)
+
+	// ReadStream returns the events of a stream with a sequence greater
+	// than afterSequence, in order.
+	ReadStream(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]StoredEvent, error)
+
+	// LastSequence returns the sequence of the last event of a stream, or 0
+	// when the stream has no events.
+	LastSequence(ctx context.Context, aggregateType string, aggregateID string) (int, error)
+
+	// ListStreams returns the IDs of the aggregates of a type that have
+	// events, in the order their streams were started.
+	ListStreams(ctx context.Context, aggregateType string) ([]string, error)
+
+	// QueryEvents returns up to filter.Limit events of any stream that pass
+	// the filter, in the order they were stored.
+	QueryEvents(ctx context.Context, filter EventFilter) ([]StoredEvent, error)
+}
+
+// EventFilter selects stored events across streams. Zero fields do not
+// filter.
+type EventFilter struct {
+	AggregateType string
+	AggregateID   string
+	EventTypes    []string
+	ActorID       string
+	From          *time.Time // inclusive
+	To            *time.Time // exclusive
+	AfterID       int64      // このIDより後に保存されたイベントだけを返す
+	Limit         int
 }
 
+// Matches reports whether a stored event passes the filter, not counting
+// the limit.
+func (f EventFilter) Matches(event StoredEvent) bool {
+	if f.AggregateType != "" && event.AggregateType != f.AggregateType {
+		return false
+	}
+	if f.AggregateID != "" && event.AggregateID != f.AggregateID {
+		return false
+	}
+	if len(f.EventTypes) > 0 && !containsString(f.EventTypes, event.EventType) {
+		return false
+	}
+	if f.ActorID != "" && event.ActorID != f.ActorID {
+		return false
+	}
+	if f.From != nil && event.OccurredAt.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && !event.OccurredAt.Before(*f.To) {
+		return false
+	}
+	return event.ID > f.AfterID
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StoredEvent is an event as kept in the store.
 type StoredEvent struct {
-	ID            string          `json:"id"`
+	ID            int64           `json:"id"`
 	AggregateID   string          `json:"aggregate_id"`
 	AggregateType string          `json:"aggregate_type"`
+	Sequence      int             `json:"sequence"`
 	EventType     string          `json:"event_type"`
+	SchemaVersion int             `json:"schema_version"`
 	EventData     json.RawMessage `json:"event_data"`
 	OccurredAt    time.Time       `json:"occurred_at"`
+	ActorID       string          `json:"actor_id"`   // 操作したユーザー（システムによる変更では空）
+	RequestID     string          `json:"request_id"` // 変更を起こしたリクエスト
 }
 
 func NewEventStore(db EventStoreDB) *EventStore {
@@ -29,17 +113,95 @@ func NewEventStore(db EventStoreDB) *EventStore {
 	}
 }
 
+// SaveEvent appends an event to its stream without a version check.
 func (s *EventStore) SaveEvent(event domain.DomainEvent) error {
-	return s.db.Store(event)
+	_, err := s.Append(context.Background(), AnyVersion, event)
+	return err
 }
 
+// Append stores events of one aggregate and returns the new stream version.
+func (s *EventStore) Append(ctx context.Context, expectedVersion int, events ...domain.DomainEvent) (int, error) {
+	if len(events) == 0 {
+		return expectedVersion, nil
+	}
+
+	stored := make([]StoredEvent, 0, len(events))
+	for _, event := range events {
+		if event.AggregateType() != events[0].AggregateType() || event.AggregateID() != events[0].AggregateID() {
+			return 0, ErrMixedStreams
+		}
+
+		encoded, err := EncodeEvent(event)
+		if err != nil {
+			return 0, err
+		}
+		stored = append(stored, encoded)
+	}
+	stampActor(ctx, stored)
+
+	return s.db.Append(ctx, expectedVersion, stored)
+}
+
+// ReadStream returns the events of an aggregate and the version of its stream.
+func (s *EventStore) ReadStream(ctx context.Context, aggregateType string, aggregateID string) ([]domain.DomainEvent, int, error) {
+	return s.ReadStreamAfter(ctx, aggregateType, aggregateID, 0)
+}
+
+// ReadStreamAfter returns the events of an aggregate that follow
+// afterSequence, and the version of its stream.
+func (s *EventStore) ReadStreamAfter(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]domain.DomainEvent, int, error) {
+	stored, err := s.db.ReadStream(ctx, aggregateType, aggregateID, afterSequence)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := make([]domain.DomainEvent, 0, len(stored))
+	version := afterSequence
+	for _, record := range stored {
+		event, err := DecodeEvent(record)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+		version = record.Sequence
+	}
+	return events, version, nil
+}
+
+// ListStreams returns the IDs of the aggregates of a type that have events.
+func (s *EventStore) ListStreams(ctx context.Context, aggregateType string) ([]string, error) {
+	return s.db.ListStreams(ctx, aggregateType)
+}
+
+// EncodeEvent converts an event to its stored form with DefaultEventRegistry.
+func EncodeEvent(event domain.DomainEvent) (StoredEvent, error) {
+	return DefaultEventRegistry.Encode(event)
+}
+
+// DecodeEvent restores an event from its stored form with
+// DefaultEventRegistry, upcasting older payloads.
+func DecodeEvent(stored StoredEvent) (domain.DomainEvent, error) {
+	return DefaultEventRegistry.Decode(stored)
+}
+
+// GetEventType returns the name the event is stored under, or "Unknown".
 func GetEventType(event domain.DomainEvent) string {
-	switch event.(type) {
-	case domain.InvestmentCreatedEvent:
-		return "InvestmentCreated"
-	case domain.PortfolioUpdatedEvent:
-		return "PortfolioUpdated"
-	default:
-		return "Unknown"
+	if name, ok := DefaultEventRegistry.Name(event); ok {
+		return name
 	}
+	return "Unknown"
+}
+
+// EventSchemaVersion returns the schema version new events of the type are
+// written with.
+func EventSchemaVersion(eventType string) int {
+	return DefaultEventRegistry.Version(eventType)
+}
+
+// EventTypes lists the names of the registered events.
+var EventTypes = DefaultEventRegistry.Names()
+
+// IsEventType reports whether name is the type of a known event.
+func IsEventType(name string) bool {
+	return DefaultEventRegistry.Has(name)
 }
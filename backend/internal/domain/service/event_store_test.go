@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"moneyget/internal/domain"
 	"testing"
 	"time"
@@ -10,53 +11,214 @@ import (
 
 // モックEventStoreDB
 type mockEventStoreDB struct {
-	storedEvents []domain.DomainEvent
+	storedEvents    []StoredEvent
+	expectedVersion int
 }
 
-func (m *mockEventStoreDB) Store(event domain.DomainEvent) error {
-	m.storedEvents = append(m.storedEvents, event)
-	return nil
+func (m *mockEventStoreDB) Append(ctx context.Context, expectedVersion int, events []StoredEvent) (int, error) {
+	m.expectedVersion = expectedVersion
+	for _, event := range events {
+		event.ID = int64(len(m.storedEvents) + 1)
+		event.Sequence = len(m.storedEvents) + 1
+		m.storedEvents = append(m.storedEvents, event)
+	}
+	return len(m.storedEvents), nil
 }
 
-type testInvestmentCreatedEvent struct {
-	investmentID domain.InvestmentID
-	createdAt    time.Time
+func (m *mockEventStoreDB) ReadStream(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]StoredEvent, error) {
+	var events []StoredEvent
+	for _, event := range m.storedEvents {
+		if event.AggregateType == aggregateType && event.AggregateID == aggregateID && event.Sequence > afterSequence {
+			events = append(events, event)
+		}
+	}
+	return events, nil
 }
 
-func (e testInvestmentCreatedEvent) Name() string {
-	return "InvestmentCreated"
+func (m *mockEventStoreDB) LastSequence(ctx context.Context, aggregateType string, aggregateID string) (int, error) {
+	sequence := 0
+	for _, event := range m.storedEvents {
+		if event.AggregateType == aggregateType && event.AggregateID == aggregateID {
+			sequence = event.Sequence
+		}
+	}
+	return sequence, nil
 }
 
-func (e testInvestmentCreatedEvent) OccurredAt() time.Time {
-	return e.createdAt
+func (m *mockEventStoreDB) ListStreams(ctx context.Context, aggregateType string) ([]string, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, event := range m.storedEvents {
+		if event.AggregateType == aggregateType && !seen[event.AggregateID] {
+			seen[event.AggregateID] = true
+			ids = append(ids, event.AggregateID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockEventStoreDB) QueryEvents(ctx context.Context, filter EventFilter) ([]StoredEvent, error) {
+	var events []StoredEvent
+	for _, event := range m.storedEvents {
+		if filter.Matches(event) && len(events) < filter.Limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func newTestInvestment(t *testing.T) *domain.Investment {
+	investment, err := domain.NewInvestment(
+		domain.NewInvestmentID("test-investment-id"),
+		domain.Money{Amount: 1000, Currency: "JPY"},
+		domain.Stock,
+		domain.Aggressive,
+	)
+	assert.NoError(t, err)
+	return investment
 }
 
 func TestEventStore(t *testing.T) {
+	portfolioID := domain.NewPortfolioID("portfolio-id")
+
 	t.Run("SaveEvent success", func(t *testing.T) {
-		mockDB := &mockEventStoreDB{storedEvents: make([]domain.DomainEvent, 0)}
+		mockDB := &mockEventStoreDB{}
 		eventStore := NewEventStore(mockDB)
 
-		event := testInvestmentCreatedEvent{
-			investmentID: domain.NewInvestmentID("test-id"),
-			createdAt:    time.Now(),
-		}
+		event := domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1000, Currency: "JPY"}, time.Now())
 
 		err := eventStore.SaveEvent(event)
 		assert.NoError(t, err)
 
 		assert.Equal(t, 1, len(mockDB.storedEvents))
-		assert.Equal(t, event, mockDB.storedEvents[0])
+		assert.Equal(t, AnyVersion, mockDB.expectedVersion)
+		assert.Equal(t, "PortfolioUpdated", mockDB.storedEvents[0].EventType)
+		assert.Equal(t, domain.AggregatePortfolio, mockDB.storedEvents[0].AggregateType)
+		assert.Equal(t, "portfolio-id", mockDB.storedEvents[0].AggregateID)
 	})
 
-	t.Run("GetEventType", func(t *testing.T) {
-		money, err := domain.NewMoney(1000, "JPY")
+	t.Run("Append and ReadStream round trip", func(t *testing.T) {
+		eventStore := NewEventStore(&mockEventStoreDB{})
+
+		events := []domain.DomainEvent{
+			domain.NewInvestmentCreatedEvent(portfolioID, newTestInvestment(t)),
+			domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1000, Currency: "JPY"}, time.Now()),
+		}
+		version, err := eventStore.Append(context.Background(), 0, events...)
 		assert.NoError(t, err)
+		assert.Equal(t, 2, version)
 
-		// 実際のInvestmentCreatedEventを使用してテスト
-		event := domain.NewInvestmentCreatedEvent(
-			domain.NewInvestmentID("test-investment-id"),
-			money,
+		read, version, err := eventStore.ReadStream(context.Background(), domain.AggregatePortfolio, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, 2, version)
+		assert.Equal(t, events, read)
+	})
+
+	t.Run("Append records the actor of the context", func(t *testing.T) {
+		mockDB := &mockEventStoreDB{}
+		eventStore := NewEventStore(mockDB)
+
+		ctx := WithActor(context.Background(), Actor{UserID: "user-id", RequestID: "request-id"})
+		_, err := eventStore.Append(ctx, 0, domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1, Currency: "JPY"}, time.Now()))
+		assert.NoError(t, err)
+		_, err = eventStore.Append(context.Background(), AnyVersion, domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 2, Currency: "JPY"}, time.Now()))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "user-id", mockDB.storedEvents[0].ActorID)
+		assert.Equal(t, "request-id", mockDB.storedEvents[0].RequestID)
+		// リクエスト外の変更には操作者がいない
+		assert.Empty(t, mockDB.storedEvents[1].ActorID)
+	})
+
+	t.Run("EventFilter", func(t *testing.T) {
+		at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		later := at.Add(time.Hour)
+		event := StoredEvent{ID: 5, AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-id", EventType: "PortfolioRenamed", ActorID: "user-id", OccurredAt: at}
+
+		matching := []EventFilter{
+			{},
+			{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-id"},
+			{EventTypes: []string{"PortfolioCreated", "PortfolioRenamed"}, ActorID: "user-id"},
+			{From: &at, To: &later, AfterID: 4},
+		}
+		for _, filter := range matching {
+			assert.True(t, filter.Matches(event), "%+v", filter)
+		}
+
+		excluding := []EventFilter{
+			{AggregateID: "other"},
+			{EventTypes: []string{"PortfolioCreated"}},
+			{ActorID: "other"},
+			{From: &later},
+			{To: &at},
+			{AfterID: 5},
+		}
+		for _, filter := range excluding {
+			assert.False(t, filter.Matches(event), "%+v", filter)
+		}
+	})
+
+	t.Run("Append rejects events of several aggregates", func(t *testing.T) {
+		eventStore := NewEventStore(&mockEventStoreDB{})
+
+		_, err := eventStore.Append(context.Background(), 0,
+			domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1, Currency: "JPY"}, time.Now()),
+			domain.NewPortfolioUpdatedEvent(domain.NewPortfolioID("other"), domain.Money{Amount: 1, Currency: "JPY"}, time.Now()),
 		)
+		assert.ErrorIs(t, err, ErrMixedStreams)
+	})
+
+	t.Run("EncodeEvent and DecodeEvent round trip every event type", func(t *testing.T) {
+		investment := newTestInvestment(t)
+		tx, err := domain.NewCashTransaction("cash-id", domain.CashSale, domain.Money{Amount: 10, Currency: "JPY"}, investment.ID())
+		assert.NoError(t, err)
+
+		now := time.Now()
+		events := []domain.DomainEvent{
+			domain.NewPortfolioCreatedEvent(portfolioID, "user-id", "Main", now),
+			domain.NewPortfolioRenamedEvent(portfolioID, "Savings", now),
+			domain.NewPortfolioArchivedEvent(portfolioID, now),
+			domain.NewPortfolioDeletedEvent(portfolioID, now),
+			domain.NewPortfolioRebalancedEvent(portfolioID, []domain.RebalanceChange{
+				{InvestmentID: investment.ID(), Amount: domain.Money{Amount: 500, Currency: "JPY"}},
+			}, now),
+			domain.NewInvestmentCreatedEvent(portfolioID, investment),
+			domain.NewInvestmentAmountChangedEvent(portfolioID, investment.ID(), investment.Amount(), domain.Money{Amount: 1200, Currency: "JPY"}, now),
+			domain.NewInvestmentRemovedEvent(portfolioID, investment.ID(), now),
+			domain.NewCashTransactionRecordedEvent(portfolioID, tx),
+			domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1000, Currency: "JPY"}, time.Now()),
+		}
+
+		assert.Len(t, events, len(EventTypes))
+		for _, event := range events {
+			stored, err := EncodeEvent(event)
+			assert.NoError(t, err)
+			assert.NotEqual(t, "Unknown", stored.EventType)
+
+			decoded, err := DecodeEvent(stored)
+			assert.NoError(t, err)
+			assert.Equal(t, event, decoded, stored.EventType)
+		}
+	})
+
+	t.Run("DecodeEvent rejects unknown types and schema versions", func(t *testing.T) {
+		stored, err := EncodeEvent(domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1, Currency: "JPY"}, time.Now()))
+		assert.NoError(t, err)
+
+		unknown := stored
+		unknown.EventType = "Unknown"
+		_, err = DecodeEvent(unknown)
+		assert.ErrorIs(t, err, ErrUnknownEventType)
+
+		newer := stored
+		newer.SchemaVersion = EventSchemaVersion(stored.EventType) + 1
+		_, err = DecodeEvent(newer)
+		assert.Error(t, err)
+	})
+
+	t.Run("GetEventType", func(t *testing.T) {
+		// 実際のInvestmentCreatedEventを使用してテスト
+		event := domain.NewInvestmentCreatedEvent(portfolioID, newTestInvestment(t))
 
 		eventType := GetEventType(event)
 		assert.Equal(t, "InvestmentCreated", eventType)
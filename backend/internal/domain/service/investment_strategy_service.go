@@ -23,7 +23,7 @@ func (s *InvestmentStrategyService) ValidateInvestmentStrategy(
 	portfolio *domain.Portfolio,
 ) error {
 	// 投資額の上限チェック
-	totalAmount := portfolio.CalculateTotalAmount()
+	totalAmount := portfolio.CalculateInvestedAmount()
 	newAmount, err := totalAmount.Add(investment.Amount())
 	if err != nil {
 		return err
@@ -58,7 +58,7 @@ func (s *InvestmentStrategyService) CalculateRiskScore(portfolio *domain.Portfol
 		domain.Aggressive:   1.0,
 	}
 
-	totalAmount := portfolio.CalculateTotalAmount()
+	totalAmount := portfolio.CalculateInvestedAmount()
 	if totalAmount.Amount == 0 {
 		return 0, nil
 	}
@@ -81,7 +81,7 @@ func (s *InvestmentStrategyService) SuggestRebalancing(portfolio *domain.Portfol
 
 	var suggestions []RebalancingSuggestion
 	allocation := make(map[domain.InvestmentStrategy]float64)
-	totalAmount := portfolio.CalculateTotalAmount()
+	totalAmount := portfolio.CalculateInvestedAmount()
 
 	if totalAmount.Amount == 0 {
 		return suggestions, nil
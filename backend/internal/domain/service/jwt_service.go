@@ -1,47 +1,85 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"moneyget/internal/domain/constants"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
+// ErrInvalidToken is returned by ValidateToken for any token that must not be trusted
+var ErrInvalidToken = errors.New("invalid token")
+
 type JWTService interface {
-	GenerateToken(userID uint) (string, error)
-	ValidateToken(tokenString string) (uint, error)
+	// GenerateToken issues a signed token whose subject is the user's ID
+	GenerateToken(userID string) (string, error)
+	// ValidateToken verifies the token and returns its subject
+	ValidateToken(tokenString string) (string, error)
 }
 
 type jwtService struct {
 	secretKey []byte
+	issuer    string
+	audience  string
+	ttl       time.Duration
+	now       func() time.Time
 }
 
 func NewJWTService(secretKey string) JWTService {
 	return &jwtService{
 		secretKey: []byte(secretKey),
+		issuer:    constants.JWTIssuer,
+		audience:  constants.JWTAudience,
+		ttl:       constants.JWTTokenExpiration,
+		now:       time.Now,
 	}
 }
 
-func (s *jwtService) GenerateToken(userID uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(constants.JWTTokenExpiration).Unix(),
-	})
+func (s *jwtService) GenerateToken(userID string) (string, error) {
+	if userID == "" {
+		return "", fmt.Errorf("%w: subject is required", ErrInvalidToken)
+	}
+
+	now := s.now()
+	claims := jwt.RegisteredClaims{
+		Subject:   userID,
+		Issuer:    s.issuer,
+		Audience:  jwt.ClaimStrings{s.audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		ID:        uuid.New().String(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(s.secretKey)
 }
 
-func (s *jwtService) ValidateToken(tokenString string) (uint, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+func (s *jwtService) ValidateToken(tokenString string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	parser := jwt.NewParser(
+		// HS256以外（noneや非対称鍵のアルゴリズムを含む）は受け付けない
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(s.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(s.now),
+	)
+
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return s.secretKey, nil
 	})
 	if err != nil {
-		return 0, err
+		return "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := uint(claims["user_id"].(float64))
-		return userID, nil
+	if !token.Valid || claims.Subject == "" || claims.ID == "" {
+		return "", ErrInvalidToken
 	}
-	return 0, jwt.ErrSignatureInvalid
+
+	return claims.Subject, nil
 }
@@ -1,48 +1,189 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
 	"testing"
 	"time"
 
+	"moneyget/internal/domain/constants"
+
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestJWTService(t *testing.T) {
 	secretKey := "test-secret-key"
-	jwtService := NewJWTService(secretKey)
+	service := NewJWTService(secretKey)
+	userID := "5f0c6c1e-3f4b-4b8e-9a52-2f8d8c1c7d10"
 
-	t.Run("GenerateToken and ValidateToken success", func(t *testing.T) {
-		userID := uint(123)
+	// signClaims は任意のクレームとアルゴリズムでトークンを作成する
+	signClaims := func(method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		assert.NoError(t, err)
+		return token
+	}
+	validClaims := func() jwt.RegisteredClaims {
+		now := time.Now()
+		return jwt.RegisteredClaims{
+			Subject:   userID,
+			Issuer:    constants.JWTIssuer,
+			Audience:  jwt.ClaimStrings{constants.JWTAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			ID:        "test-jti",
+		}
+	}
 
+	t.Run("GenerateToken and ValidateToken success", func(t *testing.T) {
 		// トークン生成のテスト
-		token, err := jwtService.GenerateToken(userID)
+		token, err := service.GenerateToken(userID)
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 
 		// トークン検証のテスト
-		validatedUserID, err := jwtService.ValidateToken(token)
+		validatedUserID, err := service.ValidateToken(token)
 		assert.NoError(t, err)
 		assert.Equal(t, userID, validatedUserID)
 	})
 
+	t.Run("GenerateToken sets standard claims", func(t *testing.T) {
+		token, err := service.GenerateToken(userID)
+		assert.NoError(t, err)
+
+		claims := &jwt.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, claims.Subject)
+		assert.Equal(t, constants.JWTIssuer, claims.Issuer)
+		assert.Equal(t, jwt.ClaimStrings{constants.JWTAudience}, claims.Audience)
+		assert.NotNil(t, claims.IssuedAt)
+		assert.NotNil(t, claims.NotBefore)
+		assert.NotNil(t, claims.ExpiresAt)
+		assert.NotEmpty(t, claims.ID)
+
+		// jtiはトークンごとに一意
+		other, err := service.GenerateToken(userID)
+		assert.NoError(t, err)
+		otherClaims := &jwt.RegisteredClaims{}
+		_, _, err = jwt.NewParser().ParseUnverified(other, otherClaims)
+		assert.NoError(t, err)
+		assert.NotEqual(t, claims.ID, otherClaims.ID)
+	})
+
+	t.Run("GenerateToken with empty subject", func(t *testing.T) {
+		_, err := service.GenerateToken("")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
 	t.Run("ValidateToken with invalid token", func(t *testing.T) {
 		// 不正なトークンのテスト
-		_, err := jwtService.ValidateToken("invalid-token")
-		assert.Error(t, err)
+		_, err := service.ValidateToken("invalid-token")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken with tampered token", func(t *testing.T) {
+		token, err := service.GenerateToken(userID)
+		assert.NoError(t, err)
+
+		// 署名はそのままでペイロードを別ユーザーのものに差し替える
+		forged := signClaims(jwt.SigningMethodHS256, []byte("attacker-key"), func() jwt.RegisteredClaims {
+			claims := validClaims()
+			claims.Subject = "other-user"
+			return claims
+		}())
+		parts := strings.Split(token, ".")
+		forgedParts := strings.Split(forged, ".")
+		tampered := parts[0] + "." + forgedParts[1] + "." + parts[2]
+
+		_, err = service.ValidateToken(tampered)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		// 別の鍵で署名されたトークン
+		_, err = service.ValidateToken(forged)
+		assert.ErrorIs(t, err, ErrInvalidToken)
 	})
 
 	t.Run("ValidateToken with expired token", func(t *testing.T) {
 		// 期限切れトークンの作成
-		userID := uint(123)
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": userID,
-			"exp":     time.Now().Add(-time.Hour).Unix(), // 1時間前の期限切れトークン
-		})
-		expiredToken, _ := token.SignedString([]byte(secretKey))
+		claims := validClaims()
+		claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Hour))
+		claims.NotBefore = claims.IssuedAt
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour)) // 1時間前の期限切れトークン
+		expiredToken := signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims)
 
 		// 期限切れトークンの検証
-		_, err := jwtService.ValidateToken(expiredToken)
-		assert.Error(t, err)
+		_, err := service.ValidateToken(expiredToken)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken with expired token from the service clock", func(t *testing.T) {
+		issuedAt := time.Now().Add(-constants.JWTTokenExpiration - time.Minute)
+		past := &jwtService{
+			secretKey: []byte(secretKey),
+			issuer:    constants.JWTIssuer,
+			audience:  constants.JWTAudience,
+			ttl:       constants.JWTTokenExpiration,
+			now:       func() time.Time { return issuedAt },
+		}
+		token, err := past.GenerateToken(userID)
+		assert.NoError(t, err)
+
+		_, err = service.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken without expiration", func(t *testing.T) {
+		claims := validClaims()
+		claims.ExpiresAt = nil
+		_, err := service.ValidateToken(signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken before nbf", func(t *testing.T) {
+		claims := validClaims()
+		claims.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		_, err := service.ValidateToken(signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken with wrong issuer or audience", func(t *testing.T) {
+		claims := validClaims()
+		claims.Issuer = "someone-else"
+		_, err := service.ValidateToken(signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		claims = validClaims()
+		claims.Audience = jwt.ClaimStrings{"another-api"}
+		_, err = service.ValidateToken(signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken without subject", func(t *testing.T) {
+		claims := validClaims()
+		claims.Subject = ""
+		_, err := service.ValidateToken(signClaims(jwt.SigningMethodHS256, []byte(secretKey), claims))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("ValidateToken with wrong algorithm", func(t *testing.T) {
+		// 同じ秘密鍵でもHS256以外のHMACは拒否する
+		hs512 := signClaims(jwt.SigningMethodHS512, []byte(secretKey), validClaims())
+		_, err := service.ValidateToken(hs512)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		// 署名なしトークン
+		none := signClaims(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())
+		_, err = service.ValidateToken(none)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		// 非対称鍵アルゴリズム
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		assert.NoError(t, err)
+		rs256 := signClaims(jwt.SigningMethodRS256, privateKey, validClaims())
+		_, err = service.ValidateToken(rs256)
+		assert.ErrorIs(t, err, ErrInvalidToken)
 	})
 }
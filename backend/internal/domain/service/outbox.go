@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"moneyget/internal/domain"
+	"time"
+)
+
+// OutboxMessage is an event waiting to be delivered to the subscribers.
+type OutboxMessage struct {
+	ID            int64
+	Event         StoredEvent
+	Attempts      int       // 失敗した配信の回数
+	NextAttemptAt time.Time // これより前には配信しない
+	LastError     string
+	CreatedAt     time.Time
+}
+
+// DeadLetter is a message whose delivery was given up.
+type DeadLetter struct {
+	ID        int64
+	MessageID int64 // 元のアウトボックスのメッセージ
+	Event     StoredEvent
+	Attempts  int
+	Reason    string
+	FailedAt  time.Time
+}
+
+// OutboxStoreDB keeps the messages of the outbox and the dead letters.
+type OutboxStoreDB interface {
+	// Enqueue adds the events to the outbox, due at once. It joins the
+	// transaction of the context.
+	Enqueue(ctx context.Context, events []StoredEvent, enqueuedAt time.Time) error
+
+	// PendingMessages returns up to limit messages due at now in the order
+	// they were enqueued. Messages that follow one not due yet in the same
+	// stream are left out, since they must wait for it.
+	PendingMessages(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error)
+
+	// DeleteMessage removes a delivered message.
+	DeleteMessage(ctx context.Context, id int64) error
+
+	// RescheduleMessage records a failed delivery of a message.
+	RescheduleMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error
+
+	// DeadLetter moves a message from the outbox to the dead letters.
+	DeadLetter(ctx context.Context, message OutboxMessage, reason string, failedAt time.Time) error
+
+	// DeadLetters returns up to limit dead letters, oldest first.
+	DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error)
+}
+
+// Outbox implements domain.EventOutbox: events are appended to their
+// streams and queued for the relay in the caller's transaction.
+type Outbox struct {
+	streams EventStoreDB
+	db      OutboxStoreDB
+	now     func() time.Time
+}
+
+func NewOutbox(streams EventStoreDB, db OutboxStoreDB) *Outbox {
+	return &Outbox{
+		streams: streams,
+		db:      db,
+		now:     time.Now,
+	}
+}
+
+// Add stores the events. It must run in the transaction that saves the
+// aggregates, so that both are committed or rolled back together.
+func (o *Outbox) Add(ctx context.Context, events ...domain.DomainEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	stored := make([]StoredEvent, 0, len(events))
+	for _, event := range events {
+		encoded, err := EncodeEvent(event)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, encoded)
+	}
+	stampActor(ctx, stored)
+
+	// 連続する同じ集約のイベントをまとめてストリームに追記する
+	for start := 0; start < len(stored); {
+		end := start + 1
+		for end < len(stored) && sameStream(stored[start], stored[end]) {
+			end++
+		}
+		if _, err := o.streams.Append(ctx, AnyVersion, stored[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+
+	return o.db.Enqueue(ctx, stored, o.now().UTC())
+}
+
+func sameStream(a StoredEvent, b StoredEvent) bool {
+	return a.AggregateType == b.AggregateType && a.AggregateID == b.AggregateID
+}
+
+// RelayPolicy controls how the relay polls the outbox and retries failed
+// deliveries.
+type RelayPolicy struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int           // これだけ失敗したらデッドレターに移す
+	Backoff      time.Duration // 最初の待ち時間（失敗ごとに倍増する）
+	MaxBackoff   time.Duration
+}
+
+var DefaultRelayPolicy = RelayPolicy{
+	PollInterval: 200 * time.Millisecond,
+	BatchSize:    100,
+	MaxAttempts:  8,
+	Backoff:      time.Second,
+	MaxBackoff:   5 * time.Minute,
+}
+
+// errUndeliverable marks failures that retrying cannot fix.
+var errUndeliverable = errors.New("undeliverable message")
+
+// Dispatcher hands an event to its handlers. Dispatch returns once all of
+// them have handled it, and fails when any of them failed.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, event domain.DomainEvent) error
+}
+
+// OutboxRelay delivers the messages of the outbox to the handlers, at least
+// once: a message is removed only after every handler has handled it, and is
+// delivered again after a failure or if the relay stops in between. The
+// messages of one aggregate are delivered in order; a failing one holds back
+// those that follow it.
+type OutboxRelay struct {
+	db         OutboxStoreDB
+	dispatcher Dispatcher
+	policy     RelayPolicy
+	now        func() time.Time
+}
+
+func NewOutboxRelay(db OutboxStoreDB, dispatcher Dispatcher, policy RelayPolicy) *OutboxRelay {
+	return &OutboxRelay{
+		db:         db,
+		dispatcher: dispatcher,
+		policy:     policy,
+		now:        time.Now,
+	}
+}
+
+// Run delivers the outbox every poll interval until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.policy.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Deliver(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to relay the outbox: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver publishes the messages that are due and returns how many were
+// delivered.
+func (r *OutboxRelay) Deliver(ctx context.Context) (int, error) {
+	now := r.now().UTC()
+	messages, err := r.db.PendingMessages(ctx, now, r.policy.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// 今回失敗したメッセージより後のイベントは配信しない
+	held := make(map[string]bool)
+	delivered := 0
+
+	for _, message := range messages {
+		stream := message.Event.AggregateType + "/" + message.Event.AggregateID
+		if held[stream] {
+			continue
+		}
+
+		if err := r.publish(ctx, message); err != nil {
+			// 止める時に待つのをやめたものは失敗に数えず、次回に配信する
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			retrying, err := r.fail(ctx, message, err, now)
+			if err != nil {
+				return delivered, err
+			}
+			held[stream] = retrying
+			continue
+		}
+
+		if err := r.db.DeleteMessage(ctx, message.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, message OutboxMessage) error {
+	event, err := DecodeEvent(message.Event)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUndeliverable, err)
+	}
+	return r.dispatcher.Dispatch(ctx, event)
+}
+
+// fail reschedules a message, or moves it to the dead letters once it runs
+// out of attempts, and reports whether it will be retried.
+func (r *OutboxRelay) fail(ctx context.Context, message OutboxMessage, cause error, now time.Time) (bool, error) {
+	message.Attempts++
+	message.LastError = cause.Error()
+
+	if errors.Is(cause, errUndeliverable) || message.Attempts >= r.policy.MaxAttempts {
+		log.Printf("Giving up %s event %d after %d attempts: %v\n", message.Event.EventType, message.ID, message.Attempts, cause)
+		return false, r.db.DeadLetter(ctx, message, message.LastError, now)
+	}
+
+	next := now.Add(r.backoff(message.Attempts))
+	return true, r.db.RescheduleMessage(ctx, message.ID, message.Attempts, next, message.LastError)
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	return exponentialBackoff(r.policy.Backoff, r.policy.MaxBackoff, attempts)
+}
+
+// exponentialBackoff doubles the wait from base with every failed attempt
+// after the first, up to max when it is set.
+func exponentialBackoff(base time.Duration, max time.Duration, attempts int) time.Duration {
+	wait := base
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if max > 0 && wait >= max {
+			return max
+		}
+	}
+	return wait
+}
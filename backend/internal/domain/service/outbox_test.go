@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"moneyget/internal/domain"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// モックOutboxStoreDB
+type mockOutboxStoreDB struct {
+	messages    []OutboxMessage
+	deadLetters []DeadLetter
+	lastID      int64
+}
+
+func (m *mockOutboxStoreDB) Enqueue(ctx context.Context, events []StoredEvent, enqueuedAt time.Time) error {
+	for _, event := range events {
+		m.lastID++
+		m.messages = append(m.messages, OutboxMessage{ID: m.lastID, Event: event, NextAttemptAt: enqueuedAt, CreatedAt: enqueuedAt})
+	}
+	return nil
+}
+
+func (m *mockOutboxStoreDB) PendingMessages(ctx context.Context, now time.Time, limit int) ([]OutboxMessage, error) {
+	var messages []OutboxMessage
+	waiting := make(map[string]bool)
+	for _, message := range m.messages {
+		stream := message.Event.AggregateType + "/" + message.Event.AggregateID
+		if message.NextAttemptAt.After(now) {
+			waiting[stream] = true
+		}
+		if !waiting[stream] && len(messages) < limit {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (m *mockOutboxStoreDB) DeleteMessage(ctx context.Context, id int64) error {
+	for i, message := range m.messages {
+		if message.ID == id {
+			m.messages = append(m.messages[:i:i], m.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockOutboxStoreDB) RescheduleMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	for i := range m.messages {
+		if m.messages[i].ID == id {
+			m.messages[i].Attempts = attempts
+			m.messages[i].NextAttemptAt = nextAttemptAt
+			m.messages[i].LastError = lastError
+		}
+	}
+	return nil
+}
+
+func (m *mockOutboxStoreDB) DeadLetter(ctx context.Context, message OutboxMessage, reason string, failedAt time.Time) error {
+	m.deadLetters = append(m.deadLetters, DeadLetter{
+		ID:        int64(len(m.deadLetters) + 1),
+		MessageID: message.ID,
+		Event:     message.Event,
+		Attempts:  message.Attempts,
+		Reason:    reason,
+		FailedAt:  failedAt,
+	})
+	return m.DeleteMessage(ctx, message.ID)
+}
+
+func (m *mockOutboxStoreDB) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	return m.deadLetters, nil
+}
+
+// recordingPublisher records the events it publishes and fails with the
+// errors queued for an aggregate.
+type recordingPublisher struct {
+	published []domain.DomainEvent
+	failures  map[string][]error
+}
+
+func (p *recordingPublisher) Dispatch(ctx context.Context, event domain.DomainEvent) error {
+	if errs := p.failures[event.AggregateID()]; len(errs) > 0 {
+		p.failures[event.AggregateID()] = errs[1:]
+		return errs[0]
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := RelayPolicy{BatchSize: 10, MaxAttempts: 3, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	newRelay := func() (*Outbox, *OutboxRelay, *mockEventStoreDB, *mockOutboxStoreDB, *recordingPublisher, *time.Time) {
+		streams := &mockEventStoreDB{}
+		db := &mockOutboxStoreDB{}
+		publisher := &recordingPublisher{failures: make(map[string][]error)}
+		outbox := NewOutbox(streams, db)
+		relay := NewOutboxRelay(db, publisher, policy)
+		now := start
+		outbox.now = func() time.Time { return now }
+		relay.now = func() time.Time { return now }
+		return outbox, relay, streams, db, publisher, &now
+	}
+
+	created := func(id string) domain.DomainEvent {
+		return domain.NewPortfolioCreatedEvent(domain.NewPortfolioID(id), "user-id", id, start)
+	}
+	renamed := func(id string, name string) domain.DomainEvent {
+		return domain.NewPortfolioRenamedEvent(domain.NewPortfolioID(id), name, start)
+	}
+
+	t.Run("Add appends to the streams and enqueues", func(t *testing.T) {
+		outbox, _, streams, db, _, _ := newRelay()
+
+		err := outbox.Add(ctx, created("portfolio-1"), renamed("portfolio-1", "Savings"), created("portfolio-2"))
+		assert.NoError(t, err)
+
+		assert.Len(t, streams.storedEvents, 3)
+		assert.Len(t, db.messages, 3)
+		assert.Equal(t, "PortfolioRenamed", db.messages[1].Event.EventType)
+		assert.Equal(t, "portfolio-2", db.messages[2].Event.AggregateID)
+	})
+
+	t.Run("Add records the actor on the streams", func(t *testing.T) {
+		outbox, _, streams, _, _, _ := newRelay()
+
+		ctx := WithActor(ctx, Actor{UserID: "user-id", RequestID: "request-id"})
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1"), created("portfolio-2")))
+
+		for _, event := range streams.storedEvents {
+			assert.Equal(t, "user-id", event.ActorID)
+			assert.Equal(t, "request-id", event.RequestID)
+		}
+	})
+
+	t.Run("Deliver publishes and removes the messages", func(t *testing.T) {
+		outbox, relay, _, db, publisher, _ := newRelay()
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1"), renamed("portfolio-1", "Savings")))
+
+		delivered, err := relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Equal(t, []domain.DomainEvent{created("portfolio-1"), renamed("portfolio-1", "Savings")}, publisher.published)
+		assert.Empty(t, db.messages)
+	})
+
+	t.Run("A failure holds back the aggregate until retried", func(t *testing.T) {
+		outbox, relay, _, db, publisher, now := newRelay()
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1"), renamed("portfolio-1", "Savings")))
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-2")))
+		publisher.failures["portfolio-1"] = []error{errors.New("handler failed")}
+
+		// 失敗した集約の後続は配信せず、他の集約は配信する
+		delivered, err := relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, []domain.DomainEvent{created("portfolio-2")}, publisher.published)
+		assert.Len(t, db.messages, 2)
+		assert.Equal(t, 1, db.messages[0].Attempts)
+		assert.Equal(t, "handler failed", db.messages[0].LastError)
+		assert.Equal(t, start.Add(time.Second), db.messages[0].NextAttemptAt)
+
+		// 待ち時間が過ぎるまでは再試行しない
+		delivered, err = relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+
+		*now = start.Add(time.Second)
+		delivered, err = relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		assert.Equal(t, []domain.DomainEvent{created("portfolio-2"), created("portfolio-1"), renamed("portfolio-1", "Savings")}, publisher.published)
+		assert.Empty(t, db.messages)
+	})
+
+	t.Run("Messages held back do not fill the batch", func(t *testing.T) {
+		outbox, relay, _, db, publisher, _ := newRelay()
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1")))
+		for i := 0; i < policy.BatchSize+5; i++ {
+			assert.NoError(t, outbox.Add(ctx, renamed("portfolio-1", fmt.Sprintf("Savings %d", i))))
+		}
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-2")))
+		publisher.failures["portfolio-1"] = []error{errors.New("handler failed")}
+
+		delivered, err := relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, delivered)
+
+		// 再試行待ちの集約のメッセージが1回分より多くても、他の集約は配信される
+		delivered, err = relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Equal(t, []domain.DomainEvent{created("portfolio-2")}, publisher.published)
+		assert.Len(t, db.messages, policy.BatchSize+6)
+	})
+
+	t.Run("A failing subscriber keeps the message for a retry", func(t *testing.T) {
+		outbox, _, _, db, _, now := newRelay()
+		dispatcher := NewEventDispatcher()
+		relay := NewOutboxRelay(db, dispatcher, policy)
+		relay.now = func() time.Time { return *now }
+
+		var snapshots, webhooks []string
+		dispatcher.SubscribeWith(Subscription{Name: "snapshots"}, nil, func(event domain.DomainEvent) error {
+			snapshots = append(snapshots, event.AggregateID())
+			return nil
+		})
+		failures := 1
+		dispatcher.SubscribeWith(Subscription{Name: "webhooks"}, nil, func(event domain.DomainEvent) error {
+			if failures > 0 {
+				failures--
+				return errors.New("webhook store unavailable")
+			}
+			webhooks = append(webhooks, event.AggregateID())
+			return nil
+		})
+		defer closeDispatcher(t, dispatcher)
+
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1")))
+
+		// 一つの購読者でも失敗すればメッセージは消さない
+		delivered, err := relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		if assert.Len(t, db.messages, 1) {
+			assert.Equal(t, 1, db.messages[0].Attempts)
+			assert.Equal(t, "webhooks: webhook store unavailable", db.messages[0].LastError)
+		}
+		assert.Empty(t, webhooks)
+
+		// 再試行で全員が処理してから消す（成功した購読者には重ねて届く）
+		*now = start.Add(time.Second)
+		delivered, err = relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		assert.Empty(t, db.messages)
+		assert.Equal(t, []string{"portfolio-1"}, webhooks)
+		assert.Equal(t, []string{"portfolio-1", "portfolio-1"}, snapshots)
+	})
+
+	t.Run("Messages that keep failing become dead letters", func(t *testing.T) {
+		outbox, relay, _, db, publisher, now := newRelay()
+		assert.NoError(t, outbox.Add(ctx, created("portfolio-1"), renamed("portfolio-1", "Savings")))
+		failure := errors.New("handler failed")
+		publisher.failures["portfolio-1"] = []error{failure, failure, failure}
+
+		for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+			_, err := relay.Deliver(ctx)
+			assert.NoError(t, err)
+			*now = now.Add(time.Hour)
+		}
+
+		assert.Len(t, db.deadLetters, 1)
+		assert.Equal(t, 3, db.deadLetters[0].Attempts)
+		assert.Equal(t, "PortfolioCreated", db.deadLetters[0].Event.EventType)
+		assert.Equal(t, "handler failed", db.deadLetters[0].Reason)
+		assert.Empty(t, db.messages)
+
+		// 諦めたメッセージは後続を止めない
+		assert.Equal(t, []domain.DomainEvent{renamed("portfolio-1", "Savings")}, publisher.published)
+	})
+
+	t.Run("Undecodable messages become dead letters at once", func(t *testing.T) {
+		_, relay, _, db, publisher, _ := newRelay()
+		assert.NoError(t, db.Enqueue(ctx, []StoredEvent{{
+			AggregateType: domain.AggregatePortfolio,
+			AggregateID:   "portfolio-1",
+			EventType:     "Unheard",
+			SchemaVersion: 1,
+			EventData:     []byte(`{}`),
+		}}, start))
+
+		delivered, err := relay.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, delivered)
+		assert.Empty(t, publisher.published)
+		assert.Len(t, db.deadLetters, 1)
+		assert.Equal(t, 1, db.deadLetters[0].Attempts)
+	})
+
+	t.Run("Backoff doubles up to the maximum", func(t *testing.T) {
+		_, relay, _, _, _, _ := newRelay()
+
+		assert.Equal(t, time.Second, relay.backoff(1))
+		assert.Equal(t, 2*time.Second, relay.backoff(2))
+		assert.Equal(t, 3*time.Second, relay.backoff(3))
+		assert.Equal(t, 3*time.Second, relay.backoff(10))
+	})
+}
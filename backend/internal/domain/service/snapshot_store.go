@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"moneyget/internal/domain"
+	"time"
+)
+
+// DefaultSnapshotInterval is the number of events after which a new
+// snapshot is taken.
+const DefaultSnapshotInterval = 100
+
+// Snapshot is the state of an aggregate at a version of its stream.
+type Snapshot struct {
+	AggregateType string
+	AggregateID   string
+	Version       int    // 含まれる最後のイベントのシーケンス
+	SchemaHash    string // ペイロードの形式（変わったスナップショットは使わない）
+	Data          json.RawMessage
+	CreatedAt     time.Time
+}
+
+// SnapshotStoreDB keeps the latest snapshot of each aggregate.
+type SnapshotStoreDB interface {
+	// SaveSnapshot replaces the snapshot of the aggregate, unless the stored
+	// one is of a later version.
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+
+	// LatestSnapshot returns the snapshot of an aggregate, or nil.
+	LatestSnapshot(ctx context.Context, aggregateType string, aggregateID string) (*Snapshot, error)
+
+	// DeleteSnapshots removes the snapshots of an aggregate type whose
+	// schema hash differs from schemaHash and returns how many were removed.
+	DeleteSnapshots(ctx context.Context, aggregateType string, schemaHash string) (int, error)
+}
+
+// PortfolioLoader loads portfolios from their event streams, starting from
+// the latest usable snapshot. Snapshots are taken on demand with
+// TakeSnapshot, and by Load once interval events follow the latest one.
+type PortfolioLoader struct {
+	events    *EventStore
+	snapshots SnapshotStoreDB
+	interval  int
+}
+
+// NewPortfolioLoader returns a loader taking a snapshot every interval
+// events; an interval of 0 disables periodic snapshots.
+func NewPortfolioLoader(events *EventStore, snapshots SnapshotStoreDB, interval int) *PortfolioLoader {
+	return &PortfolioLoader{
+		events:    events,
+		snapshots: snapshots,
+		interval:  interval,
+	}
+}
+
+// Load returns a portfolio and the version of its stream. A portfolio
+// without events or deleted is domain.ErrPortfolioNotFound.
+func (l *PortfolioLoader) Load(ctx context.Context, id string) (*domain.Portfolio, int, error) {
+	portfolio, version, replayed, err := l.load(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if l.interval > 0 && replayed >= l.interval {
+		if err := l.save(ctx, portfolio, version); err != nil {
+			return nil, 0, err
+		}
+	}
+	return portfolio, version, nil
+}
+
+// TakeSnapshot stores a snapshot of the current state of a portfolio and
+// returns its version.
+func (l *PortfolioLoader) TakeSnapshot(ctx context.Context, id string) (int, error) {
+	portfolio, version, _, err := l.load(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := l.save(ctx, portfolio, version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// InvalidateSnapshots removes the portfolio snapshots written with another
+// schema and returns how many were removed.
+func (l *PortfolioLoader) InvalidateSnapshots(ctx context.Context) (int, error) {
+	return l.snapshots.DeleteSnapshots(ctx, domain.AggregatePortfolio, domain.PortfolioSnapshotSchema)
+}
+
+// load also returns the number of events applied on top of the snapshot.
+func (l *PortfolioLoader) load(ctx context.Context, id string) (*domain.Portfolio, int, int, error) {
+	snapshot, err := l.snapshots.LatestSnapshot(ctx, domain.AggregatePortfolio, id)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if snapshot != nil && snapshot.SchemaHash != domain.PortfolioSnapshotSchema {
+		// 形式の古いスナップショットは無視して最初から再生する
+		snapshot = nil
+	}
+
+	if snapshot == nil {
+		events, version, err := l.events.ReadStream(ctx, domain.AggregatePortfolio, id)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		portfolio, err := domain.RebuildPortfolio(events)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		return portfolio, version, len(events), nil
+	}
+
+	events, version, err := l.events.ReadStreamAfter(ctx, domain.AggregatePortfolio, id, snapshot.Version)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	portfolio, err := domain.RestorePortfolio(snapshot.Data, events)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return portfolio, version, len(events), nil
+}
+
+func (l *PortfolioLoader) save(ctx context.Context, portfolio *domain.Portfolio, version int) error {
+	data, err := portfolio.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	return l.snapshots.SaveSnapshot(ctx, Snapshot{
+		AggregateType: domain.AggregatePortfolio,
+		AggregateID:   portfolio.ID().Value,
+		Version:       version,
+		SchemaHash:    domain.PortfolioSnapshotSchema,
+		Data:          data,
+		CreatedAt:     time.Now().UTC(),
+	})
+}
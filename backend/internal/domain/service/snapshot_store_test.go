@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// モックSnapshotStoreDB
+type mockSnapshotStoreDB struct {
+	snapshots map[string]Snapshot
+}
+
+func (m *mockSnapshotStoreDB) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	key := snapshot.AggregateType + "/" + snapshot.AggregateID
+	if stored, ok := m.snapshots[key]; ok && stored.Version > snapshot.Version {
+		return nil
+	}
+	m.snapshots[key] = snapshot
+	return nil
+}
+
+func (m *mockSnapshotStoreDB) LatestSnapshot(ctx context.Context, aggregateType string, aggregateID string) (*Snapshot, error) {
+	snapshot, ok := m.snapshots[aggregateType+"/"+aggregateID]
+	if !ok {
+		return nil, nil
+	}
+	return &snapshot, nil
+}
+
+func (m *mockSnapshotStoreDB) DeleteSnapshots(ctx context.Context, aggregateType string, schemaHash string) (int, error) {
+	deleted := 0
+	for key, snapshot := range m.snapshots {
+		if snapshot.AggregateType == aggregateType && snapshot.SchemaHash != schemaHash {
+			delete(m.snapshots, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// appendRenames appends n renames of the portfolio to its stream.
+func appendRenames(t *testing.T, events *EventStore, portfolio *domain.Portfolio, n int) {
+	for i := 0; i < n; i++ {
+		_, version, err := events.ReadStream(context.Background(), domain.AggregatePortfolio, portfolio.ID().Value)
+		assert.NoError(t, err)
+
+		before := len(portfolio.Events())
+		assert.NoError(t, portfolio.Rename(portfolio.Name+"!"))
+		_, err = events.Append(context.Background(), version, portfolio.Events()[before:]...)
+		assert.NoError(t, err)
+	}
+}
+
+func TestPortfolioLoader(t *testing.T) {
+	ctx := context.Background()
+
+	newLoader := func(t *testing.T, interval int) (*PortfolioLoader, *EventStore, *mockSnapshotStoreDB, *domain.Portfolio) {
+		events := NewEventStore(&mockEventStoreDB{})
+		snapshots := &mockSnapshotStoreDB{snapshots: make(map[string]Snapshot)}
+		portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-id"), "user-id")
+		_, err := events.Append(ctx, 0, portfolio.Events()...)
+		assert.NoError(t, err)
+		return NewPortfolioLoader(events, snapshots, interval), events, snapshots, portfolio
+	}
+
+	t.Run("Load takes a snapshot every interval events", func(t *testing.T) {
+		loader, events, snapshots, portfolio := newLoader(t, 5)
+
+		appendRenames(t, events, portfolio, 3)
+		_, version, err := loader.Load(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, 4, version)
+		assert.Empty(t, snapshots.snapshots)
+
+		appendRenames(t, events, portfolio, 1)
+		_, _, err = loader.Load(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		snapshot := snapshots.snapshots[domain.AggregatePortfolio+"/portfolio-id"]
+		assert.Equal(t, 5, snapshot.Version)
+		assert.Equal(t, domain.PortfolioSnapshotSchema, snapshot.SchemaHash)
+
+		// スナップショット以降のイベントだけを数える
+		appendRenames(t, events, portfolio, 4)
+		loaded, version, err := loader.Load(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, 9, version)
+		assert.Equal(t, portfolio.Name, loaded.Name)
+		assert.Equal(t, 5, snapshots.snapshots[domain.AggregatePortfolio+"/portfolio-id"].Version)
+	})
+
+	t.Run("Load applies the events after the snapshot", func(t *testing.T) {
+		loader, events, snapshots, portfolio := newLoader(t, 0)
+
+		appendRenames(t, events, portfolio, 2)
+		version, err := loader.TakeSnapshot(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, 3, version)
+
+		appendRenames(t, events, portfolio, 2)
+		loaded, version, err := loader.Load(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, 5, version)
+		assert.Equal(t, portfolio.Name, loaded.Name)
+		assert.Equal(t, 3, snapshots.snapshots[domain.AggregatePortfolio+"/portfolio-id"].Version)
+	})
+
+	t.Run("Snapshots of another schema are ignored and invalidated", func(t *testing.T) {
+		loader, events, snapshots, portfolio := newLoader(t, 0)
+
+		appendRenames(t, events, portfolio, 1)
+		snapshots.snapshots[domain.AggregatePortfolio+"/portfolio-id"] = Snapshot{
+			AggregateType: domain.AggregatePortfolio,
+			AggregateID:   "portfolio-id",
+			Version:       2,
+			SchemaHash:    "outdated",
+			Data:          []byte(`{"name":"Stale"}`),
+		}
+
+		loaded, _, err := loader.Load(ctx, "portfolio-id")
+		assert.NoError(t, err)
+		assert.Equal(t, portfolio.Name, loaded.Name)
+
+		deleted, err := loader.InvalidateSnapshots(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, deleted)
+		assert.Empty(t, snapshots.snapshots)
+	})
+
+	t.Run("Load of an unknown portfolio", func(t *testing.T) {
+		loader, _, _, _ := newLoader(t, 1)
+
+		_, _, err := loader.Load(ctx, "missing")
+		assert.ErrorIs(t, err, domain.ErrPortfolioNotFound)
+	})
+}
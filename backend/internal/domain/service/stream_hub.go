@@ -0,0 +1,107 @@
+package service
+
+import (
+	"moneyget/internal/domain"
+	"sync"
+)
+
+// StreamHub tells the connections watching an aggregate that its stream has
+// new events. It only signals: watchers read the events from the store
+// themselves, so a slow connection never holds back the dispatcher and
+// misses nothing.
+type StreamHub struct {
+	mu       sync.Mutex
+	watchers map[string]map[*StreamWatcher]struct{}
+	closed   bool
+}
+
+// StreamWatcher receives the signals of one aggregate.
+type StreamWatcher struct {
+	hub     *StreamHub
+	key     string
+	changed chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewStreamHub() *StreamHub {
+	return &StreamHub{
+		watchers: make(map[string]map[*StreamWatcher]struct{}),
+	}
+}
+
+// Watch starts watching the stream of an aggregate. The watcher must be
+// closed when it is no longer used.
+func (h *StreamHub) Watch(aggregateType string, aggregateID string) *StreamWatcher {
+	w := &StreamWatcher{
+		hub:     h,
+		key:     aggregateType + "/" + aggregateID,
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(w.done)
+		return w
+	}
+	if h.watchers[w.key] == nil {
+		h.watchers[w.key] = make(map[*StreamWatcher]struct{})
+	}
+	h.watchers[w.key][w] = struct{}{}
+	return w
+}
+
+// Publish signals the watchers of the event's aggregate. It is meant to be
+// subscribed to the EventDispatcher and never fails.
+func (h *StreamHub) Publish(event domain.DomainEvent) error {
+	key := event.AggregateType() + "/" + event.AggregateID()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers[key] {
+		// 通知済みで未読なら、まとめて一度読めばよい
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close ends all watchers, e.g. so that open connections finish when the
+// server shuts down.
+func (h *StreamHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for key, watchers := range h.watchers {
+		for w := range watchers {
+			w.once.Do(func() { close(w.done) })
+		}
+		delete(h.watchers, key)
+	}
+}
+
+// Changed receives a value when the stream may have new events.
+func (w *StreamWatcher) Changed() <-chan struct{} {
+	return w.changed
+}
+
+// Done is closed when the watcher or its hub is closed.
+func (w *StreamWatcher) Done() <-chan struct{} {
+	return w.done
+}
+
+func (w *StreamWatcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	if watchers, ok := w.hub.watchers[w.key]; ok {
+		delete(watchers, w)
+		if len(watchers) == 0 {
+			delete(w.hub.watchers, w.key)
+		}
+	}
+	w.once.Do(func() { close(w.done) })
+}
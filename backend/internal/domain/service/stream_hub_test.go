@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signalled reports whether a value is waiting on the channel.
+func signalled(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestStreamHub(t *testing.T) {
+	t.Run("Signals the watchers of the aggregate", func(t *testing.T) {
+		hub := NewStreamHub()
+		watched := hub.Watch("Test", "a")
+		other := hub.Watch("Test", "b")
+		defer watched.Close()
+		defer other.Close()
+
+		assert.NoError(t, hub.Publish(testEvent{data: "a"}))
+		assert.True(t, signalled(watched.Changed()))
+		assert.False(t, signalled(other.Changed()))
+	})
+
+	t.Run("Coalesces signals that were not read", func(t *testing.T) {
+		hub := NewStreamHub()
+		watcher := hub.Watch("Test", "a")
+		defer watcher.Close()
+
+		// 読まれない通知で発行側が止まってはいけない
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, hub.Publish(testEvent{data: "a"}))
+		}
+		assert.True(t, signalled(watcher.Changed()))
+		assert.False(t, signalled(watcher.Changed()))
+	})
+
+	t.Run("Closed watchers are not signalled", func(t *testing.T) {
+		hub := NewStreamHub()
+		watcher := hub.Watch("Test", "a")
+		watcher.Close()
+		watcher.Close()
+
+		assert.NoError(t, hub.Publish(testEvent{data: "a"}))
+		assert.False(t, signalled(watcher.Changed()))
+		assert.True(t, signalled(watcher.Done()))
+		assert.Empty(t, hub.watchers)
+	})
+
+	t.Run("Close ends all watchers", func(t *testing.T) {
+		hub := NewStreamHub()
+		watcher := hub.Watch("Test", "a")
+
+		hub.Close()
+		assert.True(t, signalled(watcher.Done()))
+		watcher.Close()
+
+		late := hub.Watch("Test", "a")
+		assert.True(t, signalled(late.Done()))
+	})
+}
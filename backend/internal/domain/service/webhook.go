@@ -0,0 +1,400 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"moneyget/internal/domain"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhookのリクエストに付けるヘッダー
+const (
+	WebhookEventHeader     = "X-Moneyget-Event"
+	WebhookDeliveryHeader  = "X-Moneyget-Delivery"
+	WebhookTimestampHeader = "X-Moneyget-Timestamp"
+	WebhookSignatureHeader = "X-Moneyget-Signature"
+)
+
+// SignWebhook returns the signature header of a request body sent at the
+// given unix time: "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription's secret. Receivers
+// recompute it, and reject old timestamps to prevent replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookSecret returns a random secret for a subscription.
+func NewWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// WebhookPayload is the JSON body posted for an event. Data is the payload
+// the event is stored with.
+type WebhookPayload struct {
+	ID            string          `json:"id"` // 配信のID（再配信でも変わらない）
+	EventType     string          `json:"event_type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// WebhookNotifier creates a delivery of every event for the subscriptions
+// of the owner of the event's portfolio. Members of shared portfolios are
+// not notified.
+type WebhookNotifier struct {
+	repo    domain.WebhookRepository
+	streams EventStoreDB
+	now     func() time.Time
+
+	mu     sync.Mutex
+	owners map[string]string // ポートフォリオIDから所有者（変わらないのでキャッシュする）
+}
+
+func NewWebhookNotifier(repo domain.WebhookRepository, streams EventStoreDB) *WebhookNotifier {
+	return &WebhookNotifier{
+		repo:    repo,
+		streams: streams,
+		now:     time.Now,
+		owners:  make(map[string]string),
+	}
+}
+
+// Notify queues the event for the deliverer.
+func (n *WebhookNotifier) Notify(ctx context.Context, event domain.DomainEvent) error {
+	if event.AggregateType() != domain.AggregatePortfolio {
+		return nil
+	}
+
+	owner, err := n.owner(ctx, event.AggregateID())
+	if err != nil || owner == "" {
+		return err
+	}
+
+	subscriptions, err := n.repo.FindSubscriptionsByUserID(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	eventType := GetEventType(event)
+	var sequence int
+	now := n.now().UTC()
+	for _, subscription := range subscriptions {
+		if !subscription.Accepts(eventType) {
+			continue
+		}
+
+		if sequence == 0 {
+			if sequence, err = n.sequence(ctx, event); err != nil {
+				return err
+			}
+		}
+		id := webhookDeliveryID(event, sequence, subscription.ID)
+		payload, err := NewWebhookPayload(id, event)
+		if err != nil {
+			return err
+		}
+		if err := n.repo.SaveDelivery(ctx, domain.NewWebhookDelivery(id, subscription.ID, eventType, payload, now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// webhookDeliveryID identifies the delivery of the event at sequence of its
+// stream to a subscription, so that notifying an event again, when the
+// outbox redelivers it, does not create another delivery.
+func webhookDeliveryID(event domain.DomainEvent, sequence int, subscriptionID string) string {
+	name := fmt.Sprintf("%s/%s/%d/%s", event.AggregateType(), event.AggregateID(), sequence, subscriptionID)
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name)).String()
+}
+
+// sequence finds the stored event in its stream and returns its sequence.
+func (n *WebhookNotifier) sequence(ctx context.Context, event domain.DomainEvent) (int, error) {
+	encoded, err := EncodeEvent(event)
+	if err != nil {
+		return 0, err
+	}
+
+	// 保存時に時刻が丸められても見つかるよう、前後に幅を持たせて探す
+	from, to := encoded.OccurredAt.Add(-time.Second), encoded.OccurredAt.Add(time.Second)
+	candidates, err := n.streams.QueryEvents(ctx, EventFilter{
+		AggregateType: encoded.AggregateType,
+		AggregateID:   encoded.AggregateID,
+		EventTypes:    []string{encoded.EventType},
+		From:          &from,
+		To:            &to,
+		Limit:         webhookSequenceCandidates,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, candidate := range candidates {
+		decoded, err := DecodeEvent(candidate)
+		if err != nil {
+			return 0, err
+		}
+		stored, err := EncodeEvent(decoded)
+		if err != nil {
+			return 0, err
+		}
+		if stored.OccurredAt.Equal(encoded.OccurredAt) && bytes.Equal(stored.EventData, encoded.EventData) {
+			return candidate.Sequence, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s event of %s %s is not stored", domain.ErrInvalidEventStream, encoded.EventType, encoded.AggregateType, encoded.AggregateID)
+}
+
+// 同じ時刻付近にある同じ種類のイベントをこれだけ調べる
+const webhookSequenceCandidates = 100
+
+// NewWebhookPayload encodes the body posted for an event.
+func NewWebhookPayload(id string, event domain.DomainEvent) ([]byte, error) {
+	stored, err := EncodeEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(WebhookPayload{
+		ID:            id,
+		EventType:     stored.EventType,
+		AggregateType: stored.AggregateType,
+		AggregateID:   stored.AggregateID,
+		OccurredAt:    stored.OccurredAt,
+		Data:          stored.EventData,
+	})
+}
+
+// owner returns the user who created a portfolio, from the first event of
+// its stream, so that events of deleted portfolios are delivered too.
+func (n *WebhookNotifier) owner(ctx context.Context, portfolioID string) (string, error) {
+	n.mu.Lock()
+	owner, ok := n.owners[portfolioID]
+	n.mu.Unlock()
+	if ok {
+		return owner, nil
+	}
+
+	stored, err := n.streams.ReadStream(ctx, domain.AggregatePortfolio, portfolioID, 0)
+	if err != nil || len(stored) == 0 {
+		return "", err
+	}
+	event, err := DecodeEvent(stored[0])
+	if err != nil {
+		return "", err
+	}
+	created, ok := event.(domain.PortfolioCreatedEvent)
+	if !ok {
+		return "", fmt.Errorf("%w: portfolio %s does not start with its creation", domain.ErrInvalidEventStream, portfolioID)
+	}
+
+	n.mu.Lock()
+	n.owners[portfolioID] = created.UserID()
+	n.mu.Unlock()
+	return created.UserID(), nil
+}
+
+// WebhookPolicy controls how the deliverer polls for deliveries and retries
+// failed ones.
+type WebhookPolicy struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int           // これだけ失敗したら配信を諦める
+	Backoff      time.Duration // 最初の待ち時間（失敗ごとに倍増する）
+	MaxBackoff   time.Duration
+	Timeout      time.Duration // 1回のリクエストの期限
+}
+
+var DefaultWebhookPolicy = WebhookPolicy{
+	PollInterval: time.Second,
+	BatchSize:    50,
+	MaxAttempts:  8,
+	Backoff:      10 * time.Second,
+	MaxBackoff:   time.Hour,
+	Timeout:      10 * time.Second,
+}
+
+// WebhookDeliverer posts the pending deliveries to their subscriptions.
+type WebhookDeliverer struct {
+	repo   domain.WebhookRepository
+	client *http.Client
+	policy WebhookPolicy
+	now    func() time.Time
+}
+
+// ErrWebhookAddressNotAllowed is returned when the host of a webhook
+// resolves to an address of the server's own network.
+var ErrWebhookAddressNotAllowed = errors.New("webhook address is not allowed")
+
+// NewWebhookDeliverer returns a deliverer posting with client, or with a
+// client that only connects to public addresses when it is nil.
+func NewWebhookDeliverer(repo domain.WebhookRepository, client *http.Client, policy WebhookPolicy) *WebhookDeliverer {
+	if client == nil {
+		client = newWebhookClient(policy.Timeout)
+	}
+	return &WebhookDeliverer{
+		repo:   repo,
+		client: client,
+		policy: policy,
+		now:    time.Now,
+	}
+}
+
+// newWebhookClient checks the address when connecting, after the host was
+// resolved and on every redirect, so that a name pointing at an internal
+// address is refused as well.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !domain.IsPublicWebhookIP(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// プロキシを経由すると接続先を確かめられないので使わない
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Run delivers every poll interval until ctx is done.
+func (d *WebhookDeliverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.policy.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Deliver(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to deliver webhooks: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deliver posts the deliveries that are due and returns how many succeeded.
+func (d *WebhookDeliverer) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := d.repo.FindDueDeliveries(ctx, d.now().UTC(), d.policy.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	for _, delivery := range deliveries {
+		subscription, err := d.repo.FindSubscriptionByID(ctx, delivery.SubscriptionID)
+		if isNotFound(err) {
+			// 配信の途中で購読が削除された。配信の記録も消えていれば何もしない
+			delivery.Fail(0, "subscription was deleted", nil, d.now().UTC())
+			if err := d.repo.UpdateDelivery(ctx, delivery); err != nil && !isNotFound(err) {
+				return succeeded, err
+			}
+			continue
+		}
+		if err != nil {
+			return succeeded, err
+		}
+
+		status, err := d.post(ctx, subscription, delivery)
+		now := d.now().UTC()
+		if err == nil {
+			delivery.Succeed(status, now)
+			succeeded++
+		} else {
+			var retryAt *time.Time
+			if delivery.Attempts+1 < d.policy.MaxAttempts {
+				next := now.Add(exponentialBackoff(d.policy.Backoff, d.policy.MaxBackoff, delivery.Attempts+1))
+				retryAt = &next
+			} else {
+				log.Printf("Giving up webhook delivery %s after %d attempts: %v\n", delivery.ID, delivery.Attempts+1, err)
+			}
+			delivery.Fail(status, err.Error(), retryAt, now)
+		}
+
+		if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+			return succeeded, err
+		}
+	}
+	return succeeded, nil
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) || errors.Is(err, domain.ErrNotFound)
+}
+
+// post sends one attempt and returns the response status, 0 if there was
+// no response.
+func (d *WebhookDeliverer) post(ctx context.Context, subscription *domain.WebhookSubscription, delivery *domain.WebhookDelivery) (int, error) {
+	if d.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.policy.Timeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := d.now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "moneyget-webhooks")
+	request.Header.Set(WebhookEventHeader, delivery.EventType)
+	request.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	request.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(subscription.Secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// 接続を再利用できるよう本文を読み捨てる
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,370 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"moneyget/internal/domain"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// モックWebhookRepository
+type mockWebhookRepository struct {
+	subscriptions map[string]domain.WebhookSubscription
+	deliveries    map[string]domain.WebhookDelivery
+	findErr       error // FindSubscriptionByIDが返すエラー
+}
+
+func newMockWebhookRepository(subscriptions ...*domain.WebhookSubscription) *mockWebhookRepository {
+	m := &mockWebhookRepository{
+		subscriptions: make(map[string]domain.WebhookSubscription),
+		deliveries:    make(map[string]domain.WebhookDelivery),
+	}
+	for _, subscription := range subscriptions {
+		m.subscriptions[subscription.ID] = *subscription
+	}
+	return m
+}
+
+func (m *mockWebhookRepository) SaveSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	m.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+func (m *mockWebhookRepository) FindSubscriptionByID(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	if m.findErr != nil {
+		return nil, m.findErr
+	}
+	subscription, ok := m.subscriptions[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &subscription, nil
+}
+
+func (m *mockWebhookRepository) FindSubscriptionsByUserID(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error) {
+	var subscriptions []*domain.WebhookSubscription
+	for _, subscription := range m.subscriptions {
+		if subscription.UserID == userID {
+			subscription := subscription
+			subscriptions = append(subscriptions, &subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+	return subscriptions, nil
+}
+
+func (m *mockWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *mockWebhookRepository) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	if _, ok := m.deliveries[delivery.ID]; !ok {
+		m.deliveries[delivery.ID] = *delivery
+	}
+	return nil
+}
+
+func (m *mockWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	if _, ok := m.deliveries[delivery.ID]; !ok {
+		return domain.ErrNotFound
+	}
+	m.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (m *mockWebhookRepository) FindDeliveryByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	delivery, ok := m.deliveries[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &delivery, nil
+}
+
+func (m *mockWebhookRepository) FindDeliveriesBySubscriptionID(ctx context.Context, subscriptionID string, limit int) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			delivery := delivery
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == domain.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			delivery := delivery
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].EventType < deliveries[j].EventType })
+	return deliveries, nil
+}
+
+// webhookReceiver is an endpoint that checks the signature of the requests
+// and answers with the queued statuses, 204 once they are used up.
+type webhookReceiver struct {
+	*httptest.Server
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	received []WebhookPayload
+	invalid  int
+}
+
+func newWebhookReceiver(t *testing.T, secret string) *webhookReceiver {
+	r := &webhookReceiver{secret: secret}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(req.Body)
+	timestamp, err := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil || req.Header.Get(WebhookSignatureHeader) != SignWebhook(r.secret, timestamp, body) {
+		r.invalid++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	if status/100 == 2 {
+		var payload WebhookPayload
+		json.Unmarshal(body, &payload)
+		r.received = append(r.received, payload)
+	}
+	w.WriteHeader(status)
+}
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event_type":"PortfolioCreated"}`)
+	signature := SignWebhook("secret", 1700000000, body)
+
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+	assert.Equal(t, signature, SignWebhook("secret", 1700000000, body))
+	// 秘密鍵、時刻、本文のいずれが違っても署名は変わる
+	assert.NotEqual(t, signature, SignWebhook("other", 1700000000, body))
+	assert.NotEqual(t, signature, SignWebhook("secret", 1700000001, body))
+	assert.NotEqual(t, signature, SignWebhook("secret", 1700000000, []byte(`{}`)))
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := WebhookPolicy{BatchSize: 10, MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Timeout: time.Second}
+	portfolioID := domain.NewPortfolioID("portfolio-1")
+
+	setup := func(t *testing.T, subscriptions ...*domain.WebhookSubscription) (*WebhookNotifier, *WebhookDeliverer, *mockWebhookRepository, *time.Time) {
+		streams := &mockEventStoreDB{}
+		created, err := EncodeEvent(domain.NewPortfolioCreatedEvent(portfolioID, "owner", "Main", start))
+		assert.NoError(t, err)
+		_, err = streams.Append(ctx, AnyVersion, []StoredEvent{created})
+		assert.NoError(t, err)
+
+		repo := newMockWebhookRepository(subscriptions...)
+		notifier := NewWebhookNotifier(repo, streams)
+		// 受け手はループバックで待つので、宛先を制限しないクライアントを使う
+		deliverer := NewWebhookDeliverer(repo, &http.Client{Timeout: policy.Timeout}, policy)
+		now := start
+		notifier.now = func() time.Time { return now }
+		deliverer.now = func() time.Time { return now }
+		return notifier, deliverer, repo, &now
+	}
+
+	// record stores the event in its stream, as the outbox does before it is notified
+	record := func(t *testing.T, notifier *WebhookNotifier, event domain.DomainEvent) domain.DomainEvent {
+		t.Helper()
+		stored, err := EncodeEvent(event)
+		assert.NoError(t, err)
+		_, err = notifier.streams.Append(ctx, AnyVersion, []StoredEvent{stored})
+		assert.NoError(t, err)
+		return event
+	}
+
+	subscription := func(id string, userID string, url string, eventTypes ...string) *domain.WebhookSubscription {
+		return &domain.WebhookSubscription{ID: id, UserID: userID, URL: url, EventTypes: eventTypes, Secret: "secret", CreatedAt: start}
+	}
+
+	t.Run("Events are delivered signed to the owner's subscriptions", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret")
+		notifier, deliverer, repo, _ := setup(t,
+			subscription("webhook-1", "owner", receiver.URL, "PortfolioRenamed"),
+			subscription("webhook-2", "owner", receiver.URL, "PortfolioArchived"),
+			subscription("webhook-3", "someone-else", receiver.URL, "PortfolioRenamed"),
+		)
+
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Savings", start))))
+		assert.Len(t, repo.deliveries, 1)
+
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, succeeded)
+		assert.Zero(t, receiver.invalid)
+		if assert.Len(t, receiver.received, 1) {
+			payload := receiver.received[0]
+			assert.Equal(t, "PortfolioRenamed", payload.EventType)
+			assert.Equal(t, "portfolio-1", payload.AggregateID)
+			assert.JSONEq(t, `{"portfolio_id":"portfolio-1","name":"Savings","occurred_at":"2024-01-01T00:00:00Z"}`, string(payload.Data))
+
+			delivery := repo.deliveries[payload.ID]
+			assert.Equal(t, domain.WebhookDeliverySucceeded, delivery.Status)
+			assert.Equal(t, http.StatusNoContent, delivery.ResponseStatus)
+			assert.Equal(t, 1, delivery.Attempts)
+		}
+	})
+
+	t.Run("Notifying an event again does not create another delivery", func(t *testing.T) {
+		// 他の購読者の失敗でアウトボックスが同じイベントを再び通知することがある
+		notifier, _, repo, now := setup(t, subscription("webhook-1", "owner", "https://example.com/hooks", "PortfolioRenamed"))
+		event := record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Savings", start))
+
+		assert.NoError(t, notifier.Notify(ctx, event))
+		*now = now.Add(time.Minute)
+		assert.NoError(t, notifier.Notify(ctx, event))
+		first := onlyDelivery(t, repo)
+		assert.Equal(t, start, first.CreatedAt)
+
+		// 別のイベントは別に配信する
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Old savings", start))))
+		assert.Len(t, repo.deliveries, 2)
+	})
+
+	t.Run("Failures are retried with exponential backoff", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret")
+		receiver.statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+		notifier, deliverer, repo, now := setup(t, subscription("webhook-1", "owner", receiver.URL, "PortfolioArchived"))
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioArchivedEvent(portfolioID, start))))
+
+		_, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		delivery := onlyDelivery(t, repo)
+		assert.Equal(t, domain.WebhookDeliveryPending, delivery.Status)
+		assert.Equal(t, 1, delivery.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, delivery.ResponseStatus)
+		assert.Contains(t, delivery.LastError, "500")
+		assert.Equal(t, start.Add(time.Minute), delivery.NextAttemptAt)
+
+		// 待ち時間が過ぎるまでは再試行しない
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, succeeded)
+		assert.Equal(t, 1, onlyDelivery(t, repo).Attempts)
+
+		*now = start.Add(time.Minute)
+		_, err = deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, now.Add(2*time.Minute), onlyDelivery(t, repo).NextAttemptAt)
+
+		*now = now.Add(2 * time.Minute)
+		succeeded, err = deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, succeeded)
+		delivery = onlyDelivery(t, repo)
+		assert.Equal(t, domain.WebhookDeliverySucceeded, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+		assert.Empty(t, delivery.LastError)
+	})
+
+	t.Run("Deliveries that keep failing are given up and can be redelivered", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "secret")
+		receiver.statuses = []int{500, 500, 500}
+		notifier, deliverer, repo, now := setup(t, subscription("webhook-1", "owner", receiver.URL, "PortfolioDeleted"))
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioDeletedEvent(portfolioID, start))))
+
+		for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+			_, err := deliverer.Deliver(ctx)
+			assert.NoError(t, err)
+			*now = now.Add(time.Hour)
+		}
+		delivery := onlyDelivery(t, repo)
+		assert.Equal(t, domain.WebhookDeliveryFailed, delivery.Status)
+		assert.Equal(t, 3, delivery.Attempts)
+
+		delivery.Redeliver(*now)
+		assert.NoError(t, repo.UpdateDelivery(ctx, &delivery))
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, succeeded)
+		assert.Len(t, receiver.received, 1)
+		assert.Equal(t, delivery.ID, receiver.received[0].ID)
+	})
+
+	t.Run("Deliveries of deleted subscriptions are given up, other lookup errors are returned", func(t *testing.T) {
+		notifier, deliverer, repo, _ := setup(t, subscription("webhook-1", "owner", "https://example.com/hooks", "PortfolioRenamed"))
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Savings", start))))
+
+		// 一時的な失敗では配信を諦めない
+		repo.findErr = errors.New("database is locked")
+		_, err := deliverer.Deliver(ctx)
+		assert.ErrorIs(t, err, repo.findErr)
+		assert.Equal(t, domain.WebhookDeliveryPending, onlyDelivery(t, repo).Status)
+
+		repo.findErr = nil
+		delete(repo.subscriptions, "webhook-1")
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, succeeded)
+		delivery := onlyDelivery(t, repo)
+		assert.Equal(t, domain.WebhookDeliveryFailed, delivery.Status)
+		assert.Equal(t, "subscription was deleted", delivery.LastError)
+	})
+
+	t.Run("A wrong secret is rejected by the receiver", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, "another secret")
+		notifier, deliverer, repo, _ := setup(t, subscription("webhook-1", "owner", receiver.URL, "PortfolioRenamed"))
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Savings", start))))
+
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, succeeded)
+		assert.Equal(t, 1, receiver.invalid)
+		assert.Equal(t, http.StatusUnauthorized, onlyDelivery(t, repo).ResponseStatus)
+	})
+
+	t.Run("The default client refuses internal addresses when connecting", func(t *testing.T) {
+		// 登録時に公開のホストでも、名前解決の結果が内部のアドレスなら送らない
+		receiver := newWebhookReceiver(t, "secret")
+		notifier, _, repo, _ := setup(t, subscription("webhook-1", "owner", receiver.URL, "PortfolioRenamed"))
+		deliverer := NewWebhookDeliverer(repo, nil, policy)
+		deliverer.now = func() time.Time { return start }
+		assert.NoError(t, notifier.Notify(ctx, record(t, notifier, domain.NewPortfolioRenamedEvent(portfolioID, "Savings", start))))
+
+		succeeded, err := deliverer.Deliver(ctx)
+		assert.NoError(t, err)
+		assert.Zero(t, succeeded)
+		assert.Empty(t, receiver.received)
+		assert.Contains(t, onlyDelivery(t, repo).LastError, ErrWebhookAddressNotAllowed.Error())
+	})
+}
+
+func onlyDelivery(t *testing.T, repo *mockWebhookRepository) domain.WebhookDelivery {
+	t.Helper()
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(repo.deliveries))
+	}
+	for _, delivery := range repo.deliveries {
+		return delivery
+	}
+	return domain.WebhookDelivery{}
+}
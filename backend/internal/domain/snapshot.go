@@ -0,0 +1,164 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PortfolioSnapshotSchema identifies the layout of portfolio snapshots. It
+// is derived from the snapshot payload type, so any change to the payload
+// changes it and makes older snapshots unusable.
+var PortfolioSnapshotSchema = schemaHash(reflect.TypeOf(portfolioSnapshot{}))
+
+// portfolioSnapshot is the JSON form of the state of a portfolio.
+type portfolioSnapshot struct {
+	PortfolioID      string                    `json:"portfolio_id"`
+	UserID           string                    `json:"user_id"`
+	Name             string                    `json:"name"`
+	ArchivedAt       *time.Time                `json:"archived_at"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+	Investments      []investmentSnapshot      `json:"investments"`
+	CashTransactions []cashTransactionSnapshot `json:"cash_transactions"`
+}
+
+type investmentSnapshot struct {
+	ID        string             `json:"id"`
+	Amount    moneyPayload       `json:"amount"`
+	Type      InvestmentType     `json:"type"`
+	Strategy  InvestmentStrategy `json:"strategy"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type cashTransactionSnapshot struct {
+	ID           string              `json:"id"`
+	Type         CashTransactionType `json:"type"`
+	Amount       moneyPayload        `json:"amount"`
+	InvestmentID string              `json:"investment_id,omitempty"`
+	OccurredAt   time.Time           `json:"occurred_at"`
+}
+
+// Snapshot returns the state of the portfolio as JSON, to be restored with
+// RestorePortfolio. Versions and unpublished events are not part of it.
+func (p *Portfolio) Snapshot() ([]byte, error) {
+	snapshot := portfolioSnapshot{
+		PortfolioID:      p.id.Value,
+		UserID:           p.UserID,
+		Name:             p.Name,
+		ArchivedAt:       p.ArchivedAt,
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
+		Investments:      make([]investmentSnapshot, 0, len(p.Investments)),
+		CashTransactions: make([]cashTransactionSnapshot, 0, len(p.CashTransactions)),
+	}
+
+	for _, investment := range p.Investments {
+		snapshot.Investments = append(snapshot.Investments, investmentSnapshot{
+			ID:        investment.ID().Value,
+			Amount:    newMoneyPayload(investment.Amount()),
+			Type:      investment.Type(),
+			Strategy:  investment.Strategy(),
+			CreatedAt: investment.CreatedAt,
+			UpdatedAt: investment.UpdatedAt,
+		})
+	}
+	sort.Slice(snapshot.Investments, func(i, j int) bool {
+		return snapshot.Investments[i].ID < snapshot.Investments[j].ID
+	})
+
+	for _, tx := range p.CashTransactions {
+		snapshot.CashTransactions = append(snapshot.CashTransactions, cashTransactionSnapshot{
+			ID:           tx.ID,
+			Type:         tx.Type,
+			Amount:       newMoneyPayload(tx.Amount),
+			InvestmentID: tx.InvestmentID.Value,
+			OccurredAt:   tx.OccurredAt,
+		})
+	}
+
+	return json.Marshal(snapshot)
+}
+
+// RestorePortfolio rebuilds a portfolio from a snapshot and the events that
+// followed it. Like RebuildPortfolio it yields ErrPortfolioNotFound when the
+// events end with the deletion of the portfolio.
+func RestorePortfolio(snapshot []byte, events []DomainEvent) (*Portfolio, error) {
+	var payload portfolioSnapshot
+	if err := json.Unmarshal(snapshot, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEventStream, err)
+	}
+
+	p := &Portfolio{
+		id:          NewPortfolioID(payload.PortfolioID),
+		UserID:      payload.UserID,
+		Name:        payload.Name,
+		Investments: make(map[InvestmentID]*Investment, len(payload.Investments)),
+		ArchivedAt:  payload.ArchivedAt,
+		CreatedAt:   payload.CreatedAt,
+		UpdatedAt:   payload.UpdatedAt,
+	}
+	for _, investment := range payload.Investments {
+		id := NewInvestmentID(investment.ID)
+		p.Investments[id] = ReconstituteInvestment(
+			id,
+			investment.Amount.money(),
+			investment.Type,
+			investment.Strategy,
+			0,
+			investment.CreatedAt,
+			investment.UpdatedAt,
+		)
+	}
+	for _, tx := range payload.CashTransactions {
+		p.CashTransactions = append(p.CashTransactions, &CashTransaction{
+			ID:           tx.ID,
+			Type:         tx.Type,
+			Amount:       tx.Amount.money(),
+			InvestmentID: NewInvestmentID(tx.InvestmentID),
+			OccurredAt:   tx.OccurredAt,
+		})
+	}
+
+	if err := p.applyStream(events); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// schemaHash fingerprints the shape of a type: field names, JSON tags and
+// kinds, recursively.
+func schemaHash(t reflect.Type) string {
+	sum := sha256.Sum256([]byte(describeType(t)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func describeType(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "time"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + describeType(t.Elem())
+	case reflect.Slice:
+		return "[]" + describeType(t.Elem())
+	case reflect.Map:
+		return "map[" + describeType(t.Key()) + "]" + describeType(t.Elem())
+	case reflect.Struct:
+		fields := make([]string, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fields = append(fields, field.Name+" "+describeType(field.Type)+" "+string(field.Tag))
+		}
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	default:
+		return t.Kind().String()
+	}
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRestorePortfolio(t *testing.T) {
+	portfolio := NewPortfolio(NewPortfolioID("test-portfolio"), "test-user")
+	portfolio.Rename("Savings")
+
+	deposit, _ := NewCashTransaction("cash-1", CashDeposit, Money{Amount: 5000, Currency: "JPY"}, InvestmentID{})
+	portfolio.RecordCashTransaction(deposit)
+	stock, _ := NewInvestment(NewInvestmentID("inv-1"), Money{Amount: 1000, Currency: "JPY"}, Stock, Moderate)
+	bond, _ := NewInvestment(NewInvestmentID("inv-2"), Money{Amount: 2000, Currency: "JPY"}, Bond, Conservative)
+	portfolio.AddInvestment(stock)
+	portfolio.AddInvestment(bond)
+
+	snapshot, err := portfolio.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	taken := len(portfolio.Events())
+
+	// スナップショット以降の変更
+	portfolio.UpdateInvestmentAmount(stock.ID(), Money{Amount: 1500, Currency: "JPY"})
+	portfolio.RemoveInvestment(bond.ID())
+	portfolio.Archive()
+	tail := portfolio.Events()[taken:]
+
+	restored, err := RestorePortfolio(snapshot, tail)
+	if err != nil {
+		t.Fatalf("RestorePortfolio failed: %v", err)
+	}
+	rebuilt, err := RebuildPortfolio(portfolio.Events())
+	if err != nil {
+		t.Fatalf("RebuildPortfolio failed: %v", err)
+	}
+
+	// スナップショットからの復元と全件の再生は同じ状態になる
+	want, _ := rebuilt.Snapshot()
+	got, _ := restored.Snapshot()
+	if string(got) != string(want) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if restored.Name != "Savings" || restored.ArchivedAt == nil || len(restored.Investments) != 1 {
+		t.Errorf("Unexpected restored portfolio %+v", restored)
+	}
+	if len(restored.Events()) != 0 {
+		t.Error("A restored portfolio should have no new events")
+	}
+
+	portfolio.RemoveInvestment(stock.ID())
+	portfolio.Delete()
+	if _, err := RestorePortfolio(snapshot, portfolio.Events()[taken:]); err != ErrPortfolioNotFound {
+		t.Errorf("Expected ErrPortfolioNotFound for a deleted portfolio, got %v", err)
+	}
+
+	if _, err := RestorePortfolio([]byte("{"), nil); err == nil {
+		t.Error("Expected an error for a broken snapshot")
+	}
+}
+
+func TestSchemaHash(t *testing.T) {
+	type v1 struct {
+		Name string `json:"name"`
+	}
+	type renamed struct {
+		Name string `json:"title"`
+	}
+	type added struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	hash := schemaHash(reflect.TypeOf(v1{}))
+	if hash != schemaHash(reflect.TypeOf(v1{})) {
+		t.Error("The hash of a type should be stable")
+	}
+	if hash == schemaHash(reflect.TypeOf(renamed{})) || hash == schemaHash(reflect.TypeOf(added{})) {
+		t.Error("Changing the fields should change the hash")
+	}
+	if len(PortfolioSnapshotSchema) != 16 {
+		t.Errorf("Unexpected schema hash %q", PortfolioSnapshotSchema)
+	}
+}
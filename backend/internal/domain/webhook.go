@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebhookSubscription asks for the events of a user's portfolios to be
+// posted to a URL. The body of every request is signed with the secret.
+// Only the portfolios the user created are covered; members of a shared
+// portfolio, even those with PermissionManage, get no webhooks for it.
+type WebhookSubscription struct {
+	ID         string
+	UserID     string
+	URL        string
+	EventTypes []string
+	Secret     string
+	CreatedAt  time.Time
+}
+
+func NewWebhookSubscription(id string, userID string, rawURL string, eventTypes []string, secret string) (*WebhookSubscription, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return nil, ErrInvalidWebhookURL
+	}
+	// 内部のサービスに送らせない（名前解決後の宛先は送信時に確かめる）
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, ErrInvalidWebhookURL
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicWebhookIP(ip) {
+		return nil, ErrInvalidWebhookURL
+	}
+
+	// 重複を除き、指定された順序を保つ
+	seen := make(map[string]bool)
+	var types []string
+	for _, eventType := range eventTypes {
+		eventType = strings.TrimSpace(eventType)
+		if eventType == "" {
+			return nil, ErrInvalidWebhookEventType
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			types = append(types, eventType)
+		}
+	}
+	if len(types) == 0 {
+		return nil, ErrInvalidWebhookEventType
+	}
+
+	if secret == "" {
+		return nil, ErrInvalidWebhookSecret
+	}
+
+	return &WebhookSubscription{
+		ID:         id,
+		UserID:     userID,
+		URL:        rawURL,
+		EventTypes: types,
+		Secret:     secret,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// IsPublicWebhookIP reports whether webhooks may be posted to the address.
+// Loopback, private, link-local, multicast and unspecified addresses reach
+// the server's own network and are refused.
+func IsPublicWebhookIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 0 {
+		return false // 0.0.0.0/8 は自ホストを指す
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// Accepts reports whether events of the type are delivered to the subscription.
+func (s *WebhookSubscription) Accepts(eventType string) bool {
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "PENDING"   // 配信待ち（再試行待ちを含む）
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "SUCCEEDED" // 2xxの応答を受けた
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "FAILED"    // 再試行を諦めた
+)
+
+// WebhookDelivery is one event posted to a subscription, and the log of the
+// attempts so far.
+type WebhookDelivery struct {
+	ID             string
+	SubscriptionID string
+	EventType      string
+	Payload        []byte // 送信するJSON（再配信でも同じ内容を送る）
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	ResponseStatus int // 最後の応答のステータス（応答がなければ0）
+	LastError      string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+func NewWebhookDelivery(id string, subscriptionID string, eventType string, payload []byte, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:             id,
+		SubscriptionID: subscriptionID,
+		EventType:      eventType,
+		Payload:        payload,
+		Status:         WebhookDeliveryPending,
+		NextAttemptAt:  now,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// Succeed records an attempt answered with a 2xx status.
+func (d *WebhookDelivery) Succeed(responseStatus int, at time.Time) {
+	d.Attempts++
+	d.Status = WebhookDeliverySucceeded
+	d.ResponseStatus = responseStatus
+	d.LastError = ""
+	d.UpdatedAt = at
+	d.DeliveredAt = &at
+}
+
+// Fail records a failed attempt. The delivery is retried at retryAt, or
+// given up when retryAt is nil.
+func (d *WebhookDelivery) Fail(responseStatus int, reason string, retryAt *time.Time, at time.Time) {
+	d.Attempts++
+	d.ResponseStatus = responseStatus
+	d.LastError = reason
+	d.UpdatedAt = at
+	if retryAt == nil {
+		d.Status = WebhookDeliveryFailed
+		return
+	}
+	d.NextAttemptAt = *retryAt
+}
+
+// Redeliver queues the delivery again with a fresh set of attempts.
+func (d *WebhookDelivery) Redeliver(at time.Time) {
+	d.Status = WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = at
+	d.UpdatedAt = at
+}
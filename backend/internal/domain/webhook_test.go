@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewWebhookSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		eventTypes []string
+		secret     string
+		want       error
+	}{
+		{"valid", "https://example.com/hooks", []string{"PortfolioCreated"}, "secret", nil},
+		{"relative URL", "/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"other scheme", "ftp://example.com", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"public address", "http://93.184.216.34:8080/hooks", []string{"PortfolioCreated"}, "secret", nil},
+		{"localhost", "http://localhost:8080/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"localhost subdomain", "http://api.localhost./hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"loopback", "http://127.0.0.1/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"IPv6 loopback", "http://[::1]/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"private", "http://10.0.0.5/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"private 192.168", "http://192.168.1.1/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"metadata service", "http://169.254.169.254/latest/meta-data", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"unspecified", "http://0.0.0.0/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"IPv4-mapped loopback", "http://[::ffff:127.0.0.1]/hooks", []string{"PortfolioCreated"}, "secret", ErrInvalidWebhookURL},
+		{"no event types", "https://example.com", nil, "secret", ErrInvalidWebhookEventType},
+		{"blank event type", "https://example.com", []string{" "}, "secret", ErrInvalidWebhookEventType},
+		{"no secret", "https://example.com", []string{"PortfolioCreated"}, "", ErrInvalidWebhookSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebhookSubscription("id", "user", tt.url, tt.eventTypes, tt.secret); err != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	subscription, err := NewWebhookSubscription("id", "user", " https://example.com ", []string{"PortfolioCreated", "PortfolioCreated", "PortfolioDeleted"}, "secret")
+	if err != nil {
+		t.Fatalf("NewWebhookSubscription failed: %v", err)
+	}
+	if subscription.URL != "https://example.com" || !reflect.DeepEqual(subscription.EventTypes, []string{"PortfolioCreated", "PortfolioDeleted"}) {
+		t.Errorf("Unexpected subscription %+v", subscription)
+	}
+	if !subscription.Accepts("PortfolioDeleted") || subscription.Accepts("PortfolioRenamed") {
+		t.Errorf("Expected only the subscribed event types to be accepted")
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	delivery := NewWebhookDelivery("delivery", "webhook", "PortfolioCreated", []byte(`{}`), start)
+
+	retryAt := start.Add(time.Minute)
+	delivery.Fail(500, "server error", &retryAt, start)
+	if delivery.Status != WebhookDeliveryPending || delivery.Attempts != 1 || !delivery.NextAttemptAt.Equal(retryAt) {
+		t.Errorf("Expected a retry to be scheduled, got %+v", delivery)
+	}
+
+	delivery.Fail(0, "connection refused", nil, retryAt)
+	if delivery.Status != WebhookDeliveryFailed || delivery.Attempts != 2 || delivery.ResponseStatus != 0 {
+		t.Errorf("Expected the delivery to be given up, got %+v", delivery)
+	}
+
+	later := start.Add(time.Hour)
+	delivery.Redeliver(later)
+	if delivery.Status != WebhookDeliveryPending || delivery.Attempts != 0 || !delivery.NextAttemptAt.Equal(later) {
+		t.Errorf("Expected the delivery to be queued again, got %+v", delivery)
+	}
+
+	delivery.Succeed(200, later)
+	if delivery.Status != WebhookDeliverySucceeded || delivery.DeliveredAt == nil || delivery.LastError != "" {
+		t.Errorf("Expected the delivery to succeed, got %+v", delivery)
+	}
+}
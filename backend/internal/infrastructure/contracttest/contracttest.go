@@ -0,0 +1,1291 @@
+// Package contracttest is the behaviour every repository backend must share.
+// Each backend runs it from its own tests with a factory for an empty store:
+//
+//	contracttest.Run(t, func(t *testing.T) contracttest.Store { ... })
+package contracttest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Store is the set of repositories provided by a backend.
+type Store struct {
+	Users       domain.UserRepository
+	Investments domain.InvestmentRepository
+	Portfolios  domain.PortfolioRepository
+	Memberships domain.MembershipRepository
+	TxManager   domain.TransactionManager
+	Events      service.EventStoreDB
+	Snapshots   service.SnapshotStoreDB
+	Outbox      service.OutboxStoreDB
+	Webhooks    domain.WebhookRepository
+}
+
+// Run runs the contract against stores returned by newStore. Every subtest
+// gets a new, empty store.
+func Run(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Store)
+	}{
+		{"Users", testUsers},
+		{"Investments", testInvestments},
+		{"InvestmentOptimisticLocking", testInvestmentOptimisticLocking},
+		{"InvestmentQuery", testInvestmentQuery},
+		{"Portfolios", testPortfolios},
+		{"PortfolioDeleteRemovesMemberships", testPortfolioDeleteRemovesMemberships},
+		{"PortfolioRoundTrip", testPortfolioRoundTrip},
+		{"PortfolioBatchLoading", testPortfolioBatchLoading},
+		{"PortfolioOptimisticLocking", testPortfolioOptimisticLocking},
+		{"PortfolioUniqueNames", testPortfolioUniqueNames},
+		{"Memberships", testMemberships},
+		{"TransactionRollback", testTransactionRollback},
+		{"NestedTransaction", testNestedTransaction},
+		{"Events", testEvents},
+		{"EventExpectedVersion", testEventExpectedVersion},
+		{"EventsInTransaction", testEventsInTransaction},
+		{"EventQuery", testEventQuery},
+		{"Snapshots", testSnapshots},
+		{"Outbox", testOutbox},
+		{"OutboxInTransaction", testOutboxInTransaction},
+		{"Webhooks", testWebhooks},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// 時刻はバックエンドの精度（PostgreSQLはマイクロ秒）に揃えておく
+var (
+	createdAt = time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	updatedAt = time.Date(2023, 6, 7, 8, 9, 10, 0, time.UTC)
+)
+
+func isNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) || errors.Is(err, domain.ErrNotFound)
+}
+
+func createUser(t *testing.T, s Store, email string) *domain.User {
+	t.Helper()
+
+	user := &domain.User{Name: "Test User", Email: email, Password: "hashed"}
+	if err := s.Users.Create(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return user
+}
+
+func newInvestment(id string, amount float64) *domain.Investment {
+	return domain.ReconstituteInvestment(
+		domain.NewInvestmentID(id),
+		domain.Money{Amount: amount, Currency: "JPY"},
+		domain.Stock,
+		domain.Conservative,
+		0,
+		createdAt,
+		updatedAt,
+	)
+}
+
+// createPortfolio stores a portfolio owned by userID holding the given investments.
+func createPortfolio(t *testing.T, s Store, id string, userID string, investments ...*domain.Investment) *domain.Portfolio {
+	t.Helper()
+	ctx := context.Background()
+
+	for _, investment := range investments {
+		if err := s.Investments.Create(ctx, investment); err != nil {
+			t.Fatalf("Failed to create investment: %v", err)
+		}
+	}
+
+	portfolio := domain.ReconstitutePortfolio(domain.PortfolioState{
+		ID:          domain.NewPortfolioID(id),
+		UserID:      userID,
+		Name:        id, // 同じユーザーのポートフォリオ名は一意
+		Investments: investments,
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
+	})
+	if err := s.Portfolios.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to create portfolio: %v", err)
+	}
+	return portfolio
+}
+
+func testUsers(t *testing.T, s Store) {
+	user := createUser(t, s, "user@example.com")
+	if user.ID == "" {
+		t.Fatal("Expected Create to assign an ID")
+	}
+
+	found, err := s.Users.FindByID(user.ID)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if found.Email != "user@example.com" || found.Password != "hashed" {
+		t.Errorf("Unexpected user %+v", found)
+	}
+
+	found.Name = "Renamed"
+	if err := s.Users.Update(found); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	byEmail, err := s.Users.FindByEmail("user@example.com")
+	if err != nil {
+		t.Fatalf("FindByEmail failed: %v", err)
+	}
+	if byEmail.ID != user.ID || byEmail.Name != "Renamed" {
+		t.Errorf("Unexpected user %+v", byEmail)
+	}
+
+	if err := s.Users.Create(&domain.User{Name: "Other", Email: "user@example.com", Password: "x"}); err == nil {
+		t.Error("Expected duplicate email to be rejected")
+	}
+
+	if err := s.Users.Delete(user.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Users.FindByID(user.ID); !isNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+	if _, err := s.Users.FindByEmail("missing@example.com"); !isNotFound(err) {
+		t.Errorf("Expected not found for unknown email, got %v", err)
+	}
+	if err := s.Users.Delete(user.ID); !isNotFound(err) {
+		t.Errorf("Expected not found deleting twice, got %v", err)
+	}
+	if err := s.Users.Update(user); !isNotFound(err) {
+		t.Errorf("Expected not found updating a deleted user, got %v", err)
+	}
+}
+
+func testInvestments(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "owner@example.com")
+
+	investment := domain.ReconstituteInvestment(
+		domain.NewInvestmentID("inv-1"),
+		domain.Money{Amount: 1234.5, Currency: "USD"},
+		domain.RealEstate,
+		domain.Aggressive,
+		0,
+		createdAt,
+		updatedAt,
+	)
+	other := newInvestment("inv-2", 500)
+	createPortfolio(t, s, "portfolio-1", user.ID, investment)
+	if err := s.Investments.Save(ctx, other); err != nil {
+		t.Fatalf("Save of a new investment failed: %v", err)
+	}
+
+	found, err := s.Investments.FindByID(ctx, investment.ID())
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if found.Amount() != investment.Amount() || found.Type() != domain.RealEstate || found.Strategy() != domain.Aggressive {
+		t.Errorf("Unexpected investment %+v", found)
+	}
+	if found.Version != 1 {
+		t.Errorf("Expected version 1, got %d", found.Version)
+	}
+	if !found.CreatedAt.Equal(createdAt) || !found.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected timestamps %v/%v, got %v/%v", createdAt, updatedAt, found.CreatedAt, found.UpdatedAt)
+	}
+
+	byPortfolio, err := s.Investments.FindAllByPortfolioID(ctx, domain.NewPortfolioID("portfolio-1"))
+	if err != nil {
+		t.Fatalf("FindAllByPortfolioID failed: %v", err)
+	}
+	if len(byPortfolio) != 1 || byPortfolio[0].ID() != investment.ID() {
+		t.Errorf("Expected only %s in portfolio, got %v", investment.ID().Value, byPortfolio)
+	}
+
+	all, err := s.Investments.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("Expected 2 investments, got %d", len(all))
+	}
+
+	if err := s.Investments.Delete(ctx, other.ID()); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Investments.FindByID(ctx, other.ID()); !isNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+}
+
+func testInvestmentOptimisticLocking(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	investment := newInvestment("inv-1", 1000)
+	if err := s.Investments.Create(ctx, investment); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	first, _ := s.Investments.FindByID(ctx, investment.ID())
+	second, _ := s.Investments.FindByID(ctx, investment.ID())
+
+	if err := s.Investments.Save(ctx, first); err != nil {
+		t.Fatalf("Save of current copy failed: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2 after save, got %d", first.Version)
+	}
+	if err := s.Investments.Save(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification, got %v", err)
+	}
+}
+
+func testInvestmentQuery(t *testing.T, s Store) {
+	ctx := context.Background()
+	user := createUser(t, s, "owner@example.com")
+
+	// 異なるタイムゾーンで記録された日時も時系列で並ぶ
+	jst := time.FixedZone("JST", 9*60*60)
+	investment := func(id string, amount float64, currency string, kind domain.InvestmentType, strategy domain.InvestmentStrategy, at time.Time) *domain.Investment {
+		return domain.ReconstituteInvestment(domain.NewInvestmentID(id), domain.Money{Amount: amount, Currency: currency}, kind, strategy, 0, at, at)
+	}
+	first := createPortfolio(t, s, "portfolio-1", user.ID,
+		investment("inv-a", 1000, "JPY", domain.Stock, domain.Conservative, createdAt),
+		investment("inv-b", 3000, "JPY", domain.Bond, domain.Moderate, createdAt.Add(time.Hour).In(jst)),
+		investment("inv-c", 2000, "USD", domain.Stock, domain.Aggressive, createdAt.Add(2*time.Hour)),
+	)
+	second := createPortfolio(t, s, "portfolio-2", user.ID,
+		investment("inv-d", 2000, "JPY", domain.RealEstate, domain.Moderate, createdAt.Add(3*time.Hour).In(jst)),
+		investment("inv-e", 500, "JPY", domain.Stock, domain.Moderate, createdAt),
+	)
+
+	from, to := createdAt.Add(time.Hour), createdAt.Add(3*time.Hour)
+	minAmount, maxAmount := 1000.0, 2000.0
+
+	tests := []struct {
+		name  string
+		query domain.InvestmentQuery
+		want  []string
+	}{
+		{"CreatedAtAscending", domain.InvestmentQuery{}, []string{"inv-a", "inv-e", "inv-b", "inv-c", "inv-d"}},
+		{"CreatedAtDescending", domain.InvestmentQuery{Descending: true}, []string{"inv-d", "inv-c", "inv-b", "inv-e", "inv-a"}},
+		{"AmountAscending", domain.InvestmentQuery{SortBy: domain.SortInvestmentsByAmount}, []string{"inv-e", "inv-a", "inv-c", "inv-d", "inv-b"}},
+		{"AmountDescending", domain.InvestmentQuery{SortBy: domain.SortInvestmentsByAmount, Descending: true}, []string{"inv-b", "inv-d", "inv-c", "inv-a", "inv-e"}},
+		{"Type", domain.InvestmentQuery{Types: []domain.InvestmentType{domain.Stock}}, []string{"inv-a", "inv-e", "inv-c"}},
+		{"TypeAndStrategy", domain.InvestmentQuery{Types: []domain.InvestmentType{domain.Stock, domain.Bond}, Strategies: []domain.InvestmentStrategy{domain.Moderate}}, []string{"inv-e", "inv-b"}},
+		{"Currency", domain.InvestmentQuery{Currency: "USD"}, []string{"inv-c"}},
+		{"AmountRange", domain.InvestmentQuery{MinAmount: &minAmount, MaxAmount: &maxAmount}, []string{"inv-a", "inv-c", "inv-d"}},
+		{"CreatedRange", domain.InvestmentQuery{CreatedFrom: &from, CreatedTo: &to}, []string{"inv-b", "inv-c"}},
+		{"Portfolio", domain.InvestmentQuery{PortfolioIDs: []domain.PortfolioID{second.ID()}}, []string{"inv-e", "inv-d"}},
+		{"Portfolios", domain.InvestmentQuery{PortfolioIDs: []domain.PortfolioID{first.ID(), second.ID()}, Currency: "JPY"}, []string{"inv-a", "inv-e", "inv-b", "inv-d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 2件ずつのページをたどって全件を集める
+			query := tt.query
+			query.Limit = 2
+
+			var got []string
+			for pages := 0; ; pages++ {
+				if pages > len(tt.want) {
+					t.Fatalf("Too many pages, got %v so far", got)
+				}
+				page, err := s.Investments.Find(ctx, query)
+				if err != nil {
+					t.Fatalf("Find failed: %v", err)
+				}
+				if len(page.Investments) > query.Limit {
+					t.Fatalf("Expected at most %d investments per page, got %d", query.Limit, len(page.Investments))
+				}
+				for _, investment := range page.Investments {
+					got = append(got, investment.ID().Value)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	page, err := s.Investments.Find(ctx, domain.InvestmentQuery{Limit: 5})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if len(page.Investments) != 5 || page.NextCursor != "" {
+		t.Errorf("Expected a single full page, got %d investments and cursor %q", len(page.Investments), page.NextCursor)
+	}
+	if !page.Investments[2].CreatedAt.Equal(createdAt.Add(time.Hour)) {
+		t.Errorf("Expected created at %v, got %v", createdAt.Add(time.Hour), page.Investments[2].CreatedAt)
+	}
+
+	// 別の並び順のカーソルは使えない
+	page, err = s.Investments.Find(ctx, domain.InvestmentQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if _, err := s.Investments.Find(ctx, domain.InvestmentQuery{SortBy: domain.SortInvestmentsByAmount, Cursor: page.NextCursor}); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a cursor of another order, got %v", err)
+	}
+	if _, err := s.Investments.Find(ctx, domain.InvestmentQuery{Cursor: "not a cursor"}); !errors.Is(err, domain.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func testPortfolios(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	other := createUser(t, s, "other@example.com")
+
+	investment := newInvestment("inv-1", 1000)
+	portfolio := createPortfolio(t, s, "portfolio-1", owner.ID, investment)
+	createPortfolio(t, s, "portfolio-2", owner.ID)
+	createPortfolio(t, s, "portfolio-3", other.ID)
+
+	if portfolio.Version != 1 {
+		t.Errorf("Expected version 1 after create, got %d", portfolio.Version)
+	}
+
+	owned, err := s.Portfolios.FindByUserID(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("FindByUserID failed: %v", err)
+	}
+	if len(owned) != 2 {
+		t.Errorf("Expected 2 portfolios for owner, got %d", len(owned))
+	}
+
+	byInvestment, err := s.Portfolios.FindByInvestmentID(ctx, investment.ID())
+	if err != nil {
+		t.Fatalf("FindByInvestmentID failed: %v", err)
+	}
+	if byInvestment.ID() != portfolio.ID() {
+		t.Errorf("Expected %s, got %s", portfolio.ID().Value, byInvestment.ID().Value)
+	}
+	if _, err := s.Portfolios.FindByInvestmentID(ctx, domain.NewInvestmentID("missing")); !isNotFound(err) {
+		t.Errorf("Expected not found for unknown investment, got %v", err)
+	}
+
+	// 投資の入れ替えと名前の変更
+	added := newInvestment("inv-2", 2000)
+	if err := s.Investments.Create(ctx, added); err != nil {
+		t.Fatalf("Failed to create investment: %v", err)
+	}
+	if err := byInvestment.RemoveInvestment(investment.ID()); err != nil {
+		t.Fatalf("RemoveInvestment failed: %v", err)
+	}
+	if err := byInvestment.AddInvestment(added); err != nil {
+		t.Fatalf("AddInvestment failed: %v", err)
+	}
+	byInvestment.Rename("Renamed")
+	if err := s.Portfolios.Save(ctx, byInvestment); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	reloaded, err := s.Portfolios.FindByID(ctx, portfolio.ID())
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	investments := reloaded.GetInvestments()
+	if len(investments) != 1 || investments[0].ID() != added.ID() {
+		t.Errorf("Expected only %s after save, got %v", added.ID().Value, investments)
+	}
+	if reloaded.Name != "Renamed" || reloaded.Version != 2 {
+		t.Errorf("Expected Renamed at version 2, got %q at version %d", reloaded.Name, reloaded.Version)
+	}
+
+	// 読み込んだ後に保存された版は削除できない
+	if err := s.Portfolios.Delete(ctx, portfolio); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification deleting a stale portfolio, got %v", err)
+	}
+	if err := s.Portfolios.Delete(ctx, reloaded); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Portfolios.FindByID(ctx, portfolio.ID()); !isNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+	if _, err := s.Portfolios.FindByInvestmentID(ctx, added.ID()); !isNotFound(err) {
+		t.Errorf("Expected investment to be unlinked after delete, got %v", err)
+	}
+}
+
+func testPortfolioDeleteRemovesMemberships(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	portfolio := createPortfolio(t, s, "portfolio-1", owner.ID)
+
+	invitation, err := domain.NewPortfolioInvitation("membership-1", portfolio.ID(), "spouse@example.com", domain.RoleViewer, owner.ID)
+	if err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if err := s.Memberships.Save(ctx, invitation); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if err := s.Portfolios.Delete(ctx, portfolio); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Memberships.FindByID(ctx, invitation.ID); !isNotFound(err) {
+		t.Errorf("Expected membership to be deleted with the portfolio, got %v", err)
+	}
+}
+
+func testPortfolioRoundTrip(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+
+	archivedAt := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	occurredAt := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	// 現在の上限を超える、アーカイブ済みのポートフォリオも復元できる
+	investments := []*domain.Investment{newInvestment("inv-1", 8000000), newInvestment("inv-2", 7000000)}
+	for _, investment := range investments {
+		if err := s.Investments.Create(ctx, investment); err != nil {
+			t.Fatalf("Failed to create investment: %v", err)
+		}
+	}
+
+	portfolio := domain.ReconstitutePortfolio(domain.PortfolioState{
+		ID:          domain.NewPortfolioID("portfolio-1"),
+		UserID:      owner.ID,
+		Name:        "Legacy",
+		Investments: investments,
+		CashTransactions: []*domain.CashTransaction{
+			{ID: "cash-1", Type: domain.CashDeposit, Amount: domain.Money{Amount: 500, Currency: "JPY"}, OccurredAt: occurredAt},
+			{ID: "cash-2", Type: domain.CashDividend, Amount: domain.Money{Amount: 20, Currency: "USD"}, InvestmentID: investments[0].ID(), OccurredAt: occurredAt},
+		},
+		ArchivedAt: &archivedAt,
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
+	})
+	if err := s.Portfolios.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	found, err := s.Portfolios.FindByID(ctx, portfolio.ID())
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if found.UserID != owner.ID || found.Name != "Legacy" || found.Version != 1 {
+		t.Errorf("Unexpected portfolio: user=%s name=%s version=%d", found.UserID, found.Name, found.Version)
+	}
+	if !found.CreatedAt.Equal(createdAt) || !found.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected timestamps %v/%v, got %v/%v", createdAt, updatedAt, found.CreatedAt, found.UpdatedAt)
+	}
+	if found.ArchivedAt == nil || !found.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("Expected archived at %v, got %v", archivedAt, found.ArchivedAt)
+	}
+	if total := found.CalculateInvestedAmount(); total.Amount != 15000000 {
+		t.Errorf("Expected invested amount 15000000, got %f", total.Amount)
+	}
+
+	if len(found.CashTransactions) != 2 {
+		t.Fatalf("Expected 2 cash transactions, got %d", len(found.CashTransactions))
+	}
+	// 同時刻の取引は記録順に並ぶ
+	first, second := found.CashTransactions[0], found.CashTransactions[1]
+	if first.ID != "cash-1" || first.Type != domain.CashDeposit || first.Amount.Amount != 500 || first.InvestmentID.Value != "" {
+		t.Errorf("Unexpected first cash transaction %+v", first)
+	}
+	if second.ID != "cash-2" || second.Amount.Currency != "USD" || second.InvestmentID != investments[0].ID() {
+		t.Errorf("Unexpected second cash transaction %+v", second)
+	}
+	if !first.OccurredAt.Equal(occurredAt) {
+		t.Errorf("Expected occurred at %v, got %v", occurredAt, first.OccurredAt)
+	}
+}
+
+func testPortfolioBatchLoading(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	other := createUser(t, s, "other@example.com")
+
+	first := createPortfolio(t, s, "portfolio-1", owner.ID, newInvestment("inv-1", 1000), newInvestment("inv-2", 2000))
+	second := createPortfolio(t, s, "portfolio-2", owner.ID, newInvestment("inv-3", 3000))
+	empty := createPortfolio(t, s, "portfolio-3", other.ID)
+
+	deposit := &domain.CashTransaction{ID: "cash-1", Type: domain.CashDeposit, Amount: domain.Money{Amount: 500, Currency: "JPY"}, OccurredAt: createdAt}
+	if err := second.RecordCashTransaction(deposit); err != nil {
+		t.Fatalf("RecordCashTransaction failed: %v", err)
+	}
+	if err := s.Portfolios.Save(ctx, second); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// 投資と入出金はそれぞれのポートフォリオに振り分けられる
+	owned, err := s.Portfolios.FindByUserID(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("FindByUserID failed: %v", err)
+	}
+	if len(owned) != 2 {
+		t.Fatalf("Expected 2 portfolios, got %d", len(owned))
+	}
+	for _, portfolio := range owned {
+		var wantInvested float64
+		var wantCash int
+		switch portfolio.ID() {
+		case first.ID():
+			wantInvested, wantCash = 3000, 0
+		case second.ID():
+			wantInvested, wantCash = 3000, 1
+		default:
+			t.Fatalf("Unexpected portfolio %s", portfolio.ID().Value)
+		}
+		if total := portfolio.CalculateInvestedAmount(); total.Amount != wantInvested {
+			t.Errorf("%s: expected invested amount %f, got %f", portfolio.ID().Value, wantInvested, total.Amount)
+		}
+		if len(portfolio.CashTransactions) != wantCash {
+			t.Errorf("%s: expected %d cash transactions, got %d", portfolio.ID().Value, wantCash, len(portfolio.CashTransactions))
+		}
+	}
+
+	found, err := s.Portfolios.FindByIDs(ctx, []domain.PortfolioID{
+		empty.ID(),
+		domain.NewPortfolioID("missing"),
+		first.ID(),
+		empty.ID(),
+	})
+	if err != nil {
+		t.Fatalf("FindByIDs failed: %v", err)
+	}
+	if len(found) != 2 || found[0].ID() != empty.ID() || found[1].ID() != first.ID() {
+		t.Fatalf("Expected [%s %s], got %v", empty.ID().Value, first.ID().Value, found)
+	}
+	if len(found[0].GetInvestments()) != 0 || len(found[1].GetInvestments()) != 2 {
+		t.Errorf("Expected 0 and 2 investments, got %d and %d", len(found[0].GetInvestments()), len(found[1].GetInvestments()))
+	}
+
+	all, err := s.Portfolios.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(all) != 3 || all[0].ID() != first.ID() || all[1].ID() != second.ID() || all[2].ID() != empty.ID() {
+		t.Fatalf("Expected the 3 portfolios of every user, got %v", all)
+	}
+	if len(all[1].GetInvestments()) != 1 || len(all[1].CashTransactions) != 1 {
+		t.Errorf("Expected FindAll to load investments and cash, got %d and %d", len(all[1].GetInvestments()), len(all[1].CashTransactions))
+	}
+
+	none, err := s.Portfolios.FindByIDs(ctx, nil)
+	if err != nil {
+		t.Fatalf("FindByIDs failed: %v", err)
+	}
+	if none == nil || len(none) != 0 {
+		t.Errorf("Expected an empty slice, got %v", none)
+	}
+}
+
+func testPortfolioOptimisticLocking(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	portfolio := createPortfolio(t, s, "portfolio-1", owner.ID)
+
+	first, _ := s.Portfolios.FindByID(ctx, portfolio.ID())
+	second, _ := s.Portfolios.FindByID(ctx, portfolio.ID())
+
+	first.Rename("First")
+	if err := s.Portfolios.Save(ctx, first); err != nil {
+		t.Fatalf("Save of current copy failed: %v", err)
+	}
+
+	second.Rename("Second")
+	if err := s.Portfolios.Save(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification from Save, got %v", err)
+	}
+	if err := s.Portfolios.Update(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification from Update, got %v", err)
+	}
+
+	if err := s.Portfolios.Update(ctx, first); err != nil {
+		t.Fatalf("Update of current copy failed: %v", err)
+	}
+	stored, _ := s.Portfolios.FindByID(ctx, portfolio.ID())
+	if stored.Name != "First" || stored.Version != 3 {
+		t.Errorf("Expected First at version 3, got %q at version %d", stored.Name, stored.Version)
+	}
+}
+
+func testPortfolioUniqueNames(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	other := createUser(t, s, "other@example.com")
+	createPortfolio(t, s, "portfolio-1", owner.ID)
+
+	// 大文字小文字だけが違う名前も重複とみなす
+	duplicate := domain.NewPortfolio(domain.NewPortfolioID("portfolio-2"), owner.ID)
+	duplicate.Rename("PORTFOLIO-1")
+	if err := s.Portfolios.Create(ctx, duplicate); !errors.Is(err, domain.ErrDuplicatePortfolioName) {
+		t.Errorf("Expected ErrDuplicatePortfolioName from Create, got %v", err)
+	}
+	if err := s.Portfolios.Save(ctx, duplicate); !errors.Is(err, domain.ErrDuplicatePortfolioName) {
+		t.Errorf("Expected ErrDuplicatePortfolioName from Save, got %v", err)
+	}
+
+	// 別のユーザーは同じ名前を使える
+	createPortfolio(t, s, "portfolio-3", other.ID)
+	shared := domain.NewPortfolio(domain.NewPortfolioID("portfolio-4"), other.ID)
+	shared.Rename("portfolio-1")
+	if err := s.Portfolios.Save(ctx, shared); err != nil {
+		t.Fatalf("Save with another owner's name failed: %v", err)
+	}
+
+	// 名前の変更も重複できない
+	renamed := createPortfolio(t, s, "portfolio-5", owner.ID)
+	renamed.Rename("Portfolio-1")
+	if err := s.Portfolios.Save(ctx, renamed); !errors.Is(err, domain.ErrDuplicatePortfolioName) {
+		t.Errorf("Expected ErrDuplicatePortfolioName from renaming, got %v", err)
+	}
+	if err := s.Portfolios.Update(ctx, renamed); !errors.Is(err, domain.ErrDuplicatePortfolioName) {
+		t.Errorf("Expected ErrDuplicatePortfolioName from Update, got %v", err)
+	}
+}
+
+func testMemberships(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	portfolio := createPortfolio(t, s, "portfolio-1", owner.ID)
+
+	invitation, err := domain.NewPortfolioInvitation("membership-1", portfolio.ID(), "Spouse@Example.com", domain.RoleEditor, owner.ID)
+	if err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if err := s.Memberships.Save(ctx, invitation); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	found, err := s.Memberships.FindByID(ctx, invitation.ID)
+	if err != nil {
+		t.Fatalf("FindByID failed: %v", err)
+	}
+	if found.InviteeEmail != "spouse@example.com" || found.Status != domain.MembershipPending || found.UserID != "" || found.AcceptedAt != nil {
+		t.Errorf("Unexpected invitation %+v", found)
+	}
+
+	pending, err := s.Memberships.FindPendingByEmail(ctx, "SPOUSE@example.com")
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected 1 pending invitation, got %d (err: %v)", len(pending), err)
+	}
+
+	if err := invitation.Accept("spouse", "spouse@example.com"); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if err := s.Memberships.Save(ctx, invitation); err != nil {
+		t.Fatalf("Save of accepted membership failed: %v", err)
+	}
+
+	active, err := s.Memberships.FindActiveByUserID(ctx, "spouse")
+	if err != nil || len(active) != 1 {
+		t.Fatalf("Expected 1 active membership, got %d (err: %v)", len(active), err)
+	}
+	// PostgreSQLはマイクロ秒に丸めるため誤差を許容する
+	if active[0].AcceptedAt == nil || active[0].AcceptedAt.Sub(*invitation.AcceptedAt).Abs() > time.Microsecond {
+		t.Errorf("Expected accepted at %v, got %v", invitation.AcceptedAt, active[0].AcceptedAt)
+	}
+	if pending, _ := s.Memberships.FindPendingByEmail(ctx, "spouse@example.com"); len(pending) != 0 {
+		t.Errorf("Expected no pending invitations after accept, got %d", len(pending))
+	}
+
+	byPortfolio, err := s.Memberships.FindByPortfolioID(ctx, portfolio.ID())
+	if err != nil || len(byPortfolio) != 1 {
+		t.Fatalf("Expected 1 membership for portfolio, got %d (err: %v)", len(byPortfolio), err)
+	}
+
+	if err := s.Memberships.Delete(ctx, invitation.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := s.Memberships.FindByID(ctx, invitation.ID); !isNotFound(err) {
+		t.Errorf("Expected not found after delete, got %v", err)
+	}
+	if err := s.Memberships.Delete(ctx, invitation.ID); !isNotFound(err) {
+		t.Errorf("Expected not found deleting twice, got %v", err)
+	}
+}
+
+func testTransactionRollback(t *testing.T, s Store) {
+	ctx := context.Background()
+	owner := createUser(t, s, "owner@example.com")
+	failure := errors.New("boom")
+
+	err := s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.Investments.Create(ctx, newInvestment("inv-1", 1000)); err != nil {
+			return err
+		}
+		portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), owner.ID)
+		if err := s.Portfolios.Create(ctx, portfolio); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the callback error, got %v", err)
+	}
+
+	if _, err := s.Investments.FindByID(ctx, domain.NewInvestmentID("inv-1")); !isNotFound(err) {
+		t.Errorf("Expected investment to be rolled back, got %v", err)
+	}
+	if _, err := s.Portfolios.FindByID(ctx, domain.NewPortfolioID("portfolio-1")); !isNotFound(err) {
+		t.Errorf("Expected portfolio to be rolled back, got %v", err)
+	}
+
+	err = s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		return s.Investments.Create(ctx, newInvestment("inv-2", 1000))
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction failed: %v", err)
+	}
+	if _, err := s.Investments.FindByID(ctx, domain.NewInvestmentID("inv-2")); err != nil {
+		t.Errorf("Expected committed investment, got %v", err)
+	}
+}
+
+func testNestedTransaction(t *testing.T, s Store) {
+	ctx := context.Background()
+	failure := errors.New("boom")
+
+	err := s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.Investments.Create(ctx, newInvestment("outer", 1000)); err != nil {
+			return err
+		}
+
+		// 内側の失敗は外側の書き込みを取り消さない
+		err := s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := s.Investments.Create(ctx, newInvestment("inner", 1000)); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Errorf("Expected inner error, got %v", err)
+		}
+
+		// トランザクション内では自分の書き込みが見える
+		if _, err := s.Investments.FindByID(ctx, domain.NewInvestmentID("outer")); err != nil {
+			t.Errorf("Expected outer write to be visible inside the transaction, got %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction failed: %v", err)
+	}
+
+	if _, err := s.Investments.FindByID(ctx, domain.NewInvestmentID("outer")); err != nil {
+		t.Errorf("Expected outer write to be committed, got %v", err)
+	}
+	if _, err := s.Investments.FindByID(ctx, domain.NewInvestmentID("inner")); !isNotFound(err) {
+		t.Errorf("Expected inner write to be rolled back, got %v", err)
+	}
+}
+
+func testEvents(t *testing.T, s Store) {
+	ctx := context.Background()
+	store := service.NewEventStore(s.Events)
+
+	portfolioID := domain.NewPortfolioID("portfolio-1")
+	events := []domain.DomainEvent{
+		domain.NewInvestmentCreatedEvent(portfolioID, newInvestment("inv-1", 1000)),
+		domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: 1000.5, Currency: "JPY"}, time.Now()),
+	}
+
+	version, err := store.Append(ctx, 0, events...)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if version != 2 {
+		t.Errorf("Expected version 2, got %d", version)
+	}
+
+	// 別のストリームは独立して番号が振られる
+	other := domain.NewPortfolioUpdatedEvent(domain.NewPortfolioID("portfolio-2"), domain.Money{Amount: 1, Currency: "USD"}, time.Now())
+	if version, err := store.Append(ctx, 0, other); err != nil || version != 1 {
+		t.Fatalf("Expected the other stream at version 1, got %d, %v", version, err)
+	}
+
+	streams, err := store.ListStreams(ctx, domain.AggregatePortfolio)
+	if err != nil {
+		t.Fatalf("ListStreams failed: %v", err)
+	}
+	if !reflect.DeepEqual(streams, []string{"portfolio-1", "portfolio-2"}) {
+		t.Errorf("Expected streams [portfolio-1 portfolio-2], got %v", streams)
+	}
+	if streams, err := store.ListStreams(ctx, "Other"); err != nil || len(streams) != 0 {
+		t.Errorf("Expected no streams of another type, got %v, %v", streams, err)
+	}
+
+	// ペイロードがそのまま復元されること
+	read, version, err := store.ReadStream(ctx, domain.AggregatePortfolio, portfolioID.Value)
+	if err != nil {
+		t.Fatalf("ReadStream failed: %v", err)
+	}
+	if version != 2 || !reflect.DeepEqual(read, events) {
+		t.Errorf("Expected %+v at version 2, got %+v at version %d", events, read, version)
+	}
+
+	stored, err := s.Events.ReadStream(ctx, domain.AggregatePortfolio, portfolioID.Value, 1)
+	if err != nil {
+		t.Fatalf("ReadStream failed: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("Expected 1 event after sequence 1, got %d", len(stored))
+	}
+	if e := stored[0]; e.Sequence != 2 || e.EventType != "PortfolioUpdated" || e.SchemaVersion != service.EventSchemaVersion("PortfolioUpdated") ||
+		e.AggregateType != domain.AggregatePortfolio || e.AggregateID != portfolioID.Value || e.ID == 0 {
+		t.Errorf("Unexpected stored event %+v", e)
+	}
+	if !sameInstant(stored[0].OccurredAt, events[1].OccurredAt()) {
+		t.Errorf("Expected occurred_at %v, got %v", events[1].OccurredAt(), stored[0].OccurredAt)
+	}
+
+	if sequence, err := s.Events.LastSequence(ctx, domain.AggregatePortfolio, portfolioID.Value); err != nil || sequence != 2 {
+		t.Errorf("Expected the last sequence 2, got %d, %v", sequence, err)
+	}
+	if sequence, err := s.Events.LastSequence(ctx, domain.AggregatePortfolio, "portfolio-3"); err != nil || sequence != 0 {
+		t.Errorf("Expected 0 for a stream without events, got %d, %v", sequence, err)
+	}
+}
+
+func testEventExpectedVersion(t *testing.T, s Store) {
+	ctx := context.Background()
+	store := service.NewEventStore(s.Events)
+
+	portfolioID := domain.NewPortfolioID("portfolio-1")
+	update := func(amount float64) domain.DomainEvent {
+		return domain.NewPortfolioUpdatedEvent(portfolioID, domain.Money{Amount: amount, Currency: "JPY"}, time.Now())
+	}
+
+	if _, err := store.Append(ctx, 0, update(1)); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// 古いバージョンを前提にした追記は拒否され、何も保存されない
+	if _, err := store.Append(ctx, 0, update(2), update(3)); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification, got %v", err)
+	}
+	if _, err := store.Append(ctx, 5, update(2)); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification for a future version, got %v", err)
+	}
+
+	if version, err := store.Append(ctx, 1, update(2)); err != nil || version != 2 {
+		t.Errorf("Expected version 2, got %d, %v", version, err)
+	}
+	if version, err := store.Append(ctx, service.AnyVersion, update(3)); err != nil || version != 3 {
+		t.Errorf("Expected AnyVersion to append at version 3, got %d, %v", version, err)
+	}
+
+	read, _, err := store.ReadStream(ctx, domain.AggregatePortfolio, portfolioID.Value)
+	if err != nil {
+		t.Fatalf("ReadStream failed: %v", err)
+	}
+	var amounts []float64
+	for _, event := range read {
+		amounts = append(amounts, event.(domain.PortfolioUpdatedEvent).TotalAmount().Amount)
+	}
+	if !reflect.DeepEqual(amounts, []float64{1, 2, 3}) {
+		t.Errorf("Expected amounts [1 2 3], got %v", amounts)
+	}
+}
+
+func testEventQuery(t *testing.T, s Store) {
+	ctx := context.Background()
+	store := service.NewEventStore(s.Events)
+
+	// 2つのストリームに、時刻と操作者の異なるイベントを保存する
+	alice := service.WithActor(ctx, service.Actor{UserID: "alice", RequestID: "request-1"})
+	bob := service.WithActor(ctx, service.Actor{UserID: "bob", RequestID: "request-2"})
+	appendEvent := func(ctx context.Context, event domain.DomainEvent) {
+		t.Helper()
+		if _, err := store.Append(ctx, service.AnyVersion, event); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+	first, second := domain.NewPortfolioID("portfolio-1"), domain.NewPortfolioID("portfolio-2")
+	appendEvent(alice, domain.NewPortfolioCreatedEvent(first, "alice", "Main", createdAt))
+	appendEvent(bob, domain.NewPortfolioCreatedEvent(second, "bob", "Main", createdAt.Add(time.Hour)))
+	appendEvent(alice, domain.NewPortfolioRenamedEvent(first, "Savings", createdAt.Add(2*time.Hour)))
+	appendEvent(ctx, domain.NewPortfolioArchivedEvent(first, createdAt.Add(3*time.Hour)))
+
+	query := func(filter service.EventFilter) []service.StoredEvent {
+		t.Helper()
+		if filter.Limit == 0 {
+			filter.Limit = 10
+		}
+		events, err := s.Events.QueryEvents(ctx, filter)
+		if err != nil {
+			t.Fatalf("QueryEvents failed: %v", err)
+		}
+		return events
+	}
+	types := func(events []service.StoredEvent) []string {
+		var names []string
+		for _, event := range events {
+			names = append(names, event.AggregateID+"/"+event.EventType)
+		}
+		return names
+	}
+
+	all := query(service.EventFilter{})
+	if want := []string{"portfolio-1/PortfolioCreated", "portfolio-2/PortfolioCreated", "portfolio-1/PortfolioRenamed", "portfolio-1/PortfolioArchived"}; !reflect.DeepEqual(types(all), want) {
+		t.Fatalf("Expected %v in the order stored, got %v", want, types(all))
+	}
+	if e := all[0]; e.ActorID != "alice" || e.RequestID != "request-1" || e.Sequence != 1 {
+		t.Errorf("Expected the actor to be stored, got %+v", e)
+	}
+	if e := all[3]; e.ActorID != "" || e.RequestID != "" {
+		t.Errorf("Expected no actor outside of a request, got %+v", e)
+	}
+
+	from, to := createdAt.Add(time.Hour), createdAt.Add(3*time.Hour)
+	tests := []struct {
+		name   string
+		filter service.EventFilter
+		want   []string
+	}{
+		{"aggregate", service.EventFilter{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-2"}, []string{"portfolio-2/PortfolioCreated"}},
+		{"event types", service.EventFilter{EventTypes: []string{"PortfolioRenamed", "PortfolioArchived"}}, []string{"portfolio-1/PortfolioRenamed", "portfolio-1/PortfolioArchived"}},
+		{"actor", service.EventFilter{ActorID: "alice"}, []string{"portfolio-1/PortfolioCreated", "portfolio-1/PortfolioRenamed"}},
+		{"time range", service.EventFilter{From: &from, To: &to}, []string{"portfolio-2/PortfolioCreated", "portfolio-1/PortfolioRenamed"}},
+		{"other aggregate type", service.EventFilter{AggregateType: "Other"}, nil},
+	}
+	for _, tt := range tests {
+		if got := types(query(tt.filter)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// IDの後から続きを読む
+	page := query(service.EventFilter{Limit: 2})
+	rest := query(service.EventFilter{AfterID: page[len(page)-1].ID})
+	if len(page) != 2 || !reflect.DeepEqual(append(page, rest...), all) {
+		t.Errorf("Expected the pages to add up to all events, got %v and %v", types(page), types(rest))
+	}
+}
+
+func testEventsInTransaction(t *testing.T, s Store) {
+	ctx := context.Background()
+	store := service.NewEventStore(s.Events)
+	event := domain.NewPortfolioUpdatedEvent(domain.NewPortfolioID("portfolio-1"), domain.Money{Amount: 1, Currency: "JPY"}, time.Now())
+
+	errRollback := errors.New("rollback")
+	err := s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		if _, err := store.Append(ctx, 0, event); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Expected the rollback error, got %v", err)
+	}
+
+	// ロールバックされたイベントは残らない
+	if _, version, err := store.ReadStream(ctx, domain.AggregatePortfolio, "portfolio-1"); err != nil || version != 0 {
+		t.Errorf("Expected an empty stream, got version %d, %v", version, err)
+	}
+}
+
+func testSnapshots(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if snapshot, err := s.Snapshots.LatestSnapshot(ctx, domain.AggregatePortfolio, "portfolio-1"); err != nil || snapshot != nil {
+		t.Fatalf("Expected no snapshot, got %+v, %v", snapshot, err)
+	}
+
+	snapshot := func(id string, version int, schemaHash string) service.Snapshot {
+		return service.Snapshot{
+			AggregateType: domain.AggregatePortfolio,
+			AggregateID:   id,
+			Version:       version,
+			SchemaHash:    schemaHash,
+			Data:          []byte(`{"version":` + strconv.Itoa(version) + `}`),
+			CreatedAt:     createdAt,
+		}
+	}
+
+	// 新しいバージョンで置き換わり、古いバージョンでは置き換わらない
+	for _, saved := range []service.Snapshot{
+		snapshot("portfolio-1", 5, "current"),
+		snapshot("portfolio-1", 10, "current"),
+		snapshot("portfolio-1", 7, "current"),
+		snapshot("portfolio-2", 3, "old"),
+	} {
+		if err := s.Snapshots.SaveSnapshot(ctx, saved); err != nil {
+			t.Fatalf("SaveSnapshot failed: %v", err)
+		}
+	}
+
+	latest, err := s.Snapshots.LatestSnapshot(ctx, domain.AggregatePortfolio, "portfolio-1")
+	if err != nil || latest == nil {
+		t.Fatalf("LatestSnapshot failed: %+v, %v", latest, err)
+	}
+	want := snapshot("portfolio-1", 10, "current")
+	if latest.AggregateType != want.AggregateType || latest.AggregateID != want.AggregateID || latest.Version != want.Version ||
+		latest.SchemaHash != want.SchemaHash || !sameInstant(latest.CreatedAt, want.CreatedAt) {
+		t.Errorf("Expected %+v, got %+v", want, latest)
+	}
+	var data map[string]int
+	if err := json.Unmarshal(latest.Data, &data); err != nil || data["version"] != 10 {
+		t.Errorf("Expected the data of version 10, got %s, %v", latest.Data, err)
+	}
+
+	// 形式の違うスナップショットだけが削除される
+	deleted, err := s.Snapshots.DeleteSnapshots(ctx, domain.AggregatePortfolio, "current")
+	if err != nil || deleted != 1 {
+		t.Errorf("Expected 1 snapshot deleted, got %d, %v", deleted, err)
+	}
+	if latest, err := s.Snapshots.LatestSnapshot(ctx, domain.AggregatePortfolio, "portfolio-2"); err != nil || latest != nil {
+		t.Errorf("Expected the old snapshot to be gone, got %+v, %v", latest, err)
+	}
+	if latest, err := s.Snapshots.LatestSnapshot(ctx, domain.AggregatePortfolio, "portfolio-1"); err != nil || latest == nil {
+		t.Errorf("Expected the current snapshot to be kept, got %+v, %v", latest, err)
+	}
+}
+
+func testOutbox(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	events := []service.StoredEvent{
+		{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-1", EventType: "PortfolioCreated", SchemaVersion: 1, EventData: []byte(`{"name":"Main"}`), OccurredAt: createdAt},
+		{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-1", EventType: "PortfolioRenamed", SchemaVersion: 1, EventData: []byte(`{"name":"Savings"}`), OccurredAt: updatedAt},
+		{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-2", EventType: "PortfolioCreated", SchemaVersion: 1, EventData: []byte(`{"name":"NISA"}`), OccurredAt: updatedAt},
+	}
+	if err := s.Outbox.Enqueue(ctx, events, createdAt); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	messages, err := s.Outbox.PendingMessages(ctx, createdAt, 2)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v, %v", messages, err)
+	}
+	first := messages[0]
+	if first.Event.EventType != "PortfolioCreated" || first.Event.AggregateID != "portfolio-1" || first.Event.SchemaVersion != 1 ||
+		!sameInstant(first.Event.OccurredAt, createdAt) || !sameInstant(first.NextAttemptAt, createdAt) || first.Attempts != 0 {
+		t.Errorf("Unexpected first message %+v", first)
+	}
+	var data map[string]string
+	if err := json.Unmarshal(first.Event.EventData, &data); err != nil || data["name"] != "Main" {
+		t.Errorf("Expected the payload to be kept, got %s, %v", first.Event.EventData, err)
+	}
+	if messages[1].Event.EventType != "PortfolioRenamed" || messages[1].ID <= first.ID {
+		t.Errorf("Expected the messages in the order they were enqueued, got %+v", messages)
+	}
+
+	// 配信済み、再試行待ち、デッドレターへの移動
+	if err := s.Outbox.DeleteMessage(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	next := updatedAt.Add(time.Minute)
+	if err := s.Outbox.RescheduleMessage(ctx, messages[1].ID, 1, next, "handler failed"); err != nil {
+		t.Fatalf("RescheduleMessage failed: %v", err)
+	}
+
+	archived := service.StoredEvent{AggregateType: domain.AggregatePortfolio, AggregateID: "portfolio-1", EventType: "PortfolioArchived", SchemaVersion: 1, EventData: []byte(`{}`), OccurredAt: updatedAt}
+	if err := s.Outbox.Enqueue(ctx, []service.StoredEvent{archived}, updatedAt); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	// 再試行待ちのストリームは、後のメッセージも期限まで返さない
+	messages, err = s.Outbox.PendingMessages(ctx, updatedAt, 1)
+	if err != nil || len(messages) != 1 || messages[0].Event.AggregateID != "portfolio-2" {
+		t.Fatalf("Expected only the message of portfolio-2 to be due, got %+v, %v", messages, err)
+	}
+	messages, err = s.Outbox.PendingMessages(ctx, next, 10)
+	if err != nil || len(messages) != 3 || messages[2].Event.EventType != "PortfolioArchived" {
+		t.Fatalf("Expected 3 messages due after the retry time, got %+v, %v", messages, err)
+	}
+	retried := messages[0]
+	if retried.Attempts != 1 || retried.LastError != "handler failed" || !sameInstant(retried.NextAttemptAt, next) {
+		t.Errorf("Expected the failure to be recorded, got %+v", retried)
+	}
+
+	retried.Attempts = 2
+	if err := s.Outbox.DeadLetter(ctx, retried, "gave up", updatedAt); err != nil {
+		t.Fatalf("DeadLetter failed: %v", err)
+	}
+	messages, err = s.Outbox.PendingMessages(ctx, updatedAt, 10)
+	if err != nil || len(messages) != 2 || messages[0].Event.AggregateID != "portfolio-2" || messages[1].Event.EventType != "PortfolioArchived" {
+		t.Errorf("Expected the messages of portfolio-2 and the archive left, got %+v, %v", messages, err)
+	}
+
+	letters, err := s.Outbox.DeadLetters(ctx, 10)
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %+v, %v", letters, err)
+	}
+	letter := letters[0]
+	if letter.MessageID != retried.ID || letter.Attempts != 2 || letter.Reason != "gave up" ||
+		letter.Event.EventType != "PortfolioRenamed" || !sameInstant(letter.FailedAt, updatedAt) {
+		t.Errorf("Unexpected dead letter %+v", letter)
+	}
+	if err := json.Unmarshal(letter.Event.EventData, &data); err != nil || data["name"] != "Savings" {
+		t.Errorf("Expected the payload in the dead letter, got %s, %v", letter.Event.EventData, err)
+	}
+}
+
+func testOutboxInTransaction(t *testing.T, s Store) {
+	ctx := context.Background()
+	outbox := service.NewOutbox(s.Events, s.Outbox)
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "user-1")
+
+	errRollback := errors.New("rollback")
+	err := s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.Portfolios.Save(ctx, portfolio); err != nil {
+			return err
+		}
+		if err := outbox.Add(ctx, portfolio.Events()...); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Expected the rollback error, got %v", err)
+	}
+
+	// ロールバックされた変更のイベントは配信されない
+	if messages, err := s.Outbox.PendingMessages(ctx, time.Now(), 10); err != nil || len(messages) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v, %v", messages, err)
+	}
+	if streams, err := s.Events.ListStreams(ctx, domain.AggregatePortfolio); err != nil || len(streams) != 0 {
+		t.Errorf("Expected no stream, got %v, %v", streams, err)
+	}
+
+	err = s.TxManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		if err := s.Portfolios.Save(ctx, portfolio); err != nil {
+			return err
+		}
+		return outbox.Add(ctx, portfolio.Events()...)
+	})
+	if err != nil {
+		t.Fatalf("RunInTransaction failed: %v", err)
+	}
+
+	messages, err := s.Outbox.PendingMessages(ctx, time.Now(), 10)
+	if err != nil || len(messages) != 1 || messages[0].Event.EventType != "PortfolioCreated" {
+		t.Errorf("Expected the creation in the outbox, got %+v, %v", messages, err)
+	}
+	stored, err := s.Events.ReadStream(ctx, domain.AggregatePortfolio, "portfolio-1", 0)
+	if err != nil || len(stored) != 1 {
+		t.Errorf("Expected the creation in the stream, got %+v, %v", stored, err)
+	}
+}
+
+func testWebhooks(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	subscription := &domain.WebhookSubscription{
+		ID:         "webhook-1",
+		UserID:     "user-1",
+		URL:        "https://example.com/hooks",
+		EventTypes: []string{"PortfolioCreated", "InvestmentCreated"},
+		Secret:     "secret",
+		CreatedAt:  createdAt,
+	}
+	other := &domain.WebhookSubscription{ID: "webhook-2", UserID: "user-2", URL: "https://example.org", EventTypes: []string{"PortfolioDeleted"}, Secret: "other", CreatedAt: createdAt}
+	for _, sub := range []*domain.WebhookSubscription{subscription, other} {
+		if err := s.Webhooks.SaveSubscription(ctx, sub); err != nil {
+			t.Fatalf("SaveSubscription failed: %v", err)
+		}
+	}
+
+	found, err := s.Webhooks.FindSubscriptionByID(ctx, "webhook-1")
+	if err != nil {
+		t.Fatalf("FindSubscriptionByID failed: %v", err)
+	}
+	if found.UserID != "user-1" || found.URL != subscription.URL || found.Secret != "secret" ||
+		!reflect.DeepEqual(found.EventTypes, subscription.EventTypes) || !sameInstant(found.CreatedAt, createdAt) {
+		t.Errorf("Unexpected subscription %+v", found)
+	}
+	if byUser, err := s.Webhooks.FindSubscriptionsByUserID(ctx, "user-1"); err != nil || len(byUser) != 1 || byUser[0].ID != "webhook-1" {
+		t.Errorf("Expected the subscription of user-1, got %+v, %v", byUser, err)
+	}
+	if _, err := s.Webhooks.FindSubscriptionByID(ctx, "missing"); !isNotFound(err) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	// 配信の作成と状態の更新
+	payload := []byte(`{"event_type":"PortfolioCreated","data":{"name":"Main"}}`)
+	first := domain.NewWebhookDelivery("delivery-1", "webhook-1", "PortfolioCreated", payload, createdAt)
+	second := domain.NewWebhookDelivery("delivery-2", "webhook-1", "InvestmentCreated", []byte(`{}`), updatedAt)
+	for _, delivery := range []*domain.WebhookDelivery{first, second} {
+		if err := s.Webhooks.SaveDelivery(ctx, delivery); err != nil {
+			t.Fatalf("SaveDelivery failed: %v", err)
+		}
+	}
+
+	due, err := s.Webhooks.FindDueDeliveries(ctx, createdAt, 10)
+	if err != nil || len(due) != 1 || due[0].ID != "delivery-1" {
+		t.Fatalf("Expected only delivery-1 to be due, got %+v, %v", due, err)
+	}
+	if string(due[0].Payload) != string(payload) || due[0].Status != domain.WebhookDeliveryPending {
+		t.Errorf("Unexpected delivery %+v", due[0])
+	}
+
+	retryAt := updatedAt.Add(time.Hour)
+	first.Fail(500, "server error", &retryAt, updatedAt)
+	if err := s.Webhooks.UpdateDelivery(ctx, first); err != nil {
+		t.Fatalf("UpdateDelivery of a failure failed: %v", err)
+	}
+	// 同じ配信をもう一度作っても記録は変わらない
+	if err := s.Webhooks.SaveDelivery(ctx, domain.NewWebhookDelivery("delivery-1", "webhook-1", "PortfolioCreated", payload, updatedAt)); err != nil {
+		t.Fatalf("SaveDelivery of an existing delivery failed: %v", err)
+	}
+	missing := domain.NewWebhookDelivery("missing", "webhook-1", "PortfolioCreated", payload, updatedAt)
+	if err := s.Webhooks.UpdateDelivery(ctx, missing); !isNotFound(err) {
+		t.Errorf("Expected not found for a delivery that was never saved, got %v", err)
+	}
+	if due, err := s.Webhooks.FindDueDeliveries(ctx, updatedAt, 10); err != nil || len(due) != 1 || due[0].ID != "delivery-2" {
+		t.Errorf("Expected only delivery-2 to be due, got %+v, %v", due, err)
+	}
+
+	second.Succeed(204, updatedAt)
+	if err := s.Webhooks.UpdateDelivery(ctx, second); err != nil {
+		t.Fatalf("UpdateDelivery of a success failed: %v", err)
+	}
+
+	deliveries, err := s.Webhooks.FindDeliveriesBySubscriptionID(ctx, "webhook-1", 10)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %+v, %v", deliveries, err)
+	}
+	if deliveries[0].ID != "delivery-2" || deliveries[0].Status != domain.WebhookDeliverySucceeded ||
+		deliveries[0].ResponseStatus != 204 || deliveries[0].DeliveredAt == nil || !sameInstant(*deliveries[0].DeliveredAt, updatedAt) {
+		t.Errorf("Expected the newest delivery to have succeeded, got %+v", deliveries[0])
+	}
+	failed := deliveries[1]
+	if failed.Attempts != 1 || failed.ResponseStatus != 500 || failed.LastError != "server error" ||
+		!sameInstant(failed.NextAttemptAt, retryAt) || failed.DeliveredAt != nil {
+		t.Errorf("Expected the failure to be recorded, got %+v", failed)
+	}
+	if limited, err := s.Webhooks.FindDeliveriesBySubscriptionID(ctx, "webhook-1", 1); err != nil || len(limited) != 1 {
+		t.Errorf("Expected the limit to apply, got %+v, %v", limited, err)
+	}
+
+	// 購読を削除すると配信の記録も消える
+	if err := s.Webhooks.DeleteSubscription(ctx, "webhook-1"); err != nil {
+		t.Fatalf("DeleteSubscription failed: %v", err)
+	}
+	if _, err := s.Webhooks.FindDeliveryByID(ctx, "delivery-1"); !isNotFound(err) {
+		t.Errorf("Expected the deliveries to be removed, got %v", err)
+	}
+	if err := s.Webhooks.DeleteSubscription(ctx, "webhook-1"); !isNotFound(err) {
+		t.Errorf("Expected not found deleting twice, got %v", err)
+	}
+	if _, err := s.Webhooks.FindSubscriptionByID(ctx, "webhook-2"); err != nil {
+		t.Errorf("Expected the other subscription to be kept, got %v", err)
+	}
+}
+
+// sameInstant compares times at the microsecond precision of the backends.
+func sameInstant(a time.Time, b time.Time) bool {
+	return a.Truncate(time.Microsecond).Equal(b.Truncate(time.Microsecond))
+}
@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"moneyget/internal/infrastructure/contracttest"
+	"testing"
+)
+
+func TestRepositoryContract(t *testing.T) {
+	contracttest.Run(t, func(t *testing.T) contracttest.Store {
+		db := NewDB()
+
+		return contracttest.Store{
+			Users:       NewUserRepository(db),
+			Investments: NewInvestmentRepository(db),
+			Portfolios:  NewPortfolioRepository(db),
+			Memberships: NewMembershipRepository(db),
+			TxManager:   NewTransactionManager(db),
+			Events:      NewEventStoreDB(db),
+			Snapshots:   NewSnapshotStoreDB(db),
+			Outbox:      NewOutboxStoreDB(db),
+			Webhooks:    NewWebhookRepository(db),
+		}
+	})
+}
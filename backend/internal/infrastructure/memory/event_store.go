@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+)
+
+type EventStoreDB struct {
+	db *DB
+}
+
+func NewEventStoreDB(db *DB) *EventStoreDB {
+	return &EventStoreDB{db: db}
+}
+
+func (e *EventStoreDB) Append(ctx context.Context, expectedVersion int, events []service.StoredEvent) (int, error) {
+	if len(events) == 0 {
+		return expectedVersion, nil
+	}
+	aggregateType, aggregateID := events[0].AggregateType, events[0].AggregateID
+
+	var version int
+	err := e.db.write(ctx, func(s *state) error {
+		version = streamVersion(s, aggregateType, aggregateID)
+		if expectedVersion != service.AnyVersion && version != expectedVersion {
+			return fmt.Errorf("%w: stream %s %s is at version %d, expected %d",
+				domain.ErrConcurrentModification, aggregateType, aggregateID, version, expectedVersion)
+		}
+
+		for _, event := range events {
+			version++
+			event.ID = int64(len(s.events) + 1)
+			event.Sequence = version
+			event.EventData = append(json.RawMessage(nil), event.EventData...)
+			s.events = append(s.events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+func (e *EventStoreDB) ReadStream(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]service.StoredEvent, error) {
+	var events []service.StoredEvent
+	err := e.db.read(func(s *state) error {
+		for _, event := range s.events {
+			if event.AggregateType == aggregateType && event.AggregateID == aggregateID && event.Sequence > afterSequence {
+				event.EventData = append(json.RawMessage(nil), event.EventData...)
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (e *EventStoreDB) LastSequence(ctx context.Context, aggregateType string, aggregateID string) (int, error) {
+	var sequence int
+	err := e.db.read(func(s *state) error {
+		sequence = streamVersion(s, aggregateType, aggregateID)
+		return nil
+	})
+	return sequence, err
+}
+
+func (e *EventStoreDB) QueryEvents(ctx context.Context, filter service.EventFilter) ([]service.StoredEvent, error) {
+	var events []service.StoredEvent
+	err := e.db.read(func(s *state) error {
+		for _, event := range s.events {
+			if len(events) == filter.Limit {
+				break
+			}
+			if filter.Matches(event) {
+				event.EventData = append(json.RawMessage(nil), event.EventData...)
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+func (e *EventStoreDB) ListStreams(ctx context.Context, aggregateType string) ([]string, error) {
+	var ids []string
+	err := e.db.read(func(s *state) error {
+		seen := make(map[string]bool)
+		for _, event := range s.events {
+			if event.AggregateType == aggregateType && !seen[event.AggregateID] {
+				seen[event.AggregateID] = true
+				ids = append(ids, event.AggregateID)
+			}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+func streamVersion(s *state, aggregateType string, aggregateID string) int {
+	version := 0
+	for _, event := range s.events {
+		if event.AggregateType == aggregateType && event.AggregateID == aggregateID {
+			version = event.Sequence
+		}
+	}
+	return version
+}
@@ -0,0 +1,225 @@
+package memory
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"sort"
+)
+
+type investmentRepository struct {
+	db *DB
+}
+
+func NewInvestmentRepository(db *DB) domain.InvestmentRepository {
+	return &investmentRepository{db: db}
+}
+
+func (r *investmentRepository) Create(ctx context.Context, investment *domain.Investment) error {
+	err := r.db.write(ctx, func(s *state) error {
+		id := investment.ID().Value
+		if _, ok := s.investments[id]; ok {
+			return errAlreadyExists("investment", id)
+		}
+
+		s.investments[id] = newInvestmentRecord(investment, 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	investment.Version = 1
+	return nil
+}
+
+// Save inserts a new investment (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
+func (r *investmentRepository) Save(ctx context.Context, investment *domain.Investment) error {
+	err := r.db.write(ctx, func(s *state) error {
+		id := investment.ID().Value
+		record := newInvestmentRecord(investment, investment.Version+1)
+
+		if stored, ok := s.investments[id]; ok {
+			if stored.version != investment.Version {
+				return errConcurrentModification("investment", id)
+			}
+			// 作成日時は最初に保存された値を維持する
+			record.createdAt = stored.createdAt
+		}
+
+		s.investments[id] = record
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	investment.Version++
+	return nil
+}
+
+func (r *investmentRepository) FindByID(ctx context.Context, id domain.InvestmentID) (*domain.Investment, error) {
+	var investment *domain.Investment
+
+	err := r.db.read(func(s *state) error {
+		record, ok := s.investments[id.Value]
+		if !ok {
+			return errNotFound("investment", id.Value)
+		}
+		investment = record.toDomain()
+		return nil
+	})
+
+	return investment, err
+}
+
+func (r *investmentRepository) FindAllByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.Investment, error) {
+	var investments []*domain.Investment
+
+	err := r.db.read(func(s *state) error {
+		portfolio, ok := s.portfolios[portfolioID.Value]
+		if !ok {
+			return nil
+		}
+		investments = s.portfolioInvestments(portfolio)
+		return nil
+	})
+
+	return investments, err
+}
+
+func (r *investmentRepository) FindAll(ctx context.Context) ([]*domain.Investment, error) {
+	var investments []*domain.Investment
+
+	err := r.db.read(func(s *state) error {
+		for _, record := range s.investments {
+			investments = append(investments, record.toDomain())
+		}
+		return nil
+	})
+
+	sortInvestments(investments)
+	return investments, err
+}
+
+func (r *investmentRepository) Delete(ctx context.Context, id domain.InvestmentID) error {
+	return r.db.write(ctx, func(s *state) error {
+		delete(s.investments, id.Value)
+
+		// 関連付けも削除する（SQLの ON DELETE CASCADE と同じ）
+		for _, portfolio := range s.portfolios {
+			portfolio.investmentIDs = removeString(portfolio.investmentIDs, id.Value)
+		}
+		return nil
+	})
+}
+
+func newInvestmentRecord(investment *domain.Investment, version int) *investmentRecord {
+	return &investmentRecord{
+		id:         investment.ID().Value,
+		amount:     investment.Amount(),
+		investType: investment.Type(),
+		strategy:   investment.Strategy(),
+		version:    version,
+		createdAt:  investment.CreatedAt,
+		updatedAt:  investment.UpdatedAt,
+	}
+}
+
+func (r *investmentRecord) toDomain() *domain.Investment {
+	return domain.ReconstituteInvestment(
+		domain.NewInvestmentID(r.id),
+		r.amount,
+		r.investType,
+		r.strategy,
+		r.version,
+		r.createdAt,
+		r.updatedAt,
+	)
+}
+
+// portfolioInvestments returns the investments linked to the portfolio,
+// ordered like the SQL stores.
+func (s *state) portfolioInvestments(portfolio *portfolioRecord) []*domain.Investment {
+	var investments []*domain.Investment
+	for _, id := range portfolio.investmentIDs {
+		if record, ok := s.investments[id]; ok {
+			investments = append(investments, record.toDomain())
+		}
+	}
+
+	sortInvestments(investments)
+	return investments
+}
+
+// Find returns one page of investments, filtered and ordered like the SQL
+// stores.
+func (r *investmentRepository) Find(ctx context.Context, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := query.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	var investments []*domain.Investment
+
+	err = r.db.read(func(s *state) error {
+		var inScope map[string]bool
+		if len(query.PortfolioIDs) > 0 {
+			inScope = make(map[string]bool)
+			for _, portfolioID := range query.PortfolioIDs {
+				if record, ok := s.portfolios[portfolioID.Value]; ok {
+					for _, id := range record.investmentIDs {
+						inScope[id] = true
+					}
+				}
+			}
+		}
+
+		for id, record := range s.investments {
+			if inScope != nil && !inScope[id] {
+				continue
+			}
+			investment := record.toDomain()
+			if !query.Matches(investment) || (cursor != nil && !cursor.After(investment)) {
+				continue
+			}
+			investments = append(investments, investment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(investments, func(i, j int) bool {
+		return query.Less(investments[i], investments[j])
+	})
+	if len(investments) > query.Limit+1 {
+		investments = investments[:query.Limit+1]
+	}
+	return query.Page(investments), nil
+}
+
+func sortInvestments(investments []*domain.Investment) {
+	sort.SliceStable(investments, func(i, j int) bool {
+		if !investments[i].CreatedAt.Equal(investments[j].CreatedAt) {
+			return investments[i].CreatedAt.Before(investments[j].CreatedAt)
+		}
+		return investments[i].ID().Value < investments[j].ID().Value
+	})
+}
+
+func removeString(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
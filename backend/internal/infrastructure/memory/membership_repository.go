@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"sort"
+	"strings"
+)
+
+type membershipRepository struct {
+	db *DB
+}
+
+func NewMembershipRepository(db *DB) domain.MembershipRepository {
+	return &membershipRepository{db: db}
+}
+
+func (r *membershipRepository) Save(ctx context.Context, membership *domain.PortfolioMembership) error {
+	return r.db.write(ctx, func(s *state) error {
+		record := *membership
+		record.AcceptedAt = copyTime(membership.AcceptedAt)
+
+		// 既存の招待は承認に関する項目だけを更新する
+		if stored, ok := s.memberships[membership.ID]; ok {
+			stored.UserID = record.UserID
+			stored.Role = record.Role
+			stored.Status = record.Status
+			stored.AcceptedAt = record.AcceptedAt
+			record = stored
+		}
+
+		s.memberships[membership.ID] = record
+		return nil
+	})
+}
+
+func (r *membershipRepository) FindByID(ctx context.Context, id string) (*domain.PortfolioMembership, error) {
+	var membership *domain.PortfolioMembership
+
+	err := r.db.read(func(s *state) error {
+		record, ok := s.memberships[id]
+		if !ok {
+			return errNotFound("membership", id)
+		}
+		membership = copyMembership(record)
+		return nil
+	})
+
+	return membership, err
+}
+
+func (r *membershipRepository) FindByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.PortfolioMembership, error) {
+	return r.find(func(m domain.PortfolioMembership) bool {
+		return m.PortfolioID == portfolioID
+	})
+}
+
+func (r *membershipRepository) FindActiveByUserID(ctx context.Context, userID string) ([]*domain.PortfolioMembership, error) {
+	return r.find(func(m domain.PortfolioMembership) bool {
+		return m.UserID == userID && m.Status == domain.MembershipActive
+	})
+}
+
+func (r *membershipRepository) FindPendingByEmail(ctx context.Context, email string) ([]*domain.PortfolioMembership, error) {
+	email = strings.ToLower(email)
+	return r.find(func(m domain.PortfolioMembership) bool {
+		return m.InviteeEmail == email && m.Status == domain.MembershipPending
+	})
+}
+
+func (r *membershipRepository) Delete(ctx context.Context, id string) error {
+	return r.db.write(ctx, func(s *state) error {
+		if _, ok := s.memberships[id]; !ok {
+			return errNotFound("membership", id)
+		}
+		delete(s.memberships, id)
+		return nil
+	})
+}
+
+// find returns the matching memberships ordered by creation time, like the SQL stores.
+func (r *membershipRepository) find(match func(m domain.PortfolioMembership) bool) ([]*domain.PortfolioMembership, error) {
+	var memberships []*domain.PortfolioMembership
+
+	err := r.db.read(func(s *state) error {
+		for _, record := range s.memberships {
+			if match(record) {
+				memberships = append(memberships, copyMembership(record))
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return memberships[i].ID < memberships[j].ID
+	})
+	return memberships, err
+}
+
+func copyMembership(record domain.PortfolioMembership) *domain.PortfolioMembership {
+	record.AcceptedAt = copyTime(record.AcceptedAt)
+	return &record
+}
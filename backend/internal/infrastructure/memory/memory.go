@@ -0,0 +1,225 @@
+// Package memory implements the repositories in process memory, for tests
+// and for running the server without a database file. Nothing is persisted.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"sync"
+	"time"
+)
+
+type investmentRecord struct {
+	id         string
+	amount     domain.Money
+	investType domain.InvestmentType
+	strategy   domain.InvestmentStrategy
+	version    int
+	createdAt  time.Time
+	updatedAt  time.Time
+}
+
+type portfolioRecord struct {
+	id               string
+	userID           string
+	name             string
+	archivedAt       *time.Time
+	version          int
+	createdAt        time.Time
+	updatedAt        time.Time
+	investmentIDs    []string
+	cashTransactions []domain.CashTransaction
+}
+
+// state is the transactional part of the store. Values are copied in and
+// out so callers never share memory with it.
+type state struct {
+	investments map[string]*investmentRecord
+	portfolios  map[string]*portfolioRecord
+	memberships map[string]domain.PortfolioMembership
+	events      []service.StoredEvent
+	snapshots   map[string]service.Snapshot
+	outbox      []service.OutboxMessage
+	deadLetters []service.DeadLetter
+	lastOutbox  int64 // 最後に振ったアウトボックスのID
+
+	webhookSubscriptions map[string]domain.WebhookSubscription
+	webhookDeliveries    map[string]domain.WebhookDelivery
+}
+
+func newState() *state {
+	return &state{
+		investments: make(map[string]*investmentRecord),
+		portfolios:  make(map[string]*portfolioRecord),
+		memberships: make(map[string]domain.PortfolioMembership),
+		snapshots:   make(map[string]service.Snapshot),
+
+		webhookSubscriptions: make(map[string]domain.WebhookSubscription),
+		webhookDeliveries:    make(map[string]domain.WebhookDelivery),
+	}
+}
+
+// clone returns a deep copy used to roll back a transaction.
+func (s *state) clone() *state {
+	c := newState()
+
+	for id, record := range s.investments {
+		copied := *record
+		c.investments[id] = &copied
+	}
+
+	for id, record := range s.portfolios {
+		copied := *record
+		copied.archivedAt = copyTime(record.archivedAt)
+		copied.investmentIDs = append([]string(nil), record.investmentIDs...)
+		copied.cashTransactions = append([]domain.CashTransaction(nil), record.cashTransactions...)
+		c.portfolios[id] = &copied
+	}
+
+	for id, membership := range s.memberships {
+		membership.AcceptedAt = copyTime(membership.AcceptedAt)
+		c.memberships[id] = membership
+	}
+
+	// 保存済みのイベントは変更されないので、スライスの複製だけでよい
+	c.events = append([]service.StoredEvent(nil), s.events...)
+
+	// スナップショットも置き換えるだけで変更されない
+	for key, snapshot := range s.snapshots {
+		c.snapshots[key] = snapshot
+	}
+
+	// アウトボックスの要素は置き換えで更新するので、スライスの複製だけでよい
+	c.outbox = append([]service.OutboxMessage(nil), s.outbox...)
+	c.deadLetters = append([]service.DeadLetter(nil), s.deadLetters...)
+	c.lastOutbox = s.lastOutbox
+
+	for id, subscription := range s.webhookSubscriptions {
+		c.webhookSubscriptions[id] = *copyWebhookSubscription(subscription)
+	}
+	for id, delivery := range s.webhookDeliveries {
+		c.webhookDeliveries[id] = *copyWebhookDelivery(delivery)
+	}
+
+	return c
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	value := *t
+	return &value
+}
+
+// DB holds the data shared by the repositories of one store.
+//
+// Transactions are serialized: RunInTransaction holds writeMu until it
+// returns, and writes outside a transaction take it for their own duration,
+// so a rollback never discards someone else's write. Reads only take mu and
+// may observe the writes of a transaction that is still running.
+//
+// Users are not part of transactions, like the SQL stores where that
+// repository does not take a context.
+type DB struct {
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	data    *state
+
+	users map[string]domain.User
+}
+
+func NewDB() *DB {
+	return &DB{
+		data:  newState(),
+		users: make(map[string]domain.User),
+	}
+}
+
+type txKey struct{}
+
+// unitOfWork marks a context as running inside a transaction of db.
+type unitOfWork struct {
+	db *DB
+}
+
+func (db *DB) inTransaction(ctx context.Context) bool {
+	uow, ok := ctx.Value(txKey{}).(*unitOfWork)
+	return ok && uow.db == db
+}
+
+func (db *DB) read(fn func(s *state) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return fn(db.data)
+}
+
+// write applies fn under the write lock. fn must check everything before
+// changing the state, so that a failed write leaves it untouched.
+func (db *DB) write(ctx context.Context, fn func(s *state) error) error {
+	if !db.inTransaction(ctx) {
+		db.writeMu.Lock()
+		defer db.writeMu.Unlock()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return fn(db.data)
+}
+
+type transactionManager struct {
+	db *DB
+}
+
+func NewTransactionManager(db *DB) domain.TransactionManager {
+	return &transactionManager{db: db}
+}
+
+// RunInTransaction snapshots the state and restores it if fn fails or
+// panics. Nested calls take their own snapshot, like a savepoint.
+func (tm *transactionManager) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	db := tm.db
+
+	if !db.inTransaction(ctx) {
+		db.writeMu.Lock()
+		defer db.writeMu.Unlock()
+		ctx = context.WithValue(ctx, txKey{}, &unitOfWork{db: db})
+	}
+
+	db.mu.RLock()
+	snapshot := db.data.clone()
+	db.mu.RUnlock()
+
+	rollback := func() {
+		db.mu.Lock()
+		db.data = snapshot
+		db.mu.Unlock()
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+func errConcurrentModification(aggregate string, id string) error {
+	return fmt.Errorf("%w: %s %s", domain.ErrConcurrentModification, aggregate, id)
+}
+
+func errNotFound(kind string, id string) error {
+	return fmt.Errorf("%w: %s %s", domain.ErrNotFound, kind, id)
+}
+
+func errAlreadyExists(kind string, id string) error {
+	return fmt.Errorf("memory: %s %s already exists", kind, id)
+}
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"sync"
+	"testing"
+)
+
+func TestTransactionManager_RollsBackOnPanic(t *testing.T) {
+	db := NewDB()
+	txManager := NewTransactionManager(db)
+	investmentRepo := NewInvestmentRepository(db)
+	ctx := context.Background()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected the panic to be re-raised")
+			}
+		}()
+
+		_ = txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			money, _ := domain.NewMoney(1000, "JPY")
+			investment, _ := domain.NewInvestment(domain.NewInvestmentID("inv-1"), money, domain.Stock, domain.Conservative)
+			if err := investmentRepo.Create(ctx, investment); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("inv-1")); !errors.Is(err, domain.ErrNotFound) {
+		t.Errorf("Expected investment to be rolled back, got %v", err)
+	}
+}
+
+func TestRepositories_CopyValues(t *testing.T) {
+	db := NewDB()
+	portfolioRepo := NewPortfolioRepository(db)
+	ctx := context.Background()
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "user-1")
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	// 保存後や読み込み後の変更はストアに影響しない
+	portfolio.Rename("Changed after save")
+	loaded, _ := portfolioRepo.FindByID(ctx, portfolio.ID())
+	loaded.Rename("Changed after load")
+
+	stored, _ := portfolioRepo.FindByID(ctx, portfolio.ID())
+	if stored.Name != "Main" {
+		t.Errorf("Expected stored name to be unchanged, got %q", stored.Name)
+	}
+}
+
+func TestPortfolioRepository_ConcurrentSaves(t *testing.T) {
+	db := NewDB()
+	txManager := NewTransactionManager(db)
+	portfolioRepo := NewPortfolioRepository(db)
+	ctx := context.Background()
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "user-1")
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded, conflicted := 0, 0
+
+	for i := 0; i < writers; i++ {
+		// 全員が同じバージョンを読み込んでから書き込む
+		loaded, err := portfolioRepo.FindByID(ctx, portfolio.ID())
+		if err != nil {
+			t.Fatalf("FindByID failed: %v", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+				loaded.Rename("Renamed")
+				return portfolioRepo.Save(ctx, loaded)
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, domain.ErrConcurrentModification):
+				conflicted++
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 || conflicted != writers-1 {
+		t.Errorf("Expected 1 success and %d conflicts, got %d and %d", writers-1, succeeded, conflicted)
+	}
+
+	stored, _ := portfolioRepo.FindByID(ctx, portfolio.ID())
+	if stored.Version != 2 {
+		t.Errorf("Expected version 2, got %d", stored.Version)
+	}
+}
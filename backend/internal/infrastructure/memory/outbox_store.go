@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"moneyget/internal/domain/service"
+	"time"
+)
+
+type OutboxStoreDB struct {
+	db *DB
+}
+
+func NewOutboxStoreDB(db *DB) *OutboxStoreDB {
+	return &OutboxStoreDB{db: db}
+}
+
+func (o *OutboxStoreDB) Enqueue(ctx context.Context, events []service.StoredEvent, enqueuedAt time.Time) error {
+	return o.db.write(ctx, func(s *state) error {
+		for _, event := range events {
+			s.lastOutbox++
+			event.EventData = append(json.RawMessage(nil), event.EventData...)
+			s.outbox = append(s.outbox, service.OutboxMessage{
+				ID:            s.lastOutbox,
+				Event:         event,
+				NextAttemptAt: enqueuedAt,
+				CreatedAt:     enqueuedAt,
+			})
+		}
+		return nil
+	})
+}
+
+func (o *OutboxStoreDB) PendingMessages(ctx context.Context, now time.Time, limit int) ([]service.OutboxMessage, error) {
+	var messages []service.OutboxMessage
+	err := o.db.read(func(s *state) error {
+		waiting := make(map[string]bool)
+		for _, message := range s.outbox {
+			if len(messages) == limit {
+				break
+			}
+			stream := message.Event.AggregateType + "/" + message.Event.AggregateID
+			if message.NextAttemptAt.After(now) {
+				waiting[stream] = true
+			}
+			if waiting[stream] {
+				continue
+			}
+			message.Event.EventData = append(json.RawMessage(nil), message.Event.EventData...)
+			messages = append(messages, message)
+		}
+		return nil
+	})
+	return messages, err
+}
+
+func (o *OutboxStoreDB) DeleteMessage(ctx context.Context, id int64) error {
+	return o.db.write(ctx, func(s *state) error {
+		s.outbox = removeMessage(s.outbox, id)
+		return nil
+	})
+}
+
+func (o *OutboxStoreDB) RescheduleMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	return o.db.write(ctx, func(s *state) error {
+		for i, message := range s.outbox {
+			if message.ID == id {
+				message.Attempts = attempts
+				message.NextAttemptAt = nextAttemptAt
+				message.LastError = lastError
+				s.outbox[i] = message
+			}
+		}
+		return nil
+	})
+}
+
+func (o *OutboxStoreDB) DeadLetter(ctx context.Context, message service.OutboxMessage, reason string, failedAt time.Time) error {
+	return o.db.write(ctx, func(s *state) error {
+		event := message.Event
+		event.EventData = append(json.RawMessage(nil), event.EventData...)
+		s.deadLetters = append(s.deadLetters, service.DeadLetter{
+			ID:        int64(len(s.deadLetters) + 1),
+			MessageID: message.ID,
+			Event:     event,
+			Attempts:  message.Attempts,
+			Reason:    reason,
+			FailedAt:  failedAt,
+		})
+		s.outbox = removeMessage(s.outbox, message.ID)
+		return nil
+	})
+}
+
+func (o *OutboxStoreDB) DeadLetters(ctx context.Context, limit int) ([]service.DeadLetter, error) {
+	var letters []service.DeadLetter
+	err := o.db.read(func(s *state) error {
+		for _, letter := range s.deadLetters {
+			if len(letters) == limit {
+				break
+			}
+			letter.Event.EventData = append(json.RawMessage(nil), letter.Event.EventData...)
+			letters = append(letters, letter)
+		}
+		return nil
+	})
+	return letters, err
+}
+
+// removeMessage returns the outbox without the message, in a new slice so
+// that a transaction's snapshot is left untouched.
+func removeMessage(outbox []service.OutboxMessage, id int64) []service.OutboxMessage {
+	kept := make([]service.OutboxMessage, 0, len(outbox))
+	for _, message := range outbox {
+		if message.ID != id {
+			kept = append(kept, message)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,274 @@
+package memory
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"sort"
+	"strings"
+)
+
+type portfolioRepository struct {
+	db *DB
+}
+
+func NewPortfolioRepository(db *DB) domain.PortfolioRepository {
+	return &portfolioRepository{db: db}
+}
+
+func (r *portfolioRepository) Create(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := r.db.write(ctx, func(s *state) error {
+		id := portfolio.ID().Value
+		if _, ok := s.portfolios[id]; ok {
+			return errAlreadyExists("portfolio", id)
+		}
+		if s.portfolioNameTaken(portfolio) {
+			return domain.ErrDuplicatePortfolioName
+		}
+
+		s.portfolios[id] = newPortfolioRecord(portfolio, 1, nil)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version = 1
+	return nil
+}
+
+// Save inserts a new portfolio (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
+func (r *portfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := r.db.write(ctx, func(s *state) error {
+		id := portfolio.ID().Value
+
+		stored, ok := s.portfolios[id]
+		if ok && stored.version != portfolio.Version {
+			return errConcurrentModification("portfolio", id)
+		}
+		if s.portfolioNameTaken(portfolio) {
+			return domain.ErrDuplicatePortfolioName
+		}
+
+		s.portfolios[id] = newPortfolioRecord(portfolio, portfolio.Version+1, stored)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version++
+	return nil
+}
+
+// Update changes an existing portfolio. Like Save it only applies if the
+// stored version still matches.
+func (r *portfolioRepository) Update(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := r.db.write(ctx, func(s *state) error {
+		id := portfolio.ID().Value
+
+		stored, ok := s.portfolios[id]
+		if !ok || stored.version != portfolio.Version {
+			return errConcurrentModification("portfolio", id)
+		}
+		if s.portfolioNameTaken(portfolio) {
+			return domain.ErrDuplicatePortfolioName
+		}
+
+		s.portfolios[id] = newPortfolioRecord(portfolio, portfolio.Version+1, stored)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version++
+	return nil
+}
+
+func (r *portfolioRepository) FindByID(ctx context.Context, id domain.PortfolioID) (*domain.Portfolio, error) {
+	var portfolio *domain.Portfolio
+
+	err := r.db.read(func(s *state) error {
+		record, ok := s.portfolios[id.Value]
+		if !ok {
+			return errNotFound("portfolio", id.Value)
+		}
+		portfolio = s.toDomain(record)
+		return nil
+	})
+
+	return portfolio, err
+}
+
+// FindByIDs loads the portfolios in the order of ids. Unknown ids are skipped.
+func (r *portfolioRepository) FindByIDs(ctx context.Context, ids []domain.PortfolioID) ([]*domain.Portfolio, error) {
+	portfolios := []*domain.Portfolio{}
+
+	err := r.db.read(func(s *state) error {
+		seen := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			record, ok := s.portfolios[id.Value]
+			if !ok || seen[id.Value] {
+				continue
+			}
+			seen[id.Value] = true
+			portfolios = append(portfolios, s.toDomain(record))
+		}
+		return nil
+	})
+
+	return portfolios, err
+}
+
+func (r *portfolioRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	return r.findPortfolios(func(record *portfolioRecord) bool {
+		return record.userID == userID
+	})
+}
+
+func (r *portfolioRepository) FindAll(ctx context.Context) ([]*domain.Portfolio, error) {
+	return r.findPortfolios(func(record *portfolioRecord) bool {
+		return true
+	})
+}
+
+// findPortfolios returns the portfolios whose record matches, oldest first.
+func (r *portfolioRepository) findPortfolios(match func(record *portfolioRecord) bool) ([]*domain.Portfolio, error) {
+	portfolios := []*domain.Portfolio{}
+
+	err := r.db.read(func(s *state) error {
+		var records []*portfolioRecord
+		for _, record := range s.portfolios {
+			if match(record) {
+				records = append(records, record)
+			}
+		}
+
+		sort.Slice(records, func(i, j int) bool {
+			if !records[i].createdAt.Equal(records[j].createdAt) {
+				return records[i].createdAt.Before(records[j].createdAt)
+			}
+			return records[i].id < records[j].id
+		})
+
+		for _, record := range records {
+			portfolios = append(portfolios, s.toDomain(record))
+		}
+		return nil
+	})
+
+	return portfolios, err
+}
+
+func (r *portfolioRepository) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
+	var portfolio *domain.Portfolio
+
+	err := r.db.read(func(s *state) error {
+		for _, record := range s.portfolios {
+			for _, id := range record.investmentIDs {
+				if id == investmentID.Value {
+					portfolio = s.toDomain(record)
+					return nil
+				}
+			}
+		}
+		return errNotFound("portfolio with investment", investmentID.Value)
+	})
+
+	return portfolio, err
+}
+
+// Delete removes the portfolio together with its cash ledger and
+// memberships. Like Save it only applies if the stored version still matches.
+func (r *portfolioRepository) Delete(ctx context.Context, portfolio *domain.Portfolio) error {
+	id := portfolio.ID()
+	return r.db.write(ctx, func(s *state) error {
+		stored, ok := s.portfolios[id.Value]
+		if !ok || stored.version != portfolio.Version {
+			return errConcurrentModification("portfolio", id.Value)
+		}
+		delete(s.portfolios, id.Value)
+
+		for membershipID, membership := range s.memberships {
+			if membership.PortfolioID == id {
+				delete(s.memberships, membershipID)
+			}
+		}
+		return nil
+	})
+}
+
+// portfolioNameTaken reports whether another portfolio of the same owner
+// has the name, ignoring case. The SQL stores enforce this with a unique
+// index.
+func (s *state) portfolioNameTaken(portfolio *domain.Portfolio) bool {
+	for id, record := range s.portfolios {
+		if id != portfolio.ID().Value && record.userID == portfolio.UserID && strings.EqualFold(record.name, portfolio.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// newPortfolioRecord copies the portfolio. The cash ledger is append-only:
+// entries that are already stored are kept as they were.
+func newPortfolioRecord(portfolio *domain.Portfolio, version int, stored *portfolioRecord) *portfolioRecord {
+	record := &portfolioRecord{
+		id:         portfolio.ID().Value,
+		userID:     portfolio.UserID,
+		name:       portfolio.Name,
+		archivedAt: copyTime(portfolio.ArchivedAt),
+		version:    version,
+		createdAt:  portfolio.CreatedAt,
+		updatedAt:  portfolio.UpdatedAt,
+	}
+
+	for _, investment := range portfolio.GetInvestments() {
+		record.investmentIDs = append(record.investmentIDs, investment.ID().Value)
+	}
+
+	seen := make(map[string]bool)
+	if stored != nil {
+		// 作成日時は最初に保存された値を維持する
+		record.createdAt = stored.createdAt
+		record.cashTransactions = append(record.cashTransactions, stored.cashTransactions...)
+		for _, tx := range stored.cashTransactions {
+			seen[tx.ID] = true
+		}
+	}
+	for _, tx := range portfolio.CashTransactions {
+		if !seen[tx.ID] {
+			record.cashTransactions = append(record.cashTransactions, *tx)
+			seen[tx.ID] = true
+		}
+	}
+
+	return record
+}
+
+func (s *state) toDomain(record *portfolioRecord) *domain.Portfolio {
+	cashTransactions := make([]*domain.CashTransaction, 0, len(record.cashTransactions))
+	for _, tx := range record.cashTransactions {
+		tx := tx
+		cashTransactions = append(cashTransactions, &tx)
+	}
+	// 発生日時順（同時刻は記録順）に並べる
+	sort.SliceStable(cashTransactions, func(i, j int) bool {
+		return cashTransactions[i].OccurredAt.Before(cashTransactions[j].OccurredAt)
+	})
+
+	// 保存済みの状態は投資上限やアーカイブの検証を通さずにそのまま復元する
+	return domain.ReconstitutePortfolio(domain.PortfolioState{
+		ID:               domain.NewPortfolioID(record.id),
+		UserID:           record.userID,
+		Name:             record.name,
+		Investments:      s.portfolioInvestments(record),
+		CashTransactions: cashTransactions,
+		ArchivedAt:       copyTime(record.archivedAt),
+		Version:          record.version,
+		CreatedAt:        record.createdAt,
+		UpdatedAt:        record.updatedAt,
+	})
+}
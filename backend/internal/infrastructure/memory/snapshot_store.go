@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"moneyget/internal/domain/service"
+)
+
+type SnapshotStoreDB struct {
+	db *DB
+}
+
+func NewSnapshotStoreDB(db *DB) *SnapshotStoreDB {
+	return &SnapshotStoreDB{db: db}
+}
+
+func (s *SnapshotStoreDB) SaveSnapshot(ctx context.Context, snapshot service.Snapshot) error {
+	return s.db.write(ctx, func(st *state) error {
+		key := snapshotKey(snapshot.AggregateType, snapshot.AggregateID)
+		if stored, ok := st.snapshots[key]; ok && stored.Version > snapshot.Version {
+			return nil
+		}
+
+		snapshot.Data = append(json.RawMessage(nil), snapshot.Data...)
+		st.snapshots[key] = snapshot
+		return nil
+	})
+}
+
+func (s *SnapshotStoreDB) LatestSnapshot(ctx context.Context, aggregateType string, aggregateID string) (*service.Snapshot, error) {
+	var snapshot *service.Snapshot
+	err := s.db.read(func(st *state) error {
+		if stored, ok := st.snapshots[snapshotKey(aggregateType, aggregateID)]; ok {
+			stored.Data = append(json.RawMessage(nil), stored.Data...)
+			snapshot = &stored
+		}
+		return nil
+	})
+	return snapshot, err
+}
+
+func (s *SnapshotStoreDB) DeleteSnapshots(ctx context.Context, aggregateType string, schemaHash string) (int, error) {
+	deleted := 0
+	err := s.db.write(ctx, func(st *state) error {
+		for key, snapshot := range st.snapshots {
+			if snapshot.AggregateType == aggregateType && snapshot.SchemaHash != schemaHash {
+				delete(st.snapshots, key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func snapshotKey(aggregateType string, aggregateID string) string {
+	return aggregateType + "/" + aggregateID
+}
@@ -0,0 +1,96 @@
+package memory
+
+import (
+	"moneyget/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type userRepository struct {
+	db *DB
+}
+
+func NewUserRepository(db *DB) domain.UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) Create(user *domain.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.emailTaken(user.Email, "") {
+		return errAlreadyExists("user with email", user.Email)
+	}
+
+	user.ID = uuid.New().String()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	r.db.users[user.ID] = *user
+	return nil
+}
+
+func (r *userRepository) FindByID(id string) (*domain.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	user, ok := r.db.users[id]
+	if !ok {
+		return nil, errNotFound("user", id)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) FindByEmail(email string) (*domain.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, user := range r.db.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, errNotFound("user with email", email)
+}
+
+func (r *userRepository) Update(user *domain.User) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.users[user.ID]
+	if !ok {
+		return errNotFound("user", user.ID)
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return errAlreadyExists("user with email", user.Email)
+	}
+
+	stored.Name = user.Name
+	stored.Email = user.Email
+	stored.Password = user.Password
+	r.db.users[user.ID] = stored
+	return nil
+}
+
+func (r *userRepository) Delete(id string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.users[id]; !ok {
+		return errNotFound("user", id)
+	}
+	delete(r.db.users, id)
+	return nil
+}
+
+// emailTaken reports whether another user already has the email. The SQL
+// stores enforce this with a UNIQUE constraint, which is case-sensitive.
+func (r *userRepository) emailTaken(email string, exceptID string) bool {
+	for id, user := range r.db.users {
+		if id != exceptID && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
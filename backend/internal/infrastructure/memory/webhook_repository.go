@@ -0,0 +1,176 @@
+package memory
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"sort"
+	"time"
+)
+
+type webhookRepository struct {
+	db *DB
+}
+
+func NewWebhookRepository(db *DB) domain.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+func (r *webhookRepository) SaveSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	return r.db.write(ctx, func(s *state) error {
+		s.webhookSubscriptions[subscription.ID] = *copyWebhookSubscription(*subscription)
+		return nil
+	})
+}
+
+func (r *webhookRepository) FindSubscriptionByID(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	var subscription *domain.WebhookSubscription
+
+	err := r.db.read(func(s *state) error {
+		record, ok := s.webhookSubscriptions[id]
+		if !ok {
+			return errNotFound("webhook subscription", id)
+		}
+		subscription = copyWebhookSubscription(record)
+		return nil
+	})
+
+	return subscription, err
+}
+
+func (r *webhookRepository) FindSubscriptionsByUserID(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error) {
+	var subscriptions []*domain.WebhookSubscription
+
+	err := r.db.read(func(s *state) error {
+		for _, record := range s.webhookSubscriptions {
+			if record.UserID == userID {
+				subscriptions = append(subscriptions, copyWebhookSubscription(record))
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions, err
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	return r.db.write(ctx, func(s *state) error {
+		if _, ok := s.webhookSubscriptions[id]; !ok {
+			return errNotFound("webhook subscription", id)
+		}
+		delete(s.webhookSubscriptions, id)
+
+		for deliveryID, delivery := range s.webhookDeliveries {
+			if delivery.SubscriptionID == id {
+				delete(s.webhookDeliveries, deliveryID)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return r.db.write(ctx, func(s *state) error {
+		if _, ok := s.webhookDeliveries[delivery.ID]; !ok {
+			s.webhookDeliveries[delivery.ID] = *copyWebhookDelivery(*delivery)
+		}
+		return nil
+	})
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return r.db.write(ctx, func(s *state) error {
+		stored, ok := s.webhookDeliveries[delivery.ID]
+		if !ok {
+			return errNotFound("webhook delivery", delivery.ID)
+		}
+
+		// 状態だけを更新する
+		record := *copyWebhookDelivery(*delivery)
+		record.SubscriptionID = stored.SubscriptionID
+		record.EventType = stored.EventType
+		record.Payload = stored.Payload
+		record.CreatedAt = stored.CreatedAt
+		s.webhookDeliveries[delivery.ID] = record
+		return nil
+	})
+}
+
+func (r *webhookRepository) FindDeliveryByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	var delivery *domain.WebhookDelivery
+
+	err := r.db.read(func(s *state) error {
+		record, ok := s.webhookDeliveries[id]
+		if !ok {
+			return errNotFound("webhook delivery", id)
+		}
+		delivery = copyWebhookDelivery(record)
+		return nil
+	})
+
+	return delivery, err
+}
+
+func (r *webhookRepository) FindDeliveriesBySubscriptionID(ctx context.Context, subscriptionID string, limit int) ([]*domain.WebhookDelivery, error) {
+	deliveries, err := r.findDeliveries(func(d domain.WebhookDelivery) bool {
+		return d.SubscriptionID == subscriptionID
+	})
+
+	// 新しい順
+	for i, j := 0, len(deliveries)-1; i < j; i, j = i+1, j-1 {
+		deliveries[i], deliveries[j] = deliveries[j], deliveries[i]
+	}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+func (r *webhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	deliveries, err := r.findDeliveries(func(d domain.WebhookDelivery) bool {
+		return d.Status == domain.WebhookDeliveryPending && !d.NextAttemptAt.After(now)
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, err
+}
+
+// findDeliveries returns the matching deliveries oldest first, like the SQL stores.
+func (r *webhookRepository) findDeliveries(match func(d domain.WebhookDelivery) bool) ([]*domain.WebhookDelivery, error) {
+	var deliveries []*domain.WebhookDelivery
+
+	err := r.db.read(func(s *state) error {
+		for _, record := range s.webhookDeliveries {
+			if match(record) {
+				deliveries = append(deliveries, copyWebhookDelivery(record))
+			}
+		}
+		return nil
+	})
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries, err
+}
+
+func copyWebhookSubscription(record domain.WebhookSubscription) *domain.WebhookSubscription {
+	record.EventTypes = append([]string(nil), record.EventTypes...)
+	return &record
+}
+
+func copyWebhookDelivery(record domain.WebhookDelivery) *domain.WebhookDelivery {
+	record.Payload = append([]byte(nil), record.Payload...)
+	record.DeliveredAt = copyTime(record.DeliveredAt)
+	return &record
+}
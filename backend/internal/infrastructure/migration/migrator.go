@@ -0,0 +1,366 @@
+// Package migration applies numbered SQL migrations and records them in a
+// schema_migrations table. It is shared by the SQLite and PostgreSQL stores,
+// which embed their own migration files.
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrMigrationChecksumMismatch = errors.New("migration checksum mismatch")
+	ErrUnknownMigration          = errors.New("applied migration is missing from the binary")
+	ErrIrreversibleMigration     = errors.New("migration has no down script")
+	ErrNoMigrationToRollback     = errors.New("no applied migration to roll back")
+)
+
+// migrationFilePattern matches files such as 0002_add_outbox.up.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change. Checksum is the SHA-256 of the up
+// script and is stored when the migration is applied, so edits to an already
+// applied migration are detected.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status describes a migration known to the binary or recorded in
+// the database.
+type Status struct {
+	Version          int
+	Name             string
+	Applied          bool
+	AppliedAt        *time.Time
+	ChecksumMismatch bool
+	// Missing is true for migrations recorded in the database but not
+	// embedded in this binary (e.g. after a downgrade).
+	Missing bool
+}
+
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt sql.NullTime
+}
+
+// Placeholder returns the bind parameter for the n-th (1-based) argument of
+// a statement in the database's SQL dialect.
+type Placeholder func(n int) string
+
+var (
+	// QuestionMark is used by SQLite.
+	QuestionMark Placeholder = func(int) string { return "?" }
+	// Dollar is used by PostgreSQL.
+	Dollar Placeholder = func(n int) string { return "$" + strconv.Itoa(n) }
+)
+
+type Migrator struct {
+	db          *sql.DB
+	placeholder Placeholder
+	migrations  []Migration
+}
+
+// NewMigrator loads the migrations at the root of fsys.
+func NewMigrator(db *sql.DB, fsys fs.FS, placeholder Placeholder) (*Migrator, error) {
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, placeholder: placeholder, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			migration.Checksum = checksum(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction. It refuses to run if an applied migration was modified or is
+// unknown to the binary.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := m.verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := m.apply(ctx, migration); err != nil {
+			return migrated, err
+		}
+		migrated = append(migrated, migration)
+	}
+
+	return migrated, nil
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	applied, err := m.verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if err := m.revert(ctx, migration); err != nil {
+			return nil, err
+		}
+		return &migration, nil
+	}
+
+	return nil, ErrNoMigrationToRollback
+}
+
+// Redo rolls back the most recently applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) (*Migration, error) {
+	migration, err := m.Down(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.apply(ctx, *migration); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = timePtr(record.appliedAt)
+			status.ChecksumMismatch = record.checksum != migration.Checksum
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range applied {
+		statuses = append(statuses, Status{
+			Version:   record.version,
+			Name:      record.name,
+			Applied:   true,
+			AppliedAt: timePtr(record.appliedAt),
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// verify checks the applied migrations against the embedded ones.
+func (m *Migrator) verify(ctx context.Context) (map[int]appliedMigration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	for version, record := range applied {
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrUnknownMigration, version, record.name)
+		}
+		if record.checksum != migration.Checksum {
+			return nil, fmt.Errorf("%w: %04d_%s", ErrMigrationChecksumMismatch, version, migration.Name)
+		}
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var record appliedMigration
+		if err := rows.Scan(&record.version, &record.name, &record.checksum, &record.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[record.version] = record
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) apply(ctx context.Context, migration Migration) error {
+	err := m.inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(
+				"INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (%s, %s, %s, %s)",
+				m.placeholder(1), m.placeholder(2), m.placeholder(3), m.placeholder(4),
+			),
+			migration.Version,
+			migration.Name,
+			migration.Checksum,
+			time.Now().UTC(),
+		)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("applying migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func (m *Migrator) revert(ctx context.Context, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("%w: %04d_%s", ErrIrreversibleMigration, migration.Version, migration.Name)
+	}
+
+	err := m.inTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = "+m.placeholder(1), migration.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("reverting migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+// inTransaction runs a migration and its bookkeeping atomically. Both SQLite
+// and PostgreSQL support transactional DDL.
+func (m *Migrator) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("error rolling back transaction: %v (original error: %v)", rbErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,234 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_create_accounts.up.sql":   {Data: []byte("CREATE TABLE accounts (id TEXT PRIMARY KEY);")},
+		"0001_create_accounts.down.sql": {Data: []byte("DROP TABLE accounts;")},
+		"0002_create_ledger.up.sql":     {Data: []byte("CREATE TABLE ledger (id TEXT PRIMARY KEY);")},
+		"0002_create_ledger.down.sql":   {Data: []byte("DROP TABLE ledger;")},
+	}
+}
+
+func TestMigrator_UpDownRedo(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db, testMigrations(), QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != 2 || applied[0].Version != 1 || applied[1].Version != 2 {
+		t.Fatalf("Expected migrations 1 and 2 to be applied in order, got %+v", applied)
+	}
+	if !tableExists(t, db, "accounts") || !tableExists(t, db, "ledger") {
+		t.Fatal("Expected both tables to exist after Up")
+	}
+
+	// 2回目は何も適用しない
+	applied, err = migrator.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Expected no pending migrations, got %+v (err: %v)", applied, err)
+	}
+
+	reverted, err := migrator.Down(ctx)
+	if err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if reverted.Version != 2 || tableExists(t, db, "ledger") || !tableExists(t, db, "accounts") {
+		t.Fatalf("Expected only migration 2 to be reverted, got %d", reverted.Version)
+	}
+
+	redone, err := migrator.Redo(ctx)
+	if err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	if redone.Version != 1 || !tableExists(t, db, "accounts") {
+		t.Fatalf("Expected migration 1 to be redone, got %d", redone.Version)
+	}
+
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if _, err := migrator.Down(ctx); !errors.Is(err, ErrNoMigrationToRollback) {
+		t.Errorf("Expected ErrNoMigrationToRollback, got %v", err)
+	}
+}
+
+func TestMigrator_Status(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+
+	files := testMigrations()
+	first, err := NewMigrator(db, fstest.MapFS{
+		"0001_create_accounts.up.sql": files["0001_create_accounts.up.sql"],
+	}, QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := first.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	migrator, err := NewMigrator(db, files, QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 statuses, got %d", len(statuses))
+	}
+	if !statuses[0].Applied || statuses[0].AppliedAt == nil || statuses[0].ChecksumMismatch {
+		t.Errorf("Expected migration 1 to be applied, got %+v", statuses[0])
+	}
+	if statuses[1].Applied || statuses[1].AppliedAt != nil {
+		t.Errorf("Expected migration 2 to be pending, got %+v", statuses[1])
+	}
+}
+
+func TestMigrator_ChecksumVerification(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db, testMigrations(), QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	// 適用済みのマイグレーションを書き換える
+	files := testMigrations()
+	files["0001_create_accounts.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE accounts (id TEXT PRIMARY KEY, name TEXT);")}
+	edited, err := NewMigrator(db, files, QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if _, err := edited.Up(ctx); !errors.Is(err, ErrMigrationChecksumMismatch) {
+		t.Errorf("Expected ErrMigrationChecksumMismatch from Up, got %v", err)
+	}
+	if _, err := edited.Down(ctx); !errors.Is(err, ErrMigrationChecksumMismatch) {
+		t.Errorf("Expected ErrMigrationChecksumMismatch from Down, got %v", err)
+	}
+
+	statuses, err := edited.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if !statuses[0].ChecksumMismatch {
+		t.Errorf("Expected status to report the checksum mismatch, got %+v", statuses[0])
+	}
+
+	// 適用済みだがバイナリに含まれないマイグレーション
+	delete(files, "0002_create_ledger.up.sql")
+	delete(files, "0002_create_ledger.down.sql")
+	files["0001_create_accounts.up.sql"] = testMigrations()["0001_create_accounts.up.sql"]
+	older, err := NewMigrator(db, files, QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	if _, err := older.Up(ctx); !errors.Is(err, ErrUnknownMigration) {
+		t.Errorf("Expected ErrUnknownMigration, got %v", err)
+	}
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+
+	files := testMigrations()
+	files["0003_broken.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE broken (id TEXT); INSERT INTO missing VALUES (1);")}
+
+	migrator, err := NewMigrator(db, files, QuestionMark)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("Expected Up to fail")
+	}
+	if len(applied) != 2 {
+		t.Errorf("Expected the 2 valid migrations to be applied, got %d", len(applied))
+	}
+	if tableExists(t, db, "broken") {
+		t.Error("Expected the failed migration to be rolled back")
+	}
+
+	statuses, _ := migrator.Status(ctx)
+	if statuses[2].Applied {
+		t.Error("Failed migration should not be recorded")
+	}
+
+	if _, err := migrator.Down(ctx); err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if _, err := migrator.Redo(ctx); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+}
+
+func TestLoadMigrations_InvalidFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"bad name", fstest.MapFS{"create_accounts.sql": {Data: []byte("SELECT 1;")}}},
+		{"down only", fstest.MapFS{"0001_create_accounts.down.sql": {Data: []byte("SELECT 1;")}}},
+		{"conflicting names", fstest.MapFS{
+			"0001_create_accounts.up.sql": {Data: []byte("SELECT 1;")},
+			"0001_create_ledger.up.sql":   {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadMigrations(tt.files); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
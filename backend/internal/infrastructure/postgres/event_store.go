@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type EventStoreDB struct {
+	db *sql.DB
+}
+
+func NewEventStoreDB(db *sql.DB) *EventStoreDB {
+	return &EventStoreDB{db: db}
+}
+
+// Append joins the transaction of the context, so that events can be
+// stored atomically with the state they describe.
+func (e *EventStoreDB) Append(ctx context.Context, expectedVersion int, events []service.StoredEvent) (int, error) {
+	if len(events) == 0 {
+		return expectedVersion, nil
+	}
+	aggregateType, aggregateID := events[0].AggregateType, events[0].AggregateID
+
+	var version int
+	err := runInTransaction(ctx, e.db, func(ctx context.Context) error {
+		q := conn(ctx, e.db)
+
+		err := q.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(sequence), 0) FROM events
+			WHERE aggregate_type = $1 AND aggregate_id = $2
+		`, aggregateType, aggregateID).Scan(&version)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != service.AnyVersion && version != expectedVersion {
+			return errStreamVersion(aggregateType, aggregateID, version, expectedVersion)
+		}
+
+		for _, event := range events {
+			version++
+			// JSONB には文字列として渡す（[]byte は bytea として送信されるため）
+			_, err := q.ExecContext(ctx, `
+				INSERT INTO events (aggregate_type, aggregate_id, sequence, event_type, schema_version, event_data, occurred_at, actor_id, request_id)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`, aggregateType, aggregateID, version, event.EventType, event.SchemaVersion, string(event.EventData), event.OccurredAt,
+				event.ActorID, event.RequestID)
+			if isUniqueViolation(err) {
+				// 同じバージョンへの追記が並行して行われた
+				return errStreamVersion(aggregateType, aggregateID, version-1, expectedVersion)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+const eventColumns = `id, aggregate_type, aggregate_id, sequence, event_type, schema_version, event_data, occurred_at, actor_id, request_id`
+
+func (e *EventStoreDB) ReadStream(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]service.StoredEvent, error) {
+	return e.query(ctx, `
+		SELECT `+eventColumns+`
+		FROM events
+		WHERE aggregate_type = $1 AND aggregate_id = $2 AND sequence > $3
+		ORDER BY sequence
+	`, aggregateType, aggregateID, afterSequence)
+}
+
+func (e *EventStoreDB) LastSequence(ctx context.Context, aggregateType string, aggregateID string) (int, error) {
+	var sequence int
+	err := conn(ctx, e.db).QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(sequence), 0) FROM events
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+	`, aggregateType, aggregateID).Scan(&sequence)
+	return sequence, err
+}
+
+func (e *EventStoreDB) QueryEvents(ctx context.Context, filter service.EventFilter) ([]service.StoredEvent, error) {
+	var params queryParams
+	conds := []string{"id > " + params.add(filter.AfterID)}
+
+	if filter.AggregateType != "" {
+		conds = append(conds, "aggregate_type = "+params.add(filter.AggregateType))
+	}
+	if filter.AggregateID != "" {
+		conds = append(conds, "aggregate_id = "+params.add(filter.AggregateID))
+	}
+	if len(filter.EventTypes) > 0 {
+		conds = append(conds, "event_type = ANY("+params.add(pq.Array(filter.EventTypes))+")")
+	}
+	if filter.ActorID != "" {
+		conds = append(conds, "actor_id = "+params.add(filter.ActorID))
+	}
+	if filter.From != nil {
+		conds = append(conds, "occurred_at >= "+params.add(*filter.From))
+	}
+	if filter.To != nil {
+		conds = append(conds, "occurred_at < "+params.add(*filter.To))
+	}
+
+	query := `SELECT ` + eventColumns + ` FROM events WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY id LIMIT ` + params.add(filter.Limit)
+	return e.query(ctx, query, params...)
+}
+
+func (e *EventStoreDB) query(ctx context.Context, query string, args ...interface{}) ([]service.StoredEvent, error) {
+	rows, err := conn(ctx, e.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []service.StoredEvent
+	for rows.Next() {
+		var event service.StoredEvent
+		var data string
+		if err := rows.Scan(
+			&event.ID, &event.AggregateType, &event.AggregateID, &event.Sequence,
+			&event.EventType, &event.SchemaVersion, &data, &event.OccurredAt,
+			&event.ActorID, &event.RequestID,
+		); err != nil {
+			return nil, err
+		}
+		event.EventData = []byte(data)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListStreams returns the IDs of the streams of an aggregate type, in the
+// order their first event was stored.
+func (e *EventStoreDB) ListStreams(ctx context.Context, aggregateType string) ([]string, error) {
+	rows, err := conn(ctx, e.db).QueryContext(ctx, `
+		SELECT aggregate_id FROM events
+		WHERE aggregate_type = $1
+		GROUP BY aggregate_id
+		ORDER BY MIN(id)
+	`, aggregateType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func errStreamVersion(aggregateType string, aggregateID string, version int, expected int) error {
+	return fmt.Errorf("%w: stream %s %s is at version %d, expected %d",
+		domain.ErrConcurrentModification, aggregateType, aggregateID, version, expected)
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,259 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"moneyget/internal/domain"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type investmentRepository struct {
+	db *sql.DB
+}
+
+func NewInvestmentRepository(db *sql.DB) domain.InvestmentRepository {
+	return &investmentRepository{db: db}
+}
+
+func (r *investmentRepository) Create(ctx context.Context, investment *domain.Investment) error {
+	query := `
+		INSERT INTO investments (id, amount, currency, type, strategy, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, 1, $6, $7)
+	`
+
+	amount := investment.Amount()
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		investment.ID().Value,
+		amount.Amount,
+		amount.Currency,
+		string(investment.Type()),
+		string(investment.Strategy()),
+		investment.CreatedAt,
+		investment.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	investment.Version = 1
+	return nil
+}
+
+// Save inserts a new investment (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
+func (r *investmentRepository) Save(ctx context.Context, investment *domain.Investment) error {
+	query := `
+		INSERT INTO investments (id, amount, currency, type, strategy, version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			amount = excluded.amount,
+			currency = excluded.currency,
+			type = excluded.type,
+			strategy = excluded.strategy,
+			version = excluded.version,
+			updated_at = excluded.updated_at
+		WHERE investments.version = $9
+	`
+
+	amount := investment.Amount()
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
+		investment.ID().Value,
+		amount.Amount,
+		amount.Currency,
+		string(investment.Type()),
+		string(investment.Strategy()),
+		investment.Version+1,
+		investment.CreatedAt,
+		investment.UpdatedAt,
+		investment.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := checkVersionedWrite(result, "investment", investment.ID().Value); err != nil {
+		return err
+	}
+
+	investment.Version++
+	return nil
+}
+
+const investmentColumns = `id, amount, currency, type, strategy, version, created_at, updated_at`
+
+func (r *investmentRepository) FindByID(ctx context.Context, id domain.InvestmentID) (*domain.Investment, error) {
+	query := `SELECT ` + investmentColumns + ` FROM investments WHERE id = $1`
+	return scanInvestment(conn(ctx, r.db).QueryRowContext(ctx, query, id.Value))
+}
+
+func (r *investmentRepository) FindAllByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.Investment, error) {
+	query := `
+		SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.version, i.created_at, i.updated_at
+		FROM investments i
+		JOIN portfolio_investments pi ON i.id = pi.investment_id
+		WHERE pi.portfolio_id = $1
+		ORDER BY i.created_at, i.id
+	`
+	return r.query(ctx, query, portfolioID.Value)
+}
+
+func (r *investmentRepository) FindAll(ctx context.Context) ([]*domain.Investment, error) {
+	query := `SELECT ` + investmentColumns + ` FROM investments ORDER BY created_at, id`
+	return r.query(ctx, query)
+}
+
+func (r *investmentRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.Investment, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var investments []*domain.Investment
+	for rows.Next() {
+		investment, err := scanInvestment(rows)
+		if err != nil {
+			return nil, err
+		}
+		investments = append(investments, investment)
+	}
+
+	return investments, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanInvestment scans the investment columns, followed by any extra
+// columns into extra.
+func scanInvestment(row rowScanner, extra ...interface{}) (*domain.Investment, error) {
+	var id string
+	var amount float64
+	var currency string
+	var investmentType string
+	var strategy string
+	var version int
+	var createdAt time.Time
+	var updatedAt time.Time
+
+	dest := []interface{}{&id, &amount, &currency, &investmentType, &strategy, &version, &createdAt, &updatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// 保存済みの値は検証せずにそのまま復元する
+	return domain.ReconstituteInvestment(
+		domain.NewInvestmentID(id),
+		domain.Money{Amount: amount, Currency: currency},
+		domain.InvestmentType(investmentType),
+		domain.InvestmentStrategy(strategy),
+		version,
+		createdAt,
+		updatedAt,
+	), nil
+}
+
+func (r *investmentRepository) Delete(ctx context.Context, id domain.InvestmentID) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM investments WHERE id = $1", id.Value)
+	return err
+}
+
+// Find returns one page of investments, ordered by the sort key of the query
+// and then by id so that the cursor position is unambiguous.
+func (r *investmentRepository) Find(ctx context.Context, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := query.DecodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	var conds []string
+	var params queryParams
+
+	if len(query.PortfolioIDs) > 0 {
+		ids := make([]string, len(query.PortfolioIDs))
+		for i, id := range query.PortfolioIDs {
+			ids[i] = id.Value
+		}
+		conds = append(conds, "i.id IN (SELECT investment_id FROM portfolio_investments WHERE portfolio_id = ANY("+params.add(pq.Array(ids))+"))")
+	}
+	if len(query.Types) > 0 {
+		types := make([]string, len(query.Types))
+		for i, t := range query.Types {
+			types[i] = string(t)
+		}
+		conds = append(conds, "i.type = ANY("+params.add(pq.Array(types))+")")
+	}
+	if len(query.Strategies) > 0 {
+		strategies := make([]string, len(query.Strategies))
+		for i, s := range query.Strategies {
+			strategies[i] = string(s)
+		}
+		conds = append(conds, "i.strategy = ANY("+params.add(pq.Array(strategies))+")")
+	}
+	if query.Currency != "" {
+		conds = append(conds, "i.currency = "+params.add(query.Currency))
+	}
+	if query.MinAmount != nil {
+		conds = append(conds, "i.amount >= "+params.add(*query.MinAmount))
+	}
+	if query.MaxAmount != nil {
+		conds = append(conds, "i.amount <= "+params.add(*query.MaxAmount))
+	}
+	if query.CreatedFrom != nil {
+		conds = append(conds, "i.created_at >= "+params.add(*query.CreatedFrom))
+	}
+	if query.CreatedTo != nil {
+		conds = append(conds, "i.created_at < "+params.add(*query.CreatedTo))
+	}
+
+	sortKey, direction, op := "i.created_at", "ASC", ">"
+	if query.SortBy == domain.SortInvestmentsByAmount {
+		sortKey = "i.amount"
+	}
+	if query.Descending {
+		direction, op = "DESC", "<"
+	}
+
+	if cursor != nil {
+		var key interface{} = cursor.CreatedAt
+		if query.SortBy == domain.SortInvestmentsByAmount {
+			key = cursor.Amount
+		}
+		keyParam := params.add(key)
+		conds = append(conds, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND i.id %[2]s %[4]s))", sortKey, op, keyParam, params.add(cursor.ID)))
+	}
+
+	sqlQuery := `SELECT ` + investmentColumns + ` FROM investments i`
+	if len(conds) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conds, " AND ")
+	}
+	// 次のページがあるかを知るために1件多く取得する
+	sqlQuery += fmt.Sprintf(" ORDER BY %s %s, i.id %s LIMIT %s", sortKey, direction, direction, params.add(query.Limit+1))
+
+	investments, err := r.query(ctx, sqlQuery, params...)
+	if err != nil {
+		return nil, err
+	}
+	return query.Page(investments), nil
+}
+
+// queryParams collects the arguments of a query built at run time.
+type queryParams []interface{}
+
+// add appends an argument and returns its placeholder.
+func (p *queryParams) add(value interface{}) string {
+	*p = append(*p, value)
+	return "$" + strconv.Itoa(len(*p))
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"moneyget/internal/domain"
+)
+
+type membershipRepository struct {
+	db *sql.DB
+}
+
+func NewMembershipRepository(db *sql.DB) domain.MembershipRepository {
+	return &membershipRepository{db: db}
+}
+
+const membershipColumns = `id, portfolio_id, invitee_email, user_id, role, status, invited_by, created_at, accepted_at`
+
+func (r *membershipRepository) Save(ctx context.Context, membership *domain.PortfolioMembership) error {
+	query := `
+		INSERT INTO portfolio_memberships (` + membershipColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = excluded.user_id,
+			role = excluded.role,
+			status = excluded.status,
+			accepted_at = excluded.accepted_at
+	`
+
+	var userID sql.NullString
+	if membership.UserID != "" {
+		userID = sql.NullString{String: membership.UserID, Valid: true}
+	}
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		membership.ID,
+		membership.PortfolioID.Value,
+		membership.InviteeEmail,
+		userID,
+		string(membership.Role),
+		string(membership.Status),
+		membership.InvitedBy,
+		membership.CreatedAt,
+		membership.AcceptedAt,
+	)
+	return err
+}
+
+func (r *membershipRepository) FindByID(ctx context.Context, id string) (*domain.PortfolioMembership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM portfolio_memberships WHERE id = $1`
+	return scanMembership(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *membershipRepository) FindByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.PortfolioMembership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM portfolio_memberships WHERE portfolio_id = $1 ORDER BY created_at, id`
+	return r.query(ctx, query, portfolioID.Value)
+}
+
+func (r *membershipRepository) FindActiveByUserID(ctx context.Context, userID string) ([]*domain.PortfolioMembership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM portfolio_memberships WHERE user_id = $1 AND status = $2 ORDER BY created_at, id`
+	return r.query(ctx, query, userID, string(domain.MembershipActive))
+}
+
+func (r *membershipRepository) FindPendingByEmail(ctx context.Context, email string) ([]*domain.PortfolioMembership, error) {
+	query := `SELECT ` + membershipColumns + ` FROM portfolio_memberships WHERE invitee_email = LOWER($1) AND status = $2 ORDER BY created_at, id`
+	return r.query(ctx, query, email, string(domain.MembershipPending))
+}
+
+func (r *membershipRepository) Delete(ctx context.Context, id string) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM portfolio_memberships WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *membershipRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.PortfolioMembership, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*domain.PortfolioMembership
+	for rows.Next() {
+		membership, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, rows.Err()
+}
+
+func scanMembership(row rowScanner) (*domain.PortfolioMembership, error) {
+	var m domain.PortfolioMembership
+	var portfolioID string
+	var userID sql.NullString
+	var role string
+	var status string
+	var acceptedAt sql.NullTime
+
+	err := row.Scan(
+		&m.ID,
+		&portfolioID,
+		&m.InviteeEmail,
+		&userID,
+		&role,
+		&status,
+		&m.InvitedBy,
+		&m.CreatedAt,
+		&acceptedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.PortfolioID = domain.NewPortfolioID(portfolioID)
+	m.UserID = userID.String
+	m.Role = domain.PortfolioRole(role)
+	m.Status = domain.MembershipStatus(status)
+	if acceptedAt.Valid {
+		m.AcceptedAt = &acceptedAt.Time
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"moneyget/internal/infrastructure/migration"
+)
+
+// マイグレーションはバイナリに埋め込むため、作業ディレクトリに依存しない
+//
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// NewMigrator returns a migrator for the PostgreSQL migrations embedded in the binary.
+func NewMigrator(db *sql.DB) (*migration.Migrator, error) {
+	sub, err := fs.Sub(embeddedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migration.NewMigrator(db, sub, migration.Dollar)
+}
+
+// RunMigrations applies all pending migrations.
+func RunMigrations(db *sql.DB) error {
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(context.Background())
+	return err
+}
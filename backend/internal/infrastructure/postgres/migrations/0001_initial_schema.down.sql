@@ -0,0 +1,8 @@
+-- 0001_initial_schema のロールバック（インデックスはテーブルと一緒に削除される）
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS portfolio_memberships;
+DROP TABLE IF EXISTS cash_transactions;
+DROP TABLE IF EXISTS portfolio_investments;
+DROP TABLE IF EXISTS portfolios;
+DROP TABLE IF EXISTS investments;
+DROP TABLE IF EXISTS users;
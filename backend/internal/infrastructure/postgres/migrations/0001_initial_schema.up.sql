@@ -0,0 +1,78 @@
+-- テーブル: users
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS investments (
+    id TEXT PRIMARY KEY,
+    amount DOUBLE PRECISION NOT NULL,
+    currency TEXT NOT NULL,
+    type TEXT NOT NULL,
+    strategy TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS portfolios (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL DEFAULT 'Main',
+    archived_at TIMESTAMPTZ,
+    version INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS portfolio_investments (
+    portfolio_id TEXT NOT NULL REFERENCES portfolios(id) ON DELETE CASCADE,
+    investment_id TEXT NOT NULL REFERENCES investments(id) ON DELETE CASCADE,
+    PRIMARY KEY (portfolio_id, investment_id)
+);
+
+-- 現金台帳（ポートフォリオごと、通貨ごとの入出金）
+-- seq は同時刻の取引を記録順に並べるための連番
+CREATE TABLE IF NOT EXISTS cash_transactions (
+    id TEXT PRIMARY KEY,
+    seq BIGSERIAL NOT NULL,
+    portfolio_id TEXT NOT NULL REFERENCES portfolios(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    amount DOUBLE PRECISION NOT NULL,
+    currency TEXT NOT NULL,
+    investment_id TEXT,
+    occurred_at TIMESTAMPTZ NOT NULL
+);
+
+-- ポートフォリオの共有メンバー（招待中を含む）
+CREATE TABLE IF NOT EXISTS portfolio_memberships (
+    id TEXT PRIMARY KEY,
+    portfolio_id TEXT NOT NULL REFERENCES portfolios(id) ON DELETE CASCADE,
+    invitee_email TEXT NOT NULL,
+    user_id TEXT,
+    role TEXT NOT NULL,
+    status TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    event_data JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_user_id ON portfolios(user_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_investments_portfolio_id ON portfolio_investments(portfolio_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_investments_investment_id ON portfolio_investments(investment_id);
+CREATE INDEX IF NOT EXISTS idx_cash_transactions_portfolio_id ON cash_transactions(portfolio_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_portfolio_id ON portfolio_memberships(portfolio_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_user_id ON portfolio_memberships(user_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_invitee_email ON portfolio_memberships(invitee_email);
+CREATE INDEX IF NOT EXISTS idx_events_type ON events(event_type);
+CREATE INDEX IF NOT EXISTS idx_events_occurred_at ON events(occurred_at);
@@ -0,0 +1,7 @@
+-- 0002_event_streams のロールバック
+DROP INDEX IF EXISTS idx_events_stream;
+
+ALTER TABLE events DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE events DROP COLUMN IF EXISTS sequence;
+ALTER TABLE events DROP COLUMN IF EXISTS aggregate_id;
+ALTER TABLE events DROP COLUMN IF EXISTS aggregate_type;
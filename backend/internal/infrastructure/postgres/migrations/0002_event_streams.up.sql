@@ -0,0 +1,12 @@
+-- イベントを集約ごとのストリームとして保存する
+ALTER TABLE events ADD COLUMN IF NOT EXISTS aggregate_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS aggregate_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+
+-- 既存のイベントには集約の情報がないため、1件ずつの独立したストリームとして残す
+UPDATE events
+SET aggregate_type = 'Unknown', aggregate_id = id::TEXT, sequence = 1
+WHERE aggregate_id = '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_events_stream ON events(aggregate_type, aggregate_id, sequence);
@@ -0,0 +1,2 @@
+-- 0003_snapshots のロールバック
+DROP TABLE IF EXISTS snapshots;
@@ -0,0 +1,10 @@
+-- 集約のスナップショット（集約ごとに最新の1件だけを保持する）
+CREATE TABLE IF NOT EXISTS snapshots (
+    aggregate_type TEXT NOT NULL,
+    aggregate_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    schema_hash TEXT NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (aggregate_type, aggregate_id)
+);
@@ -0,0 +1,3 @@
+-- 0004_outbox のロールバック
+DROP TABLE IF EXISTS dead_letters;
+DROP TABLE IF EXISTS outbox;
@@ -0,0 +1,3 @@
+-- 0005_webhooks のロールバック
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
@@ -0,0 +1,5 @@
+-- 0006_event_actors のロールバック
+DROP INDEX IF EXISTS idx_events_actor_id;
+
+ALTER TABLE events DROP COLUMN IF EXISTS request_id;
+ALTER TABLE events DROP COLUMN IF EXISTS actor_id;
@@ -0,0 +1,5 @@
+-- 監査ログのため、イベントを起こしたユーザーとリクエストを記録する
+ALTER TABLE events ADD COLUMN IF NOT EXISTS actor_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS request_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_events_actor_id ON events(actor_id);
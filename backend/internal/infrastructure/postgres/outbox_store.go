@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"moneyget/internal/domain/service"
+	"time"
+)
+
+type OutboxStoreDB struct {
+	db *sql.DB
+}
+
+func NewOutboxStoreDB(db *sql.DB) *OutboxStoreDB {
+	return &OutboxStoreDB{db: db}
+}
+
+func (o *OutboxStoreDB) Enqueue(ctx context.Context, events []service.StoredEvent, enqueuedAt time.Time) error {
+	return runInTransaction(ctx, o.db, func(ctx context.Context) error {
+		q := conn(ctx, o.db)
+		for _, event := range events {
+			_, err := q.ExecContext(ctx, `
+				INSERT INTO outbox (aggregate_type, aggregate_id, event_type, schema_version, event_data, occurred_at, next_attempt_at, created_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			`, event.AggregateType, event.AggregateID, event.EventType, event.SchemaVersion, string(event.EventData),
+				event.OccurredAt.UTC(), enqueuedAt.UTC(), enqueuedAt.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (o *OutboxStoreDB) PendingMessages(ctx context.Context, now time.Time, limit int) ([]service.OutboxMessage, error) {
+	rows, err := conn(ctx, o.db).QueryContext(ctx, `
+		SELECT id, aggregate_type, aggregate_id, event_type, schema_version, event_data, occurred_at,
+			attempts, next_attempt_at, last_error, created_at
+		FROM outbox m
+		WHERE next_attempt_at <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox w
+				WHERE w.aggregate_type = m.aggregate_type AND w.aggregate_id = m.aggregate_id
+					AND w.id < m.id AND w.next_attempt_at > $1
+			)
+		ORDER BY id
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []service.OutboxMessage
+	for rows.Next() {
+		var message service.OutboxMessage
+		var data string
+		if err := rows.Scan(
+			&message.ID, &message.Event.AggregateType, &message.Event.AggregateID, &message.Event.EventType,
+			&message.Event.SchemaVersion, &data, &message.Event.OccurredAt,
+			&message.Attempts, &message.NextAttemptAt, &message.LastError, &message.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		message.Event.EventData = []byte(data)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func (o *OutboxStoreDB) DeleteMessage(ctx context.Context, id int64) error {
+	_, err := conn(ctx, o.db).ExecContext(ctx, "DELETE FROM outbox WHERE id = $1", id)
+	return err
+}
+
+func (o *OutboxStoreDB) RescheduleMessage(ctx context.Context, id int64, attempts int, nextAttemptAt time.Time, lastError string) error {
+	_, err := conn(ctx, o.db).ExecContext(ctx,
+		"UPDATE outbox SET attempts = $1, next_attempt_at = $2, last_error = $3 WHERE id = $4",
+		attempts, nextAttemptAt.UTC(), lastError, id,
+	)
+	return err
+}
+
+func (o *OutboxStoreDB) DeadLetter(ctx context.Context, message service.OutboxMessage, reason string, failedAt time.Time) error {
+	return runInTransaction(ctx, o.db, func(ctx context.Context) error {
+		q := conn(ctx, o.db)
+		event := message.Event
+
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO dead_letters (message_id, aggregate_type, aggregate_id, event_type, schema_version, event_data, occurred_at, attempts, reason, failed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, message.ID, event.AggregateType, event.AggregateID, event.EventType, event.SchemaVersion, string(event.EventData),
+			event.OccurredAt.UTC(), message.Attempts, reason, failedAt.UTC())
+		if err != nil {
+			return err
+		}
+
+		_, err = q.ExecContext(ctx, "DELETE FROM outbox WHERE id = $1", message.ID)
+		return err
+	})
+}
+
+func (o *OutboxStoreDB) DeadLetters(ctx context.Context, limit int) ([]service.DeadLetter, error) {
+	rows, err := conn(ctx, o.db).QueryContext(ctx, `
+		SELECT id, message_id, aggregate_type, aggregate_id, event_type, schema_version, event_data, occurred_at,
+			attempts, reason, failed_at
+		FROM dead_letters
+		ORDER BY id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []service.DeadLetter
+	for rows.Next() {
+		var letter service.DeadLetter
+		var data string
+		if err := rows.Scan(
+			&letter.ID, &letter.MessageID, &letter.Event.AggregateType, &letter.Event.AggregateID, &letter.Event.EventType,
+			&letter.Event.SchemaVersion, &data, &letter.Event.OccurredAt,
+			&letter.Attempts, &letter.Reason, &letter.FailedAt,
+		); err != nil {
+			return nil, err
+		}
+		letter.Event.EventData = []byte(data)
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
@@ -0,0 +1,431 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"moneyget/internal/domain"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type portfolioRepository struct {
+	db *sql.DB
+}
+
+func NewPortfolioRepository(db *sql.DB) domain.PortfolioRepository {
+	return &portfolioRepository{db: db}
+}
+
+func (r *portfolioRepository) Create(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		query := `
+			INSERT INTO portfolios (id, user_id, name, archived_at, version, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, 1, $5, $6)
+		`
+		_, err := tx.ExecContext(ctx, query,
+			portfolio.ID().Value,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.CreatedAt,
+			portfolio.UpdatedAt,
+		)
+		if err != nil {
+			return portfolioWriteError(err)
+		}
+
+		if err := savePortfolioInvestments(ctx, tx, portfolio); err != nil {
+			return err
+		}
+
+		return saveCashTransactions(ctx, tx, portfolio, portfolio.CashTransactions)
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version = 1
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
+
+// Save inserts a new portfolio (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
+func (r *portfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		query := `
+			INSERT INTO portfolios (id, user_id, name, archived_at, version, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (id) DO UPDATE SET
+				user_id = excluded.user_id,
+				name = excluded.name,
+				archived_at = excluded.archived_at,
+				version = excluded.version,
+				updated_at = excluded.updated_at
+			WHERE portfolios.version = $8
+		`
+		result, err := tx.ExecContext(ctx, query,
+			portfolio.ID().Value,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.Version+1,
+			portfolio.CreatedAt,
+			portfolio.UpdatedAt,
+			portfolio.Version,
+		)
+		if err != nil {
+			return portfolioWriteError(err)
+		}
+		if err := checkVersionedWrite(result, "portfolio", portfolio.ID().Value); err != nil {
+			return err
+		}
+
+		if err := savePortfolioInvestments(ctx, tx, portfolio); err != nil {
+			return err
+		}
+
+		return saveCashTransactions(ctx, tx, portfolio, unsavedCashTransactions(portfolio))
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version++
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
+
+func (r *portfolioRepository) Update(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		query := `
+			UPDATE portfolios
+			SET user_id = $1, name = $2, archived_at = $3, version = version + 1, updated_at = $4
+			WHERE id = $5 AND version = $6
+		`
+		result, err := tx.ExecContext(ctx, query,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.UpdatedAt,
+			portfolio.ID().Value,
+			portfolio.Version,
+		)
+		if err != nil {
+			return portfolioWriteError(err)
+		}
+		if err := checkVersionedWrite(result, "portfolio", portfolio.ID().Value); err != nil {
+			return err
+		}
+
+		if err := savePortfolioInvestments(ctx, tx, portfolio); err != nil {
+			return err
+		}
+
+		return saveCashTransactions(ctx, tx, portfolio, unsavedCashTransactions(portfolio))
+	})
+	if err != nil {
+		return err
+	}
+
+	portfolio.Version++
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
+
+func (r *portfolioRepository) FindByID(ctx context.Context, id domain.PortfolioID) (*domain.Portfolio, error) {
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db), "p.id = $1", id.Value)
+	if err != nil {
+		return nil, err
+	}
+	if len(portfolios) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return portfolios[0], nil
+}
+
+// FindByIDs loads the portfolios in the order of ids. Unknown ids are skipped.
+func (r *portfolioRepository) FindByIDs(ctx context.Context, ids []domain.PortfolioID) ([]*domain.Portfolio, error) {
+	if len(ids) == 0 {
+		return []*domain.Portfolio{}, nil
+	}
+
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.Value
+	}
+
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db), "p.id = ANY($1)", pq.Array(values))
+	if err != nil {
+		return nil, err
+	}
+	return orderByIDs(portfolios, ids), nil
+}
+
+func (r *portfolioRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	return loadPortfolios(ctx, conn(ctx, r.db), "p.user_id = $1", userID)
+}
+
+func (r *portfolioRepository) FindAll(ctx context.Context) ([]*domain.Portfolio, error) {
+	return loadPortfolios(ctx, conn(ctx, r.db), "1 = 1")
+}
+
+func (r *portfolioRepository) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db),
+		"p.id IN (SELECT portfolio_id FROM portfolio_investments WHERE investment_id = $1)",
+		investmentID.Value,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(portfolios) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return portfolios[0], nil
+}
+
+// Delete removes the portfolio if the stored version still matches; its
+// investment links, cash ledger and memberships are removed by ON DELETE
+// CASCADE.
+func (r *portfolioRepository) Delete(ctx context.Context, portfolio *domain.Portfolio) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx,
+		"DELETE FROM portfolios WHERE id = $1 AND version = $2",
+		portfolio.ID().Value,
+		portfolio.Version,
+	)
+	if err != nil {
+		return err
+	}
+	return checkVersionedWrite(result, "portfolio", portfolio.ID().Value)
+}
+
+// loadPortfolios loads the portfolios matching cond, a condition on
+// portfolios aliased as p, with their investments and cash ledgers. It
+// issues three queries however many portfolios match, instead of a few per
+// portfolio.
+func loadPortfolios(ctx context.Context, q querier, cond string, args ...interface{}) ([]*domain.Portfolio, error) {
+	states, err := loadPortfolioStates(ctx, q, cond, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return []*domain.Portfolio{}, nil
+	}
+
+	byID := make(map[string]*domain.PortfolioState, len(states))
+	for _, state := range states {
+		byID[state.ID.Value] = state
+	}
+
+	if err := loadPortfolioInvestments(ctx, q, byID, cond, args); err != nil {
+		return nil, err
+	}
+	if err := loadCashTransactions(ctx, q, byID, cond, args); err != nil {
+		return nil, err
+	}
+
+	portfolios := make([]*domain.Portfolio, 0, len(states))
+	for _, state := range states {
+		// 保存済みの状態は投資上限やアーカイブの検証を通さずにそのまま復元する
+		portfolios = append(portfolios, domain.ReconstitutePortfolio(*state))
+	}
+	return portfolios, nil
+}
+
+func loadPortfolioStates(ctx context.Context, q querier, cond string, args []interface{}) ([]*domain.PortfolioState, error) {
+	query := `
+		SELECT p.id, p.user_id, p.name, p.archived_at, p.version, p.created_at, p.updated_at
+		FROM portfolios p
+		WHERE ` + cond + `
+		ORDER BY p.created_at, p.id
+	`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []*domain.PortfolioState
+	for rows.Next() {
+		var state domain.PortfolioState
+		var id string
+		var archivedAt sql.NullTime
+
+		err := rows.Scan(&id, &state.UserID, &state.Name, &archivedAt, &state.Version, &state.CreatedAt, &state.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		state.ID = domain.NewPortfolioID(id)
+		if archivedAt.Valid {
+			state.ArchivedAt = &archivedAt.Time
+		}
+		states = append(states, &state)
+	}
+
+	return states, rows.Err()
+}
+
+func loadPortfolioInvestments(ctx context.Context, q querier, byID map[string]*domain.PortfolioState, cond string, args []interface{}) error {
+	query := `
+		SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.version, i.created_at, i.updated_at, pi.portfolio_id
+		FROM portfolios p
+		JOIN portfolio_investments pi ON pi.portfolio_id = p.id
+		JOIN investments i ON i.id = pi.investment_id
+		WHERE ` + cond
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var portfolioID string
+		investment, err := scanInvestment(rows, &portfolioID)
+		if err != nil {
+			return err
+		}
+		if state, ok := byID[portfolioID]; ok {
+			state.Investments = append(state.Investments, investment)
+		}
+	}
+
+	return rows.Err()
+}
+
+func loadCashTransactions(ctx context.Context, q querier, byID map[string]*domain.PortfolioState, cond string, args []interface{}) error {
+	query := `
+		SELECT c.portfolio_id, c.id, c.type, c.amount, c.currency, c.investment_id, c.occurred_at
+		FROM portfolios p
+		JOIN cash_transactions c ON c.portfolio_id = p.id
+		WHERE ` + cond + `
+		ORDER BY c.occurred_at, c.seq
+	`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var portfolioID string
+		var tx domain.CashTransaction
+		var typeVal string
+		var investmentID sql.NullString
+		var occurredAt time.Time
+
+		err := rows.Scan(&portfolioID, &tx.ID, &typeVal, &tx.Amount.Amount, &tx.Amount.Currency, &investmentID, &occurredAt)
+		if err != nil {
+			return err
+		}
+
+		tx.Type = domain.CashTransactionType(typeVal)
+		tx.InvestmentID = domain.NewInvestmentID(investmentID.String)
+		tx.OccurredAt = occurredAt
+		if state, ok := byID[portfolioID]; ok {
+			state.CashTransactions = append(state.CashTransactions, &tx)
+		}
+	}
+
+	return rows.Err()
+}
+
+// orderByIDs returns the portfolios in the order of ids.
+func orderByIDs(portfolios []*domain.Portfolio, ids []domain.PortfolioID) []*domain.Portfolio {
+	byID := make(map[string]*domain.Portfolio, len(portfolios))
+	for _, portfolio := range portfolios {
+		byID[portfolio.ID().Value] = portfolio
+	}
+
+	ordered := make([]*domain.Portfolio, 0, len(portfolios))
+	for _, id := range ids {
+		if portfolio, ok := byID[id.Value]; ok {
+			ordered = append(ordered, portfolio)
+			// 同じIDが複数回指定されても1度だけ返す
+			delete(byID, id.Value)
+		}
+	}
+	return ordered
+}
+
+// savePortfolioInvestments replaces the portfolio's investment links.
+func savePortfolioInvestments(ctx context.Context, tx querier, portfolio *domain.Portfolio) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = $1", portfolio.ID().Value)
+	if err != nil {
+		return err
+	}
+
+	for _, investment := range portfolio.GetInvestments() {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES ($1, $2)",
+			portfolio.ID().Value,
+			investment.ID().Value,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unsavedCashTransactions returns the ledger entries a write has to insert:
+// the whole ledger of a new portfolio, otherwise only the entries recorded
+// since it was loaded, so that a write does not cost the size of the ledger.
+func unsavedCashTransactions(portfolio *domain.Portfolio) []*domain.CashTransaction {
+	if portfolio.Version == 0 {
+		return portfolio.CashTransactions
+	}
+	return portfolio.UnsavedCashTransactions()
+}
+
+// saveCashTransactions appends ledger entries. The ledger is append-only, so
+// entries that are already stored (for example those of a replayed
+// portfolio) are skipped rather than rewritten.
+func saveCashTransactions(ctx context.Context, tx querier, portfolio *domain.Portfolio, entries []*domain.CashTransaction) error {
+	for _, cashTx := range entries {
+		var investmentID sql.NullString
+		if cashTx.InvestmentID.Value != "" {
+			investmentID = sql.NullString{String: cashTx.InvestmentID.Value, Valid: true}
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO cash_transactions (id, portfolio_id, type, amount, currency, investment_id, occurred_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (id) DO NOTHING
+		`,
+			cashTx.ID,
+			portfolio.ID().Value,
+			string(cashTx.Type),
+			cashTx.Amount.Amount,
+			cashTx.Amount.Currency,
+			investmentID,
+			cashTx.OccurredAt,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// portfolioWriteError reports a violation of the unique index on the owner
+// and name of portfolios as domain.ErrDuplicatePortfolioName.
+func portfolioWriteError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "idx_portfolios_user_id_name" {
+		return domain.ErrDuplicatePortfolioName
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+// Package postgres implements the repositories on PostgreSQL, for
+// deployments that need more concurrent writers than SQLite allows.
+package postgres
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+// DriverName is the database/sql driver used for PostgreSQL.
+const DriverName = "postgres"
+
+// Open connects to the database at dsn, either a postgres:// URL or a
+// key=value connection string.
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
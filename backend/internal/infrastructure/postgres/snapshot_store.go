@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"moneyget/internal/domain/service"
+)
+
+type SnapshotStoreDB struct {
+	db *sql.DB
+}
+
+func NewSnapshotStoreDB(db *sql.DB) *SnapshotStoreDB {
+	return &SnapshotStoreDB{db: db}
+}
+
+func (s *SnapshotStoreDB) SaveSnapshot(ctx context.Context, snapshot service.Snapshot) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx, `
+		INSERT INTO snapshots (aggregate_type, aggregate_id, version, schema_hash, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (aggregate_type, aggregate_id) DO UPDATE SET
+			version = excluded.version,
+			schema_hash = excluded.schema_hash,
+			data = excluded.data,
+			created_at = excluded.created_at
+		WHERE snapshots.version <= excluded.version
+	`, snapshot.AggregateType, snapshot.AggregateID, snapshot.Version, snapshot.SchemaHash, string(snapshot.Data), snapshot.CreatedAt.UTC())
+	return err
+}
+
+func (s *SnapshotStoreDB) LatestSnapshot(ctx context.Context, aggregateType string, aggregateID string) (*service.Snapshot, error) {
+	var snapshot service.Snapshot
+	var data string
+
+	err := conn(ctx, s.db).QueryRowContext(ctx, `
+		SELECT aggregate_type, aggregate_id, version, schema_hash, data, created_at
+		FROM snapshots
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+	`, aggregateType, aggregateID).Scan(
+		&snapshot.AggregateType, &snapshot.AggregateID, &snapshot.Version, &snapshot.SchemaHash, &data, &snapshot.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Data = []byte(data)
+	return &snapshot, nil
+}
+
+func (s *SnapshotStoreDB) DeleteSnapshots(ctx context.Context, aggregateType string, schemaHash string) (int, error) {
+	result, err := conn(ctx, s.db).ExecContext(ctx,
+		"DELETE FROM snapshots WHERE aggregate_type = $1 AND schema_hash <> $2",
+		aggregateType, schemaHash,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"database/sql"
+	"moneyget/internal/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type userRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) domain.UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) Create(user *domain.User) error {
+	user.ID = uuid.New().String()
+	query := `INSERT INTO users (id, name, email, password, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.Exec(query, user.ID, user.Name, user.Email, user.Password, time.Now())
+	return err
+}
+
+func (r *userRepository) FindByID(id string) (*domain.User, error) {
+	user := &domain.User{}
+	query := `SELECT id, name, email, password FROM users WHERE id = $1`
+	err := r.db.QueryRow(query, id).Scan(&user.ID, &user.Name, &user.Email, &user.Password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) FindByEmail(email string) (*domain.User, error) {
+	user := &domain.User{}
+	query := `SELECT id, name, email, password FROM users WHERE email = $1`
+	err := r.db.QueryRow(query, email).Scan(&user.ID, &user.Name, &user.Email, &user.Password)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) Update(user *domain.User) error {
+	query := `UPDATE users SET name = $1, email = $2, password = $3 WHERE id = $4`
+	result, err := r.db.Exec(query, user.Name, user.Email, user.Password, user.ID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *userRepository) Delete(id string) error {
+	result, err := r.db.Exec(`DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// expectAffected reports sql.ErrNoRows when a write matched no row.
+func expectAffected(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"moneyget/internal/domain"
+	"time"
+)
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) domain.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+const (
+	webhookSubscriptionColumns = `id, user_id, url, event_types, secret, created_at`
+	webhookDeliveryColumns     = `id, subscription_id, event_type, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, updated_at, delivered_at`
+)
+
+func (r *webhookRepository) SaveSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	eventTypes, err := json.Marshal(subscription.EventTypes)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO webhook_subscriptions (`+webhookSubscriptionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			url = excluded.url,
+			event_types = excluded.event_types,
+			secret = excluded.secret
+	`, subscription.ID, subscription.UserID, subscription.URL, string(eventTypes), subscription.Secret, subscription.CreatedAt)
+	return err
+}
+
+func (r *webhookRepository) FindSubscriptionByID(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	return scanWebhookSubscription(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *webhookRepository) FindSubscriptionsByUserID(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE user_id = $1 ORDER BY created_at, id`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*domain.WebhookSubscription
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// DeleteSubscription relies on ON DELETE CASCADE to remove the deliveries.
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (`+webhookDeliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO NOTHING
+	`,
+		delivery.ID,
+		delivery.SubscriptionID,
+		delivery.EventType,
+		string(delivery.Payload),
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.CreatedAt,
+		delivery.UpdatedAt,
+		delivery.DeliveredAt,
+	)
+	return err
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, next_attempt_at = $3, response_status = $4, last_error = $5, updated_at = $6, delivered_at = $7
+		WHERE id = $8
+	`,
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.UpdatedAt,
+		delivery.DeliveredAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (r *webhookRepository) FindDeliveryByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+	return scanWebhookDelivery(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *webhookRepository) FindDeliveriesBySubscriptionID(ctx context.Context, subscriptionID string, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+		WHERE subscription_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+	return r.queryDeliveries(ctx, query, subscriptionID, limit)
+}
+
+func (r *webhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY created_at, id
+		LIMIT $3`
+	return r.queryDeliveries(ctx, query, string(domain.WebhookDeliveryPending), now, limit)
+}
+
+func (r *webhookRepository) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]*domain.WebhookDelivery, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	var s domain.WebhookSubscription
+	var eventTypes string
+
+	if err := row.Scan(&s.ID, &s.UserID, &s.URL, &eventTypes, &s.Secret, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &s.EventTypes); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (*domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	var payload string
+	var status string
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventType,
+		&payload,
+		&status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.ResponseStatus,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = []byte(payload)
+	d.Status = domain.WebhookDeliveryStatus(status)
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+
+	return &d, nil
+}
@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"database/sql"
+	"moneyget/internal/infrastructure/contracttest"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepositoryContract(t *testing.T) {
+	contracttest.Run(t, func(t *testing.T) contracttest.Store {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "contract.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		if err := RunMigrations(db); err != nil {
+			t.Fatalf("Failed to run migrations: %v", err)
+		}
+
+		return contracttest.Store{
+			Users:       NewUserRepository(db),
+			Investments: NewInvestmentRepository(db),
+			Portfolios:  NewPortfolioRepository(db),
+			Memberships: NewMembershipRepository(db),
+			TxManager:   NewTransactionManager(db),
+			Events:      NewEventStoreDB(db),
+			Snapshots:   NewSnapshotStoreDB(db),
+			Outbox:      NewOutboxStoreDB(db),
+			Webhooks:    NewWebhookRepository(db),
+		}
+	})
+}
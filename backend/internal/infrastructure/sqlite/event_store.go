@@ -1,9 +1,15 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 type EventStoreDB struct {
@@ -14,28 +20,165 @@ func NewEventStoreDB(db *sql.DB) *EventStoreDB {
 	return &EventStoreDB{db: db}
 }
 
-func (e *EventStoreDB) Store(event domain.DomainEvent) error {
-	eventData, err := json.Marshal(event)
+// Append joins the transaction of the context, so that events can be
+// stored atomically with the state they describe.
+func (e *EventStoreDB) Append(ctx context.Context, expectedVersion int, events []service.StoredEvent) (int, error) {
+	if len(events) == 0 {
+		return expectedVersion, nil
+	}
+	aggregateType, aggregateID := events[0].AggregateType, events[0].AggregateID
+
+	var version int
+	err := runInTransaction(ctx, e.db, func(ctx context.Context) error {
+		q := conn(ctx, e.db)
+
+		err := q.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(sequence), 0) FROM events
+			WHERE aggregate_type = ? AND aggregate_id = ?
+		`, aggregateType, aggregateID).Scan(&version)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != service.AnyVersion && version != expectedVersion {
+			return errStreamVersion(aggregateType, aggregateID, version, expectedVersion)
+		}
+
+		for _, event := range events {
+			version++
+			_, err := q.ExecContext(ctx, `
+				INSERT INTO events (aggregate_type, aggregate_id, sequence, event_type, schema_version, event_data, occurred_at, actor_id, request_id)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, aggregateType, aggregateID, version, event.EventType, event.SchemaVersion, string(event.EventData), event.OccurredAt.UTC(),
+				event.ActorID, event.RequestID)
+			if isUniqueViolation(err) {
+				// 同じバージョンへの追記が並行して行われた
+				return errStreamVersion(aggregateType, aggregateID, version-1, expectedVersion)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
+	return version, nil
+}
 
-	query := `
-		INSERT INTO events (event_type, event_data, occurred_at)
-		VALUES (?, ?, ?)
-	`
+const eventColumns = `id, aggregate_type, aggregate_id, sequence, event_type, schema_version, event_data, occurred_at, actor_id, request_id`
+
+func (e *EventStoreDB) ReadStream(ctx context.Context, aggregateType string, aggregateID string, afterSequence int) ([]service.StoredEvent, error) {
+	return e.query(ctx, `
+		SELECT `+eventColumns+`
+		FROM events
+		WHERE aggregate_type = ? AND aggregate_id = ? AND sequence > ?
+		ORDER BY sequence
+	`, aggregateType, aggregateID, afterSequence)
+}
 
-	_, err = e.db.Exec(query, getEventType(event), eventData, event.OccurredAt())
-	return err
+func (e *EventStoreDB) LastSequence(ctx context.Context, aggregateType string, aggregateID string) (int, error) {
+	var sequence int
+	err := conn(ctx, e.db).QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(sequence), 0) FROM events
+		WHERE aggregate_type = ? AND aggregate_id = ?
+	`, aggregateType, aggregateID).Scan(&sequence)
+	return sequence, err
 }
 
-func getEventType(event domain.DomainEvent) string {
-	switch event.(type) {
-	case domain.InvestmentCreatedEvent:
-		return "InvestmentCreated"
-	case domain.PortfolioUpdatedEvent:
-		return "PortfolioUpdated"
-	default:
-		return "Unknown"
+// QueryEvents compares times with julianday(), like the investment query.
+func (e *EventStoreDB) QueryEvents(ctx context.Context, filter service.EventFilter) ([]service.StoredEvent, error) {
+	conds := []string{"id > ?"}
+	args := []interface{}{filter.AfterID}
+
+	if filter.AggregateType != "" {
+		conds = append(conds, "aggregate_type = ?")
+		args = append(args, filter.AggregateType)
+	}
+	if filter.AggregateID != "" {
+		conds = append(conds, "aggregate_id = ?")
+		args = append(args, filter.AggregateID)
+	}
+	if len(filter.EventTypes) > 0 {
+		conds = append(conds, "event_type IN ("+placeholders(len(filter.EventTypes))+")")
+		for _, eventType := range filter.EventTypes {
+			args = append(args, eventType)
+		}
+	}
+	if filter.ActorID != "" {
+		conds = append(conds, "actor_id = ?")
+		args = append(args, filter.ActorID)
 	}
+	if filter.From != nil {
+		conds = append(conds, "julianday(occurred_at) >= julianday(?)")
+		args = append(args, timeParam(*filter.From))
+	}
+	if filter.To != nil {
+		conds = append(conds, "julianday(occurred_at) < julianday(?)")
+		args = append(args, timeParam(*filter.To))
+	}
+	args = append(args, filter.Limit)
+
+	return e.query(ctx, `SELECT `+eventColumns+` FROM events WHERE `+strings.Join(conds, " AND ")+` ORDER BY id LIMIT ?`, args...)
+}
+
+func (e *EventStoreDB) query(ctx context.Context, query string, args ...interface{}) ([]service.StoredEvent, error) {
+	rows, err := conn(ctx, e.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []service.StoredEvent
+	for rows.Next() {
+		var event service.StoredEvent
+		var data string
+		var occurredAt nullTime
+		if err := rows.Scan(
+			&event.ID, &event.AggregateType, &event.AggregateID, &event.Sequence,
+			&event.EventType, &event.SchemaVersion, &data, &occurredAt,
+			&event.ActorID, &event.RequestID,
+		); err != nil {
+			return nil, err
+		}
+		event.EventData = []byte(data)
+		event.OccurredAt = occurredAt.Time
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// ListStreams returns the IDs of the streams of an aggregate type, in the
+// order their first event was stored.
+func (e *EventStoreDB) ListStreams(ctx context.Context, aggregateType string) ([]string, error) {
+	rows, err := conn(ctx, e.db).QueryContext(ctx, `
+		SELECT aggregate_id FROM events
+		WHERE aggregate_type = ?
+		GROUP BY aggregate_id
+		ORDER BY MIN(id)
+	`, aggregateType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func errStreamVersion(aggregateType string, aggregateID string, version int, expected int) error {
+	return fmt.Errorf("%w: stream %s %s is at version %d, expected %d",
+		domain.ErrConcurrentModification, aggregateType, aggregateID, version, expected)
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
 }
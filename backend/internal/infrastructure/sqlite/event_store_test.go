@@ -1,13 +1,16 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
 	"os"
 	"testing"
 )
 
-func setupTestDB(t *testing.T) (*sql.DB, func()) {
+func setupTestDB(t testing.TB) (*sql.DB, func()) {
 	dbPath := "test.db"
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -15,14 +18,8 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 	}
 
 	// スキーマの作成
-	schema, err := os.ReadFile("schema.sql")
-	if err != nil {
-		t.Fatalf("Failed to read schema.sql: %v", err)
-	}
-
-	_, err = db.Exec(string(schema))
-	if err != nil {
-		t.Fatalf("Failed to create schema: %v", err)
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
 	}
 
 	cleanup := func() {
@@ -33,51 +30,42 @@ func setupTestDB(t *testing.T) (*sql.DB, func()) {
 	return db, cleanup
 }
 
-func TestEventStore_Store(t *testing.T) {
+func TestEventStore_AppendStoresPayload(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	store := NewEventStoreDB(db)
+	store := service.NewEventStore(NewEventStoreDB(db))
 
-	// テストケース1: InvestmentCreatedEventの保存
-	money, err := domain.NewMoney(1000, "JPY")
+	investment, err := domain.NewInvestment(domain.NewInvestmentID("test-id"), domain.Money{Amount: 1000, Currency: "JPY"}, domain.Stock, domain.Moderate)
 	if err != nil {
-		t.Fatalf("Failed to create money: %v", err)
+		t.Fatalf("Failed to create investment: %v", err)
 	}
+	event := domain.NewInvestmentCreatedEvent(domain.NewPortfolioID("portfolio-id"), investment)
 
-	investmentID := domain.NewInvestmentID("test-id")
-	event := domain.NewInvestmentCreatedEvent(investmentID, money)
-
-	err = store.Store(event)
-	if err != nil {
-		t.Errorf("Failed to store event: %v", err)
+	if _, err := store.Append(context.Background(), 0, event); err != nil {
+		t.Fatalf("Failed to append event: %v", err)
 	}
 
-	// 保存されたイベントの検証
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM events WHERE event_type = ?", "InvestmentCreated").Scan(&count)
+	// 保存されたイベントの検証（以前は非公開フィールドのため {} が保存されていた）
+	var eventType, aggregateType, aggregateID, data string
+	var sequence int
+	err = db.QueryRow(
+		"SELECT event_type, aggregate_type, aggregate_id, sequence, event_data FROM events",
+	).Scan(&eventType, &aggregateType, &aggregateID, &sequence, &data)
 	if err != nil {
-		t.Errorf("Failed to query events: %v", err)
+		t.Fatalf("Failed to query events: %v", err)
 	}
-	if count != 1 {
-		t.Errorf("Expected 1 event, got %d", count)
+	if eventType != "InvestmentCreated" || aggregateType != domain.AggregatePortfolio || aggregateID != "portfolio-id" || sequence != 1 {
+		t.Errorf("Unexpected event row: %s %s %s %d", eventType, aggregateType, aggregateID, sequence)
 	}
 
-	// テストケース2: PortfolioUpdatedEventの保存
-	portfolioID := domain.NewPortfolioID("portfolio-id")
-	portfolioEvent := domain.NewPortfolioUpdatedEvent(portfolioID, money)
-
-	err = store.Store(portfolioEvent)
-	if err != nil {
-		t.Errorf("Failed to store portfolio event: %v", err)
-	}
-
-	// 保存されたイベントの検証
-	err = db.QueryRow("SELECT COUNT(*) FROM events WHERE event_type = ?", "PortfolioUpdated").Scan(&count)
-	if err != nil {
-		t.Errorf("Failed to query events: %v", err)
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil {
+		t.Fatalf("Failed to decode payload %s: %v", data, err)
 	}
-	if count != 1 {
-		t.Errorf("Expected 1 event, got %d", count)
+	for _, key := range []string{"portfolio_id", "investment_id", "amount", "type", "strategy", "occurred_at"} {
+		if _, ok := payload[key]; !ok {
+			t.Errorf("Expected %s in the payload, got %s", key, data)
+		}
 	}
 }
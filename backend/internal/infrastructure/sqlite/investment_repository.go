@@ -3,7 +3,10 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"moneyget/internal/domain"
+	"strings"
 )
 
 type investmentRepository struct {
@@ -16,12 +19,12 @@ func NewInvestmentRepository(db *sql.DB) domain.InvestmentRepository {
 
 func (r *investmentRepository) Create(ctx context.Context, investment *domain.Investment) error {
 	query := `
-		INSERT INTO investments (id, amount, currency, type, strategy, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO investments (id, amount, currency, type, strategy, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?)
 	`
 
 	amount := investment.Amount()
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		investment.ID().Value,
 		amount.Amount,
 		amount.Currency,
@@ -30,82 +33,79 @@ func (r *investmentRepository) Create(ctx context.Context, investment *domain.In
 		investment.CreatedAt,
 		investment.UpdatedAt,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	investment.Version = 1
+	return nil
 }
 
+// Save inserts a new investment (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
 func (r *investmentRepository) Save(ctx context.Context, investment *domain.Investment) error {
 	query := `
-		INSERT INTO investments (id, amount, currency, type, strategy, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO investments (id, amount, currency, type, strategy, version, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			amount = excluded.amount,
 			currency = excluded.currency,
 			type = excluded.type,
 			strategy = excluded.strategy,
+			version = excluded.version,
 			updated_at = excluded.updated_at
+		WHERE investments.version = ?
 	`
 
 	amount := investment.Amount()
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		investment.ID().Value,
 		amount.Amount,
 		amount.Currency,
 		string(investment.Type()),
 		string(investment.Strategy()),
+		investment.Version+1,
 		investment.CreatedAt,
 		investment.UpdatedAt,
-	)
-	return err
-}
-
-func (r *investmentRepository) FindByID(ctx context.Context, id domain.InvestmentID) (*domain.Investment, error) {
-	query := `
-		SELECT amount, currency, type, strategy, created_at, updated_at
-		FROM investments
-		WHERE id = ?
-	`
-
-	var amount float64
-	var currency string
-	var investmentType string
-	var strategy string
-	var createdAt string
-	var updatedAt string
-
-	err := r.db.QueryRowContext(ctx, query, id.Value).Scan(
-		&amount,
-		&currency,
-		&investmentType,
-		&strategy,
-		&createdAt,
-		&updatedAt,
+		investment.Version,
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	money, err := domain.NewMoney(amount, currency)
-	if err != nil {
-		return nil, err
+	if err := checkVersionedWrite(result, "investment", investment.ID().Value); err != nil {
+		return err
 	}
 
-	return domain.NewInvestment(
-		id,
-		money,
-		domain.InvestmentType(investmentType),
-		domain.InvestmentStrategy(strategy),
-	)
+	investment.Version++
+	return nil
+}
+
+const investmentColumns = `id, amount, currency, type, strategy, version, created_at, updated_at`
+
+func (r *investmentRepository) FindByID(ctx context.Context, id domain.InvestmentID) (*domain.Investment, error) {
+	query := `SELECT ` + investmentColumns + ` FROM investments WHERE id = ?`
+	return scanInvestment(conn(ctx, r.db).QueryRowContext(ctx, query, id.Value))
 }
 
 func (r *investmentRepository) FindAllByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.Investment, error) {
 	query := `
-		SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.created_at, i.updated_at
+		SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.version, i.created_at, i.updated_at
 		FROM investments i
 		JOIN portfolio_investments pi ON i.id = pi.investment_id
 		WHERE pi.portfolio_id = ?
 	`
+	return r.query(ctx, query, portfolioID.Value)
+}
 
-	rows, err := r.db.QueryContext(ctx, query, portfolioID.Value)
+func (r *investmentRepository) FindAll(ctx context.Context) ([]*domain.Investment, error) {
+	query := `SELECT ` + investmentColumns + ` FROM investments`
+	return r.query(ctx, query)
+}
+
+func (r *investmentRepository) query(ctx context.Context, query string, args ...interface{}) ([]*domain.Investment, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -113,90 +113,148 @@ func (r *investmentRepository) FindAllByPortfolioID(ctx context.Context, portfol
 
 	var investments []*domain.Investment
 	for rows.Next() {
-		var id string
-		var amount float64
-		var currency string
-		var investmentType string
-		var strategy string
-		var createdAt string
-		var updatedAt string
-
-		err := rows.Scan(&id, &amount, &currency, &investmentType, &strategy, &createdAt, &updatedAt)
+		investment, err := scanInvestment(rows)
 		if err != nil {
 			return nil, err
 		}
+		investments = append(investments, investment)
+	}
 
-		money, err := domain.NewMoney(amount, currency)
-		if err != nil {
-			return nil, err
-		}
+	return investments, rows.Err()
+}
 
-		investment, err := domain.NewInvestment(
-			domain.NewInvestmentID(id),
-			money,
-			domain.InvestmentType(investmentType),
-			domain.InvestmentStrategy(strategy),
-		)
-		if err != nil {
-			return nil, err
-		}
+// scanInvestment scans the investment columns, followed by any extra
+// columns into extra.
+func scanInvestment(row rowScanner, extra ...interface{}) (*domain.Investment, error) {
+	var id string
+	var amount float64
+	var currency string
+	var investmentType string
+	var strategy string
+	var version int
+	var createdAt nullTime
+	var updatedAt nullTime
 
-		investments = append(investments, investment)
+	dest := []interface{}{&id, &amount, &currency, &investmentType, &strategy, &version, &createdAt, &updatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
 	}
 
-	return investments, nil
+	// 保存済みの値は検証せずにそのまま復元する
+	return domain.ReconstituteInvestment(
+		domain.NewInvestmentID(id),
+		domain.Money{Amount: amount, Currency: currency},
+		domain.InvestmentType(investmentType),
+		domain.InvestmentStrategy(strategy),
+		version,
+		createdAt.Time,
+		updatedAt.Time,
+	), nil
 }
 
-func (r *investmentRepository) FindAll(ctx context.Context) ([]*domain.Investment, error) {
-	query := `
-		SELECT id, amount, currency, type, strategy, created_at, updated_at
-		FROM investments
-	`
+func (r *investmentRepository) Delete(ctx context.Context, id domain.InvestmentID) error {
+	query := "DELETE FROM investments WHERE id = ?"
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id.Value)
+	return err
+}
 
-	rows, err := r.db.QueryContext(ctx, query)
+// Find returns one page of investments, ordered by the sort key of the query
+// and then by id so that the cursor position is unambiguous. Times are
+// compared with julianday() because the stored strings do not sort
+// chronologically across time zones.
+func (r *investmentRepository) Find(ctx context.Context, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := query.DecodeCursor()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var investments []*domain.Investment
-	for rows.Next() {
-		var id string
-		var amount float64
-		var currency string
-		var investmentType string
-		var strategy string
-		var createdAt string
-		var updatedAt string
-
-		err := rows.Scan(&id, &amount, &currency, &investmentType, &strategy, &createdAt, &updatedAt)
-		if err != nil {
-			return nil, err
-		}
+	var conds []string
+	var args []interface{}
 
-		money, err := domain.NewMoney(amount, currency)
+	if len(query.PortfolioIDs) > 0 {
+		ids := make([]string, len(query.PortfolioIDs))
+		for i, id := range query.PortfolioIDs {
+			ids[i] = id.Value
+		}
+		idList, err := json.Marshal(ids)
 		if err != nil {
 			return nil, err
 		}
+		conds = append(conds, "i.id IN (SELECT investment_id FROM portfolio_investments WHERE portfolio_id IN (SELECT value FROM json_each(?)))")
+		args = append(args, string(idList))
+	}
+	if len(query.Types) > 0 {
+		conds = append(conds, "i.type IN ("+placeholders(len(query.Types))+")")
+		for _, t := range query.Types {
+			args = append(args, string(t))
+		}
+	}
+	if len(query.Strategies) > 0 {
+		conds = append(conds, "i.strategy IN ("+placeholders(len(query.Strategies))+")")
+		for _, s := range query.Strategies {
+			args = append(args, string(s))
+		}
+	}
+	if query.Currency != "" {
+		conds = append(conds, "i.currency = ?")
+		args = append(args, query.Currency)
+	}
+	if query.MinAmount != nil {
+		conds = append(conds, "i.amount >= ?")
+		args = append(args, *query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		conds = append(conds, "i.amount <= ?")
+		args = append(args, *query.MaxAmount)
+	}
+	if query.CreatedFrom != nil {
+		conds = append(conds, "julianday(i.created_at) >= julianday(?)")
+		args = append(args, timeParam(*query.CreatedFrom))
+	}
+	if query.CreatedTo != nil {
+		conds = append(conds, "julianday(i.created_at) < julianday(?)")
+		args = append(args, timeParam(*query.CreatedTo))
+	}
 
-		investment, err := domain.NewInvestment(
-			domain.NewInvestmentID(id),
-			money,
-			domain.InvestmentType(investmentType),
-			domain.InvestmentStrategy(strategy),
-		)
-		if err != nil {
-			return nil, err
+	sortKey, direction, op := "julianday(i.created_at)", "ASC", ">"
+	if query.SortBy == domain.SortInvestmentsByAmount {
+		sortKey = "i.amount"
+	}
+	if query.Descending {
+		direction, op = "DESC", "<"
+	}
+
+	if cursor != nil {
+		var key interface{} = cursor.Amount
+		keyParam := "?"
+		if query.SortBy == domain.SortInvestmentsByCreatedAt {
+			key, keyParam = timeParam(cursor.CreatedAt), "julianday(?)"
 		}
+		conds = append(conds, fmt.Sprintf("(%[1]s %[2]s %[3]s OR (%[1]s = %[3]s AND i.id %[2]s ?))", sortKey, op, keyParam))
+		args = append(args, key, key, cursor.ID)
+	}
 
-		investments = append(investments, investment)
+	sqlQuery := `SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.version, i.created_at, i.updated_at FROM investments i`
+	if len(conds) > 0 {
+		sqlQuery += " WHERE " + strings.Join(conds, " AND ")
 	}
+	sqlQuery += fmt.Sprintf(" ORDER BY %s %s, i.id %s LIMIT ?", sortKey, direction, direction)
+	// 次のページがあるかを知るために1件多く取得する
+	args = append(args, query.Limit+1)
 
-	return investments, nil
+	investments, err := r.query(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	return query.Page(investments), nil
 }
 
-func (r *investmentRepository) Delete(ctx context.Context, id domain.InvestmentID) error {
-	query := "DELETE FROM investments WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, id.Value)
-	return err
+// placeholders returns n comma-separated parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
@@ -3,8 +3,10 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"moneyget/internal/domain"
 	"testing"
+	"time"
 )
 
 func TestInvestmentRepository(t *testing.T) {
@@ -99,3 +101,103 @@ func TestInvestmentRepository(t *testing.T) {
 		}
 	})
 }
+
+func TestInvestmentRepository_OptimisticLocking(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewInvestmentRepository(db)
+	ctx := context.Background()
+
+	money, _ := domain.NewMoney(1000, "JPY")
+	investment, _ := domain.NewInvestment(domain.NewInvestmentID("test-investment"), money, domain.Stock, domain.Conservative)
+	if err := repo.Save(ctx, investment); err != nil {
+		t.Fatalf("Failed to save investment: %v", err)
+	}
+	if investment.Version != 1 {
+		t.Errorf("Expected version 1 after insert, got %d", investment.Version)
+	}
+
+	first, _ := repo.FindByID(ctx, investment.ID())
+	second, _ := repo.FindByID(ctx, investment.ID())
+
+	newAmount, _ := domain.NewMoney(2000, "JPY")
+	first.UpdateAmount(newAmount)
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatalf("Failed to save first copy: %v", err)
+	}
+	if first.Version != 2 {
+		t.Errorf("Expected version 2, got %d", first.Version)
+	}
+
+	// 古いバージョンからの更新は拒否される
+	second.UpdateAmount(newAmount)
+	if err := repo.Save(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification, got %v", err)
+	}
+
+	// 同じIDの新規投資も既存の投資を上書きできない
+	duplicate, _ := domain.NewInvestment(investment.ID(), money, domain.Bond, domain.Moderate)
+	if err := repo.Save(ctx, duplicate); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification for duplicate insert, got %v", err)
+	}
+
+	stored, _ := repo.FindByID(ctx, investment.ID())
+	if stored.Version != 2 || stored.Amount().Amount != 2000 {
+		t.Errorf("Expected version 2 with amount 2000, got version %d amount %f", stored.Version, stored.Amount().Amount)
+	}
+}
+
+func TestInvestmentRepository_RoundTrip(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewInvestmentRepository(db)
+	ctx := context.Background()
+
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	updatedAt := time.Date(2023, 6, 7, 8, 9, 10, 0, time.UTC)
+	investment := domain.ReconstituteInvestment(
+		domain.NewInvestmentID("test-investment"),
+		domain.Money{Amount: 1234.5, Currency: "USD"},
+		domain.RealEstate,
+		domain.Aggressive,
+		0,
+		createdAt,
+		updatedAt,
+	)
+
+	if err := repo.Create(ctx, investment); err != nil {
+		t.Fatalf("Failed to create investment: %v", err)
+	}
+
+	found, err := repo.FindByID(ctx, investment.ID())
+	if err != nil {
+		t.Fatalf("Failed to find investment: %v", err)
+	}
+
+	if found.ID() != investment.ID() || found.Amount() != investment.Amount() {
+		t.Errorf("Expected %s %+v, got %s %+v", investment.ID().Value, investment.Amount(), found.ID().Value, found.Amount())
+	}
+	if found.Type() != domain.RealEstate || found.Strategy() != domain.Aggressive {
+		t.Errorf("Unexpected type/strategy %s/%s", found.Type(), found.Strategy())
+	}
+	if found.Version != 1 {
+		t.Errorf("Expected version 1, got %d", found.Version)
+	}
+	if !found.CreatedAt.Equal(createdAt) || !found.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected timestamps %v/%v, got %v/%v", createdAt, updatedAt, found.CreatedAt, found.UpdatedAt)
+	}
+
+	// SQLiteのCURRENT_TIMESTAMPで書かれた値も読み込める
+	if _, err := db.Exec("UPDATE investments SET created_at = CURRENT_TIMESTAMP WHERE id = ?", investment.ID().Value); err != nil {
+		t.Fatalf("Failed to update timestamp: %v", err)
+	}
+	found, err = repo.FindByID(ctx, investment.ID())
+	if err != nil {
+		t.Fatalf("Failed to find investment with CURRENT_TIMESTAMP: %v", err)
+	}
+	if found.CreatedAt.IsZero() {
+		t.Error("Expected created_at to be parsed")
+	}
+}
@@ -0,0 +1,95 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"moneyget/internal/domain"
+	"testing"
+)
+
+func TestMembershipRepository(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewMembershipRepository(db)
+	ctx := context.Background()
+
+	portfolioID := domain.NewPortfolioID("test-portfolio")
+	invitation, err := domain.NewPortfolioInvitation("test-membership", portfolioID, "Spouse@Example.com", domain.RoleEditor, "owner")
+	if err != nil {
+		t.Fatalf("Failed to create invitation: %v", err)
+	}
+
+	t.Run("Save and FindByID", func(t *testing.T) {
+		if err := repo.Save(ctx, invitation); err != nil {
+			t.Fatalf("Failed to save invitation: %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, invitation.ID)
+		if err != nil {
+			t.Fatalf("Failed to find invitation: %v", err)
+		}
+		if found.InviteeEmail != "spouse@example.com" {
+			t.Errorf("Expected email spouse@example.com, got %s", found.InviteeEmail)
+		}
+		if found.Role != domain.RoleEditor || found.Status != domain.MembershipPending {
+			t.Errorf("Unexpected role/status: %s/%s", found.Role, found.Status)
+		}
+		if found.UserID != "" || found.AcceptedAt != nil {
+			t.Error("Pending invitation should not have a user yet")
+		}
+	})
+
+	t.Run("FindPendingByEmail", func(t *testing.T) {
+		pending, err := repo.FindPendingByEmail(ctx, "SPOUSE@example.com")
+		if err != nil {
+			t.Fatalf("Failed to find pending invitations: %v", err)
+		}
+		if len(pending) != 1 {
+			t.Errorf("Expected 1 pending invitation, got %d", len(pending))
+		}
+	})
+
+	t.Run("Accept and FindActiveByUserID", func(t *testing.T) {
+		if err := invitation.Accept("spouse", "spouse@example.com"); err != nil {
+			t.Fatalf("Failed to accept invitation: %v", err)
+		}
+		if err := repo.Save(ctx, invitation); err != nil {
+			t.Fatalf("Failed to save accepted membership: %v", err)
+		}
+
+		active, err := repo.FindActiveByUserID(ctx, "spouse")
+		if err != nil {
+			t.Fatalf("Failed to find active memberships: %v", err)
+		}
+		if len(active) != 1 || active[0].PortfolioID != portfolioID {
+			t.Fatalf("Expected active membership for %s, got %v", portfolioID.Value, active)
+		}
+		if active[0].AcceptedAt == nil || !active[0].AcceptedAt.Equal(*invitation.AcceptedAt) {
+			t.Errorf("Expected AcceptedAt %v, got %v", invitation.AcceptedAt, active[0].AcceptedAt)
+		}
+		if !active[0].CreatedAt.Equal(invitation.CreatedAt) {
+			t.Errorf("Expected CreatedAt %v, got %v", invitation.CreatedAt, active[0].CreatedAt)
+		}
+
+		byPortfolio, err := repo.FindByPortfolioID(ctx, portfolioID)
+		if err != nil {
+			t.Fatalf("Failed to find memberships by portfolio: %v", err)
+		}
+		if len(byPortfolio) != 1 {
+			t.Errorf("Expected 1 membership, got %d", len(byPortfolio))
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := repo.Delete(ctx, invitation.ID); err != nil {
+			t.Fatalf("Failed to delete membership: %v", err)
+		}
+		if _, err := repo.FindByID(ctx, invitation.ID); err != sql.ErrNoRows {
+			t.Errorf("Expected sql.ErrNoRows, got %v", err)
+		}
+		if err := repo.Delete(ctx, invitation.ID); err != sql.ErrNoRows {
+			t.Errorf("Expected sql.ErrNoRows deleting twice, got %v", err)
+		}
+	})
+}
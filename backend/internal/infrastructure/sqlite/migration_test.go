@@ -0,0 +1,250 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/infrastructure/migration"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query sqlite_master: %v", err)
+	}
+	return count > 0
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	for _, table := range []string{"users", "investments", "portfolios", "cash_transactions", "portfolio_memberships", "events"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("Expected table %s to exist", table)
+		}
+	}
+
+	// すべてロールバックしてから再適用できる
+	for {
+		if _, err := migrator.Down(ctx); errors.Is(err, migration.ErrNoMigrationToRollback) {
+			break
+		} else if err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+	}
+	if tableExists(t, db, "portfolios") {
+		t.Error("Expected portfolios to be dropped")
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	if !tableExists(t, db, "portfolios") {
+		t.Error("Expected portfolios to be recreated")
+	}
+}
+
+func TestEventStreamsMigrationKeepsLegacyEvents(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	// 0006_event_streams まで戻す
+	for {
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+		if reverted.Version == 6 {
+			break
+		}
+	}
+
+	// 集約の情報を持たない以前の形式のイベント
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec(
+			"INSERT INTO events (event_type, event_data, occurred_at) VALUES ('PortfolioUpdated', '{}', CURRENT_TIMESTAMP)",
+		); err != nil {
+			t.Fatalf("Failed to insert legacy event: %v", err)
+		}
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	rows, err := db.Query("SELECT id, aggregate_type, aggregate_id, sequence FROM events ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var aggregateType, aggregateID string
+		var sequence int
+		if err := rows.Scan(&id, &aggregateType, &aggregateID, &sequence); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		if aggregateType != "Unknown" || aggregateID != strconv.FormatInt(id, 10) || sequence != 1 {
+			t.Errorf("Expected legacy event %d in its own stream, got %s %s %d", id, aggregateType, aggregateID, sequence)
+		}
+	}
+}
+
+func TestUniquePortfolioNamesMigrationRenamesDuplicates(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	// 0011_unique_portfolio_names まで戻す
+	for {
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			t.Fatalf("Down failed: %v", err)
+		}
+		if reverted.Version == 11 {
+			break
+		}
+	}
+
+	// 一意制約の前に作られた、大文字小文字だけが違う名前
+	for _, statement := range []string{
+		"INSERT INTO users (id, name, email, password) VALUES ('user-1', 'Alice', 'alice@example.com', 'hash')",
+		"INSERT INTO portfolios (id, user_id, name, created_at, updated_at) VALUES ('portfolio-1', 'user-1', 'Savings', '2024-01-01 00:00:00', '2024-01-01 00:00:00')",
+		"INSERT INTO portfolios (id, user_id, name, created_at, updated_at) VALUES ('portfolio-2', 'user-1', 'SAVINGS', '2024-02-01 00:00:00', '2024-02-01 00:00:00')",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	names := make(map[string]string)
+	rows, err := db.Query("SELECT id, name FROM portfolios")
+	if err != nil {
+		t.Fatalf("Failed to query portfolios: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("Failed to scan portfolio: %v", err)
+		}
+		names[id] = name
+	}
+	if names["portfolio-1"] != "Savings" || names["portfolio-2"] != "SAVINGS (portfolio-2)" {
+		t.Errorf("Expected the newer duplicate to be renamed, got %v", names)
+	}
+
+	if _, err := db.Exec(
+		"INSERT INTO portfolios (id, user_id, name, created_at, updated_at) VALUES ('portfolio-3', 'user-1', 'savings', '2024-03-01 00:00:00', '2024-03-01 00:00:00')",
+	); !isUniqueViolation(err) {
+		t.Errorf("Expected a unique violation for a duplicate name, got %v", err)
+	}
+}
+
+// TestMigrationsUpgradeBaselineDatabase upgrades a database created by the
+// schema.sql of the first release, before migrations were tracked.
+func TestMigrationsUpgradeBaselineDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "baseline.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	schema, err := os.ReadFile(filepath.Join("testdata", "baseline_schema.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read baseline schema: %v", err)
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		t.Fatalf("Failed to create baseline schema: %v", err)
+	}
+	for _, statement := range []string{
+		"INSERT INTO users (id, name, email, password) VALUES ('user-1', 'Alice', 'alice@example.com', 'hash')",
+		"INSERT INTO investments (id, amount, currency, type, strategy, created_at, updated_at) VALUES ('investment-1', 1000, 'JPY', 'STOCK', 'MODERATE', '2024-01-01 00:00:00', '2024-01-01 00:00:00')",
+		"INSERT INTO portfolios (id, user_id, created_at, updated_at) VALUES ('portfolio-1', 'user-1', '2024-01-01 00:00:00', '2024-01-01 00:00:00')",
+		"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES ('portfolio-1', 'investment-1')",
+		"INSERT INTO events (event_type, event_data, occurred_at) VALUES ('PortfolioUpdated', '{}', '2024-01-01 00:00:00')",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("Failed to insert baseline row: %v", err)
+		}
+	}
+
+	if err := RunMigrations(db); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	for _, table := range []string{"cash_transactions", "portfolio_memberships", "snapshots", "outbox", "webhook_subscriptions"} {
+		if !tableExists(t, db, table) {
+			t.Errorf("Expected table %s to exist", table)
+		}
+	}
+
+	// 以前のデータが新しい列の既定値付きで読み書きできる
+	repo := NewPortfolioRepository(db)
+	portfolio, err := repo.FindByID(ctx, domain.NewPortfolioID("portfolio-1"))
+	if err != nil {
+		t.Fatalf("Failed to load baseline portfolio: %v", err)
+	}
+	if portfolio.Name != "Main" || portfolio.IsArchived() || len(portfolio.GetInvestments()) != 1 {
+		t.Errorf("Unexpected baseline portfolio: name=%s archived=%v investments=%d", portfolio.Name, portfolio.IsArchived(), len(portfolio.GetInvestments()))
+	}
+	if err := portfolio.Rename("Savings"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if err := repo.Save(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to save baseline portfolio: %v", err)
+	}
+	portfolios, err := repo.FindByUserID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Failed to list portfolios: %v", err)
+	}
+	if len(portfolios) != 1 || portfolios[0].Name != "Savings" {
+		t.Errorf("Expected the renamed portfolio, got %+v", portfolios)
+	}
+}
@@ -0,0 +1,12 @@
+-- 0001_initial_schema のロールバック（依存関係の逆順に削除）
+DROP INDEX IF EXISTS idx_events_occurred_at;
+DROP INDEX IF EXISTS idx_events_type;
+DROP INDEX IF EXISTS idx_portfolio_investments_investment_id;
+DROP INDEX IF EXISTS idx_portfolio_investments_portfolio_id;
+DROP INDEX IF EXISTS idx_portfolio_user_id;
+
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS portfolio_investments;
+DROP TABLE IF EXISTS portfolios;
+DROP TABLE IF EXISTS investments;
+DROP TABLE IF EXISTS users;
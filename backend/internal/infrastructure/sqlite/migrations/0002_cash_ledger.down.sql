@@ -0,0 +1,3 @@
+-- 0002_cash_ledger のロールバック
+DROP INDEX IF EXISTS idx_cash_transactions_portfolio_id;
+DROP TABLE IF EXISTS cash_transactions;
@@ -0,0 +1,13 @@
+-- 現金台帳（ポートフォリオごと、通貨ごとの入出金）
+CREATE TABLE IF NOT EXISTS cash_transactions (
+    id TEXT PRIMARY KEY,
+    portfolio_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    amount REAL NOT NULL,
+    currency TEXT NOT NULL,
+    investment_id TEXT,
+    occurred_at DATETIME NOT NULL,
+    FOREIGN KEY (portfolio_id) REFERENCES portfolios(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_cash_transactions_portfolio_id ON cash_transactions(portfolio_id);
@@ -0,0 +1,3 @@
+-- 0003_portfolio_names のロールバック
+ALTER TABLE portfolios DROP COLUMN archived_at;
+ALTER TABLE portfolios DROP COLUMN name;
@@ -0,0 +1,3 @@
+-- ユーザーごとに複数のポートフォリオを名前で区別し、アーカイブできるようにする
+ALTER TABLE portfolios ADD COLUMN name TEXT NOT NULL DEFAULT 'Main';
+ALTER TABLE portfolios ADD COLUMN archived_at DATETIME;
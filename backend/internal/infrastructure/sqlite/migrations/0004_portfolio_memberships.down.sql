@@ -0,0 +1,5 @@
+-- 0004_portfolio_memberships のロールバック
+DROP INDEX IF EXISTS idx_portfolio_memberships_invitee_email;
+DROP INDEX IF EXISTS idx_portfolio_memberships_user_id;
+DROP INDEX IF EXISTS idx_portfolio_memberships_portfolio_id;
+DROP TABLE IF EXISTS portfolio_memberships;
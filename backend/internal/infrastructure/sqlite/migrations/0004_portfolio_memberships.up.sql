@@ -0,0 +1,17 @@
+-- ポートフォリオの共有メンバー（招待中を含む）
+CREATE TABLE IF NOT EXISTS portfolio_memberships (
+    id TEXT PRIMARY KEY,
+    portfolio_id TEXT NOT NULL,
+    invitee_email TEXT NOT NULL,
+    user_id TEXT,
+    role TEXT NOT NULL,
+    status TEXT NOT NULL,
+    invited_by TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    accepted_at DATETIME,
+    FOREIGN KEY (portfolio_id) REFERENCES portfolios(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_portfolio_id ON portfolio_memberships(portfolio_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_user_id ON portfolio_memberships(user_id);
+CREATE INDEX IF NOT EXISTS idx_portfolio_memberships_invitee_email ON portfolio_memberships(invitee_email);
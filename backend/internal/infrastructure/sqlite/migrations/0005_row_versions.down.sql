@@ -0,0 +1,3 @@
+-- 0005_row_versions のロールバック
+ALTER TABLE investments DROP COLUMN version;
+ALTER TABLE portfolios DROP COLUMN version;
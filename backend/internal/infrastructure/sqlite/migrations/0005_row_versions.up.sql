@@ -0,0 +1,3 @@
+-- 楽観的排他制御のためのバージョン
+ALTER TABLE portfolios ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE investments ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
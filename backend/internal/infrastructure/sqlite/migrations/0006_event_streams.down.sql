@@ -0,0 +1,7 @@
+-- 0006_event_streams のロールバック
+DROP INDEX IF EXISTS idx_events_stream;
+
+ALTER TABLE events DROP COLUMN schema_version;
+ALTER TABLE events DROP COLUMN sequence;
+ALTER TABLE events DROP COLUMN aggregate_id;
+ALTER TABLE events DROP COLUMN aggregate_type;
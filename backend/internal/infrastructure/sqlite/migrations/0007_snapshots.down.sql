@@ -0,0 +1,2 @@
+-- 0007_snapshots のロールバック
+DROP TABLE IF EXISTS snapshots;
@@ -0,0 +1,5 @@
+-- 0010_event_actors のロールバック
+DROP INDEX IF EXISTS idx_events_actor_id;
+
+ALTER TABLE events DROP COLUMN request_id;
+ALTER TABLE events DROP COLUMN actor_id;
@@ -0,0 +1,2 @@
+-- 0011_unique_portfolio_names のロールバック（付け直した名前は戻さない）
+DROP INDEX IF EXISTS idx_portfolios_user_id_name;
@@ -0,0 +1,13 @@
+-- 同じユーザーのポートフォリオ名を一意にする（大文字小文字は区別しない）
+-- 既に重複している名前は最も古いものを残し、残りにはIDを付けて区別する
+UPDATE portfolios
+SET name = name || ' (' || id || ')'
+WHERE EXISTS (
+    SELECT 1 FROM portfolios AS other
+    WHERE other.user_id = portfolios.user_id
+      AND lower(other.name) = lower(portfolios.name)
+      AND (other.created_at < portfolios.created_at
+           OR (other.created_at = portfolios.created_at AND other.id < portfolios.id))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_portfolios_user_id_name ON portfolios(user_id, name COLLATE NOCASE);
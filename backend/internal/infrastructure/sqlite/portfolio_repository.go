@@ -3,6 +3,7 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"moneyget/internal/domain"
 )
 
@@ -15,245 +16,467 @@ func NewPortfolioRepository(db *sql.DB) domain.PortfolioRepository {
 }
 
 func (r *portfolioRepository) Create(ctx context.Context, portfolio *domain.Portfolio) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		query := `
+			INSERT INTO portfolios (id, user_id, name, archived_at, version, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 1, ?, ?)
+		`
+		_, err := tx.ExecContext(ctx, query,
+			portfolio.ID().Value,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.CreatedAt,
+			portfolio.UpdatedAt,
+		)
+		if err != nil {
+			return portfolioWriteError(err)
+		}
 
-	query := `
-		INSERT INTO portfolios (id, user_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-	`
-	_, err = tx.ExecContext(ctx, query,
-		portfolio.ID().Value,
-		portfolio.UserID,
-		portfolio.CreatedAt,
-		portfolio.UpdatedAt,
-	)
+		// 投資との関連付けを登録
+		for _, investment := range portfolio.GetInvestments() {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
+				portfolio.ID().Value,
+				investment.ID().Value,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := saveCashTransactions(ctx, tx, portfolio, portfolio.CashTransactions); err != nil {
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	// 投資との関連付けを登録
-	for _, investment := range portfolio.GetInvestments() {
-		_, err = tx.ExecContext(ctx,
-			"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
+	portfolio.Version = 1
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
+
+// Save inserts a new portfolio (Version 0) or updates a loaded one. The
+// write only applies if the stored version still matches, otherwise
+// domain.ErrConcurrentModification is returned.
+func (r *portfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		// Save portfolio
+		query := `
+			INSERT INTO portfolios (id, user_id, name, archived_at, version, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				user_id = excluded.user_id,
+				name = excluded.name,
+				archived_at = excluded.archived_at,
+				version = excluded.version,
+				updated_at = excluded.updated_at
+			WHERE portfolios.version = ?
+		`
+		result, err := tx.ExecContext(ctx, query,
 			portfolio.ID().Value,
-			investment.ID().Value,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.Version+1,
+			portfolio.CreatedAt,
+			portfolio.UpdatedAt,
+			portfolio.Version,
 		)
 		if err != nil {
+			return portfolioWriteError(err)
+		}
+		if err := checkVersionedWrite(result, "portfolio", portfolio.ID().Value); err != nil {
 			return err
 		}
-	}
 
-	return tx.Commit()
-}
+		// Delete existing portfolio investments
+		_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", portfolio.ID().Value)
+		if err != nil {
+			return err
+		}
 
-func (r *portfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
-	tx, err := r.db.BeginTx(ctx, nil)
+		// Save portfolio investments
+		for _, investment := range portfolio.GetInvestments() {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
+				portfolio.ID().Value,
+				investment.ID().Value,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := saveCashTransactions(ctx, tx, portfolio, unsavedCashTransactions(portfolio)); err != nil {
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	// Save portfolio
-	query := `
-		INSERT INTO portfolios (id, user_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(id) DO UPDATE SET
-			user_id = excluded.user_id,
-			updated_at = excluded.updated_at
-	`
-	_, err = tx.ExecContext(ctx, query,
-		portfolio.ID().Value,
-		portfolio.UserID,
-		portfolio.CreatedAt,
-		portfolio.UpdatedAt,
-	)
+	portfolio.Version++
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
+
+func (r *portfolioRepository) FindByID(ctx context.Context, id domain.PortfolioID) (*domain.Portfolio, error) {
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db), "p.id = ?", id.Value)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if len(portfolios) == 0 {
+		return nil, sql.ErrNoRows
 	}
+	return portfolios[0], nil
+}
 
-	// Delete existing portfolio investments
-	_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", portfolio.ID().Value)
-	if err != nil {
-		return err
+// FindByIDs loads the portfolios in the order of ids. Unknown ids are skipped.
+func (r *portfolioRepository) FindByIDs(ctx context.Context, ids []domain.PortfolioID) ([]*domain.Portfolio, error) {
+	if len(ids) == 0 {
+		return []*domain.Portfolio{}, nil
 	}
 
-	// Save portfolio investments
-	for _, investment := range portfolio.GetInvestments() {
-		_, err = tx.ExecContext(ctx,
-			"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
-			portfolio.ID().Value,
-			investment.ID().Value,
-		)
-		if err != nil {
-			return err
-		}
+	// IDの数に関係なく1つのパラメータで渡せるようにJSON配列にする
+	values := make([]string, len(ids))
+	for i, id := range ids {
+		values[i] = id.Value
+	}
+	idList, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db), "p.id IN (SELECT value FROM json_each(?))", string(idList))
+	if err != nil {
+		return nil, err
+	}
+	return orderByIDs(portfolios, ids), nil
 }
 
-func (r *portfolioRepository) FindByID(ctx context.Context, id domain.PortfolioID) (*domain.Portfolio, error) {
-	query := `
-		SELECT user_id, created_at, updated_at
-		FROM portfolios
-		WHERE id = ?
-	`
+func (r *portfolioRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	return loadPortfolios(ctx, conn(ctx, r.db), "p.user_id = ?", userID)
+}
 
-	var userID string
-	var createdAt string
-	var updatedAt string
+func (r *portfolioRepository) FindAll(ctx context.Context) ([]*domain.Portfolio, error) {
+	return loadPortfolios(ctx, conn(ctx, r.db), "1 = 1")
+}
 
-	err := r.db.QueryRowContext(ctx, query, id.Value).Scan(
-		&userID,
-		&createdAt,
-		&updatedAt,
+func (r *portfolioRepository) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
+	portfolios, err := loadPortfolios(ctx, conn(ctx, r.db),
+		"p.id IN (SELECT portfolio_id FROM portfolio_investments WHERE investment_id = ?)",
+		investmentID.Value,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if len(portfolios) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return portfolios[0], nil
+}
 
-	portfolio := domain.NewPortfolio(id, userID)
-
-	// Load investments
-	investments, err := r.loadPortfolioInvestments(ctx, id)
+// loadPortfolios loads the portfolios matching cond, a condition on
+// portfolios aliased as p, with their investments and cash ledgers. It
+// issues three queries however many portfolios match, instead of a few per
+// portfolio.
+func loadPortfolios(ctx context.Context, q querier, cond string, args ...interface{}) ([]*domain.Portfolio, error) {
+	states, err := loadPortfolioStates(ctx, q, cond, args)
 	if err != nil {
 		return nil, err
 	}
+	if len(states) == 0 {
+		return []*domain.Portfolio{}, nil
+	}
 
-	for _, investment := range investments {
-		if err := portfolio.AddInvestment(investment); err != nil {
-			return nil, err
-		}
+	byID := make(map[string]*domain.PortfolioState, len(states))
+	for _, state := range states {
+		byID[state.ID.Value] = state
+	}
+
+	if err := loadPortfolioInvestments(ctx, q, byID, cond, args); err != nil {
+		return nil, err
+	}
+	if err := loadCashTransactions(ctx, q, byID, cond, args); err != nil {
+		return nil, err
 	}
 
-	return portfolio, nil
+	portfolios := make([]*domain.Portfolio, 0, len(states))
+	for _, state := range states {
+		// 保存済みの状態は投資上限やアーカイブの検証を通さずにそのまま復元する
+		portfolios = append(portfolios, domain.ReconstitutePortfolio(*state))
+	}
+	return portfolios, nil
 }
 
-func (r *portfolioRepository) FindByUserID(ctx context.Context, userID string) (*domain.Portfolio, error) {
+func loadPortfolioStates(ctx context.Context, q querier, cond string, args []interface{}) ([]*domain.PortfolioState, error) {
 	query := `
-		SELECT id
-		FROM portfolios
-		WHERE user_id = ?
+		SELECT p.id, p.user_id, p.name, p.archived_at, p.version, p.created_at, p.updated_at
+		FROM portfolios p
+		WHERE ` + cond + `
+		ORDER BY p.created_at, p.id
 	`
 
-	var id string
-	err := r.db.QueryRowContext(ctx, query, userID).Scan(&id)
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return r.FindByID(ctx, domain.NewPortfolioID(id))
-}
+	var states []*domain.PortfolioState
+	for rows.Next() {
+		var state domain.PortfolioState
+		var id string
+		var archivedAt nullTime
+		var createdAt nullTime
+		var updatedAt nullTime
 
-func (r *portfolioRepository) Delete(ctx context.Context, id domain.PortfolioID) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+		err := rows.Scan(&id, &state.UserID, &state.Name, &archivedAt, &state.Version, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		state.ID = domain.NewPortfolioID(id)
+		state.ArchivedAt = archivedAt.Ptr()
+		state.CreatedAt = createdAt.Time
+		state.UpdatedAt = updatedAt.Time
+		states = append(states, &state)
 	}
-	defer tx.Rollback()
 
-	// Delete portfolio investments
-	_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", id.Value)
+	return states, rows.Err()
+}
+
+func loadPortfolioInvestments(ctx context.Context, q querier, byID map[string]*domain.PortfolioState, cond string, args []interface{}) error {
+	query := `
+		SELECT i.id, i.amount, i.currency, i.type, i.strategy, i.version, i.created_at, i.updated_at, pi.portfolio_id
+		FROM portfolios p
+		JOIN portfolio_investments pi ON pi.portfolio_id = p.id
+		JOIN investments i ON i.id = pi.investment_id
+		WHERE ` + cond
+
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	// Delete portfolio
-	_, err = tx.ExecContext(ctx, "DELETE FROM portfolios WHERE id = ?", id.Value)
-	if err != nil {
-		return err
+	for rows.Next() {
+		var portfolioID string
+		investment, err := scanInvestment(rows, &portfolioID)
+		if err != nil {
+			return err
+		}
+		if state, ok := byID[portfolioID]; ok {
+			state.Investments = append(state.Investments, investment)
+		}
 	}
 
-	return tx.Commit()
+	return rows.Err()
 }
 
-func (r *portfolioRepository) Update(ctx context.Context, portfolio *domain.Portfolio) error {
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	// Update portfolio
+func loadCashTransactions(ctx context.Context, q querier, byID map[string]*domain.PortfolioState, cond string, args []interface{}) error {
 	query := `
-		UPDATE portfolios
-		SET user_id = ?, updated_at = ?
-		WHERE id = ?
+		SELECT c.portfolio_id, c.id, c.type, c.amount, c.currency, c.investment_id, c.occurred_at
+		FROM portfolios p
+		JOIN cash_transactions c ON c.portfolio_id = p.id
+		WHERE ` + cond + `
+		ORDER BY c.occurred_at, c.rowid
 	`
-	_, err = tx.ExecContext(ctx, query,
-		portfolio.UserID,
-		portfolio.UpdatedAt,
-		portfolio.ID().Value,
-	)
-	if err != nil {
-		return err
-	}
 
-	// Update portfolio investments
-	_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", portfolio.ID().Value)
+	rows, err := q.QueryContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 
-	for _, investment := range portfolio.GetInvestments() {
-		_, err = tx.ExecContext(ctx,
-			"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
-			portfolio.ID().Value,
-			investment.ID().Value,
-		)
+	for rows.Next() {
+		var portfolioID string
+		var tx domain.CashTransaction
+		var typeVal string
+		var investmentID sql.NullString
+		var occurredAt nullTime
+
+		err := rows.Scan(&portfolioID, &tx.ID, &typeVal, &tx.Amount.Amount, &tx.Amount.Currency, &investmentID, &occurredAt)
 		if err != nil {
 			return err
 		}
+		tx.OccurredAt = occurredAt.Time
+
+		tx.Type = domain.CashTransactionType(typeVal)
+		tx.InvestmentID = domain.NewInvestmentID(investmentID.String)
+		if state, ok := byID[portfolioID]; ok {
+			state.CashTransactions = append(state.CashTransactions, &tx)
+		}
 	}
 
-	return tx.Commit()
+	return rows.Err()
 }
 
-func (r *portfolioRepository) loadPortfolioInvestments(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.Investment, error) {
-	investmentRepo := NewInvestmentRepository(r.db)
-	return investmentRepo.FindAllByPortfolioID(ctx, portfolioID)
+// orderByIDs returns the portfolios in the order of ids.
+func orderByIDs(portfolios []*domain.Portfolio, ids []domain.PortfolioID) []*domain.Portfolio {
+	byID := make(map[string]*domain.Portfolio, len(portfolios))
+	for _, portfolio := range portfolios {
+		byID[portfolio.ID().Value] = portfolio
+	}
+
+	ordered := make([]*domain.Portfolio, 0, len(portfolios))
+	for _, id := range ids {
+		if portfolio, ok := byID[id.Value]; ok {
+			ordered = append(ordered, portfolio)
+			// 同じIDが複数回指定されても1度だけ返す
+			delete(byID, id.Value)
+		}
+	}
+	return ordered
 }
 
-func (r *portfolioRepository) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
-	query := `
-		SELECT p.id, p.user_id, p.created_at, p.updated_at
-		FROM portfolios p
-		JOIN portfolio_investments pi ON p.id = pi.portfolio_id
-		WHERE pi.investment_id = ?
-	`
+// Delete removes the portfolio together with its investment links, cash
+// ledger and memberships if the stored version still matches.
+func (r *portfolioRepository) Delete(ctx context.Context, portfolio *domain.Portfolio) error {
+	id := portfolio.ID()
+	return runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
 
-	var id string
-	var userID string
-	var createdAt string
-	var updatedAt string
+		// Delete portfolio investments
+		_, err := tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", id.Value)
+		if err != nil {
+			return err
+		}
 
-	err := r.db.QueryRowContext(ctx, query, investmentID.Value).Scan(
-		&id,
-		&userID,
-		&createdAt,
-		&updatedAt,
-	)
+		// Delete cash ledger
+		_, err = tx.ExecContext(ctx, "DELETE FROM cash_transactions WHERE portfolio_id = ?", id.Value)
+		if err != nil {
+			return err
+		}
+
+		// Delete memberships
+		_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_memberships WHERE portfolio_id = ?", id.Value)
+		if err != nil {
+			return err
+		}
+
+		// Delete portfolio（版が変わっていればトランザクションごと取り消す）
+		result, err := tx.ExecContext(ctx, "DELETE FROM portfolios WHERE id = ? AND version = ?", id.Value, portfolio.Version)
+		if err != nil {
+			return err
+		}
+		return checkVersionedWrite(result, "portfolio", id.Value)
+	})
+}
+
+func (r *portfolioRepository) Update(ctx context.Context, portfolio *domain.Portfolio) error {
+	err := runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		tx := conn(ctx, r.db)
+
+		// Update portfolio
+		query := `
+			UPDATE portfolios
+			SET user_id = ?, name = ?, archived_at = ?, version = version + 1, updated_at = ?
+			WHERE id = ? AND version = ?
+		`
+		result, err := tx.ExecContext(ctx, query,
+			portfolio.UserID,
+			portfolio.Name,
+			portfolio.ArchivedAt,
+			portfolio.UpdatedAt,
+			portfolio.ID().Value,
+			portfolio.Version,
+		)
+		if err != nil {
+			return portfolioWriteError(err)
+		}
+		if err := checkVersionedWrite(result, "portfolio", portfolio.ID().Value); err != nil {
+			return err
+		}
+
+		// Update portfolio investments
+		_, err = tx.ExecContext(ctx, "DELETE FROM portfolio_investments WHERE portfolio_id = ?", portfolio.ID().Value)
+		if err != nil {
+			return err
+		}
+
+		for _, investment := range portfolio.GetInvestments() {
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO portfolio_investments (portfolio_id, investment_id) VALUES (?, ?)",
+				portfolio.ID().Value,
+				investment.ID().Value,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := saveCashTransactions(ctx, tx, portfolio, unsavedCashTransactions(portfolio)); err != nil {
+			return err
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	portfolio := domain.NewPortfolio(domain.NewPortfolioID(id), userID)
+	portfolio.Version++
+	portfolio.MarkCashTransactionsSaved()
+	return nil
+}
 
-	// Load investments
-	investments, err := r.loadPortfolioInvestments(ctx, portfolio.ID())
-	if err != nil {
-		return nil, err
+// unsavedCashTransactions returns the ledger entries a write has to insert:
+// the whole ledger of a new portfolio, otherwise only the entries recorded
+// since it was loaded, so that a write does not cost the size of the ledger.
+func unsavedCashTransactions(portfolio *domain.Portfolio) []*domain.CashTransaction {
+	if portfolio.Version == 0 {
+		return portfolio.CashTransactions
 	}
+	return portfolio.UnsavedCashTransactions()
+}
 
-	for _, investment := range investments {
-		if err := portfolio.AddInvestment(investment); err != nil {
-			return nil, err
+// saveCashTransactions appends ledger entries. The ledger is append-only, so
+// entries that are already stored (for example those of a replayed
+// portfolio) are skipped rather than rewritten.
+func saveCashTransactions(ctx context.Context, tx querier, portfolio *domain.Portfolio, entries []*domain.CashTransaction) error {
+	for _, cashTx := range entries {
+		var investmentID sql.NullString
+		if cashTx.InvestmentID.Value != "" {
+			investmentID = sql.NullString{String: cashTx.InvestmentID.Value, Valid: true}
+		}
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO cash_transactions (id, portfolio_id, type, amount, currency, investment_id, occurred_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`,
+			cashTx.ID,
+			portfolio.ID().Value,
+			string(cashTx.Type),
+			cashTx.Amount.Amount,
+			cashTx.Amount.Currency,
+			investmentID,
+			cashTx.OccurredAt,
+		)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	return portfolio, nil
+// portfolioWriteError reports a violation of the unique index on the owner
+// and name of portfolios as domain.ErrDuplicatePortfolioName. A duplicate ID
+// violates the primary key instead.
+func portfolioWriteError(err error) error {
+	if isUniqueViolation(err) {
+		return domain.ErrDuplicatePortfolioName
+	}
+	return err
 }
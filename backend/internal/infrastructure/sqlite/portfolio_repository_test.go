@@ -3,8 +3,12 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"moneyget/internal/domain"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestPortfolioRepository(t *testing.T) {
@@ -71,10 +75,48 @@ func TestPortfolioRepository(t *testing.T) {
 	t.Run("FindByUserID", func(t *testing.T) {
 		found, err := repo.FindByUserID(ctx, portfolio.UserID)
 		if err != nil {
-			t.Errorf("Failed to find portfolio by user ID: %v", err)
+			t.Fatalf("Failed to find portfolio by user ID: %v", err)
 		}
-		if found.ID().Value != portfolio.ID().Value {
-			t.Errorf("Expected ID %s, got %s", portfolio.ID().Value, found.ID().Value)
+		if len(found) != 1 {
+			t.Fatalf("Expected 1 portfolio, got %d", len(found))
+		}
+		if found[0].ID().Value != portfolio.ID().Value {
+			t.Errorf("Expected ID %s, got %s", portfolio.ID().Value, found[0].ID().Value)
+		}
+	})
+
+	// 複数ポートフォリオ・名前・アーカイブのテスト
+	t.Run("MultiplePortfolios", func(t *testing.T) {
+		nisa := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio-nisa"), portfolio.UserID)
+		if err := nisa.Rename("NISA"); err != nil {
+			t.Fatalf("Failed to rename portfolio: %v", err)
+		}
+		if err := nisa.Archive(); err != nil {
+			t.Fatalf("Failed to archive portfolio: %v", err)
+		}
+		if err := repo.Save(ctx, nisa); err != nil {
+			t.Fatalf("Failed to save portfolio: %v", err)
+		}
+
+		found, err := repo.FindByUserID(ctx, portfolio.UserID)
+		if err != nil {
+			t.Fatalf("Failed to find portfolios by user ID: %v", err)
+		}
+		if len(found) != 2 {
+			t.Fatalf("Expected 2 portfolios, got %d", len(found))
+		}
+		if found[0].ID() != portfolio.ID() || found[1].ID() != nisa.ID() {
+			t.Errorf("Expected portfolios ordered by creation time, got %s, %s", found[0].ID().Value, found[1].ID().Value)
+		}
+		if found[0].Name != domain.DefaultPortfolioName || found[0].IsArchived() {
+			t.Errorf("Expected active default portfolio, got name %q archived %v", found[0].Name, found[0].IsArchived())
+		}
+		if found[1].Name != "NISA" || !found[1].IsArchived() {
+			t.Errorf("Expected archived NISA portfolio, got name %q archived %v", found[1].Name, found[1].IsArchived())
+		}
+
+		if err := repo.Delete(ctx, nisa); err != nil {
+			t.Fatalf("Failed to delete portfolio: %v", err)
 		}
 	})
 
@@ -124,9 +166,57 @@ func TestPortfolioRepository(t *testing.T) {
 		}
 	})
 
+	// 現金台帳の保存と読み込みのテスト
+	t.Run("CashTransactions", func(t *testing.T) {
+		deposit, _ := domain.NewMoney(50000, "JPY")
+		depositTx, _ := domain.NewCashTransaction("cash-deposit", domain.CashDeposit, deposit, domain.InvestmentID{})
+		if err := portfolio.RecordCashTransaction(depositTx); err != nil {
+			t.Fatalf("Failed to record deposit: %v", err)
+		}
+
+		withdrawal, _ := domain.NewMoney(20000, "JPY")
+		withdrawalTx, _ := domain.NewCashTransaction("cash-withdrawal", domain.CashWithdrawal, withdrawal, domain.InvestmentID{})
+		if err := portfolio.RecordCashTransaction(withdrawalTx); err != nil {
+			t.Fatalf("Failed to record withdrawal: %v", err)
+		}
+
+		dividend, _ := domain.NewMoney(10, "USD")
+		dividendTx, _ := domain.NewCashTransaction("cash-dividend", domain.CashDividend, dividend, investment.ID())
+		if err := portfolio.RecordCashTransaction(dividendTx); err != nil {
+			t.Fatalf("Failed to record dividend: %v", err)
+		}
+
+		// 2回保存しても台帳は重複しない
+		for i := 0; i < 2; i++ {
+			if err := repo.Save(ctx, portfolio); err != nil {
+				t.Fatalf("Failed to save portfolio: %v", err)
+			}
+		}
+
+		found, err := repo.FindByID(ctx, portfolio.ID())
+		if err != nil {
+			t.Fatalf("Failed to find portfolio: %v", err)
+		}
+		if len(found.CashTransactions) != 3 {
+			t.Fatalf("Expected 3 cash transactions, got %d", len(found.CashTransactions))
+		}
+		if balance := found.CashBalance("JPY"); balance.Amount != 30000 {
+			t.Errorf("Expected JPY balance 30000, got %f", balance.Amount)
+		}
+		if balance := found.CashBalance("USD"); balance.Amount != 10 {
+			t.Errorf("Expected USD balance 10, got %f", balance.Amount)
+		}
+		if found.CashTransactions[2].InvestmentID != investment.ID() {
+			t.Errorf("Expected dividend to reference investment %s, got %s", investment.ID().Value, found.CashTransactions[2].InvestmentID.Value)
+		}
+		if found.CashTransactions[0].OccurredAt.IsZero() {
+			t.Error("Expected occurred_at to be loaded")
+		}
+	})
+
 	// Delete のテスト
 	t.Run("Delete", func(t *testing.T) {
-		err := repo.Delete(ctx, portfolio.ID())
+		err := repo.Delete(ctx, portfolio)
 		if err != nil {
 			t.Errorf("Failed to delete portfolio: %v", err)
 		}
@@ -138,3 +228,292 @@ func TestPortfolioRepository(t *testing.T) {
 		}
 	})
 }
+
+func TestPortfolioRepository_OptimisticLocking(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewPortfolioRepository(db)
+	ctx := context.Background()
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	if err := repo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to create portfolio: %v", err)
+	}
+	if portfolio.Version != 1 {
+		t.Errorf("Expected version 1 after create, got %d", portfolio.Version)
+	}
+
+	first, _ := repo.FindByID(ctx, portfolio.ID())
+	second, _ := repo.FindByID(ctx, portfolio.ID())
+
+	first.Rename("First")
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatalf("Failed to save first copy: %v", err)
+	}
+
+	second.Rename("Second")
+	if err := repo.Save(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification from Save, got %v", err)
+	}
+	if err := repo.Update(ctx, second); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification from Update, got %v", err)
+	}
+
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("Failed to update current copy: %v", err)
+	}
+
+	stored, _ := repo.FindByID(ctx, portfolio.ID())
+	if stored.Name != "First" || stored.Version != 3 {
+		t.Errorf("Expected name First at version 3, got %q at version %d", stored.Name, stored.Version)
+	}
+}
+
+func TestPortfolioRepository_SavesOnlyNewCashTransactions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewPortfolioRepository(db)
+	ctx := context.Background()
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	for _, id := range []string{"cash-1", "cash-2"} {
+		deposit, _ := domain.NewCashTransaction(id, domain.CashDeposit, domain.Money{Amount: 1000, Currency: "JPY"}, domain.InvestmentID{})
+		if err := portfolio.RecordCashTransaction(deposit); err != nil {
+			t.Fatalf("Failed to deposit: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to create portfolio: %v", err)
+	}
+
+	loaded, err := repo.FindByID(ctx, portfolio.ID())
+	if err != nil {
+		t.Fatalf("Failed to load portfolio: %v", err)
+	}
+	if unsaved := loaded.UnsavedCashTransactions(); len(unsaved) != 0 {
+		t.Errorf("Expected no unsaved entries after loading, got %d", len(unsaved))
+	}
+
+	// 読み込んだ後に消えた行が書き戻されなければ、台帳全体は書いていない
+	if _, err := db.Exec("DELETE FROM cash_transactions WHERE id = 'cash-1'"); err != nil {
+		t.Fatalf("Failed to delete entry: %v", err)
+	}
+	withdrawal, _ := domain.NewCashTransaction("cash-3", domain.CashWithdrawal, domain.Money{Amount: 500, Currency: "JPY"}, domain.InvestmentID{})
+	if err := loaded.RecordCashTransaction(withdrawal); err != nil {
+		t.Fatalf("Failed to withdraw: %v", err)
+	}
+	if err := repo.Save(ctx, loaded); err != nil {
+		t.Fatalf("Failed to save portfolio: %v", err)
+	}
+	if unsaved := loaded.UnsavedCashTransactions(); len(unsaved) != 0 {
+		t.Errorf("Expected no unsaved entries after saving, got %d", len(unsaved))
+	}
+
+	var ids []string
+	rows, err := db.Query("SELECT id FROM cash_transactions ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query ledger: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if fmt.Sprint(ids) != "[cash-2 cash-3]" {
+		t.Errorf("Expected only the new entry to be inserted, got %v", ids)
+	}
+}
+
+func TestPortfolioRepository_RoundTrip(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	repo := NewPortfolioRepository(db)
+	investmentRepo := NewInvestmentRepository(db)
+	ctx := context.Background()
+
+	createdAt := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	updatedAt := time.Date(2023, 6, 7, 8, 9, 10, 0, time.UTC)
+	archivedAt := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	occurredAt := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	// 現在の上限（1000万円）を超える、アーカイブ済みのポートフォリオ
+	investments := []*domain.Investment{
+		domain.ReconstituteInvestment(domain.NewInvestmentID("first"), domain.Money{Amount: 8000000, Currency: "JPY"}, domain.Stock, domain.Aggressive, 0, createdAt, updatedAt),
+		domain.ReconstituteInvestment(domain.NewInvestmentID("second"), domain.Money{Amount: 7000000, Currency: "JPY"}, domain.Bond, domain.Conservative, 0, createdAt, createdAt),
+	}
+	for _, investment := range investments {
+		if err := investmentRepo.Create(ctx, investment); err != nil {
+			t.Fatalf("Failed to create investment: %v", err)
+		}
+	}
+
+	portfolio := domain.ReconstitutePortfolio(domain.PortfolioState{
+		ID:          domain.NewPortfolioID("test-portfolio"),
+		UserID:      "test-user",
+		Name:        "Legacy",
+		Investments: investments,
+		CashTransactions: []*domain.CashTransaction{
+			{
+				ID:         "deposit",
+				Type:       domain.CashDeposit,
+				Amount:     domain.Money{Amount: 500, Currency: "JPY"},
+				OccurredAt: occurredAt,
+			},
+		},
+		ArchivedAt: &archivedAt,
+		CreatedAt:  createdAt,
+		UpdatedAt:  updatedAt,
+	})
+	if err := repo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to create portfolio: %v", err)
+	}
+
+	found, err := repo.FindByID(ctx, portfolio.ID())
+	if err != nil {
+		t.Fatalf("Failed to load stored portfolio: %v", err)
+	}
+
+	if found.UserID != "test-user" || found.Name != "Legacy" || found.Version != 1 {
+		t.Errorf("Unexpected portfolio: user=%s name=%s version=%d", found.UserID, found.Name, found.Version)
+	}
+	if !found.CreatedAt.Equal(createdAt) || !found.UpdatedAt.Equal(updatedAt) {
+		t.Errorf("Expected timestamps %v/%v, got %v/%v", createdAt, updatedAt, found.CreatedAt, found.UpdatedAt)
+	}
+	if found.ArchivedAt == nil || !found.ArchivedAt.Equal(archivedAt) {
+		t.Errorf("Expected archived at %v, got %v", archivedAt, found.ArchivedAt)
+	}
+
+	if len(found.GetInvestments()) != 2 {
+		t.Fatalf("Expected 2 investments, got %d", len(found.GetInvestments()))
+	}
+	if total := found.CalculateInvestedAmount(); total.Amount != 15000000 {
+		t.Errorf("Expected invested amount 15000000, got %f", total.Amount)
+	}
+	for _, investment := range found.GetInvestments() {
+		if !investment.CreatedAt.Equal(createdAt) || investment.Version != 1 {
+			t.Errorf("Investment %s: expected created at %v version 1, got %v version %d",
+				investment.ID().Value, createdAt, investment.CreatedAt, investment.Version)
+		}
+	}
+
+	if len(found.CashTransactions) != 1 {
+		t.Fatalf("Expected 1 cash transaction, got %d", len(found.CashTransactions))
+	}
+	cash := found.CashTransactions[0]
+	if cash.ID != "deposit" || cash.Type != domain.CashDeposit || cash.Amount.Amount != 500 {
+		t.Errorf("Unexpected cash transaction %+v", cash)
+	}
+	if !cash.OccurredAt.Equal(occurredAt) {
+		t.Errorf("Expected occurred at %v, got %v", occurredAt, cash.OccurredAt)
+	}
+}
+
+// BenchmarkPortfolioRepository_Load compares loading 1,000 portfolios of 50
+// investments each one by one, as FindByUserID used to, with batch loading.
+func BenchmarkPortfolioRepository_Load(b *testing.B) {
+	const (
+		portfolioCount          = 1000
+		investmentsPerPortfolio = 50
+	)
+
+	db, err := sql.Open("sqlite3", filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := RunMigrations(db); err != nil {
+		b.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	repo := NewPortfolioRepository(db)
+	investmentRepo := NewInvestmentRepository(db)
+	ctx := context.Background()
+
+	ids := make([]domain.PortfolioID, 0, portfolioCount)
+	err = NewTransactionManager(db).RunInTransaction(ctx, func(ctx context.Context) error {
+		for i := 0; i < portfolioCount; i++ {
+			investments := make([]*domain.Investment, 0, investmentsPerPortfolio)
+			for j := 0; j < investmentsPerPortfolio; j++ {
+				investment := domain.ReconstituteInvestment(
+					domain.NewInvestmentID(fmt.Sprintf("inv-%d-%d", i, j)),
+					domain.Money{Amount: 1000, Currency: "JPY"},
+					domain.Stock,
+					domain.Moderate,
+					0,
+					time.Now(),
+					time.Now(),
+				)
+				if err := investmentRepo.Create(ctx, investment); err != nil {
+					return err
+				}
+				investments = append(investments, investment)
+			}
+
+			portfolio := domain.ReconstitutePortfolio(domain.PortfolioState{
+				ID:          domain.NewPortfolioID(fmt.Sprintf("portfolio-%d", i)),
+				UserID:      "bench-user",
+				Name:        "Main",
+				Investments: investments,
+				CreatedAt:   time.Now(),
+				UpdatedAt:   time.Now(),
+			})
+			if err := repo.Create(ctx, portfolio); err != nil {
+				return err
+			}
+			ids = append(ids, portfolio.ID())
+		}
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("Failed to seed portfolios: %v", err)
+	}
+
+	check := func(b *testing.B, portfolios []*domain.Portfolio) {
+		if len(portfolios) != portfolioCount {
+			b.Fatalf("Expected %d portfolios, got %d", portfolioCount, len(portfolios))
+		}
+		if n := len(portfolios[0].GetInvestments()); n != investmentsPerPortfolio {
+			b.Fatalf("Expected %d investments, got %d", investmentsPerPortfolio, n)
+		}
+	}
+
+	b.Run("OneByOne", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			portfolios := make([]*domain.Portfolio, 0, len(ids))
+			for _, id := range ids {
+				portfolio, err := repo.FindByID(ctx, id)
+				if err != nil {
+					b.Fatalf("FindByID failed: %v", err)
+				}
+				portfolios = append(portfolios, portfolio)
+			}
+			check(b, portfolios)
+		}
+	})
+
+	b.Run("FindByUserID", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			portfolios, err := repo.FindByUserID(ctx, "bench-user")
+			if err != nil {
+				b.Fatalf("FindByUserID failed: %v", err)
+			}
+			check(b, portfolios)
+		}
+	})
+
+	b.Run("FindByIDs", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			portfolios, err := repo.FindByIDs(ctx, ids)
+			if err != nil {
+				b.Fatalf("FindByIDs failed: %v", err)
+			}
+			check(b, portfolios)
+		}
+	})
+}
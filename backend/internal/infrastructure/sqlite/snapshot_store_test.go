@@ -0,0 +1,73 @@
+package sqlite
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"strconv"
+	"testing"
+)
+
+// benchmarkStreamLength is the number of events of the benchmarked stream.
+const benchmarkStreamLength = 2000
+
+// appendBenchmarkStream stores a portfolio whose investments are updated
+// until its stream holds benchmarkStreamLength events.
+func appendBenchmarkStream(b *testing.B, events *service.EventStore) string {
+	ctx := context.Background()
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("benchmark-portfolio"), "benchmark-user")
+	for i := 0; i < 10; i++ {
+		investment, err := domain.NewInvestment(domain.NewInvestmentID("inv-"+strconv.Itoa(i)), domain.Money{Amount: 1000, Currency: "JPY"}, domain.Stock, domain.Moderate)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := portfolio.AddInvestment(investment); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := len(portfolio.Events()); i < benchmarkStreamLength; i++ {
+		id := domain.NewInvestmentID("inv-" + strconv.Itoa(i%10))
+		if err := portfolio.UpdateInvestmentAmount(id, domain.Money{Amount: float64(1000 + i), Currency: "JPY"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if _, err := events.Append(ctx, 0, portfolio.Events()...); err != nil {
+		b.Fatal(err)
+	}
+	return portfolio.ID().Value
+}
+
+// BenchmarkPortfolioLoad compares replaying a whole stream with loading the
+// latest snapshot and the events that follow it.
+func BenchmarkPortfolioLoad(b *testing.B) {
+	ctx := context.Background()
+	db, cleanup := setupTestDB(b)
+	defer cleanup()
+
+	events := service.NewEventStore(NewEventStoreDB(db))
+	snapshots := NewSnapshotStoreDB(db)
+	id := appendBenchmarkStream(b, events)
+
+	b.Run("cold replay", func(b *testing.B) {
+		loader := service.NewPortfolioLoader(events, snapshots, 0)
+		for i := 0; i < b.N; i++ {
+			if _, _, err := loader.Load(ctx, id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("snapshot", func(b *testing.B) {
+		loader := service.NewPortfolioLoader(events, snapshots, 0)
+		if _, err := loader.TakeSnapshot(ctx, id); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, _, err := loader.Load(ctx, id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// timeLayouts are the formats a DATETIME column may hold: the ones written
+// by the driver, SQLite's own CURRENT_TIMESTAMP and time.Time.String().
+var timeLayouts = append([]string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}, sqlite3.SQLiteTimestampFormats...)
+
+// nullTime scans a DATETIME column regardless of how the value was stored.
+// The driver only converts values it recognises, so strings and unix
+// timestamps are parsed here.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *nullTime) Scan(value interface{}) error {
+	t.Time, t.Valid = time.Time{}, false
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		t.Time = v
+	case int64:
+		t.Time = time.Unix(v, 0).UTC()
+	case float64:
+		t.Time = time.Unix(0, int64(v*float64(time.Second))).UTC()
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	default:
+		return fmt.Errorf("sqlite: cannot scan %T into time", value)
+	}
+
+	t.Valid = true
+	return nil
+}
+
+func (t *nullTime) parse(value string) error {
+	value = strings.TrimSpace(value)
+	// time.Time.String()はモノトニック時計の値を付加する
+	if i := strings.Index(value, " m="); i >= 0 {
+		value = value[:i]
+	}
+
+	for _, layout := range timeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			t.Time, t.Valid = parsed, true
+			return nil
+		}
+	}
+	return fmt.Errorf("sqlite: cannot parse time %q", value)
+}
+
+// Ptr returns the time as a pointer, nil if the column was NULL.
+func (t nullTime) Ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	value := t.Time
+	return &value
+}
+
+// timeParam formats a time for comparison with julianday(). SQLite only
+// understands a "Z" or "±HH:MM" suffix, not the zone names Go may add.
+func timeParam(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999Z07:00")
+}
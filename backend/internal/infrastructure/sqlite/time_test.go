@@ -0,0 +1,48 @@
+package sqlite
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNullTime_Scan(t *testing.T) {
+	want := time.Date(2023, 4, 1, 9, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		valid bool
+	}{
+		{"time.Time", want, true},
+		{"RFC3339", "2023-04-01T09:30:15Z", true},
+		{"CURRENT_TIMESTAMP", "2023-04-01 09:30:15", true},
+		{"time.Time.String", want.String(), true},
+		{"time.Time.String with monotonic clock", "2023-04-01 09:30:15 +0000 UTC m=+0.012345678", true},
+		{"bytes", []byte("2023-04-01 09:30:15"), true},
+		{"unix seconds", want.Unix(), true},
+		{"NULL", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got nullTime
+			if err := got.Scan(tt.value); err != nil {
+				t.Fatalf("Scan(%v) returned error: %v", tt.value, err)
+			}
+			if got.Valid != tt.valid {
+				t.Fatalf("Expected Valid=%v, got %v", tt.valid, got.Valid)
+			}
+			if tt.valid && !got.Time.Equal(want) {
+				t.Errorf("Expected %v, got %v", want, got.Time)
+			}
+			if !tt.valid && got.Ptr() != nil {
+				t.Error("Expected nil pointer for NULL")
+			}
+		})
+	}
+
+	var invalid nullTime
+	if err := invalid.Scan("not a time"); err == nil {
+		t.Error("Expected error for unparsable value")
+	}
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"moneyget/internal/domain"
+)
+
+// querier is the subset of *sql.DB and *sql.Tx used by the repositories
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txKey struct{}
+
+// unitOfWork is the transaction carried by the context. Nested
+// RunInTransaction calls reuse it and are isolated with savepoints.
+type unitOfWork struct {
+	tx         *sql.Tx
+	savepoints int
+}
+
+func unitOfWorkFromContext(ctx context.Context) (*unitOfWork, bool) {
+	uow, ok := ctx.Value(txKey{}).(*unitOfWork)
+	return uow, ok
+}
+
+// conn returns the ambient transaction if there is one, or the database otherwise
+func conn(ctx context.Context, db *sql.DB) querier {
+	if uow, ok := unitOfWorkFromContext(ctx); ok {
+		return uow.tx
+	}
+	return db
+}
+
+type transactionManager struct {
+	db *sql.DB
+}
+
+func NewTransactionManager(db *sql.DB) domain.TransactionManager {
+	return &transactionManager{db: db}
+}
+
+func (tm *transactionManager) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return runInTransaction(ctx, tm.db, fn)
+}
+
+// runInTransaction runs fn in a new transaction stored in the context, or in
+// a savepoint of the ambient transaction when called inside one.
+func runInTransaction(ctx context.Context, db *sql.DB, fn func(ctx context.Context) error) error {
+	if uow, ok := unitOfWorkFromContext(ctx); ok {
+		return uow.runInSavepoint(ctx, fn)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				// パニックの場合は元のパニックを優先し、ロールバックエラーはログに記録するなどの処理を検討
+				fmt.Printf("Rollback error after panic: %v\n", rbErr)
+			}
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txKey{}, &unitOfWork{tx: tx})); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("error rolling back transaction: %v (original error: %v)", rbErr, err)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (uow *unitOfWork) runInSavepoint(ctx context.Context, fn func(ctx context.Context) error) error {
+	uow.savepoints++
+	name := fmt.Sprintf("sp_%d", uow.savepoints)
+
+	if _, err := uow.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+
+	rollback := func() error {
+		if _, err := uow.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); err != nil {
+			return err
+		}
+		_, err := uow.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			if rbErr := rollback(); rbErr != nil {
+				fmt.Printf("Rollback to savepoint error after panic: %v\n", rbErr)
+			}
+			panic(p)
+		}
+	}()
+
+	if err := fn(ctx); err != nil {
+		if rbErr := rollback(); rbErr != nil {
+			return fmt.Errorf("error rolling back to savepoint: %v (original error: %v)", rbErr, err)
+		}
+		return err
+	}
+
+	_, err := uow.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
+}
+
+// checkVersionedWrite reports domain.ErrConcurrentModification when a
+// version-guarded write matched no row.
+func checkVersionedWrite(result sql.Result, aggregate string, id string) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s %s", domain.ErrConcurrentModification, aggregate, id)
+	}
+	return nil
+}
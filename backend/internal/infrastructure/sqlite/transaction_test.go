@@ -0,0 +1,175 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/usecase"
+	"testing"
+)
+
+// failingPortfolioRepository fails every Save so that the use case aborts
+// after the investment has already been written.
+type failingPortfolioRepository struct {
+	domain.PortfolioRepository
+}
+
+var errSaveFailed = errors.New("save failed")
+
+func (r *failingPortfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
+	return errSaveFailed
+}
+
+func countRows(t *testing.T, ctx context.Context, q querier, table string) int {
+	t.Helper()
+	var count int
+	if err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&count); err != nil {
+		t.Fatalf("Failed to count %s: %v", table, err)
+	}
+	return count
+}
+
+func TestTransactionManager_CreateInvestmentRollsBack(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	portfolioRepo := NewPortfolioRepository(db)
+	investmentRepo := NewInvestmentRepository(db)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	deposit, _ := domain.NewMoney(1000000, "JPY")
+	depositTx, _ := domain.NewCashTransaction("deposit", domain.CashDeposit, deposit, domain.InvestmentID{})
+	if err := portfolio.RecordCashTransaction(depositTx); err != nil {
+		t.Fatalf("Failed to deposit: %v", err)
+	}
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to create portfolio: %v", err)
+	}
+
+	useCase := usecase.NewInvestmentUseCase(
+		investmentRepo,
+		&failingPortfolioRepository{PortfolioRepository: portfolioRepo},
+		NewMembershipRepository(db),
+		NewTransactionManager(db),
+		service.NewOutbox(NewEventStoreDB(db), NewOutboxStoreDB(db)),
+		service.NewInvestmentStrategyService(),
+	)
+
+	_, _, err := useCase.CreateInvestment(ctx, "test-user", "test-portfolio", 100000, "JPY", "STOCK", "CONSERVATIVE")
+	if !errors.Is(err, errSaveFailed) {
+		t.Fatalf("Expected save error, got %v", err)
+	}
+
+	// investmentRepo.Saveで書き込んだ投資もロールバックされている
+	if count := countRows(t, ctx, db, "investments"); count != 0 {
+		t.Errorf("Expected no investments after rollback, got %d", count)
+	}
+	if count := countRows(t, ctx, db, "portfolio_investments"); count != 0 {
+		t.Errorf("Expected no portfolio investments after rollback, got %d", count)
+	}
+	if count := countRows(t, ctx, db, "cash_transactions"); count != 1 {
+		t.Errorf("Expected only the initial deposit, got %d cash transactions", count)
+	}
+	if count := countRows(t, ctx, db, "outbox"); count != 0 {
+		t.Errorf("Expected no events in the outbox after rollback, got %d", count)
+	}
+}
+
+func TestTransactionManager_Savepoints(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	txManager := NewTransactionManager(db)
+	investmentRepo := NewInvestmentRepository(db)
+
+	newInvestment := func(id string) *domain.Investment {
+		money, _ := domain.NewMoney(1000, "JPY")
+		investment, _ := domain.NewInvestment(domain.NewInvestmentID(id), money, domain.Stock, domain.Conservative)
+		return investment
+	}
+
+	t.Run("repositories see uncommitted writes of the ambient transaction", func(t *testing.T) {
+		err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := investmentRepo.Save(ctx, newInvestment("visible")); err != nil {
+				return err
+			}
+			if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("visible")); err != nil {
+				t.Errorf("Expected to read uncommitted investment: %v", err)
+			}
+			return errors.New("abort")
+		})
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("visible")); err == nil {
+			t.Error("Investment should not exist after rollback")
+		}
+	})
+
+	t.Run("failed nested call rolls back only its savepoint", func(t *testing.T) {
+		err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := investmentRepo.Save(ctx, newInvestment("outer")); err != nil {
+				return err
+			}
+
+			nestedErr := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+				if err := investmentRepo.Save(ctx, newInvestment("inner")); err != nil {
+					return err
+				}
+				return errors.New("inner failure")
+			})
+			if nestedErr == nil {
+				t.Error("Expected nested error")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("outer")); err != nil {
+			t.Errorf("Outer investment should be committed: %v", err)
+		}
+		if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("inner")); err == nil {
+			t.Error("Inner investment should be rolled back")
+		}
+	})
+
+	t.Run("failed outer transaction discards released savepoints", func(t *testing.T) {
+		err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+				return investmentRepo.Save(ctx, newInvestment("nested-ok"))
+			}); err != nil {
+				return err
+			}
+			return errors.New("outer failure")
+		})
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if _, err := investmentRepo.FindByID(ctx, domain.NewInvestmentID("nested-ok")); err == nil {
+			t.Error("Nested investment should be rolled back with the outer transaction")
+		}
+	})
+
+	t.Run("repository transactions join the ambient transaction", func(t *testing.T) {
+		portfolioRepo := NewPortfolioRepository(db)
+		portfolio := domain.NewPortfolio(domain.NewPortfolioID("joined"), "test-user")
+
+		err := txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+			if err := portfolioRepo.Save(ctx, portfolio); err != nil {
+				return err
+			}
+			return errors.New("abort")
+		})
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if _, err := portfolioRepo.FindByID(ctx, portfolio.ID()); err == nil {
+			t.Error("Portfolio should be rolled back with the ambient transaction")
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"moneyget/internal/domain"
+	"time"
+)
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) domain.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+const (
+	webhookSubscriptionColumns = `id, user_id, url, event_types, secret, created_at`
+	webhookDeliveryColumns     = `id, subscription_id, event_type, payload, status, attempts, next_attempt_at, response_status, last_error, created_at, updated_at, delivered_at`
+)
+
+func (r *webhookRepository) SaveSubscription(ctx context.Context, subscription *domain.WebhookSubscription) error {
+	eventTypes, err := json.Marshal(subscription.EventTypes)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO webhook_subscriptions (`+webhookSubscriptionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			url = excluded.url,
+			event_types = excluded.event_types,
+			secret = excluded.secret
+	`, subscription.ID, subscription.UserID, subscription.URL, string(eventTypes), subscription.Secret, subscription.CreatedAt.UTC())
+	return err
+}
+
+func (r *webhookRepository) FindSubscriptionByID(ctx context.Context, id string) (*domain.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = ?`
+	return scanWebhookSubscription(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *webhookRepository) FindSubscriptionsByUserID(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE user_id = ? ORDER BY created_at, id`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*domain.WebhookSubscription
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	return runInTransaction(ctx, r.db, func(ctx context.Context) error {
+		q := conn(ctx, r.db)
+		if _, err := q.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE subscription_id = ?", id); err != nil {
+			return err
+		}
+
+		result, err := q.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+func (r *webhookRepository) SaveDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (`+webhookDeliveryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING
+	`,
+		delivery.ID,
+		delivery.SubscriptionID,
+		delivery.EventType,
+		string(delivery.Payload),
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC(),
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.CreatedAt.UTC(),
+		delivery.UpdatedAt.UTC(),
+		deliveredAt(delivery),
+	)
+	return err
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, response_status = ?, last_error = ?, updated_at = ?, delivered_at = ?
+		WHERE id = ?
+	`,
+		string(delivery.Status),
+		delivery.Attempts,
+		delivery.NextAttemptAt.UTC(),
+		delivery.ResponseStatus,
+		delivery.LastError,
+		delivery.UpdatedAt.UTC(),
+		deliveredAt(delivery),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func deliveredAt(delivery *domain.WebhookDelivery) interface{} {
+	if delivery.DeliveredAt == nil {
+		return nil
+	}
+	return delivery.DeliveredAt.UTC()
+}
+
+func (r *webhookRepository) FindDeliveryByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+	return scanWebhookDelivery(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+func (r *webhookRepository) FindDeliveriesBySubscriptionID(ctx context.Context, subscriptionID string, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+		WHERE subscription_id = ?
+		ORDER BY julianday(created_at) DESC, id DESC
+		LIMIT ?`
+	return r.queryDeliveries(ctx, query, subscriptionID, limit)
+}
+
+func (r *webhookRepository) FindDueDeliveries(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries
+		WHERE status = ? AND julianday(next_attempt_at) <= julianday(?)
+		ORDER BY julianday(created_at), id
+		LIMIT ?`
+	return r.queryDeliveries(ctx, query, string(domain.WebhookDeliveryPending), timeParam(now), limit)
+}
+
+func (r *webhookRepository) queryDeliveries(ctx context.Context, query string, args ...interface{}) ([]*domain.WebhookDelivery, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanWebhookSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	var s domain.WebhookSubscription
+	var eventTypes string
+	var createdAt nullTime
+
+	if err := row.Scan(&s.ID, &s.UserID, &s.URL, &eventTypes, &s.Secret, &createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &s.EventTypes); err != nil {
+		return nil, err
+	}
+	s.CreatedAt = createdAt.Time
+
+	return &s, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (*domain.WebhookDelivery, error) {
+	var d domain.WebhookDelivery
+	var payload string
+	var status string
+	var nextAttemptAt, createdAt, updatedAt, deliveredAt nullTime
+
+	err := row.Scan(
+		&d.ID,
+		&d.SubscriptionID,
+		&d.EventType,
+		&payload,
+		&status,
+		&d.Attempts,
+		&nextAttemptAt,
+		&d.ResponseStatus,
+		&d.LastError,
+		&createdAt,
+		&updatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Payload = []byte(payload)
+	d.Status = domain.WebhookDeliveryStatus(status)
+	d.NextAttemptAt = nextAttemptAt.Time
+	d.CreatedAt = createdAt.Time
+	d.UpdatedAt = updatedAt.Time
+	d.DeliveredAt = deliveredAt.Ptr()
+
+	return &d, nil
+}
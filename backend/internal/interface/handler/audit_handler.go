@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"moneyget/internal/domain"
+	"moneyget/internal/usecase"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 書き出しは全ページを読むので、一覧より長く待つ
+const auditExportTimeout = time.Minute
+
+// 書き出し形式
+const (
+	auditFormatJSON  = "json"
+	auditFormatCSV   = "csv"
+	auditFormatJSONL = "jsonl"
+)
+
+var auditCSVHeader = []string{
+	"id", "occurred_at", "aggregate_type", "aggregate_id", "sequence", "event_type", "schema_version",
+	"actor_id", "actor_name", "actor_email", "request_id", "data",
+}
+
+type AuditHandler struct {
+	BaseHandler
+	auditUsecase AuditUsecase
+}
+
+type AuditUsecase interface {
+	ListAuditLog(ctx context.Context, userID string, query usecase.AuditQuery) (*usecase.AuditPage, error)
+	ListPortfolioHistory(ctx context.Context, userID string, portfolioID string, query usecase.AuditQuery) (*usecase.AuditPage, error)
+}
+
+func NewAuditHandler(au AuditUsecase) *AuditHandler {
+	return &AuditHandler{
+		auditUsecase: au,
+	}
+}
+
+// ListAuditLog returns the stored events of all aggregates to admins.
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	h.list(c, "audit", func(ctx context.Context, userID string, query usecase.AuditQuery) (*usecase.AuditPage, error) {
+		return h.auditUsecase.ListAuditLog(ctx, userID, query)
+	})
+}
+
+// PortfolioHistory returns the stored events of a portfolio to the users
+// who may manage it.
+func (h *AuditHandler) PortfolioHistory(c *gin.Context) {
+	portfolioID := c.Param("id")
+	h.list(c, "portfolio-"+portfolioID+"-history", func(ctx context.Context, userID string, query usecase.AuditQuery) (*usecase.AuditPage, error) {
+		return h.auditUsecase.ListPortfolioHistory(ctx, userID, portfolioID, query)
+	})
+}
+
+type auditLister func(ctx context.Context, userID string, query usecase.AuditQuery) (*usecase.AuditPage, error)
+
+// list answers with one page as JSON, or with every page from the cursor on
+// as a CSV or JSON Lines attachment named after filename.
+func (h *AuditHandler) list(c *gin.Context, filename string, lister auditLister) {
+	format := c.DefaultQuery("format", auditFormatJSON)
+	timeout := 5 * time.Second
+	if format != auditFormatJSON {
+		timeout = auditExportTimeout
+	}
+	ctx, cancel := h.NewContext(c, timeout)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	query, err := parseAuditQuery(c)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	switch format {
+	case auditFormatJSON:
+		page, err := lister(ctx, userID, query)
+		if err != nil {
+			h.ResponseError(c, err)
+			return
+		}
+		h.ResponseJSON(c, http.StatusOK, newAuditPageResponse(page))
+	case auditFormatCSV, auditFormatJSONL:
+		if query.Limit == 0 {
+			query.Limit = usecase.MaxAuditPageSize
+		}
+		// 書き始める前に権限と条件を確かめるため、最初のページだけ先に読む
+		page, err := lister(ctx, userID, query)
+		if err != nil {
+			h.ResponseError(c, err)
+			return
+		}
+		h.export(c, ctx, format, filename, page, func(cursor string) (*usecase.AuditPage, error) {
+			query.Cursor = cursor
+			return lister(ctx, userID, query)
+		})
+	default:
+		h.ResponseError(c, fmt.Errorf("%w: format must be json, csv or jsonl", domain.ErrInvalidAuditQuery))
+	}
+}
+
+// export writes the pages as they are read. Once the body has started an
+// error can only cut the file short, so it is logged.
+func (h *AuditHandler) export(c *gin.Context, ctx context.Context, format string, filename string, page *usecase.AuditPage, next func(cursor string) (*usecase.AuditPage, error)) {
+	var write func(entry AuditEntryResponse) error
+	switch format {
+	case auditFormatCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		w := csv.NewWriter(c.Writer)
+		defer w.Flush()
+		if err := w.Write(auditCSVHeader); err != nil {
+			return
+		}
+		write = func(entry AuditEntryResponse) error {
+			return w.Write(entry.csvRecord())
+		}
+	default:
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".jsonl"))
+		encoder := json.NewEncoder(c.Writer)
+		write = func(entry AuditEntryResponse) error {
+			return encoder.Encode(entry)
+		}
+	}
+	c.Status(http.StatusOK)
+
+	for {
+		for _, entry := range page.Entries {
+			if err := write(newAuditEntryResponse(entry)); err != nil {
+				return
+			}
+		}
+		if page.NextCursor == "" {
+			return
+		}
+
+		var err error
+		if page, err = next(page.NextCursor); err != nil {
+			log.Printf("audit export stopped: %v", err)
+			return
+		}
+	}
+}
+
+// parseAuditQuery reads the filters and page position of an audit request.
+// Event types may be repeated or comma-separated, and times are RFC 3339 or
+// YYYY-MM-DD (UTC).
+func parseAuditQuery(c *gin.Context) (usecase.AuditQuery, error) {
+	query := usecase.AuditQuery{
+		AggregateType: c.Query("aggregate_type"),
+		AggregateID:   c.Query("aggregate_id"),
+		EventTypes:    splitQueryValues(c.QueryArray("type")),
+		ActorID:       c.Query("actor"),
+		Cursor:        c.Query("cursor"),
+	}
+
+	var err error
+	if query.From, err = parseTimeQuery(c, "from", domain.ErrInvalidAuditQuery); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTimeQuery(c, "to", domain.ErrInvalidAuditQuery); err != nil {
+		return query, err
+	}
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return query, fmt.Errorf("%w: limit must be an integer", domain.ErrInvalidAuditQuery)
+		}
+	}
+
+	return query, nil
+}
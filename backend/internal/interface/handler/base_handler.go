@@ -2,7 +2,12 @@ package handler
 
 import (
 	"context"
+	"log"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/usecase"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,9 +16,44 @@ import (
 // BaseHandler provides common functionality for all handlers
 type BaseHandler struct{}
 
-// NewContext creates a new context with timeout
+// NewContext creates a new context with timeout. A version given in the
+// If-Match header is passed on to the use cases as the expected version,
+// and the events stored under the context record the user and request ID.
 func (b *BaseHandler) NewContext(c *gin.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(c.Request.Context(), timeout)
+	userID, _ := b.CurrentUserID(c)
+	ctx := service.WithActor(c.Request.Context(), service.Actor{UserID: userID, RequestID: RequestID(c)})
+	if versions, ok := parseIfMatch(c.GetHeader("If-Match")); ok {
+		ctx = usecase.WithExpectedVersion(ctx, versions...)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// SetETag sets the ETag header for a resource at the given version
+func (b *BaseHandler) SetETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// parseIfMatch returns the versions in the comma-separated ETags of an
+// If-Match header. "*" and a missing header impose no condition. If-Match
+// uses strong comparison, so weak ETags and anything that is not one of our
+// ETags are skipped; when none is left the request fails with 412.
+func parseIfMatch(header string) ([]int, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return nil, false
+	}
+
+	versions := []int{}
+	for _, tag := range strings.Split(header, ",") {
+		value, err := strconv.Unquote(strings.TrimSpace(tag))
+		if err != nil {
+			continue
+		}
+		if version, err := strconv.Atoi(value); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions, true
 }
 
 // ResponseJSON sends a JSON response with the given status code and data
@@ -21,12 +61,28 @@ func (b *BaseHandler) ResponseJSON(c *gin.Context, status int, data interface{})
 	c.JSON(status, data)
 }
 
-// ResponseError sends an error response with the given status code and error message
-func (b *BaseHandler) ResponseError(c *gin.Context, status int, err error) {
-	c.JSON(status, gin.H{"error": err.Error()})
+// ResponseError sends the error as problem+json. The status and code come
+// from translateError; unexpected errors are logged with the correlation ID
+// and reported without their message.
+func (b *BaseHandler) ResponseError(c *gin.Context, err error) {
+	problem := translateError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v\n", RequestID(c), c.Request.Method, c.Request.URL.Path, err)
+	}
+	writeProblem(c, problem)
 }
 
 // ResponseUnauthorized sends an unauthorized error response
 func (b *BaseHandler) ResponseUnauthorized(c *gin.Context, message string) {
-	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	writeProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, message))
+}
+
+// CurrentUserID returns the ID of the authenticated user set by AuthMiddleware
+func (b *BaseHandler) CurrentUserID(c *gin.Context) (string, bool) {
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		return "", false
+	}
+	id, ok := userID.(string)
+	return id, ok && id != ""
 }
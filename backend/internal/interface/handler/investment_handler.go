@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/usecase"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,8 +20,15 @@ type InvestmentHandler struct {
 }
 
 type InvestmentUsecase interface {
-	CreateInvestment(ctx context.Context, userID string, amount float64, currency string, investmentType string, strategy string) error
-	GetInvestment(ctx context.Context, id string) (*domain.Investment, error)
+	CreateInvestment(ctx context.Context, userID string, portfolioID string, amount float64, currency string, investmentType string, strategy string) (*domain.Investment, int, error)
+	UpdateInvestmentAmount(ctx context.Context, userID string, id string, amount float64, currency string) (*domain.Investment, int, error)
+	SellInvestment(ctx context.Context, userID string, id string) error
+	RecordDividend(ctx context.Context, userID string, id string, amount float64, currency string) error
+	GetInvestment(ctx context.Context, userID string, id string) (*domain.Investment, int, error)
+	GetInvestmentWithRiskAnalysis(ctx context.Context, userID string, id string) (*usecase.InvestmentWithRisk, error)
+	GetInvestmentRebalancingSuggestions(ctx context.Context, userID string, portfolioID string) ([]service.RebalancingSuggestion, error)
+	ListInvestments(ctx context.Context, userID string, query domain.InvestmentQuery) (*domain.InvestmentPage, error)
+	ListPortfolioInvestments(ctx context.Context, userID string, portfolioID string, query domain.InvestmentQuery) (*domain.InvestmentPage, error)
 }
 
 func NewInvestmentHandler(iu InvestmentUsecase) *InvestmentHandler {
@@ -27,46 +38,305 @@ func NewInvestmentHandler(iu InvestmentUsecase) *InvestmentHandler {
 }
 
 type CreateInvestmentRequest struct {
-	UserID   string  `json:"user_id" binding:"required"`
-	Amount   float64 `json:"amount" binding:"required"`
-	Currency string  `json:"currency" binding:"required"`
-	Type     string  `json:"type" binding:"required"`
-	Strategy string  `json:"strategy" binding:"required"`
+	PortfolioID string  `json:"portfolio_id"` // 省略時はデフォルトのポートフォリオ
+	Amount      float64 `json:"amount" binding:"required"`
+	Currency    string  `json:"currency" binding:"required"`
+	Type        string  `json:"type" binding:"required"`
+	Strategy    string  `json:"strategy" binding:"required"`
 }
 
 func (h *InvestmentHandler) CreateInvestment(c *gin.Context) {
 	ctx, cancel := h.NewContext(c, 10*time.Second)
 	defer cancel()
 
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
 	var req CreateInvestmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.ResponseError(c, http.StatusBadRequest, err)
+		h.ResponseError(c, err)
+		return
+	}
+
+	investment, version, err := h.investmentUsecase.CreateInvestment(ctx, userID, req.PortfolioID, req.Amount, req.Currency, req.Type, req.Strategy)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, version)
+	h.ResponseJSON(c, http.StatusCreated, newInvestmentResponse(investment))
+}
+
+type InvestmentAmountRequest struct {
+	Amount   float64 `json:"amount" binding:"gte=0"`
+	Currency string  `json:"currency" binding:"required"`
+}
+
+// UpdateInvestmentAmount records a new amount for an investment without
+// moving cash.
+func (h *InvestmentHandler) UpdateInvestmentAmount(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req InvestmentAmountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	investment, version, err := h.investmentUsecase.UpdateInvestmentAmount(ctx, userID, c.Param("id"), req.Amount, req.Currency)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, version)
+	h.ResponseJSON(c, http.StatusOK, newInvestmentResponse(investment))
+}
+
+// SellInvestment closes an investment; its amount goes back to the cash
+// balance of the portfolio.
+func (h *InvestmentHandler) SellInvestment(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 10*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	if err := h.investmentUsecase.SellInvestment(ctx, userID, c.Param("id")); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *InvestmentHandler) RecordDividend(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req CashTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	if err := h.investmentUsecase.RecordDividend(ctx, userID, c.Param("id"), req.Amount, req.Currency); err != nil {
+		h.ResponseError(c, err)
 		return
 	}
 
-	if err := h.investmentUsecase.CreateInvestment(ctx, req.UserID, req.Amount, req.Currency, req.Type, req.Strategy); err != nil {
-		h.ResponseError(c, http.StatusInternalServerError, err)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *InvestmentHandler) GetInvestmentWithRiskAnalysis(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	result, err := h.investmentUsecase.GetInvestmentWithRiskAnalysis(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
 		return
 	}
 
-	h.ResponseJSON(c, http.StatusCreated, gin.H{"message": "Investment created successfully"})
+	h.ResponseJSON(c, http.StatusOK, newInvestmentRiskResponse(result))
 }
 
+func (h *InvestmentHandler) GetInvestmentRebalancingSuggestions(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	suggestions, err := h.investmentUsecase.GetInvestmentRebalancingSuggestions(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, RebalancingSuggestionListResponse{Suggestions: newRebalancingSuggestionResponses(suggestions)})
+}
+
+// GetInvestment returns an investment. Its ETag is the version of the
+// portfolio holding it, which If-Match on investment changes is checked
+// against.
 func (h *InvestmentHandler) GetInvestment(c *gin.Context) {
 	ctx, cancel := h.NewContext(c, 5*time.Second)
 	defer cancel()
 
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
-		h.ResponseError(c, http.StatusBadRequest, fmt.Errorf("id is required"))
+		h.ResponseError(c, fmt.Errorf("%w: id is required", domain.ErrInvalidInput))
+		return
+	}
+
+	investment, version, err := h.investmentUsecase.GetInvestment(ctx, userID, id)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, version)
+	h.ResponseJSON(c, http.StatusOK, newInvestmentResponse(investment))
+}
+
+// ListInvestments returns a page of the investments in every portfolio the
+// user can view.
+func (h *InvestmentHandler) ListInvestments(c *gin.Context) {
+	h.listInvestments(c, func(ctx context.Context, userID string, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+		return h.investmentUsecase.ListInvestments(ctx, userID, query)
+	})
+}
+
+// ListPortfolioInvestments returns a page of the investments in one portfolio.
+func (h *InvestmentHandler) ListPortfolioInvestments(c *gin.Context) {
+	h.listInvestments(c, func(ctx context.Context, userID string, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+		return h.investmentUsecase.ListPortfolioInvestments(ctx, userID, c.Param("id"), query)
+	})
+}
+
+func (h *InvestmentHandler) listInvestments(
+	c *gin.Context,
+	list func(ctx context.Context, userID string, query domain.InvestmentQuery) (*domain.InvestmentPage, error),
+) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
 		return
 	}
 
-	investment, err := h.investmentUsecase.GetInvestment(ctx, id)
+	query, err := parseInvestmentQuery(c)
 	if err != nil {
-		h.ResponseError(c, http.StatusInternalServerError, err)
+		h.ResponseError(c, err)
 		return
 	}
 
-	h.ResponseJSON(c, http.StatusOK, investment)
+	page, err := list(ctx, userID, query)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, newInvestmentPageResponse(page))
+}
+
+// parseInvestmentQuery reads the filters, sort order and page position of a
+// list request. Types and strategies may be repeated or comma-separated,
+// dates are RFC 3339 or YYYY-MM-DD (UTC), and a "-" before the sort field
+// sorts in descending order.
+func parseInvestmentQuery(c *gin.Context) (domain.InvestmentQuery, error) {
+	var query domain.InvestmentQuery
+
+	for _, value := range splitQueryValues(c.QueryArray("type")) {
+		query.Types = append(query.Types, domain.InvestmentType(strings.ToUpper(value)))
+	}
+	for _, value := range splitQueryValues(c.QueryArray("strategy")) {
+		query.Strategies = append(query.Strategies, domain.InvestmentStrategy(strings.ToUpper(value)))
+	}
+	query.Currency = strings.ToUpper(c.Query("currency"))
+
+	var err error
+	if query.MinAmount, err = parseFloatQuery(c, "min_amount"); err != nil {
+		return query, err
+	}
+	if query.MaxAmount, err = parseFloatQuery(c, "max_amount"); err != nil {
+		return query, err
+	}
+	if query.CreatedFrom, err = parseTimeQuery(c, "created_from", domain.ErrInvalidInvestmentQuery); err != nil {
+		return query, err
+	}
+	if query.CreatedTo, err = parseTimeQuery(c, "created_to", domain.ErrInvalidInvestmentQuery); err != nil {
+		return query, err
+	}
+
+	if sort := c.Query("sort"); sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.SortBy = domain.InvestmentSortField(strings.TrimPrefix(sort, "-"))
+	}
+	query.Cursor = c.Query("cursor")
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return query, fmt.Errorf("%w: limit must be an integer", domain.ErrInvalidInvestmentQuery)
+		}
+	}
+
+	return query.Normalize()
+}
+
+func splitQueryValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseFloatQuery(c *gin.Context, name string) (*float64, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a number", domain.ErrInvalidInvestmentQuery, name)
+	}
+	return &f, nil
+}
+
+// parseTimeQuery reads an RFC 3339 time or a date, and reports a malformed
+// value as invalid.
+func parseTimeQuery(c *gin.Context, name string, invalid error) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s must be an RFC 3339 time or a date", invalid, name)
 }
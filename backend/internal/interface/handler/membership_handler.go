@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MembershipHandler struct {
+	BaseHandler
+	membershipUsecase MembershipUsecase
+}
+
+type MembershipUsecase interface {
+	InviteMember(ctx context.Context, userID string, portfolioID string, email string, role string) (*domain.PortfolioMembership, error)
+	ListMembers(ctx context.Context, userID string, portfolioID string) ([]*domain.PortfolioMembership, error)
+	RemoveMember(ctx context.Context, userID string, portfolioID string, membershipID string) error
+	ListInvitations(ctx context.Context, userID string) ([]*domain.PortfolioMembership, error)
+	AcceptInvitation(ctx context.Context, userID string, invitationID string) (*domain.PortfolioMembership, error)
+	DeclineInvitation(ctx context.Context, userID string, invitationID string) error
+}
+
+func NewMembershipHandler(mu MembershipUsecase) *MembershipHandler {
+	return &MembershipHandler{
+		membershipUsecase: mu,
+	}
+}
+
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+func (h *MembershipHandler) InviteMember(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	invitation, err := h.membershipUsecase.InviteMember(ctx, userID, c.Param("id"), req.Email, req.Role)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusCreated, newMembershipResponse(invitation))
+}
+
+func (h *MembershipHandler) ListMembers(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	members, err := h.membershipUsecase.ListMembers(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, MemberListResponse{Members: newMembershipResponses(members)})
+}
+
+func (h *MembershipHandler) RemoveMember(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	if err := h.membershipUsecase.RemoveMember(ctx, userID, c.Param("id"), c.Param("membershipId")); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *MembershipHandler) ListInvitations(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	invitations, err := h.membershipUsecase.ListInvitations(ctx, userID)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, InvitationListResponse{Invitations: newMembershipResponses(invitations)})
+}
+
+func (h *MembershipHandler) AcceptInvitation(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	membership, err := h.membershipUsecase.AcceptInvitation(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, newMembershipResponse(membership))
+}
+
+func (h *MembershipHandler) DeclineInvitation(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	if err := h.membershipUsecase.DeclineInvitation(ctx, userID, c.Param("id")); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -1,37 +1,81 @@
 package handler
 
 import (
+	"moneyget/internal/domain/constants"
 	"moneyget/internal/domain/service"
+	"moneyget/internal/utils"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// userIDKey is the gin context key holding the authenticated user's ID
+const userIDKey = "userID"
+
+// requestIDKey is the gin context key holding the correlation ID of the request
+const requestIDKey = "requestID"
+
+// maxRequestIDLength limits request IDs taken over from clients
+const maxRequestIDLength = 128
+
 func AuthMiddleware(jwtService service.JWTService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
+		authHeader := c.GetHeader(constants.AuthorizationHeader)
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
+			writeProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Authorization header is required"))
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			writeProblem(c, newProblem(http.StatusUnauthorized, codeUnauthorized, "Invalid authorization header format"))
 			return
 		}
 
 		userID, err := jwtService.ValidateToken(parts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
+			writeProblem(c, translateError(service.ErrInvalidToken))
 			return
 		}
 
-		c.Set("userID", userID)
+		c.Set(userIDKey, userID)
 		c.Next()
 	}
 }
+
+// RequestIDMiddleware gives every request a correlation ID. An X-Request-ID
+// sent by the client is kept so that a request can be traced across
+// services; otherwise a new one is generated. The ID is echoed in the
+// response header and in error responses.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(constants.RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = utils.GenerateUUID()
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(constants.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// RequestID returns the correlation ID set by RequestIDMiddleware
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// isValidRequestID accepts short IDs of printable ASCII characters, so that
+// client input cannot break log lines or headers.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"moneyget/internal/domain"
+	"moneyget/internal/usecase"
 	"net/http"
 	"time"
 
@@ -16,6 +18,18 @@ type PortfolioHandler struct {
 
 type PortfolioUsecase interface {
 	GetUserPortfolio(ctx context.Context, userID string) (*domain.Portfolio, error)
+	GetPortfolio(ctx context.Context, userID string, id string) (*domain.Portfolio, error)
+	ListUserPortfolios(ctx context.Context, userID string) ([]*domain.Portfolio, error)
+	CreatePortfolio(ctx context.Context, userID string, name string) (*domain.Portfolio, error)
+	RenamePortfolio(ctx context.Context, userID string, portfolioID string, name string) (*domain.Portfolio, error)
+	ArchivePortfolio(ctx context.Context, userID string, portfolioID string) (*domain.Portfolio, error)
+	DeletePortfolio(ctx context.Context, userID string, portfolioID string) error
+	GetPortfolioAnalysis(ctx context.Context, userID string, id string) (*usecase.PortfolioAnalysis, error)
+	ValidatePortfolio(ctx context.Context, userID string, portfolioID string) error
+	RebalancePortfolio(ctx context.Context, userID string, id string, changes map[domain.InvestmentID]domain.Money) (*domain.Portfolio, error)
+	GetHouseholdView(ctx context.Context, userID string) (*usecase.HouseholdView, error)
+	DepositCash(ctx context.Context, userID string, portfolioID string, amount float64, currency string) (domain.Money, error)
+	WithdrawCash(ctx context.Context, userID string, portfolioID string, amount float64, currency string) (domain.Money, error)
 }
 
 func NewPortfolioHandler(pu PortfolioUsecase) *PortfolioHandler {
@@ -28,17 +42,311 @@ func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 	ctx, cancel := h.NewContext(c, 5*time.Second)
 	defer cancel()
 
-	userID, exists := c.Get("userID")
+	userID, exists := h.CurrentUserID(c)
 	if !exists {
 		h.ResponseUnauthorized(c, "user not authenticated")
 		return
 	}
 
-	portfolio, err := h.portfolioUsecase.GetUserPortfolio(ctx, userID.(string))
+	portfolio, err := h.portfolioUsecase.GetUserPortfolio(ctx, userID)
 	if err != nil {
-		h.ResponseError(c, http.StatusInternalServerError, err)
+		h.ResponseError(c, err)
 		return
 	}
 
-	h.ResponseJSON(c, http.StatusOK, portfolio)
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioResponse(portfolio))
+}
+
+func (h *PortfolioHandler) GetPortfolioByID(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	portfolio, err := h.portfolioUsecase.GetPortfolio(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioResponse(portfolio))
+}
+
+func (h *PortfolioHandler) ListPortfolios(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	portfolios, err := h.portfolioUsecase.ListUserPortfolios(ctx, userID)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, PortfolioListResponse{Portfolios: newPortfolioResponses(portfolios)})
+}
+
+type PortfolioNameRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (h *PortfolioHandler) CreatePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req PortfolioNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	portfolio, err := h.portfolioUsecase.CreatePortfolio(ctx, userID, req.Name)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusCreated, newPortfolioResponse(portfolio))
+}
+
+func (h *PortfolioHandler) RenamePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req PortfolioNameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	portfolio, err := h.portfolioUsecase.RenamePortfolio(ctx, userID, c.Param("id"), req.Name)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioResponse(portfolio))
+}
+
+func (h *PortfolioHandler) ArchivePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	portfolio, err := h.portfolioUsecase.ArchivePortfolio(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioResponse(portfolio))
+}
+
+// DeletePortfolio removes an empty portfolio together with its cash ledger
+// and memberships. Investments have to be sold first.
+func (h *PortfolioHandler) DeletePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	if err := h.portfolioUsecase.DeletePortfolio(ctx, userID, c.Param("id")); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *PortfolioHandler) GetPortfolioAnalysis(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 10*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	analysis, err := h.portfolioUsecase.GetPortfolioAnalysis(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, analysis.Portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioAnalysisResponse(analysis))
+}
+
+// ValidatePortfolio reports whether the portfolio satisfies the risk
+// distribution rules. A violated rule is a result, not a failed request.
+func (h *PortfolioHandler) ValidatePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	err := h.portfolioUsecase.ValidatePortfolio(ctx, userID, c.Param("id"))
+	if err == nil {
+		h.ResponseJSON(c, http.StatusOK, ValidationResponse{Valid: true})
+		return
+	}
+
+	problem := translateError(err)
+	if problem.Status != http.StatusUnprocessableEntity {
+		h.ResponseError(c, err)
+		return
+	}
+	h.ResponseJSON(c, http.StatusOK, ValidationResponse{Valid: false, Code: problem.Code, Detail: problem.Detail})
+}
+
+type RebalanceChangeRequest struct {
+	InvestmentID string  `json:"investment_id" binding:"required"`
+	Amount       float64 `json:"amount" binding:"gte=0"`
+	Currency     string  `json:"currency" binding:"required"`
+}
+
+type RebalancePortfolioRequest struct {
+	Changes []RebalanceChangeRequest `json:"changes" binding:"required,min=1,dive"`
+}
+
+// RebalancePortfolio sets new amounts for several investments at once. The
+// changes are applied together or not at all.
+func (h *PortfolioHandler) RebalancePortfolio(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 10*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req RebalancePortfolioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	changes := make(map[domain.InvestmentID]domain.Money, len(req.Changes))
+	for _, change := range req.Changes {
+		id := domain.NewInvestmentID(change.InvestmentID)
+		if _, duplicated := changes[id]; duplicated {
+			h.ResponseError(c, fmt.Errorf("%w: investment %s is changed more than once", domain.ErrInvalidInput, change.InvestmentID))
+			return
+		}
+		changes[id] = domain.Money{Amount: change.Amount, Currency: change.Currency}
+	}
+
+	portfolio, err := h.portfolioUsecase.RebalancePortfolio(ctx, userID, c.Param("id"), changes)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.SetETag(c, portfolio.Version)
+	h.ResponseJSON(c, http.StatusOK, newPortfolioResponse(portfolio))
+}
+
+func (h *PortfolioHandler) GetHouseholdView(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 10*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	view, err := h.portfolioUsecase.GetHouseholdView(ctx, userID)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, newHouseholdViewResponse(view))
+}
+
+type CashTransactionRequest struct {
+	Amount   float64 `json:"amount" binding:"required,gt=0"`
+	Currency string  `json:"currency" binding:"required"`
+}
+
+func (h *PortfolioHandler) DepositCash(c *gin.Context) {
+	h.handleCashTransaction(c, h.portfolioUsecase.DepositCash)
+}
+
+func (h *PortfolioHandler) WithdrawCash(c *gin.Context) {
+	h.handleCashTransaction(c, h.portfolioUsecase.WithdrawCash)
+}
+
+func (h *PortfolioHandler) handleCashTransaction(
+	c *gin.Context,
+	record func(ctx context.Context, userID string, portfolioID string, amount float64, currency string) (domain.Money, error),
+) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req CashTransactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	// /portfolio/cash/* はデフォルトのポートフォリオ、/portfolios/:id/cash/* は指定したポートフォリオ
+	balance, err := record(ctx, userID, c.Param("id"), req.Amount, req.Currency)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, CashBalanceResponse{
+		Currency: balance.Currency,
+		Balance:  balance.Amount,
+	})
 }
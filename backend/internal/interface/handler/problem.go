@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/constants"
+	"moneyget/internal/domain/service"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Problem is an RFC 7807 problem details object. Code is stable and meant
+// for clients; Detail is for humans and may change.
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	Code          string       `json:"code"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+	Errors        []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request. Field is the JSON
+// path of the field, e.g. "changes[0].amount".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// 汎用のエラーコード（ドメインエラーは自身のCodeを使う）
+const (
+	codeValidationFailed   = "VALIDATION_FAILED"
+	codeInvalidRequestBody = "INVALID_REQUEST_BODY"
+	codeInvalidInput       = "INVALID_INPUT"
+	codeUnauthorized       = "UNAUTHORIZED"
+	codeNotFound           = "NOT_FOUND"
+	codeInternalError      = "INTERNAL_ERROR"
+)
+
+// errorMapping maps an error to its HTTP status. Code is only set for
+// sentinel errors that are not DomainErrors. The message of a wrapped
+// sentinel is only shown if showWrapped is set, since repositories may wrap
+// them with internal details.
+type errorMapping struct {
+	err         error
+	status      int
+	code        string
+	showWrapped bool
+}
+
+// errorMappings is checked in order with errors.Is; the first match wins.
+var errorMappings = []errorMapping{
+	// 404
+	{err: domain.ErrPortfolioNotFound, status: http.StatusNotFound, code: "PORTFOLIO_NOT_FOUND"},
+	{err: domain.ErrInvestmentNotFound, status: http.StatusNotFound},
+	{err: domain.ErrInvitationNotFound, status: http.StatusNotFound},
+	{err: domain.ErrUserNotFound, status: http.StatusNotFound},
+	{err: domain.ErrWebhookNotFound, status: http.StatusNotFound},
+	{err: domain.ErrWebhookDeliveryNotFound, status: http.StatusNotFound},
+	{err: domain.ErrNotFound, status: http.StatusNotFound, code: codeNotFound},
+	{err: sql.ErrNoRows, status: http.StatusNotFound, code: codeNotFound},
+
+	// 401, 403
+	{err: domain.ErrInvalidCredentials, status: http.StatusUnauthorized},
+	{err: domain.ErrUnauthorized, status: http.StatusUnauthorized, code: codeUnauthorized},
+	{err: service.ErrInvalidToken, status: http.StatusUnauthorized, code: "INVALID_TOKEN"},
+	{err: domain.ErrForbidden, status: http.StatusForbidden},
+
+	// 400
+	{err: domain.ErrInvalidInput, status: http.StatusBadRequest, code: codeInvalidInput, showWrapped: true},
+	{err: domain.ErrInvalidEmail, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidPassword, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidPortfolioName, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidPortfolioRole, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidCashAmount, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidCashTransaction, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidInvestmentAmount, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidInvestmentType, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidInvestmentStrategy, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidInvestmentQuery, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidCursor, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidWebhookURL, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidWebhookEventType, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidWebhookSecret, status: http.StatusBadRequest},
+	{err: domain.ErrInvalidAuditQuery, status: http.StatusBadRequest},
+
+	// 409, 412
+	{err: domain.ErrConcurrentModification, status: http.StatusConflict},
+	{err: domain.ErrDuplicatePortfolioName, status: http.StatusConflict},
+	{err: domain.ErrDuplicateInvestment, status: http.StatusConflict},
+	{err: domain.ErrPortfolioArchived, status: http.StatusConflict},
+	{err: domain.ErrPortfolioNotEmpty, status: http.StatusConflict},
+	{err: domain.ErrAlreadyMember, status: http.StatusConflict},
+	{err: domain.ErrInvitationNotPending, status: http.StatusConflict},
+	{err: domain.ErrVersionMismatch, status: http.StatusPreconditionFailed},
+
+	// 422: リクエストは正しいが業務ルールに反する
+	{err: domain.ErrInsufficientFunds, status: http.StatusUnprocessableEntity},
+	{err: domain.ErrPortfolioLimitExceeded, status: http.StatusUnprocessableEntity},
+	{err: domain.ErrAggressiveInvestmentLimitExceeded, status: http.StatusUnprocessableEntity},
+}
+
+func init() {
+	// 検証エラーのフィールド名を構造体のフィールド名ではなくJSONの名前で返す
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// translateError builds the problem for an error, without the request
+// specific members. Unknown errors become a 500 that does not reveal the
+// error message.
+func translateError(err error) Problem {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		problem := newProblem(http.StatusBadRequest, codeValidationFailed, "the request has invalid fields")
+		for _, fe := range validationErrors {
+			problem.Errors = append(problem.Errors, newFieldError(fe))
+		}
+		return problem
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		problem := newProblem(http.StatusBadRequest, codeValidationFailed, "the request has invalid fields")
+		problem.Errors = []FieldError{{
+			Field:   typeError.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be a %s", jsonTypeName(typeError.Type)),
+		}}
+		return problem
+	}
+
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return newProblem(http.StatusBadRequest, codeInvalidRequestBody, "the request body is not valid JSON")
+	}
+
+	for _, mapping := range errorMappings {
+		if !errors.Is(err, mapping.err) {
+			continue
+		}
+
+		var domainErr *domain.DomainError
+		if mapping.code == "" && errors.As(mapping.err, &domainErr) {
+			return newProblem(mapping.status, domainErr.Code, domainDetail(err, domainErr))
+		}
+		if mapping.showWrapped {
+			return newProblem(mapping.status, mapping.code, err.Error())
+		}
+		// ラップされた内部の情報（SQLやIDなど）は返さない
+		return newProblem(mapping.status, mapping.code, mapping.err.Error())
+	}
+
+	// 未知のDomainErrorは業務ルール違反として扱う
+	var domainErr *domain.DomainError
+	if errors.As(err, &domainErr) {
+		return newProblem(http.StatusUnprocessableEntity, domainErr.Code, domainDetail(err, domainErr))
+	}
+
+	return newProblem(http.StatusInternalServerError, codeInternalError, "an unexpected error occurred")
+}
+
+func newProblem(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// domainDetail returns the message of a domain error, followed by the
+// context added by wrapping it as fmt.Errorf("%w: ...", err).
+func domainDetail(err error, domainErr *domain.DomainError) string {
+	if extra := strings.TrimPrefix(err.Error(), domainErr.Error()+": "); extra != err.Error() {
+		return domainErr.Message + ": " + extra
+	}
+	return domainErr.Message
+}
+
+func newFieldError(fe validator.FieldError) FieldError {
+	// 先頭の構造体名を除いたパス（例: changes[0].amount）。無名の構造体には
+	// 型名が付かないので、JSON名とGoの名前で先頭が一致する場合だけ除く
+	field := fe.Namespace()
+	top := strings.SplitN(field, ".", 2)
+	if len(top) == 2 && strings.HasPrefix(fe.StructNamespace(), top[0]+".") {
+		field = top[1]
+	}
+
+	var message string
+	switch fe.Tag() {
+	case "required":
+		message = "is required"
+	case "email":
+		message = "must be a valid email address"
+	case "gt":
+		message = "must be greater than " + fe.Param()
+	case "gte":
+		message = "must be greater than or equal to " + fe.Param()
+	case "lt":
+		message = "must be less than " + fe.Param()
+	case "lte":
+		message = "must be less than or equal to " + fe.Param()
+	case "min":
+		message = "must have at least " + fe.Param() + " characters or items"
+	case "max":
+		message = "must have at most " + fe.Param() + " characters or items"
+	default:
+		message = "failed the " + fe.Tag() + " rule"
+	}
+
+	return FieldError{Field: field, Code: fe.Tag(), Message: message}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// writeProblem completes the problem with the request and sends it.
+func writeProblem(c *gin.Context, problem Problem) {
+	problem.Instance = c.Request.URL.Path
+	problem.CorrelationID = RequestID(c)
+
+	c.Header("Content-Type", constants.ContentTypeProblemJSON)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// NoRoute answers requests for unknown paths with a problem.
+func NoRoute(c *gin.Context) {
+	writeProblem(c, newProblem(http.StatusNotFound, codeNotFound, "no route matches "+c.Request.URL.Path))
+}
+
+// Recovery reports a panic in a handler as an internal error.
+func Recovery(c *gin.Context, recovered interface{}) {
+	log.Printf("[%s] panic: %v\n", RequestID(c), recovered)
+	writeProblem(c, newProblem(http.StatusInternalServerError, codeInternalError, "an unexpected error occurred"))
+}
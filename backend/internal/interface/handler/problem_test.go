@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"moneyget/internal/domain"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		status       int
+		code         string
+		detail       string
+		hiddenDetail string
+	}{
+		{"domain error", domain.ErrPortfolioLimitExceeded, http.StatusUnprocessableEntity, "PORTFOLIO_LIMIT_EXCEEDED", domain.ErrPortfolioLimitExceeded.Message, ""},
+		{"wrapped domain error", fmt.Errorf("%w: limit must be an integer", domain.ErrInvalidInvestmentQuery), http.StatusBadRequest, "INVALID_INVESTMENT_QUERY", "investment query is invalid: limit must be an integer", ""},
+		{"forbidden", domain.ErrForbidden, http.StatusForbidden, "FORBIDDEN", domain.ErrForbidden.Message, ""},
+		{"version mismatch", domain.ErrVersionMismatch, http.StatusPreconditionFailed, "VERSION_MISMATCH", domain.ErrVersionMismatch.Message, ""},
+		{"sentinel", domain.ErrPortfolioNotFound, http.StatusNotFound, "PORTFOLIO_NOT_FOUND", "portfolio not found", ""},
+		{"no rows", fmt.Errorf("select portfolios: %w", sql.ErrNoRows), http.StatusNotFound, "NOT_FOUND", sql.ErrNoRows.Error(), "select portfolios"},
+		{"memory not found", fmt.Errorf("%w: investment inv-1", domain.ErrNotFound), http.StatusNotFound, "NOT_FOUND", "resource not found", "inv-1"},
+		{"invalid input", fmt.Errorf("%w: id is required", domain.ErrInvalidInput), http.StatusBadRequest, "INVALID_INPUT", "invalid input: id is required", ""},
+		{"unknown domain error", &domain.DomainError{Code: "NEW_RULE", Message: "a new rule"}, http.StatusUnprocessableEntity, "NEW_RULE", "a new rule", ""},
+		{"unknown error", errors.New("pq: relation does not exist"), http.StatusInternalServerError, "INTERNAL_ERROR", "an unexpected error occurred", "relation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := translateError(tt.err)
+			if problem.Status != tt.status || problem.Code != tt.code || problem.Detail != tt.detail {
+				t.Errorf("Expected %d %s %q, got %d %s %q", tt.status, tt.code, tt.detail, problem.Status, problem.Code, problem.Detail)
+			}
+			if problem.Title != http.StatusText(tt.status) || problem.Type != "about:blank" {
+				t.Errorf("Unexpected type %q and title %q", problem.Type, problem.Title)
+			}
+			if tt.hiddenDetail != "" && strings.Contains(problem.Detail, tt.hiddenDetail) {
+				t.Errorf("Detail leaks %q: %q", tt.hiddenDetail, problem.Detail)
+			}
+		})
+	}
+}
+
+func TestTranslateError_BindingErrors(t *testing.T) {
+	type change struct {
+		Amount float64 `json:"amount" binding:"gte=0"`
+	}
+	var req struct {
+		Name    string   `json:"name" binding:"required"`
+		Email   string   `json:"email" binding:"required,email"`
+		Changes []change `json:"changes" binding:"dive"`
+	}
+
+	err := binding.JSON.BindBody([]byte(`{"email":"x","changes":[{"amount":1},{"amount":-1}]}`), &req)
+	problem := translateError(err)
+	if problem.Status != http.StatusBadRequest || problem.Code != "VALIDATION_FAILED" {
+		t.Fatalf("Expected a validation problem, got %+v", problem)
+	}
+
+	expected := []FieldError{
+		{Field: "name", Code: "required", Message: "is required"},
+		{Field: "email", Code: "email", Message: "must be a valid email address"},
+		{Field: "changes[1].amount", Code: "gte", Message: "must be greater than or equal to 0"},
+	}
+	if len(problem.Errors) != len(expected) {
+		t.Fatalf("Expected %d field errors, got %+v", len(expected), problem.Errors)
+	}
+	for i, fieldError := range expected {
+		if problem.Errors[i] != fieldError {
+			t.Errorf("Expected %+v, got %+v", fieldError, problem.Errors[i])
+		}
+	}
+
+	err = binding.JSON.BindBody([]byte(`{"name":1}`), &req)
+	if problem := translateError(err); problem.Code != "VALIDATION_FAILED" || len(problem.Errors) != 1 || problem.Errors[0].Field != "name" {
+		t.Errorf("Expected a type error on name, got %+v", problem)
+	}
+
+	err = binding.JSON.BindBody([]byte(`{"name":`), &req)
+	if problem := translateError(err); problem.Code != "INVALID_REQUEST_BODY" {
+		t.Errorf("Expected INVALID_REQUEST_BODY for broken JSON, got %+v", problem)
+	}
+}
@@ -0,0 +1,541 @@
+package handler
+
+import (
+	"encoding/json"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/usecase"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// レスポンスは非公開フィールドを持つドメインの構造体を直接シリアライズせず、
+// ここで定義するDTOに変換して返す
+
+type MoneyResponse struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func newMoneyResponse(money domain.Money) MoneyResponse {
+	return MoneyResponse{Amount: money.Amount, Currency: money.Currency}
+}
+
+func newMoneyResponses(amounts []domain.Money) []MoneyResponse {
+	responses := make([]MoneyResponse, 0, len(amounts))
+	for _, money := range amounts {
+		responses = append(responses, newMoneyResponse(money))
+	}
+	return responses
+}
+
+type UserResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginResponse struct {
+	Token string       `json:"token"`
+	User  UserResponse `json:"user"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+func newUserResponse(user *domain.User) UserResponse {
+	return UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+type InvestmentResponse struct {
+	ID        string    `json:"id"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	Type      string    `json:"type"`
+	Strategy  string    `json:"strategy"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newInvestmentResponse(investment *domain.Investment) InvestmentResponse {
+	amount := investment.Amount()
+	return InvestmentResponse{
+		ID:        investment.ID().Value,
+		Amount:    amount.Amount,
+		Currency:  amount.Currency,
+		Type:      string(investment.Type()),
+		Strategy:  string(investment.Strategy()),
+		Version:   investment.Version,
+		CreatedAt: investment.CreatedAt,
+		UpdatedAt: investment.UpdatedAt,
+	}
+}
+
+// InvestmentPageResponse is one page of a list. NextCursor is null on the
+// last page.
+type InvestmentPageResponse struct {
+	Investments []InvestmentResponse `json:"investments"`
+	NextCursor  *string              `json:"next_cursor"`
+}
+
+func newInvestmentPageResponse(page *domain.InvestmentPage) InvestmentPageResponse {
+	response := InvestmentPageResponse{Investments: make([]InvestmentResponse, 0, len(page.Investments))}
+	for _, investment := range page.Investments {
+		response.Investments = append(response.Investments, newInvestmentResponse(investment))
+	}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response
+}
+
+type RebalancingSuggestionListResponse struct {
+	Suggestions []RebalancingSuggestionResponse `json:"suggestions"`
+}
+
+type InvestmentRiskResponse struct {
+	Investment InvestmentResponse `json:"investment"`
+	RiskScore  float64            `json:"risk_score"`
+}
+
+func newInvestmentRiskResponse(result *usecase.InvestmentWithRisk) InvestmentRiskResponse {
+	return InvestmentRiskResponse{
+		Investment: newInvestmentResponse(result.Investment),
+		RiskScore:  result.RiskScore,
+	}
+}
+
+type CashTransactionResponse struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	Amount       float64   `json:"amount"`
+	Currency     string    `json:"currency"`
+	InvestmentID *string   `json:"investment_id"` // 投資に紐づかない入出金ではnull
+	OccurredAt   time.Time `json:"occurred_at"`
+}
+
+func newCashTransactionResponse(tx *domain.CashTransaction) CashTransactionResponse {
+	response := CashTransactionResponse{
+		ID:         tx.ID,
+		Type:       string(tx.Type),
+		Amount:     tx.Amount.Amount,
+		Currency:   tx.Amount.Currency,
+		OccurredAt: tx.OccurredAt,
+	}
+	if tx.InvestmentID.Value != "" {
+		investmentID := tx.InvestmentID.Value
+		response.InvestmentID = &investmentID
+	}
+	return response
+}
+
+type PortfolioResponse struct {
+	ID               string                    `json:"id"`
+	UserID           string                    `json:"user_id"`
+	Name             string                    `json:"name"`
+	Investments      []InvestmentResponse      `json:"investments"`
+	CashBalances     []MoneyResponse           `json:"cash_balances"`
+	CashTransactions []CashTransactionResponse `json:"cash_transactions"`
+	InvestedAmount   MoneyResponse             `json:"invested_amount"`
+	TotalAmount      MoneyResponse             `json:"total_amount"`
+	ArchivedAt       *time.Time                `json:"archived_at"`
+	Version          int                       `json:"version"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	UpdatedAt        time.Time                 `json:"updated_at"`
+}
+
+func newPortfolioResponse(portfolio *domain.Portfolio) PortfolioResponse {
+	// 投資はマップで保持されているので作成日時順（同時刻はID順）に並べる
+	investments := portfolio.GetInvestments()
+	sort.Slice(investments, func(i, j int) bool {
+		if !investments[i].CreatedAt.Equal(investments[j].CreatedAt) {
+			return investments[i].CreatedAt.Before(investments[j].CreatedAt)
+		}
+		return investments[i].ID().Value < investments[j].ID().Value
+	})
+
+	response := PortfolioResponse{
+		ID:               portfolio.ID().Value,
+		UserID:           portfolio.UserID,
+		Name:             portfolio.Name,
+		Investments:      make([]InvestmentResponse, 0, len(investments)),
+		CashBalances:     newMoneyResponses(portfolio.CashBalances()),
+		CashTransactions: make([]CashTransactionResponse, 0, len(portfolio.CashTransactions)),
+		InvestedAmount:   newMoneyResponse(portfolio.CalculateInvestedAmount()),
+		TotalAmount:      newMoneyResponse(portfolio.CalculateTotalAmount()),
+		ArchivedAt:       portfolio.ArchivedAt,
+		Version:          portfolio.Version,
+		CreatedAt:        portfolio.CreatedAt,
+		UpdatedAt:        portfolio.UpdatedAt,
+	}
+	for _, investment := range investments {
+		response.Investments = append(response.Investments, newInvestmentResponse(investment))
+	}
+	for _, tx := range portfolio.CashTransactions {
+		response.CashTransactions = append(response.CashTransactions, newCashTransactionResponse(tx))
+	}
+	return response
+}
+
+type PortfolioListResponse struct {
+	Portfolios []PortfolioResponse `json:"portfolios"`
+}
+
+// CashBalanceResponse is the balance of one currency after a cash transaction.
+type CashBalanceResponse struct {
+	Currency string  `json:"currency"`
+	Balance  float64 `json:"balance"`
+}
+
+// ValidationResponse tells whether a portfolio follows the risk rules. Code
+// and Detail describe the violated rule like a problem would.
+type ValidationResponse struct {
+	Valid  bool   `json:"valid"`
+	Code   string `json:"code,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func newPortfolioResponses(portfolios []*domain.Portfolio) []PortfolioResponse {
+	responses := make([]PortfolioResponse, 0, len(portfolios))
+	for _, portfolio := range portfolios {
+		responses = append(responses, newPortfolioResponse(portfolio))
+	}
+	return responses
+}
+
+type RebalancingSuggestionResponse struct {
+	Action   string `json:"action"`
+	Strategy string `json:"strategy"`
+	Reason   string `json:"reason"`
+}
+
+func newRebalancingSuggestionResponses(suggestions []service.RebalancingSuggestion) []RebalancingSuggestionResponse {
+	responses := make([]RebalancingSuggestionResponse, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		responses = append(responses, RebalancingSuggestionResponse{
+			Action:   suggestion.Action,
+			Strategy: string(suggestion.Strategy),
+			Reason:   suggestion.Reason,
+		})
+	}
+	return responses
+}
+
+type PortfolioAnalysisResponse struct {
+	Portfolio          PortfolioResponse               `json:"portfolio"`
+	TotalAmount        MoneyResponse                   `json:"total_amount"`
+	RiskScore          float64                         `json:"risk_score"`
+	StrategyAllocation map[string]float64              `json:"strategy_allocation"`
+	Suggestions        []RebalancingSuggestionResponse `json:"suggestions"`
+}
+
+func newPortfolioAnalysisResponse(analysis *usecase.PortfolioAnalysis) PortfolioAnalysisResponse {
+	return PortfolioAnalysisResponse{
+		Portfolio:          newPortfolioResponse(analysis.Portfolio),
+		TotalAmount:        newMoneyResponse(analysis.TotalAmount),
+		RiskScore:          analysis.RiskScore,
+		StrategyAllocation: newStrategyAllocationResponse(analysis.StrategyAllocation),
+		Suggestions:        newRebalancingSuggestionResponses(analysis.Suggestions),
+	}
+}
+
+func newStrategyAllocationResponse(allocation map[domain.InvestmentStrategy]float64) map[string]float64 {
+	response := make(map[string]float64, len(allocation))
+	for strategy, ratio := range allocation {
+		response[string(strategy)] = ratio
+	}
+	return response
+}
+
+type PortfolioSummaryResponse struct {
+	ID             string          `json:"id"`
+	Name           string          `json:"name"`
+	InvestedAmount MoneyResponse   `json:"invested_amount"`
+	CashBalances   []MoneyResponse `json:"cash_balances"`
+	TotalAmount    MoneyResponse   `json:"total_amount"`
+	RiskScore      float64         `json:"risk_score"`
+}
+
+type HouseholdViewResponse struct {
+	Portfolios         []PortfolioSummaryResponse `json:"portfolios"`
+	TotalAmounts       []MoneyResponse            `json:"total_amounts"`
+	CashBalances       []MoneyResponse            `json:"cash_balances"`
+	InvestedAmount     float64                    `json:"invested_amount"`
+	RiskScore          float64                    `json:"risk_score"`
+	StrategyAllocation map[string]float64         `json:"strategy_allocation"`
+}
+
+func newHouseholdViewResponse(view *usecase.HouseholdView) HouseholdViewResponse {
+	response := HouseholdViewResponse{
+		Portfolios:         make([]PortfolioSummaryResponse, 0, len(view.Portfolios)),
+		TotalAmounts:       newMoneyResponses(view.TotalAmounts),
+		CashBalances:       newMoneyResponses(view.CashBalances),
+		InvestedAmount:     view.InvestedAmount,
+		RiskScore:          view.RiskScore,
+		StrategyAllocation: newStrategyAllocationResponse(view.StrategyAllocation),
+	}
+	for _, summary := range view.Portfolios {
+		response.Portfolios = append(response.Portfolios, PortfolioSummaryResponse{
+			ID:             summary.ID,
+			Name:           summary.Name,
+			InvestedAmount: newMoneyResponse(summary.InvestedAmount),
+			CashBalances:   newMoneyResponses(summary.CashBalances),
+			TotalAmount:    newMoneyResponse(summary.TotalAmount),
+			RiskScore:      summary.RiskScore,
+		})
+	}
+	return response
+}
+
+type MembershipResponse struct {
+	ID           string     `json:"id"`
+	PortfolioID  string     `json:"portfolio_id"`
+	InviteeEmail string     `json:"invitee_email"`
+	UserID       *string    `json:"user_id"` // 承認されるまではnull
+	Role         string     `json:"role"`
+	Status       string     `json:"status"`
+	InvitedBy    string     `json:"invited_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	AcceptedAt   *time.Time `json:"accepted_at"`
+}
+
+func newMembershipResponse(membership *domain.PortfolioMembership) MembershipResponse {
+	response := MembershipResponse{
+		ID:           membership.ID,
+		PortfolioID:  membership.PortfolioID.Value,
+		InviteeEmail: membership.InviteeEmail,
+		Role:         string(membership.Role),
+		Status:       string(membership.Status),
+		InvitedBy:    membership.InvitedBy,
+		CreatedAt:    membership.CreatedAt,
+		AcceptedAt:   membership.AcceptedAt,
+	}
+	if membership.UserID != "" {
+		userID := membership.UserID
+		response.UserID = &userID
+	}
+	return response
+}
+
+type MemberListResponse struct {
+	Members []MembershipResponse `json:"members"`
+}
+
+type InvitationListResponse struct {
+	Invitations []MembershipResponse `json:"invitations"`
+}
+
+func newMembershipResponses(memberships []*domain.PortfolioMembership) []MembershipResponse {
+	responses := make([]MembershipResponse, 0, len(memberships))
+	for _, membership := range memberships {
+		responses = append(responses, newMembershipResponse(membership))
+	}
+	return responses
+}
+
+type WebhookResponse struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"` // 作成時のみ
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(webhook *domain.WebhookSubscription) WebhookResponse {
+	return WebhookResponse{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		EventTypes: append([]string{}, webhook.EventTypes...),
+		CreatedAt:  webhook.CreatedAt,
+	}
+}
+
+type WebhookListResponse struct {
+	Webhooks []WebhookResponse `json:"webhooks"`
+}
+
+func newWebhookResponses(webhooks []*domain.WebhookSubscription) []WebhookResponse {
+	responses := make([]WebhookResponse, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		responses = append(responses, newWebhookResponse(webhook))
+	}
+	return responses
+}
+
+type WebhookDeliveryResponse struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhook_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"` // 配信待ちの間だけ
+	ResponseStatus *int       `json:"response_status"` // 応答がなければnull
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func newWebhookDeliveryResponse(delivery *domain.WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:          delivery.ID,
+		WebhookID:   delivery.SubscriptionID,
+		EventType:   delivery.EventType,
+		Status:      string(delivery.Status),
+		Attempts:    delivery.Attempts,
+		LastError:   delivery.LastError,
+		CreatedAt:   delivery.CreatedAt,
+		UpdatedAt:   delivery.UpdatedAt,
+		DeliveredAt: delivery.DeliveredAt,
+	}
+	if delivery.Status == domain.WebhookDeliveryPending {
+		next := delivery.NextAttemptAt
+		response.NextAttemptAt = &next
+	}
+	if delivery.ResponseStatus != 0 {
+		status := delivery.ResponseStatus
+		response.ResponseStatus = &status
+	}
+	return response
+}
+
+type WebhookDeliveryListResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+}
+
+func newWebhookDeliveryResponses(deliveries []*domain.WebhookDelivery) []WebhookDeliveryResponse {
+	responses := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		responses = append(responses, newWebhookDeliveryResponse(delivery))
+	}
+	return responses
+}
+
+// StreamEventResponse is the data of a portfolio-changed or valuation-changed
+// message. The message ID is the sequence, for Last-Event-ID.
+type StreamEventResponse struct {
+	PortfolioID string          `json:"portfolio_id"`
+	Sequence    int             `json:"sequence"`
+	EventType   string          `json:"event_type"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func newStreamEventResponse(event *service.StoredEvent) StreamEventResponse {
+	return StreamEventResponse{
+		PortfolioID: event.AggregateID,
+		Sequence:    event.Sequence,
+		EventType:   event.EventType,
+		OccurredAt:  event.OccurredAt,
+		Data:        event.EventData,
+	}
+}
+
+// StreamAlertResponse is the data of an alert message.
+type StreamAlertResponse struct {
+	PortfolioID string `json:"portfolio_id"`
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+}
+
+// AuditActorResponse is the user who caused an event.
+type AuditActorResponse struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// AuditEntryResponse is a stored event with the user and request that caused
+// it. Actor is null for changes made outside of a request.
+type AuditEntryResponse struct {
+	ID            int64               `json:"id"`
+	AggregateType string              `json:"aggregate_type"`
+	AggregateID   string              `json:"aggregate_id"`
+	Sequence      int                 `json:"sequence"`
+	EventType     string              `json:"event_type"`
+	SchemaVersion int                 `json:"schema_version"`
+	OccurredAt    time.Time           `json:"occurred_at"`
+	ActorID       string              `json:"actor_id,omitempty"` // 削除されたユーザーでも残る
+	Actor         *AuditActorResponse `json:"actor"`
+	RequestID     string              `json:"request_id,omitempty"`
+	Data          json.RawMessage     `json:"data"`
+}
+
+func newAuditEntryResponse(entry usecase.AuditEntry) AuditEntryResponse {
+	response := AuditEntryResponse{
+		ID:            entry.Event.ID,
+		AggregateType: entry.Event.AggregateType,
+		AggregateID:   entry.Event.AggregateID,
+		Sequence:      entry.Event.Sequence,
+		EventType:     entry.Event.EventType,
+		SchemaVersion: entry.Event.SchemaVersion,
+		OccurredAt:    entry.Event.OccurredAt,
+		ActorID:       entry.Event.ActorID,
+		RequestID:     entry.Event.RequestID,
+		Data:          entry.Event.EventData,
+	}
+	if entry.Actor != nil {
+		response.Actor = &AuditActorResponse{ID: entry.Actor.ID, Name: entry.Actor.Name, Email: entry.Actor.Email}
+	}
+	return response
+}
+
+// csvRecord follows auditCSVHeader.
+func (r AuditEntryResponse) csvRecord() []string {
+	var name, email string
+	if r.Actor != nil {
+		name, email = r.Actor.Name, r.Actor.Email
+	}
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.OccurredAt.UTC().Format(time.RFC3339Nano),
+		csvText(r.AggregateType),
+		csvText(r.AggregateID),
+		strconv.Itoa(r.Sequence),
+		csvText(r.EventType),
+		strconv.Itoa(r.SchemaVersion),
+		csvText(r.ActorID),
+		csvText(name),
+		csvText(email),
+		csvText(r.RequestID),
+		csvText(string(r.Data)),
+	}
+}
+
+// csvText keeps a spreadsheet from evaluating a cell as a formula, since
+// names and other cells can be chosen by any user.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// AuditPageResponse is one page of the audit log. NextCursor is null on the
+// last page.
+type AuditPageResponse struct {
+	Entries    []AuditEntryResponse `json:"entries"`
+	NextCursor *string              `json:"next_cursor"`
+}
+
+func newAuditPageResponse(page *usecase.AuditPage) AuditPageResponse {
+	entries := make([]AuditEntryResponse, 0, len(page.Entries))
+	for _, entry := range page.Entries {
+		entries = append(entries, newAuditEntryResponse(entry))
+	}
+	response := AuditPageResponse{Entries: entries}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"moneyget/internal/domain"
+	"moneyget/internal/usecase"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// プロキシに接続を切られないよう、これだけ何も送らなければコメントを送る
+const streamHeartbeat = 15 * time.Second
+
+type StreamHandler struct {
+	BaseHandler
+	streamUsecase StreamUsecase
+	heartbeat     time.Duration
+}
+
+type StreamUsecase interface {
+	OpenStream(ctx context.Context, userID string, portfolioID string, afterSequence int) (*usecase.PortfolioStream, error)
+}
+
+func NewStreamHandler(su StreamUsecase) *StreamHandler {
+	return &StreamHandler{
+		streamUsecase: su,
+		heartbeat:     streamHeartbeat,
+	}
+}
+
+// StreamPortfolio pushes the changes of a portfolio as server-sent events
+// until the client goes away. With Last-Event-ID the events the client
+// missed are sent first.
+func (h *StreamHandler) StreamPortfolio(c *gin.Context) {
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	afterSequence := usecase.StreamFromLatest
+	if header := strings.TrimSpace(c.GetHeader("Last-Event-ID")); header != "" {
+		sequence, err := strconv.Atoi(header)
+		if err != nil || sequence < 0 {
+			h.ResponseError(c, fmt.Errorf("%w: Last-Event-ID must be an event ID of the stream", domain.ErrInvalidInput))
+			return
+		}
+		afterSequence = sequence
+	}
+
+	// 接続は長く続くので、タイムアウトは開くまでにだけ掛ける
+	ctx := c.Request.Context()
+	openCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	stream, err := h.streamUsecase.OpenStream(openCtx, userID, c.Param("id"), afterSequence)
+	cancel()
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // nginxにバッファさせない
+	c.Status(200)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	// 変更がなくてもハートビートのたびにNextでアクセスを確かめ直し、
+	// 共有を外されたらストリームを終える
+	idle := false
+	for {
+		messages, err := stream.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[%s] Portfolio stream failed: %v\n", RequestID(c), err)
+			}
+			return
+		}
+		for _, message := range messages {
+			if err := sse.Encode(c.Writer, newStreamEvent(c.Param("id"), message)); err != nil {
+				return
+			}
+		}
+		if len(messages) > 0 {
+			c.Writer.Flush()
+			heartbeat.Reset(h.heartbeat)
+		}
+		if stream.Ended() {
+			return
+		}
+		if idle && len(messages) == 0 {
+			if _, err := io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		idle = false
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stream.Done():
+			return
+		case <-stream.Changed():
+		case <-heartbeat.C:
+			idle = true
+		}
+	}
+}
+
+func newStreamEvent(portfolioID string, message usecase.StreamMessage) sse.Event {
+	if message.Kind == usecase.StreamAlert {
+		return sse.Event{
+			Event: message.Kind,
+			Data: StreamAlertResponse{
+				PortfolioID: portfolioID,
+				Code:        message.Alert.Code,
+				Message:     message.Alert.Message,
+			},
+		}
+	}
+
+	return sse.Event{
+		Id:    strconv.Itoa(message.Event.Sequence),
+		Event: message.Kind,
+		Data:  newStreamEventResponse(message.Event),
+	}
+}
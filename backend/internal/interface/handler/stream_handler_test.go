@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
+	"moneyget/internal/usecase"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamHandler_EndsWhenAccessIsRevokedWithoutChanges(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "alice")
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	membership, err := domain.NewPortfolioInvitation("membership-1", portfolio.ID(), "bob@example.com", domain.RoleViewer, "alice")
+	if err != nil {
+		t.Fatalf("NewPortfolioInvitation failed: %v", err)
+	}
+	if err := membership.Accept("bob", "bob@example.com"); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if err := membershipRepo.Save(ctx, membership); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	streams := usecase.NewPortfolioStreamUseCase(portfolioRepo, membershipRepo, memory.NewEventStoreDB(db), service.NewStreamHub())
+	h := NewStreamHandler(streams)
+	h.heartbeat = 10 * time.Millisecond
+
+	reqCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/portfolios/portfolio-1/stream", nil).WithContext(reqCtx)
+	c.Params = gin.Params{{Key: "id", Value: "portfolio-1"}}
+	c.Set(userIDKey, "bob")
+
+	// 共有を外してもポートフォリオのイベントは起きない
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := membershipRepo.Delete(ctx, membership.ID); err != nil {
+			t.Errorf("Delete failed: %v", err)
+		}
+	}()
+
+	h.StreamPortfolio(c)
+	if reqCtx.Err() != nil {
+		t.Fatalf("Expected the stream to end after the membership was removed, got %q", rec.Body.String())
+	}
+}
@@ -1,12 +1,11 @@
 package handler
 
 import (
+	"fmt"
+	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
 	"moneyget/internal/usecase"
 	"net/http"
-	"strconv"
-
-	"moneyget/internal/domain/constants"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,74 +24,76 @@ func NewUserHandler(u usecase.UserUsecase, j service.JWTService) *UserHandler {
 	}
 }
 
-func (h *UserHandler) Register(c *gin.Context) {
-	var input struct {
-		Name     string `json:"name" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
-	}
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=6"`
+}
 
+func (h *UserHandler) Register(c *gin.Context) {
+	var input RegisterRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.base.ResponseError(c, http.StatusBadRequest, err)
+		h.base.ResponseError(c, err)
 		return
 	}
 
 	if err := h.userUsecase.Register(input.Name, input.Email, input.Password); err != nil {
-		h.base.ResponseError(c, http.StatusInternalServerError, err)
+		h.base.ResponseError(c, err)
 		return
 	}
 
-	h.base.ResponseJSON(c, http.StatusCreated, gin.H{"message": "User registered successfully"})
+	h.base.ResponseJSON(c, http.StatusCreated, MessageResponse{Message: "User registered successfully"})
 }
 
-func (h *UserHandler) Login(c *gin.Context) {
-	var input struct {
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required"`
-	}
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
 
+func (h *UserHandler) Login(c *gin.Context) {
+	var input LoginRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.base.ResponseError(c, http.StatusBadRequest, err)
+		h.base.ResponseError(c, err)
 		return
 	}
 
 	user, err := h.userUsecase.Login(input.Email, input.Password)
 	if err != nil {
-		h.base.ResponseUnauthorized(c, constants.InvalidCredentials)
-		return
-	}
-
-	// Convert user.ID (string) to uint
-	userID, err := strconv.ParseUint(user.ID, 10, 64)
-	if err != nil {
-		h.base.ResponseError(c, http.StatusInternalServerError, err)
+		// ユーザーが存在しない場合もパスワード違いと区別しない
+		h.base.ResponseError(c, domain.ErrInvalidCredentials)
 		return
 	}
 
-	token, err := h.jwtService.GenerateToken(uint(userID))
+	token, err := h.jwtService.GenerateToken(user.ID)
 	if err != nil {
-		h.base.ResponseError(c, http.StatusInternalServerError, err)
+		h.base.ResponseError(c, err)
 		return
 	}
 
-	h.base.ResponseJSON(c, http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+	h.base.ResponseJSON(c, http.StatusOK, LoginResponse{
+		Token: token,
+		User:  newUserResponse(user),
 	})
 }
 
 func (h *UserHandler) GetUser(c *gin.Context) {
+	userID, exists := h.base.CurrentUserID(c)
+	if !exists {
+		h.base.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
 	id := c.Param("id")
 	if id == "" {
-		h.base.ResponseError(c, http.StatusBadRequest, nil)
+		h.base.ResponseError(c, fmt.Errorf("%w: id is required", domain.ErrInvalidInput))
 		return
 	}
 
-	user, err := h.userUsecase.GetUserByID(id)
+	user, err := h.userUsecase.GetUserByID(userID, id)
 	if err != nil {
-		h.base.ResponseError(c, http.StatusNotFound, err)
+		h.base.ResponseError(c, err)
 		return
 	}
 
-	h.base.ResponseJSON(c, http.StatusOK, user)
+	h.base.ResponseJSON(c, http.StatusOK, newUserResponse(user))
 }
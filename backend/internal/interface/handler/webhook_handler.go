@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	BaseHandler
+	webhookUsecase WebhookUsecase
+}
+
+type WebhookUsecase interface {
+	CreateWebhook(ctx context.Context, userID string, url string, eventTypes []string, secret string) (*domain.WebhookSubscription, error)
+	ListWebhooks(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error)
+	DeleteWebhook(ctx context.Context, userID string, webhookID string) error
+	ListDeliveries(ctx context.Context, userID string, webhookID string) ([]*domain.WebhookDelivery, error)
+	Redeliver(ctx context.Context, userID string, webhookID string, deliveryID string) (*domain.WebhookDelivery, error)
+}
+
+func NewWebhookHandler(wu WebhookUsecase) *WebhookHandler {
+	return &WebhookHandler{
+		webhookUsecase: wu,
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16"` // 省略すると生成する
+}
+
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	webhook, err := h.webhookUsecase.CreateWebhook(ctx, userID, req.URL, req.EventTypes, req.Secret)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	// 秘密鍵は作成時にだけ返す
+	response := newWebhookResponse(webhook)
+	response.Secret = webhook.Secret
+	h.ResponseJSON(c, http.StatusCreated, response)
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	webhooks, err := h.webhookUsecase.ListWebhooks(ctx, userID)
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, WebhookListResponse{Webhooks: newWebhookResponses(webhooks)})
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	if err := h.webhookUsecase.DeleteWebhook(ctx, userID, c.Param("id")); err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	deliveries, err := h.webhookUsecase.ListDeliveries(ctx, userID, c.Param("id"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	h.ResponseJSON(c, http.StatusOK, WebhookDeliveryListResponse{Deliveries: newWebhookDeliveryResponses(deliveries)})
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	ctx, cancel := h.NewContext(c, 5*time.Second)
+	defer cancel()
+
+	userID, exists := h.CurrentUserID(c)
+	if !exists {
+		h.ResponseUnauthorized(c, "user not authenticated")
+		return
+	}
+
+	delivery, err := h.webhookUsecase.Redeliver(ctx, userID, c.Param("id"), c.Param("deliveryId"))
+	if err != nil {
+		h.ResponseError(c, err)
+		return
+	}
+
+	// 配信はバックグラウンドで行う
+	h.ResponseJSON(c, http.StatusAccepted, newWebhookDeliveryResponse(delivery))
+}
@@ -0,0 +1,203 @@
+package openapi
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs.html
+var docsFS embed.FS
+
+var (
+	docsOnce sync.Once
+	docsPage []byte
+	docsErr  error
+)
+
+// DocsHandler serves a page that describes the document. The page is
+// rendered on the server and needs no scripts or stylesheets from elsewhere,
+// so it also works without internet access.
+func DocsHandler(c *gin.Context) {
+	docsOnce.Do(func() {
+		docsPage, docsErr = RenderDocs(Operations())
+	})
+	if docsErr != nil {
+		c.AbortWithError(http.StatusInternalServerError, docsErr)
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+}
+
+// RenderDocs renders the HTML page for the given operations, grouped by tag
+// in the order they are listed.
+func RenderDocs(operations []Operation) ([]byte, error) {
+	page, err := template.New("docs.html").Funcs(template.FuncMap{
+		"lower":      strings.ToLower,
+		"schemaType": schemaType,
+	}).ParseFS(docsFS, "docs.html")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, newDocsView(Build(operations), operations)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type docsView struct {
+	Info    Info
+	Tags    []docsTag
+	Schemas []docsSchema
+}
+
+type docsTag struct {
+	Tag
+	Operations []docsOperation
+}
+
+type docsOperation struct {
+	*OperationObject
+	Method    string
+	Path      string
+	Public    bool
+	Request   *Schema
+	Responses []docsResponse
+}
+
+type docsResponse struct {
+	Status      string
+	Description string
+	ContentType string
+	Schema      *Schema
+}
+
+type docsSchema struct {
+	Name       string
+	Properties []docsProperty
+}
+
+type docsProperty struct {
+	Name     string
+	Schema   *Schema
+	Required bool
+}
+
+func newDocsView(doc *Document, operations []Operation) docsView {
+	view := docsView{Info: doc.Info}
+
+	byTag := make(map[string][]docsOperation)
+	for _, op := range operations {
+		path := openAPIPath(op.Path)
+		operation := doc.Paths[path][strings.ToLower(op.Method)]
+		byTag[op.Tag] = append(byTag[op.Tag], docsOperation{
+			OperationObject: operation,
+			Method:          op.Method,
+			Path:            BasePath + path,
+			Public:          op.Public,
+			Request:         requestSchema(operation),
+			Responses:       docsResponses(doc, operation),
+		})
+	}
+	for _, tag := range doc.Tags {
+		if len(byTag[tag.Name]) > 0 {
+			view.Tags = append(view.Tags, docsTag{Tag: tag, Operations: byTag[tag.Name]})
+		}
+	}
+
+	for name, schema := range doc.Components.Schemas {
+		view.Schemas = append(view.Schemas, docsSchema{Name: name, Properties: docsProperties(schema)})
+	}
+	sort.Slice(view.Schemas, func(i, j int) bool { return view.Schemas[i].Name < view.Schemas[j].Name })
+	return view
+}
+
+func requestSchema(operation *OperationObject) *Schema {
+	if operation.RequestBody == nil {
+		return nil
+	}
+	return operation.RequestBody.Content["application/json"].Schema
+}
+
+// docsResponses lists the responses of an operation by status, resolving
+// the shared error responses.
+func docsResponses(doc *Document, operation *OperationObject) []docsResponse {
+	statuses := make([]string, 0, len(operation.Responses))
+	for status := range operation.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	responses := make([]docsResponse, 0, len(statuses))
+	for _, status := range statuses {
+		response := operation.Responses[status]
+		if response.Ref != "" {
+			response = doc.Components.Responses[strings.TrimPrefix(response.Ref, "#/components/responses/")]
+		}
+		result := docsResponse{Status: status, Description: response.Description}
+		for contentType, media := range response.Content {
+			result.ContentType, result.Schema = contentType, media.Schema
+		}
+		responses = append(responses, result)
+	}
+	return responses
+}
+
+func docsProperties(schema *Schema) []docsProperty {
+	properties := make([]docsProperty, 0, len(schema.Properties))
+	for name, property := range schema.Properties {
+		properties = append(properties, docsProperty{Name: name, Schema: property, Required: contains(schema.Required, name)})
+	}
+	sort.Slice(properties, func(i, j int) bool { return properties[i].Name < properties[j].Name })
+	return properties
+}
+
+// schemaType describes a schema in a few words, linking the named schemas
+// it refers to.
+func schemaType(schema *Schema) template.HTML {
+	if schema == nil {
+		return ""
+	}
+	if schema.Ref != "" {
+		name := template.HTMLEscapeString(strings.TrimPrefix(schema.Ref, "#/components/schemas/"))
+		return template.HTML(`<a href="#schema-` + name + `">` + name + `</a>`)
+	}
+	if len(schema.OneOf) > 0 {
+		parts := make([]string, len(schema.OneOf))
+		for i, option := range schema.OneOf {
+			parts[i] = string(schemaType(option))
+		}
+		return template.HTML(strings.Join(parts, " | "))
+	}
+
+	var description string
+	switch t := schema.Type.(type) {
+	case string:
+		description = template.HTMLEscapeString(t)
+	case []string:
+		description = template.HTMLEscapeString(strings.Join(t, " | "))
+	default:
+		description = "any"
+	}
+	switch {
+	case schema.Items != nil:
+		description += " of " + string(schemaType(schema.Items))
+	case schema.AdditionalProperties != nil:
+		description += " of " + string(schemaType(schema.AdditionalProperties))
+	}
+	if schema.Format != "" {
+		description += " (" + template.HTMLEscapeString(schema.Format) + ")"
+	}
+	if len(schema.Enum) > 0 {
+		description += ": " + template.HTMLEscapeString(strings.Join(schema.Enum, ", "))
+	}
+	return template.HTML(description)
+}
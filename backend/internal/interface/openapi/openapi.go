@@ -0,0 +1,424 @@
+// Package openapi describes the HTTP API as an OpenAPI 3.1 document. The
+// operations are listed in operations.go; request and response schemas are
+// generated from the handler types, so they follow the code.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document is the subset of an OpenAPI 3.1 document that we use.
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers"`
+	Tags       []Tag                 `json:"tags"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                 `json:"operationId"`
+	Summary     string                 `json:"summary"`
+	Tags        []string               `json:"tags"`
+	Parameters  []ParameterObject      `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*Response   `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+}
+
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is either a reference to a shared response or a response.
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is a JSON Schema (draft 2020-12, as used by OpenAPI 3.1).
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // 文字列またはnullを許す場合は配列
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	Responses       map[string]*Response      `json:"responses"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+const (
+	// BasePath is the prefix of every path of the document.
+	BasePath = "/api"
+
+	bearerAuth         = "bearerAuth"
+	problemContentType = "application/problem+json"
+)
+
+// errorResponses names the shared responses for error statuses.
+var errorResponses = map[int]string{
+	http.StatusBadRequest:          "BadRequest",
+	http.StatusUnauthorized:        "Unauthorized",
+	http.StatusForbidden:           "Forbidden",
+	http.StatusNotFound:            "NotFound",
+	http.StatusConflict:            "Conflict",
+	http.StatusPreconditionFailed:  "PreconditionFailed",
+	http.StatusUnprocessableEntity: "UnprocessableEntity",
+	http.StatusInternalServerError: "InternalServerError",
+}
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+	specErr  error
+)
+
+// Spec returns the document for the operations of the API.
+func Spec() *Document {
+	return Build(Operations())
+}
+
+// Handler serves the document as JSON.
+func Handler(c *gin.Context) {
+	specOnce.Do(func() {
+		specJSON, specErr = json.MarshalIndent(Spec(), "", "  ")
+	})
+	if specErr != nil {
+		c.AbortWithError(http.StatusInternalServerError, specErr)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", specJSON)
+}
+
+// Build generates the document for the given operations.
+func Build(operations []Operation) *Document {
+	g := &generator{schemas: make(map[string]*Schema)}
+
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:       "MoneyGet API",
+			Version:     "1.0.0",
+			Description: "Portfolio, investment and cash management. Errors are returned as RFC 7807 problem details.",
+		},
+		Servers: []Server{{URL: BasePath}},
+		Tags:    tags,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:   g.schemas,
+			Responses: make(map[string]*Response),
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+		Security: []map[string][]string{{bearerAuth: {}}},
+	}
+
+	problem := g.schemaFor(reflect.TypeOf(problemType), false)
+	for status, name := range errorResponses {
+		doc.Components.Responses[name] = &Response{
+			Description: http.StatusText(status),
+			Content:     map[string]MediaType{problemContentType: {Schema: problem}},
+		}
+	}
+
+	for _, op := range operations {
+		path := openAPIPath(op.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(PathItem)
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = g.operation(op)
+	}
+
+	return doc
+}
+
+// openAPIPath converts a gin path relative to BasePath ("/portfolios/:id")
+// to a templated OpenAPI path ("/portfolios/{id}").
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// pathParams returns the names of the parameters of a gin path.
+func pathParams(path string) []string {
+	var params []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, ":") {
+			params = append(params, part[1:])
+		}
+	}
+	return params
+}
+
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func (g *generator) operation(op Operation) *OperationObject {
+	result := &OperationObject{
+		OperationID: op.ID,
+		Summary:     op.Summary,
+		Tags:        []string{op.Tag},
+		Responses:   make(map[string]*Response),
+	}
+	if op.Public {
+		// 公開APIは認証不要
+		result.Security = &[]map[string][]string{}
+	}
+
+	for _, name := range pathParams(op.Path) {
+		result.Parameters = append(result.Parameters, ParameterObject{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	for _, param := range op.Query {
+		result.Parameters = append(result.Parameters, g.queryParameter(param))
+	}
+	if op.Conditional {
+		result.Parameters = append(result.Parameters, ParameterObject{
+			Name:        "If-Match",
+			In:          "header",
+			Description: "ETags of the portfolio (its version) the change is based on, comma-separated. For investments this is the ETag of the portfolio holding the investment, as returned by the investment endpoints. Weak ETags never match; when none matches the request fails with 412.",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	if op.Request != nil {
+		result.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: g.schemaFor(reflect.TypeOf(op.Request), true)},
+			},
+		}
+	}
+
+	success := &Response{Description: http.StatusText(op.status())}
+	switch response := op.Response.(type) {
+	case nil:
+	case RawResponse:
+		success.Content = map[string]MediaType{response.ContentType: {Schema: response.Schema}}
+	default:
+		success.Content = map[string]MediaType{
+			"application/json": {Schema: g.schemaFor(reflect.TypeOf(response), false)},
+		}
+	}
+	result.Responses[strconv.Itoa(op.status())] = success
+
+	for _, status := range op.errorStatuses() {
+		result.Responses[strconv.Itoa(status)] = &Response{Ref: "#/components/responses/" + errorResponses[status]}
+	}
+
+	return result
+}
+
+func (g *generator) queryParameter(param QueryParameter) ParameterObject {
+	schema := &Schema{Type: param.Type, Format: param.Format, Enum: param.Enum, Minimum: param.Minimum, Maximum: param.Maximum}
+	result := ParameterObject{Name: param.Name, In: "query", Description: param.Description, Schema: schema}
+	if param.Repeated {
+		explode := true
+		result.Explode = &explode
+		result.Schema = &Schema{Type: "array", Items: schema}
+	}
+	return result
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the schema of a Go type. Named structs are added to the
+// components and referenced. In request schemas only fields with a
+// "required" binding are required; in responses every field without
+// omitempty is always present.
+func (g *generator) schemaFor(t reflect.Type, request bool) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	schema := g.baseSchema(t, request)
+	if !nullable {
+		return schema
+	}
+	if schema.Ref != "" {
+		return &Schema{OneOf: []*Schema{schema, {Type: "null"}}}
+	}
+	schema.Type = []string{schema.Type.(string), "null"}
+	return schema
+}
+
+func (g *generator) baseSchema(t reflect.Type, request bool) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem(), request)}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem(), request)}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t, request)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// 再帰する型に備えて先に登録する
+			g.schemas[t.Name()] = &Schema{}
+			*g.schemas[t.Name()] = *g.structSchema(t, request)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+func (g *generator) structSchema(t reflect.Type, request bool) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaFor(field.Type, request)
+		rules := strings.Split(field.Tag.Get("binding"), ",")
+		applyBindingRules(property, rules)
+		if values, ok := enums[t.Name()+"."+name]; ok {
+			// 配列では要素の値を制限する
+			if property.Type == "array" {
+				property.Items.Enum = values
+			} else {
+				property.Enum = values
+			}
+		}
+		schema.Properties[name] = property
+
+		omitempty := strings.Contains(options, "omitempty")
+		if (request && contains(rules, "required")) || (!request && !omitempty) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// applyBindingRules adds the validation rules of a binding tag that JSON
+// Schema can express.
+func applyBindingRules(schema *Schema, rules []string) {
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		value, err := strconv.ParseFloat(param, 64)
+		switch {
+		case name == "email":
+			schema.Format = "email"
+		case name == "gt" && err == nil:
+			schema.ExclusiveMinimum = &value
+		case name == "gte" && err == nil:
+			schema.Minimum = &value
+		case name == "min" && err == nil:
+			n := int(value)
+			if schema.Type == "array" {
+				schema.MinItems = &n
+			} else {
+				schema.MinLength = &n
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package openapi
+
+import (
+	"moneyget/internal/interface/handler"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuild_RequestSchema(t *testing.T) {
+	doc := Build([]Operation{{
+		Method: http.MethodPost, Path: "/portfolios/:id/rebalance", ID: "rebalance", Tag: "Portfolios",
+		Request: handler.RebalancePortfolioRequest{}, Response: handler.PortfolioResponse{},
+	}})
+
+	request := doc.Components.Schemas["RebalancePortfolioRequest"]
+	if request == nil {
+		t.Fatalf("Expected the request schema to be registered")
+	}
+	if !reflect.DeepEqual(request.Required, []string{"changes"}) {
+		t.Errorf("Expected changes to be required, got %v", request.Required)
+	}
+	if changes := request.Properties["changes"]; changes.MinItems == nil || *changes.MinItems != 1 {
+		t.Errorf("Expected at least one change, got %+v", changes)
+	}
+
+	// リクエストではbinding:"required"の項目だけが必須
+	change := doc.Components.Schemas["RebalanceChangeRequest"]
+	if !reflect.DeepEqual(change.Required, []string{"currency", "investment_id"}) {
+		t.Errorf("Expected currency and investment_id to be required, got %v", change.Required)
+	}
+	if amount := change.Properties["amount"]; amount.Minimum == nil || *amount.Minimum != 0 {
+		t.Errorf("Expected amount >= 0, got %+v", amount)
+	}
+
+	operation := doc.Paths["/portfolios/{id}/rebalance"]["post"]
+	if operation == nil {
+		t.Fatalf("Expected the path to be templated, got %v", doc.Paths)
+	}
+	if len(operation.Parameters) != 1 || operation.Parameters[0].Name != "id" || !operation.Parameters[0].Required {
+		t.Errorf("Expected the id path parameter, got %+v", operation.Parameters)
+	}
+	for _, status := range []string{"200", "400", "401", "404", "500"} {
+		if operation.Responses[status] == nil {
+			t.Errorf("Expected a %s response", status)
+		}
+	}
+}
+
+func TestBuild_ResponseSchema(t *testing.T) {
+	doc := Build([]Operation{{
+		Method: http.MethodGet, Path: "/portfolios/:id/analysis", ID: "getPortfolioAnalysis", Tag: "Portfolios",
+		Response: handler.PortfolioAnalysisResponse{},
+	}})
+
+	// レスポンスではomitemptyでない項目は常に含まれる
+	transaction := doc.Components.Schemas["CashTransactionResponse"]
+	investmentID := transaction.Properties["investment_id"]
+	if !reflect.DeepEqual(investmentID.Type, []string{"string", "null"}) {
+		t.Errorf("Expected a nullable string, got %v", investmentID.Type)
+	}
+	if !contains(transaction.Required, "investment_id") {
+		t.Errorf("Expected investment_id to be required, got %v", transaction.Required)
+	}
+	if len(transaction.Properties["type"].Enum) == 0 {
+		t.Errorf("Expected the transaction types to be listed")
+	}
+	if occurredAt := transaction.Properties["occurred_at"]; occurredAt.Format != "date-time" {
+		t.Errorf("Expected a date-time, got %+v", occurredAt)
+	}
+
+	analysis := doc.Components.Schemas["PortfolioAnalysisResponse"]
+	if allocation := analysis.Properties["strategy_allocation"]; allocation.AdditionalProperties == nil {
+		t.Errorf("Expected a map of allocations, got %+v", allocation)
+	}
+}
+
+func TestRenderDocs(t *testing.T) {
+	page, err := RenderDocs([]Operation{{
+		Method: http.MethodPost, Path: "/portfolios/:id/rebalance", ID: "rebalance", Tag: "Portfolios",
+		Summary: "Change <several> amounts", Conditional: true,
+		Request: handler.RebalancePortfolioRequest{}, Response: handler.PortfolioResponse{},
+	}})
+	if err != nil {
+		t.Fatalf("RenderDocs failed: %v", err)
+	}
+
+	html := string(page)
+	for _, want := range []string{
+		`<code>/api/portfolios/{id}/rebalance</code>`,
+		`Change &lt;several&gt; amounts`,
+		`<code>If-Match</code>`,
+		`<a href="#schema-RebalancePortfolioRequest">RebalancePortfolioRequest</a>`,
+		`id="schema-RebalanceChangeRequest"`,
+		`<td>412</td><td>Precondition Failed</td>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the page to contain %s", want)
+		}
+	}
+	// 外部のスクリプトやスタイルシートは読み込まない
+	if strings.Contains(html, "<script") || strings.Contains(html, "https://") {
+		t.Errorf("Expected a self-contained page")
+	}
+}
@@ -0,0 +1,458 @@
+package openapi
+
+import (
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/interface/handler"
+	"moneyget/internal/usecase"
+	"net/http"
+)
+
+// Operation describes one route of the API. Path is the gin path relative
+// to BasePath. Request and Response are values of the handler types that
+// are bound and returned; a nil Response means no content.
+type Operation struct {
+	Method  string
+	Path    string
+	ID      string
+	Summary string
+	Tag     string
+	// Public operations do not require a bearer token
+	Public bool
+	Query  []QueryParameter
+	// Conditional operations accept an If-Match header with the portfolio ETag
+	Conditional bool
+	Request     interface{}
+	Status      int // 0は200
+	Response    interface{}
+	// Errors lists the error statuses specific to the operation. 400 for a
+	// request body, 401 for protected routes, 404 for path parameters and
+	// 500 are added to every operation that can return them.
+	Errors []int
+}
+
+// RawResponse is a response that is not generated from a handler type.
+type RawResponse struct {
+	ContentType string
+	Schema      *Schema
+}
+
+// QueryParameter is a query string parameter. Repeated parameters may be
+// given several times.
+type QueryParameter struct {
+	Name        string
+	Description string
+	Type        string
+	Format      string
+	Enum        []string
+	Minimum     *float64
+	Maximum     *float64
+	Repeated    bool
+}
+
+func (op Operation) status() int {
+	if op.Status == 0 {
+		return http.StatusOK
+	}
+	return op.Status
+}
+
+func (op Operation) errorStatuses() []int {
+	seen := make(map[int]bool)
+	var statuses []int
+	add := func(status int) {
+		if !seen[status] {
+			seen[status] = true
+			statuses = append(statuses, status)
+		}
+	}
+
+	if op.Request != nil || len(op.Query) > 0 {
+		add(http.StatusBadRequest)
+	}
+	if !op.Public {
+		add(http.StatusUnauthorized)
+	}
+	if len(pathParams(op.Path)) > 0 {
+		add(http.StatusNotFound)
+	}
+	for _, status := range op.Errors {
+		add(status)
+	}
+	if op.Conditional {
+		add(http.StatusPreconditionFailed)
+	}
+	add(http.StatusInternalServerError)
+	return statuses
+}
+
+var problemType = handler.Problem{}
+
+var tags = []Tag{
+	{Name: "Users", Description: "Registration, login and user profiles"},
+	{Name: "Portfolios", Description: "Portfolios, their cash ledger and analysis"},
+	{Name: "Members", Description: "Sharing portfolios with other users"},
+	{Name: "Investments", Description: "Investments held by portfolios"},
+	{Name: "Webhooks", Description: "Signed notifications of portfolio events"},
+	{Name: "Audit", Description: "Who changed what and when"},
+	{Name: "Documentation", Description: "This document"},
+}
+
+// enums lists the allowed values of string fields, by "Type.json_name".
+var enums = map[string][]string{
+	"CreateInvestmentRequest.type":           investmentTypes,
+	"CreateInvestmentRequest.strategy":       investmentStrategies,
+	"InvestmentResponse.type":                investmentTypes,
+	"InvestmentResponse.strategy":            investmentStrategies,
+	"RebalancingSuggestionResponse.strategy": investmentStrategies,
+	"RebalancingSuggestionResponse.action":   {"REDUCE", "INCREASE"},
+	"CashTransactionResponse.type": {
+		string(domain.CashDeposit), string(domain.CashWithdrawal), string(domain.CashInvestment),
+		string(domain.CashSale), string(domain.CashDividend),
+	},
+	"InviteMemberRequest.role": invitableRoles,
+	"MembershipResponse.role":  portfolioRoles,
+	"MembershipResponse.status": {
+		string(domain.MembershipPending), string(domain.MembershipActive),
+	},
+	"CreateWebhookRequest.event_types":   service.EventTypes,
+	"WebhookResponse.event_types":        service.EventTypes,
+	"WebhookDeliveryResponse.event_type": service.EventTypes,
+	"WebhookDeliveryResponse.status": {
+		string(domain.WebhookDeliveryPending), string(domain.WebhookDeliverySucceeded), string(domain.WebhookDeliveryFailed),
+	},
+}
+
+var (
+	investmentTypes = []string{
+		string(domain.Stock), string(domain.Bond), string(domain.RealEstate),
+	}
+	investmentStrategies = []string{
+		string(domain.Conservative), string(domain.Moderate), string(domain.Aggressive),
+	}
+	portfolioRoles = []string{
+		string(domain.RoleOwner), string(domain.RoleEditor), string(domain.RoleViewer), string(domain.RoleAdvisor),
+	}
+	// 所有者はポートフォリオに記録された一人だけなので招待できない
+	invitableRoles = []string{
+		string(domain.RoleEditor), string(domain.RoleViewer), string(domain.RoleAdvisor),
+	}
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// investmentQuery are the filters, sort order and paging of investment lists.
+var investmentQuery = []QueryParameter{
+	{Name: "type", Type: "string", Enum: investmentTypes, Repeated: true, Description: "Investment types; repeated or comma-separated"},
+	{Name: "strategy", Type: "string", Enum: investmentStrategies, Repeated: true, Description: "Strategies; repeated or comma-separated"},
+	{Name: "currency", Type: "string", Description: "ISO currency code"},
+	{Name: "min_amount", Type: "number"},
+	{Name: "max_amount", Type: "number"},
+	{Name: "created_from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (UTC), inclusive"},
+	{Name: "created_to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (UTC), exclusive"},
+	{
+		Name: "sort", Type: "string",
+		Enum: []string{
+			string(domain.SortInvestmentsByCreatedAt), "-" + string(domain.SortInvestmentsByCreatedAt),
+			string(domain.SortInvestmentsByAmount), "-" + string(domain.SortInvestmentsByAmount),
+		},
+		Description: "Sort field; a leading \"-\" sorts in descending order",
+	},
+	{Name: "cursor", Type: "string", Description: "next_cursor of the previous page"},
+	{
+		Name: "limit", Type: "integer",
+		Minimum: float(1), Maximum: float(domain.MaxInvestmentPageSize),
+		Description: "Page size",
+	},
+}
+
+// auditQuery filters the audit log. The history of a portfolio ignores the
+// aggregate filters.
+var auditQuery = []QueryParameter{
+	{Name: "aggregate_type", Type: "string", Enum: []string{domain.AggregatePortfolio}},
+	{Name: "aggregate_id", Type: "string"},
+	{Name: "type", Type: "string", Enum: service.EventTypes, Repeated: true, Description: "Event types; repeated or comma-separated"},
+	{Name: "actor", Type: "string", Description: "ID of the user who caused the events"},
+	{Name: "from", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (UTC), inclusive"},
+	{Name: "to", Type: "string", Description: "RFC 3339 time or YYYY-MM-DD (UTC), exclusive"},
+	{Name: "cursor", Type: "string", Description: "next_cursor of the previous page; exports start there"},
+	{
+		Name: "limit", Type: "integer",
+		Minimum: float(1), Maximum: float(usecase.MaxAuditPageSize),
+		Description: "Page size",
+	},
+	{
+		Name: "format", Type: "string", Enum: []string{"json", "csv", "jsonl"},
+		Description: "csv and jsonl download every page as text/csv or application/x-ndjson instead",
+	},
+}
+
+// Operations returns every route registered by router.NewRouter.
+func Operations() []Operation {
+	return []Operation{
+		// ユーザー関連
+		{
+			Method: http.MethodPost, Path: "/register", ID: "register", Tag: "Users", Public: true,
+			Summary: "Register a user",
+			Request: handler.RegisterRequest{}, Status: http.StatusCreated, Response: handler.MessageResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/login", ID: "login", Tag: "Users", Public: true,
+			Summary: "Log in and get a bearer token",
+			Request: handler.LoginRequest{}, Response: handler.LoginResponse{},
+			Errors: []int{http.StatusUnauthorized},
+		},
+		{
+			Method: http.MethodGet, Path: "/users/:id", ID: "getUser", Tag: "Users",
+			Summary:  "Get the profile of the current user",
+			Response: handler.UserResponse{},
+		},
+
+		// ポートフォリオ関連
+		{
+			Method: http.MethodGet, Path: "/portfolio", ID: "getDefaultPortfolio", Tag: "Portfolios",
+			Summary:  "Get the default portfolio of the current user",
+			Response: handler.PortfolioResponse{},
+			Errors:   []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolio/cash/deposit", ID: "depositCashToDefaultPortfolio", Tag: "Portfolios",
+			Summary: "Deposit cash to the default portfolio", Conditional: true,
+			Request: handler.CashTransactionRequest{}, Response: handler.CashBalanceResponse{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolio/cash/withdraw", ID: "withdrawCashFromDefaultPortfolio", Tag: "Portfolios",
+			Summary: "Withdraw cash from the default portfolio", Conditional: true,
+			Request: handler.CashTransactionRequest{}, Response: handler.CashBalanceResponse{},
+			Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios", ID: "listPortfolios", Tag: "Portfolios",
+			Summary:  "List the portfolios the current user owns or is a member of",
+			Response: handler.PortfolioListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios", ID: "createPortfolio", Tag: "Portfolios",
+			Summary: "Create a portfolio",
+			Request: handler.PortfolioNameRequest{}, Status: http.StatusCreated, Response: handler.PortfolioResponse{},
+			Errors: []int{http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id", ID: "getPortfolio", Tag: "Portfolios",
+			Summary:  "Get a portfolio",
+			Response: handler.PortfolioResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPatch, Path: "/portfolios/:id", ID: "renamePortfolio", Tag: "Portfolios",
+			Summary: "Rename a portfolio", Conditional: true,
+			Request: handler.PortfolioNameRequest{}, Response: handler.PortfolioResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodDelete, Path: "/portfolios/:id", ID: "deletePortfolio", Tag: "Portfolios",
+			Summary: "Delete an empty portfolio", Conditional: true,
+			Status: http.StatusNoContent,
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios/:id/archive", ID: "archivePortfolio", Tag: "Portfolios",
+			Summary: "Archive a portfolio; holdings can still be sold and cash withdrawn", Conditional: true,
+			Response: handler.PortfolioResponse{},
+			Errors:   []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios/:id/rebalance", ID: "rebalancePortfolio", Tag: "Portfolios",
+			Summary: "Change the amounts of several investments at once", Conditional: true,
+			Request: handler.RebalancePortfolioRequest{}, Response: handler.PortfolioResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/analysis", ID: "getPortfolioAnalysis", Tag: "Portfolios",
+			Summary:  "Analyse the risk and allocation of a portfolio",
+			Response: handler.PortfolioAnalysisResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/validation", ID: "validatePortfolio", Tag: "Portfolios",
+			Summary:  "Check a portfolio against the risk distribution rules",
+			Response: handler.ValidationResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/rebalancing-suggestions", ID: "getRebalancingSuggestions", Tag: "Portfolios",
+			Summary:  "Suggest changes that bring a portfolio back to its target allocation",
+			Response: handler.RebalancingSuggestionListResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios/:id/cash/deposit", ID: "depositCash", Tag: "Portfolios",
+			Summary: "Deposit cash to a portfolio", Conditional: true,
+			Request: handler.CashTransactionRequest{}, Response: handler.CashBalanceResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios/:id/cash/withdraw", ID: "withdrawCash", Tag: "Portfolios",
+			Summary: "Withdraw cash from a portfolio", Conditional: true,
+			Request: handler.CashTransactionRequest{}, Response: handler.CashBalanceResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/investments", ID: "listPortfolioInvestments", Tag: "Investments",
+			Summary:  "List the investments of a portfolio",
+			Query:    investmentQuery,
+			Response: handler.InvestmentPageResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/stream", ID: "streamPortfolio", Tag: "Portfolios",
+			Summary:  "Stream portfolio-changed, valuation-changed and alert events; Last-Event-ID resumes after an event",
+			Response: RawResponse{ContentType: "text/event-stream", Schema: &Schema{Type: "string"}},
+			Errors:   []int{http.StatusBadRequest},
+		},
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/history", ID: "getPortfolioHistory", Tag: "Audit",
+			Summary:  "List the stored events of a portfolio with who caused them; users who may manage the portfolio only",
+			Query:    auditQuery,
+			Response: handler.AuditPageResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodGet, Path: "/household", ID: "getHouseholdView", Tag: "Portfolios",
+			Summary:  "Summarise all portfolios the current user can see",
+			Response: handler.HouseholdViewResponse{},
+		},
+
+		// 共有メンバー関連
+		{
+			Method: http.MethodGet, Path: "/portfolios/:id/members", ID: "listMembers", Tag: "Members",
+			Summary:  "List the members of a portfolio",
+			Response: handler.MemberListResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPost, Path: "/portfolios/:id/invitations", ID: "inviteMember", Tag: "Members",
+			Summary: "Invite a user to a portfolio",
+			Request: handler.InviteMemberRequest{}, Status: http.StatusCreated, Response: handler.MembershipResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodDelete, Path: "/portfolios/:id/members/:membershipId", ID: "removeMember", Tag: "Members",
+			Summary: "Remove a member or withdraw an invitation",
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodGet, Path: "/invitations", ID: "listInvitations", Tag: "Members",
+			Summary:  "List the pending invitations of the current user",
+			Response: handler.InvitationListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/invitations/:id/accept", ID: "acceptInvitation", Tag: "Members",
+			Summary:  "Accept an invitation",
+			Response: handler.MembershipResponse{},
+			Errors:   []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/invitations/:id/decline", ID: "declineInvitation", Tag: "Members",
+			Summary: "Decline an invitation",
+			Status:  http.StatusNoContent,
+			Errors:  []int{http.StatusForbidden, http.StatusConflict},
+		},
+
+		// Webhook関連
+		{
+			Method: http.MethodGet, Path: "/webhooks", ID: "listWebhooks", Tag: "Webhooks",
+			Summary:  "List the webhooks of the current user",
+			Response: handler.WebhookListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks", ID: "createWebhook", Tag: "Webhooks",
+			Summary: "Subscribe a public URL to events of the portfolios the current user created (not those shared with them); the secret is only returned here",
+			Request: handler.CreateWebhookRequest{}, Status: http.StatusCreated, Response: handler.WebhookResponse{},
+		},
+		{
+			Method: http.MethodDelete, Path: "/webhooks/:id", ID: "deleteWebhook", Tag: "Webhooks",
+			Summary: "Delete a webhook and its delivery log",
+			Status:  http.StatusNoContent,
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks/:id/deliveries", ID: "listWebhookDeliveries", Tag: "Webhooks",
+			Summary:  "List the latest deliveries of a webhook",
+			Response: handler.WebhookDeliveryListResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks/:id/deliveries/:deliveryId/redeliver", ID: "redeliverWebhook", Tag: "Webhooks",
+			Summary: "Queue a delivery again with the same payload",
+			Status:  http.StatusAccepted, Response: handler.WebhookDeliveryResponse{},
+		},
+
+		// 監査ログ関連
+		{
+			Method: http.MethodGet, Path: "/audit", ID: "listAuditLog", Tag: "Audit",
+			Summary:  "List the stored events of all aggregates with who caused them; admins only",
+			Query:    auditQuery,
+			Response: handler.AuditPageResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+
+		// 投資関連
+		{
+			Method: http.MethodGet, Path: "/investments", ID: "listInvestments", Tag: "Investments",
+			Summary:  "List the investments of all portfolios the current user can see",
+			Query:    investmentQuery,
+			Response: handler.InvestmentPageResponse{},
+		},
+		{
+			Method: http.MethodPost, Path: "/investments", ID: "createInvestment", Tag: "Investments",
+			Summary: "Buy an investment with the cash of a portfolio", Conditional: true,
+			Request: handler.CreateInvestmentRequest{}, Status: http.StatusCreated, Response: handler.InvestmentResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/investments/:id", ID: "getInvestment", Tag: "Investments",
+			Summary:  "Get an investment",
+			Response: handler.InvestmentResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPatch, Path: "/investments/:id", ID: "updateInvestmentAmount", Tag: "Investments",
+			Summary: "Change the amount of an investment", Conditional: true,
+			Request: handler.InvestmentAmountRequest{}, Response: handler.InvestmentResponse{},
+			Errors: []int{http.StatusForbidden, http.StatusConflict, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodDelete, Path: "/investments/:id", ID: "sellInvestment", Tag: "Investments",
+			Summary: "Sell an investment and credit the proceeds", Conditional: true,
+			Status: http.StatusNoContent,
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodGet, Path: "/investments/:id/risk", ID: "getInvestmentRisk", Tag: "Investments",
+			Summary:  "Get an investment with its risk score",
+			Response: handler.InvestmentRiskResponse{},
+			Errors:   []int{http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPost, Path: "/investments/:id/dividends", ID: "recordDividend", Tag: "Investments",
+			Summary: "Record a dividend paid by an investment", Conditional: true,
+			Request: handler.CashTransactionRequest{}, Status: http.StatusNoContent,
+			Errors: []int{http.StatusForbidden, http.StatusConflict},
+		},
+
+		// ドキュメント
+		{
+			Method: http.MethodGet, Path: "/openapi.json", ID: "getOpenAPIDocument", Tag: "Documentation", Public: true,
+			Summary:  "Get this document",
+			Response: RawResponse{ContentType: "application/json", Schema: &Schema{Type: "object"}},
+		},
+		{
+			Method: http.MethodGet, Path: "/docs", ID: "getAPIDocs", Tag: "Documentation", Public: true,
+			Summary:  "Browse this document",
+			Response: RawResponse{ContentType: "text/html", Schema: &Schema{Type: "string"}},
+		},
+	}
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"moneyget/internal/domain/service"
 	"moneyget/internal/interface/handler"
+	"moneyget/internal/interface/openapi"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,6 +12,10 @@ func NewRouter(
 	userHandler *handler.UserHandler,
 	investmentHandler *handler.InvestmentHandler,
 	portfolioHandler *handler.PortfolioHandler,
+	membershipHandler *handler.MembershipHandler,
+	webhookHandler *handler.WebhookHandler,
+	streamHandler *handler.StreamHandler,
+	auditHandler *handler.AuditHandler,
 	jwtService service.JWTService,
 ) *gin.Engine {
 	// Ginの本番モード設定
@@ -18,8 +23,10 @@ func NewRouter(
 
 	// gin.Defaultの代わりにgin.Newを使用し、必要なミドルウェアを明示的に追加
 	r := gin.New()
+	r.Use(handler.RequestIDMiddleware())
 	r.Use(gin.Logger())
-	r.Use(gin.Recovery())
+	r.Use(gin.CustomRecovery(handler.Recovery))
+	r.NoRoute(handler.NoRoute)
 
 	// CORSミドルウェアの設定
 	r.Use(corsMiddleware())
@@ -30,6 +37,8 @@ func NewRouter(
 		// パブリックルート
 		api.POST("/register", userHandler.Register)
 		api.POST("/login", userHandler.Login)
+		api.GET("/openapi.json", openapi.Handler)
+		api.GET("/docs", openapi.DocsHandler)
 
 		// 認証が必要なルート
 		protected := api.Group("")
@@ -40,9 +49,51 @@ func NewRouter(
 
 			// ポートフォリオ関連
 			protected.GET("/portfolio", portfolioHandler.GetPortfolio)
+			protected.POST("/portfolio/cash/deposit", portfolioHandler.DepositCash)
+			protected.POST("/portfolio/cash/withdraw", portfolioHandler.WithdrawCash)
+			protected.GET("/portfolios", portfolioHandler.ListPortfolios)
+			protected.POST("/portfolios", portfolioHandler.CreatePortfolio)
+			protected.GET("/portfolios/:id", portfolioHandler.GetPortfolioByID)
+			protected.PATCH("/portfolios/:id", portfolioHandler.RenamePortfolio)
+			protected.DELETE("/portfolios/:id", portfolioHandler.DeletePortfolio)
+			protected.POST("/portfolios/:id/archive", portfolioHandler.ArchivePortfolio)
+			protected.POST("/portfolios/:id/rebalance", portfolioHandler.RebalancePortfolio)
+			protected.GET("/portfolios/:id/analysis", portfolioHandler.GetPortfolioAnalysis)
+			protected.GET("/portfolios/:id/validation", portfolioHandler.ValidatePortfolio)
+			protected.GET("/portfolios/:id/rebalancing-suggestions", investmentHandler.GetInvestmentRebalancingSuggestions)
+			protected.POST("/portfolios/:id/cash/deposit", portfolioHandler.DepositCash)
+			protected.POST("/portfolios/:id/cash/withdraw", portfolioHandler.WithdrawCash)
+			protected.GET("/portfolios/:id/investments", investmentHandler.ListPortfolioInvestments)
+			protected.GET("/portfolios/:id/stream", streamHandler.StreamPortfolio)
+			protected.GET("/portfolios/:id/history", auditHandler.PortfolioHistory)
+			protected.GET("/household", portfolioHandler.GetHouseholdView)
+
+			// 共有メンバー関連
+			protected.GET("/portfolios/:id/members", membershipHandler.ListMembers)
+			protected.POST("/portfolios/:id/invitations", membershipHandler.InviteMember)
+			protected.DELETE("/portfolios/:id/members/:membershipId", membershipHandler.RemoveMember)
+			protected.GET("/invitations", membershipHandler.ListInvitations)
+			protected.POST("/invitations/:id/accept", membershipHandler.AcceptInvitation)
+			protected.POST("/invitations/:id/decline", membershipHandler.DeclineInvitation)
+
+			// Webhook関連
+			protected.GET("/webhooks", webhookHandler.ListWebhooks)
+			protected.POST("/webhooks", webhookHandler.CreateWebhook)
+			protected.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+			protected.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+			protected.POST("/webhooks/:id/deliveries/:deliveryId/redeliver", webhookHandler.Redeliver)
+
+			// 監査ログ関連
+			protected.GET("/audit", auditHandler.ListAuditLog)
 
 			// 投資関連
+			protected.GET("/investments", investmentHandler.ListInvestments)
 			protected.POST("/investments", investmentHandler.CreateInvestment)
+			protected.GET("/investments/:id", investmentHandler.GetInvestment)
+			protected.PATCH("/investments/:id", investmentHandler.UpdateInvestmentAmount)
+			protected.DELETE("/investments/:id", investmentHandler.SellInvestment)
+			protected.GET("/investments/:id/risk", investmentHandler.GetInvestmentWithRiskAnalysis)
+			protected.POST("/investments/:id/dividends", investmentHandler.RecordDividend)
 		}
 	}
 
@@ -53,8 +104,9 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-Match, X-Request-ID, Last-Event-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -0,0 +1,1284 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/sqlite"
+	"moneyget/internal/interface/handler"
+	"moneyget/internal/usecase"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// requestedRoutes records the requests the tests made, so that
+// TestRouter_EveryRouteIsTested can report routes without any test.
+var requestedRoutes []requestedRoute
+
+type requestedRoute struct {
+	method string
+	path   string
+}
+
+// recordRoute records a request made by a test.
+func recordRoute(method string, path string) {
+	requestedRoutes = append(requestedRoutes, requestedRoute{method: method, path: strings.SplitN(path, "?", 2)[0]})
+}
+
+func matchRoute(pattern string, path string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	if len(patternParts) != len(pathParts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if !strings.HasPrefix(part, ":") && part != pathParts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// testServer wires the real router, handlers, use cases and SQLite
+// repositories so that authorization is exercised end to end.
+type testServer struct {
+	t          *testing.T
+	engine     http.Handler
+	routes     gin.RoutesInfo
+	jwtService service.JWTService
+	db         *sql.DB
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := sqlite.RunMigrations(db); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	txManager := sqlite.NewTransactionManager(db)
+	userRepo := sqlite.NewUserRepository(db)
+	investmentRepo := sqlite.NewInvestmentRepository(db)
+	portfolioRepo := sqlite.NewPortfolioRepository(db)
+	membershipRepo := sqlite.NewMembershipRepository(db)
+
+	outbox := service.NewOutbox(sqlite.NewEventStoreDB(db), sqlite.NewOutboxStoreDB(db))
+	strategyService := service.NewInvestmentStrategyService()
+	jwtService := service.NewJWTService("test-secret")
+
+	userUsecase := usecase.NewUserUsecase(userRepo, service.NewPasswordService())
+	investmentUsecase := usecase.NewInvestmentUseCase(investmentRepo, portfolioRepo, membershipRepo, txManager, outbox, strategyService)
+	portfolioUsecase := usecase.NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, txManager, outbox, strategyService)
+	membershipUsecase := usecase.NewMembershipUseCase(membershipRepo, portfolioRepo, userRepo, txManager)
+	webhookUsecase := usecase.NewWebhookUseCase(sqlite.NewWebhookRepository(db))
+	streamUsecase := usecase.NewPortfolioStreamUseCase(portfolioRepo, membershipRepo, sqlite.NewEventStoreDB(db), service.NewStreamHub())
+	auditUsecase := usecase.NewAuditUseCase(sqlite.NewEventStoreDB(db), userRepo, portfolioRepo, membershipRepo, []string{"3"})
+
+	engine := NewRouter(
+		handler.NewUserHandler(userUsecase, jwtService),
+		handler.NewInvestmentHandler(investmentUsecase),
+		handler.NewPortfolioHandler(portfolioUsecase),
+		handler.NewMembershipHandler(membershipUsecase),
+		handler.NewWebhookHandler(webhookUsecase),
+		handler.NewStreamHandler(streamUsecase),
+		handler.NewAuditHandler(auditUsecase),
+		jwtService,
+	)
+	return &testServer{t: t, engine: engine, routes: engine.Routes(), jwtService: jwtService, db: db}
+}
+
+func (s *testServer) addUser(id string, email string) {
+	s.t.Helper()
+	_, err := s.db.Exec(
+		`INSERT INTO users (id, name, email, password, created_at) VALUES (?, ?, ?, ?, ?)`,
+		id, id, email, "hashed", time.Now(),
+	)
+	if err != nil {
+		s.t.Fatalf("Failed to insert user: %v", err)
+	}
+}
+
+func (s *testServer) token(userID string) string {
+	s.t.Helper()
+	token, err := s.jwtService.GenerateToken(userID)
+	if err != nil {
+		s.t.Fatalf("Failed to generate token: %v", err)
+	}
+	return token
+}
+
+func (s *testServer) do(method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("Failed to marshal body: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	recordRoute(method, path)
+	return rec
+}
+
+// stream opens an event stream and returns what was sent until the client
+// went away after wait.
+func (s *testServer) stream(path string, token string, lastEventID string, wait time.Duration) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	recordRoute(http.MethodGet, path)
+	return rec
+}
+
+// decode unmarshals the JSON body of a response.
+func (s *testServer) decode(rec *httptest.ResponseRecorder, v interface{}) {
+	s.t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		s.t.Fatalf("Failed to decode response %s: %v", rec.Body.String(), err)
+	}
+}
+
+// seedPortfolio stores a funded portfolio holding one investment for the owner.
+func (s *testServer) seedPortfolio(id string, ownerID string, investmentID string) {
+	s.t.Helper()
+	ctx := context.Background()
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID(id), ownerID)
+	deposit, _ := domain.NewMoney(1000000, "JPY")
+	depositTx, _ := domain.NewCashTransaction(id+"-deposit", domain.CashDeposit, deposit, domain.InvestmentID{})
+	if err := portfolio.RecordCashTransaction(depositTx); err != nil {
+		s.t.Fatalf("Failed to deposit: %v", err)
+	}
+
+	money, _ := domain.NewMoney(100000, "JPY")
+	investment, _ := domain.NewInvestment(domain.NewInvestmentID(investmentID), money, domain.Stock, domain.Conservative)
+	if err := sqlite.NewInvestmentRepository(s.db).Create(ctx, investment); err != nil {
+		s.t.Fatalf("Failed to create investment: %v", err)
+	}
+	if err := portfolio.AddInvestment(investment); err != nil {
+		s.t.Fatalf("Failed to add investment: %v", err)
+	}
+	if err := sqlite.NewPortfolioRepository(s.db).Create(ctx, portfolio); err != nil {
+		s.t.Fatalf("Failed to create portfolio: %v", err)
+	}
+}
+
+func (s *testServer) share(portfolioID string, userID string, email string, role domain.PortfolioRole) {
+	s.t.Helper()
+
+	membership, err := domain.NewPortfolioInvitation(portfolioID+"-"+userID, domain.NewPortfolioID(portfolioID), email, role, "1")
+	if err != nil {
+		s.t.Fatalf("Failed to create invitation: %v", err)
+	}
+	if err := membership.Accept(userID, email); err != nil {
+		s.t.Fatalf("Failed to accept invitation: %v", err)
+	}
+	if err := sqlite.NewMembershipRepository(s.db).Save(context.Background(), membership); err != nil {
+		s.t.Fatalf("Failed to save membership: %v", err)
+	}
+}
+
+func TestRouter_CrossUserAccessIsDenied(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+
+	alice := s.token("1")
+	bob := s.token("2")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"get user", http.MethodGet, "/api/users/1", nil},
+		{"get portfolio", http.MethodGet, "/api/portfolios/alice-portfolio", nil},
+		{"rename portfolio", http.MethodPatch, "/api/portfolios/alice-portfolio", gin.H{"name": "Mine"}},
+		{"archive portfolio", http.MethodPost, "/api/portfolios/alice-portfolio/archive", nil},
+		{"deposit cash", http.MethodPost, "/api/portfolios/alice-portfolio/cash/deposit", gin.H{"amount": 1000, "currency": "JPY"}},
+		{"withdraw cash", http.MethodPost, "/api/portfolios/alice-portfolio/cash/withdraw", gin.H{"amount": 1000, "currency": "JPY"}},
+		{"create investment", http.MethodPost, "/api/investments", gin.H{
+			"portfolio_id": "alice-portfolio", "amount": 10000, "currency": "JPY", "type": "STOCK", "strategy": "CONSERVATIVE",
+		}},
+		{"get investment", http.MethodGet, "/api/investments/alice-investment", nil},
+		{"list portfolio investments", http.MethodGet, "/api/portfolios/alice-portfolio/investments", nil},
+		{"list members", http.MethodGet, "/api/portfolios/alice-portfolio/members", nil},
+		{"portfolio history", http.MethodGet, "/api/portfolios/alice-portfolio/history", nil},
+		{"invite member", http.MethodPost, "/api/portfolios/alice-portfolio/invitations", gin.H{"email": "eve@example.com", "role": "VIEWER"}},
+		{"remove member", http.MethodDelete, "/api/portfolios/alice-portfolio/members/any", nil},
+		{"delete portfolio", http.MethodDelete, "/api/portfolios/alice-portfolio", nil},
+		{"analyze portfolio", http.MethodGet, "/api/portfolios/alice-portfolio/analysis", nil},
+		{"validate portfolio", http.MethodGet, "/api/portfolios/alice-portfolio/validation", nil},
+		{"rebalancing suggestions", http.MethodGet, "/api/portfolios/alice-portfolio/rebalancing-suggestions", nil},
+		{"rebalance portfolio", http.MethodPost, "/api/portfolios/alice-portfolio/rebalance", gin.H{
+			"changes": []gin.H{{"investment_id": "alice-investment", "amount": 1, "currency": "JPY"}},
+		}},
+		{"update investment amount", http.MethodPatch, "/api/investments/alice-investment", gin.H{"amount": 1, "currency": "JPY"}},
+		{"sell investment", http.MethodDelete, "/api/investments/alice-investment", nil},
+		{"investment risk", http.MethodGet, "/api/investments/alice-investment/risk", nil},
+		{"record dividend", http.MethodPost, "/api/investments/alice-investment/dividends", gin.H{"amount": 1000, "currency": "JPY"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := s.do(tt.method, tt.path, "", tt.body); rec.Code != http.StatusUnauthorized {
+				t.Errorf("Expected 401 without token, got %d", rec.Code)
+			}
+			if rec := s.do(tt.method, tt.path, bob, tt.body); rec.Code != http.StatusNotFound {
+				t.Errorf("Expected 404 for another user's resource, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// 他人のリソースへの操作が一切反映されていないこと
+	rec := s.do(http.MethodGet, "/api/portfolios/alice-portfolio", alice, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected owner to read portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+	portfolio, err := sqlite.NewPortfolioRepository(s.db).FindByID(context.Background(), domain.NewPortfolioID("alice-portfolio"))
+	if err != nil {
+		t.Fatalf("Failed to load portfolio: %v", err)
+	}
+	if portfolio.Name != domain.DefaultPortfolioName || portfolio.IsArchived() {
+		t.Errorf("Portfolio was modified by another user: name=%q archived=%v", portfolio.Name, portfolio.IsArchived())
+	}
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 1000000 {
+		t.Errorf("Expected cash balance 1000000, got %f", balance.Amount)
+	}
+	if len(portfolio.GetInvestments()) != 1 {
+		t.Errorf("Expected 1 investment, got %d", len(portfolio.GetInvestments()))
+	}
+}
+
+func TestRouter_UserIDInBodyIsIgnored(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+
+	// user_idを詐称しても、操作対象は認証されたユーザーのデフォルトのポートフォリオになる
+	rec := s.do(http.MethodPost, "/api/investments", s.token("2"), gin.H{
+		"user_id": "1", "amount": 10000, "currency": "JPY", "type": "STOCK", "strategy": "CONSERVATIVE",
+	})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 because bob has no portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	portfolio, err := sqlite.NewPortfolioRepository(s.db).FindByID(context.Background(), domain.NewPortfolioID("alice-portfolio"))
+	if err != nil {
+		t.Fatalf("Failed to load portfolio: %v", err)
+	}
+	if len(portfolio.GetInvestments()) != 1 {
+		t.Errorf("Expected alice's portfolio to be untouched, got %d investments", len(portfolio.GetInvestments()))
+	}
+}
+
+func TestRouter_SharedAccessByRole(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.addUser("3", "carol@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	s.share("alice-portfolio", "2", "bob@example.com", domain.RoleViewer)
+	s.share("alice-portfolio", "3", "carol@example.com", domain.RoleEditor)
+
+	viewer := s.token("2")
+	editor := s.token("3")
+
+	tests := []struct {
+		name     string
+		token    string
+		method   string
+		path     string
+		body     interface{}
+		expected int
+	}{
+		{"viewer reads portfolio", viewer, http.MethodGet, "/api/portfolios/alice-portfolio", nil, http.StatusOK},
+		{"viewer reads investment", viewer, http.MethodGet, "/api/investments/alice-investment", nil, http.StatusOK},
+		{"viewer cannot deposit", viewer, http.MethodPost, "/api/portfolios/alice-portfolio/cash/deposit", gin.H{"amount": 1000, "currency": "JPY"}, http.StatusForbidden},
+		{"viewer cannot trade", viewer, http.MethodPost, "/api/investments", gin.H{
+			"portfolio_id": "alice-portfolio", "amount": 10000, "currency": "JPY", "type": "STOCK", "strategy": "CONSERVATIVE",
+		}, http.StatusForbidden},
+		{"viewer cannot read owner profile", viewer, http.MethodGet, "/api/users/1", nil, http.StatusNotFound},
+		{"viewer reads own profile", viewer, http.MethodGet, "/api/users/2", nil, http.StatusOK},
+		{"editor deposits", editor, http.MethodPost, "/api/portfolios/alice-portfolio/cash/deposit", gin.H{"amount": 1000, "currency": "JPY"}, http.StatusOK},
+		{"editor trades", editor, http.MethodPost, "/api/investments", gin.H{
+			"portfolio_id": "alice-portfolio", "amount": 10000, "currency": "JPY", "type": "STOCK", "strategy": "CONSERVATIVE",
+		}, http.StatusCreated},
+		{"editor cannot rename", editor, http.MethodPatch, "/api/portfolios/alice-portfolio", gin.H{"name": "Carol"}, http.StatusForbidden},
+		{"editor cannot invite", editor, http.MethodPost, "/api/portfolios/alice-portfolio/invitations", gin.H{"email": "eve@example.com", "role": "VIEWER"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d: %s", tt.expected, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_ListInvestments(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.addUser("3", "carol@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	s.seedPortfolio("carol-portfolio", "3", "carol-investment")
+	s.share("alice-portfolio", "2", "bob@example.com", domain.RoleViewer)
+
+	alice := s.token("1")
+	for _, body := range []gin.H{
+		{"portfolio_id": "alice-portfolio", "amount": 30000, "currency": "JPY", "type": "BOND", "strategy": "CONSERVATIVE"},
+		{"portfolio_id": "alice-portfolio", "amount": 20000, "currency": "JPY", "type": "STOCK", "strategy": "MODERATE"},
+		{"portfolio_id": "alice-portfolio", "amount": 50000, "currency": "JPY", "type": "STOCK", "strategy": "CONSERVATIVE"},
+	} {
+		if rec := s.do(http.MethodPost, "/api/investments", alice, body); rec.Code != http.StatusCreated {
+			t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	type page struct {
+		Investments []handler.InvestmentResponse `json:"investments"`
+		NextCursor  *string                      `json:"next_cursor"`
+	}
+	// collect follows next_cursor and returns every investment of the list.
+	collect := func(path string, token string) []handler.InvestmentResponse {
+		t.Helper()
+
+		var all []handler.InvestmentResponse
+		cursor := ""
+		for i := 0; i < 10; i++ {
+			url := path
+			if cursor != "" {
+				url += "&cursor=" + cursor
+			}
+			rec := s.do(http.MethodGet, url, token, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200 for %s, got %d: %s", url, rec.Code, rec.Body.String())
+			}
+			var p page
+			if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+				t.Fatalf("Failed to decode page: %v", err)
+			}
+			all = append(all, p.Investments...)
+			if p.NextCursor == nil {
+				return all
+			}
+			cursor = *p.NextCursor
+		}
+		t.Fatalf("Too many pages for %s", path)
+		return nil
+	}
+
+	ids := func(investments []handler.InvestmentResponse) []string {
+		var result []string
+		for _, investment := range investments {
+			result = append(result, investment.ID)
+		}
+		return result
+	}
+
+	// 自分と共有されたポートフォリオの投資だけが見える
+	all := collect("/api/investments?limit=2", alice)
+	if len(all) != 4 || all[0].ID != "alice-investment" {
+		t.Errorf("Expected alice's 4 investments oldest first, got %v", ids(all))
+	}
+	if shared := collect("/api/investments?limit=3", s.token("2")); len(shared) != 4 {
+		t.Errorf("Expected the viewer to see 4 investments, got %v", ids(shared))
+	}
+	if own := collect("/api/investments?limit=2", s.token("3")); len(own) != 1 || own[0].ID != "carol-investment" {
+		t.Errorf("Expected only carol's investment, got %v", ids(own))
+	}
+
+	stocks := collect("/api/portfolios/alice-portfolio/investments?type=stock&sort=-amount&limit=1", alice)
+	if len(stocks) != 3 {
+		t.Fatalf("Expected 3 stocks, got %v", ids(stocks))
+	}
+	for i, amount := range []float64{100000, 50000, 20000} {
+		if stocks[i].Amount != amount || stocks[i].Type != "STOCK" {
+			t.Errorf("Expected stock of %f at %d, got %+v", amount, i, stocks[i])
+		}
+	}
+
+	filtered := collect("/api/investments?strategy=CONSERVATIVE&min_amount=40000&created_from=2000-01-01", alice)
+	if len(filtered) != 2 {
+		t.Errorf("Expected 2 conservative investments of at least 40000, got %v", ids(filtered))
+	}
+
+	for _, query := range []string{"limit=abc", "limit=1000", "sort=name", "cursor=garbage", "type=GOLD", "min_amount=x", "created_to=yesterday"} {
+		if rec := s.do(http.MethodGet, "/api/investments?"+query, alice, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRouter_LoginIssuesTokenForUUIDUser(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(http.MethodPost, "/api/register", "", gin.H{"name": "Alice", "email": "alice@example.com", "password": "password123"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 on register, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/login", "", gin.H{"email": "alice@example.com", "password": "password123"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on login, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var login struct {
+		Token string      `json:"token"`
+		User  domain.User `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+
+	subject, err := s.jwtService.ValidateToken(login.Token)
+	if err != nil {
+		t.Fatalf("Issued token is invalid: %v", err)
+	}
+	if subject != login.User.ID {
+		t.Errorf("Expected subject %s, got %s", login.User.ID, subject)
+	}
+
+	rec = s.do(http.MethodGet, "/api/users/"+login.User.ID, login.Token, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 reading own profile, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_ETagAndIfMatch(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	alice := s.token("1")
+
+	rec := s.do(http.MethodGet, "/api/portfolios/alice-portfolio", alice, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf(`Expected ETag "1", got %q`, etag)
+	}
+
+	doWithIfMatch := func(method string, path string, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+alice)
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		s.engine.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", etag, gin.H{"name": "Renamed"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with current ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Errorf(`Expected new ETag "2", got %q`, got)
+	}
+
+	// 古いETagでの更新は412
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", etag, gin.H{"name": "Stale"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 with stale ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doWithIfMatch(http.MethodPost, "/api/portfolios/alice-portfolio/cash/deposit", etag, gin.H{"amount": 1000, "currency": "JPY"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for deposit with stale ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", "garbage", gin.H{"name": "Garbage"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 with malformed If-Match, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", "*", gin.H{"name": "Any"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with If-Match *, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// If-Matchは強い比較なので、弱いETagは現在の版でも一致しない
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", `W/"3"`, gin.H{"name": "Weak"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 with weak ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// 一覧のどれかが一致すればよい
+	rec = doWithIfMatch(http.MethodPatch, "/api/portfolios/alice-portfolio", `W/"3", "1", "3"`, gin.H{"name": "Listed"})
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with current ETag in a list, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"4"` {
+		t.Errorf(`Expected new ETag "4", got %q`, got)
+	}
+
+	// 投資のETagは保有するポートフォリオのバージョン
+	rec = s.do(http.MethodGet, "/api/investments/alice-investment", alice, nil)
+	if got := rec.Header().Get("ETag"); got != `"4"` {
+		t.Errorf(`Expected the investment ETag "4", got %q`, got)
+	}
+	rec = doWithIfMatch(http.MethodPatch, "/api/investments/alice-investment", etag, gin.H{"amount": 1, "currency": "JPY"})
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for an investment with stale ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doWithIfMatch(http.MethodPatch, "/api/investments/alice-investment", `"4"`, gin.H{"amount": 1, "currency": "JPY"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for an investment with current ETag, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("ETag"); got != `"5"` {
+		t.Errorf(`Expected new investment ETag "5", got %q`, got)
+	}
+}
+
+func TestRouter_PortfolioLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	alice := s.token("1")
+
+	// デフォルトのポートフォリオ
+	rec := s.do(http.MethodGet, "/api/portfolio", alice, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for the default portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var main handler.PortfolioResponse
+	s.decode(rec, &main)
+	if main.ID != "alice-portfolio" || len(main.Investments) != 1 || main.Investments[0].ID != "alice-investment" {
+		t.Errorf("Unexpected default portfolio %+v", main)
+	}
+	if main.TotalAmount != (handler.MoneyResponse{Amount: 1100000, Currency: "JPY"}) || len(main.CashTransactions) != 1 {
+		t.Errorf("Expected total 1100000 JPY and 1 cash transaction, got %+v", main)
+	}
+
+	if rec := s.do(http.MethodPost, "/api/portfolio/cash/deposit", alice, gin.H{"amount": 5000, "currency": "JPY"}); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 on deposit, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = s.do(http.MethodPost, "/api/portfolio/cash/withdraw", alice, gin.H{"amount": 2000, "currency": "JPY"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on withdraw, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var balance struct {
+		Balance float64 `json:"balance"`
+	}
+	s.decode(rec, &balance)
+	if balance.Balance != 1003000 {
+		t.Errorf("Expected balance 1003000, got %f", balance.Balance)
+	}
+
+	rec = s.do(http.MethodPost, "/api/portfolios", alice, gin.H{"name": "NISA"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 on create, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var nisa handler.PortfolioResponse
+	s.decode(rec, &nisa)
+	if nisa.Name != "NISA" || nisa.UserID != "1" || nisa.Investments == nil || nisa.ArchivedAt != nil {
+		t.Errorf("Unexpected new portfolio %+v", nisa)
+	}
+	if rec := s.do(http.MethodPost, "/api/portfolios", alice, gin.H{"name": "NISA"}); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate name, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios", alice, nil)
+	var list struct {
+		Portfolios []handler.PortfolioResponse `json:"portfolios"`
+	}
+	s.decode(rec, &list)
+	if rec.Code != http.StatusOK || len(list.Portfolios) != 2 {
+		t.Errorf("Expected 2 portfolios, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/household", alice, nil)
+	var household handler.HouseholdViewResponse
+	s.decode(rec, &household)
+	if rec.Code != http.StatusOK || len(household.Portfolios) != 2 || household.StrategyAllocation["CONSERVATIVE"] != 1 {
+		t.Errorf("Unexpected household view %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios/alice-portfolio/analysis", alice, nil)
+	var analysis handler.PortfolioAnalysisResponse
+	s.decode(rec, &analysis)
+	if rec.Code != http.StatusOK || analysis.Portfolio.ID != "alice-portfolio" || analysis.StrategyAllocation["CONSERVATIVE"] != 1 {
+		t.Errorf("Unexpected analysis %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios/alice-portfolio/rebalancing-suggestions", alice, nil)
+	var suggestions struct {
+		Suggestions []handler.RebalancingSuggestionResponse `json:"suggestions"`
+	}
+	s.decode(rec, &suggestions)
+	if rec.Code != http.StatusOK || suggestions.Suggestions == nil {
+		t.Errorf("Unexpected suggestions %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios/alice-portfolio/validation", alice, nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"valid":true`) {
+		t.Errorf("Expected a valid portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/portfolios/alice-portfolio/rebalance", alice, gin.H{
+		"changes": []gin.H{{"investment_id": "alice-investment", "amount": 120000, "currency": "JPY"}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on rebalance, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var rebalanced handler.PortfolioResponse
+	s.decode(rec, &rebalanced)
+	if rebalanced.Investments[0].Amount != 120000 || rec.Header().Get("ETag") != strconv.Quote(strconv.Itoa(rebalanced.Version)) {
+		t.Errorf("Unexpected rebalanced portfolio %+v (ETag %s)", rebalanced, rec.Header().Get("ETag"))
+	}
+	for _, body := range []gin.H{
+		{"changes": []gin.H{}},
+		{"changes": []gin.H{{"investment_id": "alice-investment", "amount": -1, "currency": "JPY"}}},
+		{"changes": []gin.H{
+			{"investment_id": "alice-investment", "amount": 1, "currency": "JPY"},
+			{"investment_id": "alice-investment", "amount": 2, "currency": "JPY"},
+		}},
+		{"changes": []gin.H{{"investment_id": "alice-investment", "amount": 1, "currency": "USD"}}},
+	} {
+		if rec := s.do(http.MethodPost, "/api/portfolios/alice-portfolio/rebalance", alice, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %v, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	rec = s.do(http.MethodPost, "/api/portfolios/alice-portfolio/rebalance", alice, gin.H{
+		"changes": []gin.H{{"investment_id": "alice-investment", "amount": 20000000, "currency": "JPY"}},
+	})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 over the portfolio limit, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 投資が残っているポートフォリオは削除できない
+	if rec := s.do(http.MethodDelete, "/api/portfolios/alice-portfolio", alice, nil); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 deleting a portfolio with investments, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/portfolios/"+nisa.ID+"/archive", alice, nil)
+	var archived handler.PortfolioResponse
+	s.decode(rec, &archived)
+	if rec.Code != http.StatusOK || archived.ArchivedAt == nil {
+		t.Errorf("Expected the portfolio to be archived, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodDelete, "/api/portfolios/"+nisa.ID, alice, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting an empty portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/api/portfolios/"+nisa.ID, alice, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_ValidatePortfolioReportsViolations(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+
+	// 保存済みのデータがルール違反でもバリデーション結果として返す
+	ctx := context.Background()
+	money, _ := domain.NewMoney(500000, "JPY")
+	aggressive, _ := domain.NewInvestment(domain.NewInvestmentID("aggressive"), money, domain.Stock, domain.Aggressive)
+	if err := sqlite.NewInvestmentRepository(s.db).Create(ctx, aggressive); err != nil {
+		t.Fatalf("Failed to create investment: %v", err)
+	}
+	portfolioRepo := sqlite.NewPortfolioRepository(s.db)
+	portfolio, err := portfolioRepo.FindByID(ctx, domain.NewPortfolioID("alice-portfolio"))
+	if err != nil {
+		t.Fatalf("Failed to load portfolio: %v", err)
+	}
+	if err := portfolio.AddInvestment(aggressive); err != nil {
+		t.Fatalf("Failed to add investment: %v", err)
+	}
+	if err := portfolioRepo.Save(ctx, portfolio); err != nil {
+		t.Fatalf("Failed to save portfolio: %v", err)
+	}
+
+	rec := s.do(http.MethodGet, "/api/portfolios/alice-portfolio/validation", s.token("1"), nil)
+	var result struct {
+		Valid bool   `json:"valid"`
+		Code  string `json:"code"`
+	}
+	s.decode(rec, &result)
+	if rec.Code != http.StatusOK || result.Valid || result.Code != domain.ErrAggressiveInvestmentLimitExceeded.Code {
+		t.Errorf("Expected an invalid portfolio, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_InvestmentLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	alice := s.token("1")
+
+	rec := s.do(http.MethodPost, "/api/investments", alice, gin.H{
+		"amount": 200000, "currency": "JPY", "type": "BOND", "strategy": "MODERATE",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created handler.InvestmentResponse
+	s.decode(rec, &created)
+	if created.ID == "" || created.Amount != 200000 || created.Type != "BOND" || created.Strategy != "MODERATE" {
+		t.Errorf("Unexpected created investment %+v", created)
+	}
+
+	rec = s.do(http.MethodGet, "/api/investments/"+created.ID, alice, nil)
+	var fetched handler.InvestmentResponse
+	s.decode(rec, &fetched)
+	if rec.Code != http.StatusOK || fetched.ID != created.ID {
+		t.Errorf("Expected to read the new investment, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPatch, "/api/investments/"+created.ID, alice, gin.H{"amount": 250000, "currency": "JPY"})
+	var updated handler.InvestmentResponse
+	s.decode(rec, &updated)
+	if rec.Code != http.StatusOK || updated.Amount != 250000 || updated.Version <= created.Version {
+		t.Errorf("Expected the amount to be updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, tt := range []struct {
+		body     gin.H
+		expected int
+	}{
+		{gin.H{"amount": -1, "currency": "JPY"}, http.StatusBadRequest},
+		{gin.H{"amount": 1}, http.StatusBadRequest},
+		{gin.H{"amount": 1, "currency": "USD"}, http.StatusBadRequest},
+		{gin.H{"amount": 20000000, "currency": "JPY"}, http.StatusUnprocessableEntity},
+	} {
+		if rec := s.do(http.MethodPatch, "/api/investments/"+created.ID, alice, tt.body); rec.Code != tt.expected {
+			t.Errorf("Expected %d for %v, got %d: %s", tt.expected, tt.body, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := s.do(http.MethodPatch, "/api/investments/unknown", alice, gin.H{"amount": 1, "currency": "JPY"}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown investment, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/investments/"+created.ID+"/risk", alice, nil)
+	var risk handler.InvestmentRiskResponse
+	s.decode(rec, &risk)
+	if rec.Code != http.StatusOK || risk.Investment.ID != created.ID || risk.RiskScore <= 0 {
+		t.Errorf("Unexpected risk analysis %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := s.do(http.MethodPost, "/api/investments/"+created.ID+"/dividends", alice, gin.H{"amount": 3000, "currency": "JPY"}); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on dividend, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodPost, "/api/investments/"+created.ID+"/dividends", alice, gin.H{"amount": 0, "currency": "JPY"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty dividend, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 売却すると投資額が現金に戻る
+	if rec := s.do(http.MethodDelete, "/api/investments/"+created.ID, alice, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 on sell, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/api/investments/"+created.ID, alice, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after sell, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodDelete, "/api/investments/"+created.ID, alice, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 selling twice, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios/alice-portfolio", alice, nil)
+	var portfolio handler.PortfolioResponse
+	s.decode(rec, &portfolio)
+	// 1,000,000 - 200,000 + 3,000 + 250,000
+	if len(portfolio.CashBalances) != 1 || portfolio.CashBalances[0].Amount != 1053000 {
+		t.Errorf("Expected cash 1053000, got %+v", portfolio.CashBalances)
+	}
+	if len(portfolio.CashTransactions) != 4 || portfolio.CashTransactions[3].Type != string(domain.CashSale) ||
+		portfolio.CashTransactions[3].InvestmentID == nil || *portfolio.CashTransactions[3].InvestmentID != created.ID {
+		t.Errorf("Unexpected cash ledger %+v", portfolio.CashTransactions)
+	}
+}
+
+func TestRouter_MembershipLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.addUser("3", "carol@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	alice, bob, carol := s.token("1"), s.token("2"), s.token("3")
+
+	invite := func(email string) handler.MembershipResponse {
+		t.Helper()
+		rec := s.do(http.MethodPost, "/api/portfolios/alice-portfolio/invitations", alice, gin.H{"email": email, "role": "VIEWER"})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected 201 on invite, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var invitation handler.MembershipResponse
+		s.decode(rec, &invitation)
+		return invitation
+	}
+	bobInvitation := invite("bob@example.com")
+	carolInvitation := invite("carol@example.com")
+	if bobInvitation.Status != "PENDING" || bobInvitation.UserID != nil || bobInvitation.PortfolioID != "alice-portfolio" {
+		t.Errorf("Unexpected invitation %+v", bobInvitation)
+	}
+
+	rec := s.do(http.MethodGet, "/api/invitations", bob, nil)
+	var invitations struct {
+		Invitations []handler.MembershipResponse `json:"invitations"`
+	}
+	s.decode(rec, &invitations)
+	if rec.Code != http.StatusOK || len(invitations.Invitations) != 1 || invitations.Invitations[0].ID != bobInvitation.ID {
+		t.Errorf("Expected bob's invitation, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/invitations/"+bobInvitation.ID+"/accept", bob, nil)
+	var accepted handler.MembershipResponse
+	s.decode(rec, &accepted)
+	if rec.Code != http.StatusOK || accepted.UserID == nil || *accepted.UserID != "2" || accepted.AcceptedAt == nil {
+		t.Errorf("Unexpected accepted membership %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodPost, "/api/invitations/"+carolInvitation.ID+"/decline", carol, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on decline, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, "/api/portfolios/alice-portfolio/members", alice, nil)
+	var members struct {
+		Members []handler.MembershipResponse `json:"members"`
+	}
+	s.decode(rec, &members)
+	if rec.Code != http.StatusOK || len(members.Members) != 1 {
+		t.Fatalf("Expected 1 member, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := s.do(http.MethodDelete, "/api/portfolios/alice-portfolio/members/"+accepted.ID, alice, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on remove, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/api/portfolios/alice-portfolio", bob, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after removal, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_WebhookLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	alice, bob := s.token("1"), s.token("2")
+
+	rec := s.do(http.MethodPost, "/api/webhooks", alice, gin.H{"url": "https://example.com/hooks", "event_types": []string{"Unheard"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown event type, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/webhooks", alice, gin.H{"url": "https://example.com/hooks", "event_types": []string{"PortfolioCreated"}})
+	var created handler.WebhookResponse
+	s.decode(rec, &created)
+	if rec.Code != http.StatusCreated || created.Secret == "" || created.URL != "https://example.com/hooks" {
+		t.Fatalf("Expected 201 with the secret, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 一覧では秘密鍵を返さない
+	rec = s.do(http.MethodGet, "/api/webhooks", alice, nil)
+	var listed handler.WebhookListResponse
+	s.decode(rec, &listed)
+	if rec.Code != http.StatusOK || len(listed.Webhooks) != 1 || listed.Webhooks[0].Secret != "" {
+		t.Errorf("Expected alice's webhook without its secret, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	delivery := domain.NewWebhookDelivery("delivery-1", created.ID, "PortfolioCreated", []byte(`{}`), time.Now())
+	delivery.Fail(http.StatusInternalServerError, "server error", nil, time.Now())
+	if err := sqlite.NewWebhookRepository(s.db).SaveDelivery(context.Background(), delivery); err != nil {
+		t.Fatalf("Failed to save delivery: %v", err)
+	}
+
+	rec = s.do(http.MethodGet, "/api/webhooks/"+created.ID+"/deliveries", alice, nil)
+	var deliveries handler.WebhookDeliveryListResponse
+	s.decode(rec, &deliveries)
+	if rec.Code != http.StatusOK || len(deliveries.Deliveries) != 1 || deliveries.Deliveries[0].Status != "FAILED" {
+		t.Errorf("Expected the failed delivery, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = s.do(http.MethodPost, "/api/webhooks/"+created.ID+"/deliveries/delivery-1/redeliver", alice, nil)
+	var redelivered handler.WebhookDeliveryResponse
+	s.decode(rec, &redelivered)
+	if rec.Code != http.StatusAccepted || redelivered.Status != "PENDING" || redelivered.NextAttemptAt == nil {
+		t.Errorf("Expected the delivery to be queued again, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 他のユーザーのWebhookは見えない
+	if rec := s.do(http.MethodGet, "/api/webhooks/"+created.ID+"/deliveries", bob, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodDelete, "/api/webhooks/"+created.ID, bob, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := s.do(http.MethodDelete, "/api/webhooks/"+created.ID, alice, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/api/webhooks/"+created.ID+"/deliveries", alice, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_ProblemDetails(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.seedPortfolio("alice-portfolio", "1", "alice-investment")
+	alice := s.token("1")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   interface{}
+		status int
+		code   string
+		fields []string
+	}{
+		{"missing token", http.MethodGet, "/api/portfolios", "", nil, http.StatusUnauthorized, "UNAUTHORIZED", nil},
+		{"invalid token", http.MethodGet, "/api/portfolios", "garbage", nil, http.StatusUnauthorized, "INVALID_TOKEN", nil},
+		{"wrong password", http.MethodPost, "/api/login", "", gin.H{"email": "alice@example.com", "password": "wrong"}, http.StatusUnauthorized, "INVALID_CREDENTIALS", nil},
+		{"validation", http.MethodPost, "/api/investments", alice, gin.H{"amount": 1000, "type": "STOCK"}, http.StatusBadRequest, "VALIDATION_FAILED", []string{"currency", "strategy"}},
+		{"wrong type", http.MethodPost, "/api/portfolios", alice, gin.H{"name": 1}, http.StatusBadRequest, "VALIDATION_FAILED", []string{"name"}},
+		{"broken body", http.MethodPost, "/api/portfolios", alice, nil, http.StatusBadRequest, "INVALID_REQUEST_BODY", nil},
+		{"invalid query", http.MethodGet, "/api/investments?limit=abc", alice, nil, http.StatusBadRequest, "INVALID_INVESTMENT_QUERY", nil},
+		{"not found", http.MethodGet, "/api/investments/missing", alice, nil, http.StatusNotFound, "INVESTMENT_NOT_FOUND", nil},
+		{"business rule", http.MethodPatch, "/api/investments/alice-investment", alice, gin.H{"amount": 20000000, "currency": "JPY"}, http.StatusUnprocessableEntity, "PORTFOLIO_LIMIT_EXCEEDED", nil},
+		{"conflict", http.MethodDelete, "/api/portfolios/alice-portfolio", alice, nil, http.StatusConflict, "PORTFOLIO_NOT_EMPTY", nil},
+		{"unknown route", http.MethodGet, "/api/unknown", alice, nil, http.StatusNotFound, "NOT_FOUND", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.do(tt.method, tt.path, tt.token, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/problem+json") {
+				t.Errorf("Expected problem+json, got %q", contentType)
+			}
+
+			var problem handler.Problem
+			s.decode(rec, &problem)
+			if problem.Status != tt.status || problem.Code != tt.code || problem.Title != http.StatusText(tt.status) {
+				t.Errorf("Expected %d %s, got %+v", tt.status, tt.code, problem)
+			}
+			if problem.Instance != strings.SplitN(tt.path, "?", 2)[0] {
+				t.Errorf("Expected instance %s, got %s", tt.path, problem.Instance)
+			}
+			if problem.CorrelationID == "" || problem.CorrelationID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("Expected the correlation ID of the response header, got %q", problem.CorrelationID)
+			}
+			var fields []string
+			for _, fieldError := range problem.Errors {
+				fields = append(fields, fieldError.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("Expected field errors %v, got %v", tt.fields, problem.Errors)
+			}
+		})
+	}
+
+	// クライアントが送ったリクエストIDはそのまま使う
+	req := httptest.NewRequest(http.MethodGet, "/api/investments/missing", nil)
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("X-Request-ID", "trace-123")
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+
+	var problem handler.Problem
+	s.decode(rec, &problem)
+	if rec.Header().Get("X-Request-ID") != "trace-123" || problem.CorrelationID != "trace-123" {
+		t.Errorf("Expected the client's request ID, got %q and %q", rec.Header().Get("X-Request-ID"), problem.CorrelationID)
+	}
+}
+
+func TestRouter_OpenAPIDocumentMatchesRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	rec := s.do(http.MethodGet, "/api/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var document struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components map[string]map[string]interface{}            `json:"components"`
+	}
+	s.decode(rec, &document)
+	if document.OpenAPI != "3.1.0" {
+		t.Errorf("Expected OpenAPI 3.1.0, got %q", document.OpenAPI)
+	}
+
+	// 文書の操作と登録されたルートが一致すること
+	documented := make(map[string]bool)
+	for path, item := range document.Paths {
+		for method, operation := range item {
+			documented[strings.ToUpper(method)+" "+path] = true
+
+			responses, _ := operation["responses"].(map[string]interface{})
+			_, public := operation["security"]
+			if _, ok := responses["401"]; !public && !ok {
+				t.Errorf("%s %s: protected operation without a 401 response", method, path)
+			}
+		}
+	}
+	routes := make(map[string]bool)
+	for _, route := range s.routes {
+		path := strings.TrimPrefix(route.Path, "/api")
+		parts := strings.Split(path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "{" + part[1:] + "}"
+			}
+		}
+		routes[route.Method+" "+strings.Join(parts, "/")] = true
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("Route %s is not documented", route)
+		}
+	}
+	for operation := range documented {
+		if !routes[operation] {
+			t.Errorf("Operation %s has no route", operation)
+		}
+	}
+
+	// 全ての$refが解決できること
+	var raw interface{}
+	s.decode(rec, &raw)
+	var checkRefs func(v interface{})
+	checkRefs = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+				if len(parts) != 2 || document.Components[parts[0]][parts[1]] == nil {
+					t.Errorf("Unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				checkRefs(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				checkRefs(child)
+			}
+		}
+	}
+	checkRefs(raw)
+
+	rec = s.do(http.MethodGet, "/api/docs", "", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected the docs page, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	// オフラインでも読めるよう、外部の資源を読み込まない
+	if page := rec.Body.String(); !strings.Contains(page, `id="getPortfolio"`) || strings.Contains(page, "https://") {
+		t.Errorf("Expected a self-contained page describing the operations")
+	}
+}
+
+func TestRouter_PortfolioStream(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	alice, bob := s.token("1"), s.token("2")
+
+	rec := s.do(http.MethodPost, "/api/portfolios", alice, gin.H{"name": "Savings"})
+	var created handler.PortfolioResponse
+	s.decode(rec, &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodPatch, "/api/portfolios/"+created.ID, alice, gin.H{"name": "Old savings"}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on rename, got %d: %s", rec.Code, rec.Body.String())
+	}
+	path := "/api/portfolios/" + created.ID + "/stream"
+
+	if rec := s.stream(path, bob, "", time.Second); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.stream(path, alice, "latest", time.Second); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid Last-Event-ID, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Last-Event-IDの後のイベントから送る
+	rec = s.stream(path, alice, "1", 200*time.Millisecond)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("Expected an event stream, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "id:1\n") || !strings.Contains(body, "id:2\nevent:portfolio-changed\ndata:") {
+		t.Errorf("Expected the events after 1, got %q", body)
+	}
+	if !strings.Contains(body, `"event_type":"PortfolioRenamed"`) || !strings.Contains(body, `"name":"Old savings"`) {
+		t.Errorf("Expected the rename with its data, got %q", body)
+	}
+
+	// 指定がなければ、これから起きるイベントだけを送る
+	if rec := s.stream(path, alice, "", 100*time.Millisecond); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "data:") {
+		t.Errorf("Expected no past events, got %d: %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRouter_AuditLog(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("1", "alice@example.com")
+	s.addUser("2", "bob@example.com")
+	s.addUser("3", "admin@example.com")
+	alice, bob, admin := s.token("1"), s.token("2"), s.token("3")
+
+	rec := s.do(http.MethodPost, "/api/portfolios", alice, gin.H{"name": "Savings"})
+	var created handler.PortfolioResponse
+	s.decode(rec, &created)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = s.do(http.MethodPatch, "/api/portfolios/"+created.ID, alice, gin.H{"name": "Old savings"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on rename, got %d: %s", rec.Code, rec.Body.String())
+	}
+	renameRequestID := rec.Header().Get("X-Request-ID")
+	s.share(created.ID, "2", "bob@example.com", domain.RoleViewer)
+
+	// 所有者は操作者とリクエストIDの付いた履歴を読める
+	historyPath := "/api/portfolios/" + created.ID + "/history"
+	rec = s.do(http.MethodGet, historyPath+"?type=PortfolioRenamed", alice, nil)
+	var history handler.AuditPageResponse
+	s.decode(rec, &history)
+	if rec.Code != http.StatusOK || len(history.Entries) == 0 || history.NextCursor != nil {
+		t.Fatalf("Expected the renames, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rename := history.Entries[len(history.Entries)-1]
+	if rename.Actor == nil || rename.Actor.ID != "1" || rename.Actor.Email != "alice@example.com" || rename.RequestID != renameRequestID {
+		t.Errorf("Expected alice and request %q, got %+v", renameRequestID, rename)
+	}
+	if !strings.Contains(string(rename.Data), `"name":"Old savings"`) {
+		t.Errorf("Expected the event data, got %s", rename.Data)
+	}
+
+	if rec := s.do(http.MethodGet, historyPath, bob, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a member, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := s.do(http.MethodGet, "/api/audit", alice, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, query := range []string{"?type=Unheard", "?limit=many", "?from=yesterday", "?format=xml", "?cursor=%21"} {
+		if rec := s.do(http.MethodGet, "/api/audit"+query, admin, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+
+	// 管理者は全体をページ単位で読める
+	rec = s.do(http.MethodGet, "/api/audit?actor=1&limit=1", admin, nil)
+	var page handler.AuditPageResponse
+	s.decode(rec, &page)
+	if rec.Code != http.StatusOK || len(page.Entries) != 1 || page.NextCursor == nil {
+		t.Fatalf("Expected a page with a next cursor, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = s.do(http.MethodGet, "/api/audit?actor=1&limit=500&cursor="+*page.NextCursor, admin, nil)
+	var rest handler.AuditPageResponse
+	s.decode(rec, &rest)
+	if rec.Code != http.StatusOK || len(rest.Entries) == 0 || rest.Entries[0].ID <= page.Entries[0].ID {
+		t.Errorf("Expected the following events, got %d: %s", rec.Code, rec.Body.String())
+	}
+	total := len(page.Entries) + len(rest.Entries)
+
+	// 表計算ソフトに数式として評価させない
+	if _, err := s.db.Exec(`UPDATE users SET name = ? WHERE id = ?`, "=1+1", "1"); err != nil {
+		t.Fatalf("Failed to rename user: %v", err)
+	}
+
+	// 書き出しは全ページを含む
+	rec = s.do(http.MethodGet, "/api/audit?actor=1&format=csv", admin, nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") || !strings.Contains(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Fatalf("Expected a CSV attachment, got %d: %v", rec.Code, rec.Header())
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != total+1 || !strings.HasPrefix(lines[0], "id,occurred_at,aggregate_type") {
+		t.Errorf("Expected a header and %d rows, got %q", total, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), renameRequestID) {
+		t.Errorf("Expected the request ID in the CSV, got %q", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), ",'=1+1,") {
+		t.Errorf("Expected the actor name to be escaped, got %q", rec.Body.String())
+	}
+
+	rec = s.do(http.MethodGet, historyPath+"?format=jsonl", alice, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected JSON Lines, got %d: %v", rec.Code, rec.Header())
+	}
+	lines = strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	for _, line := range lines {
+		var entry handler.AuditEntryResponse
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.AggregateID != created.ID {
+			t.Errorf("Expected an event of the portfolio per line, got %q: %v", line, err)
+		}
+	}
+	if rec := s.do(http.MethodGet, historyPath+"?format=csv", bob, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a member export, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestRouter_EveryRouteIsTested checks that the tests above made a request
+// to every route. Top-level tests run in the order they are declared, so
+// this one has to stay last.
+func TestRouter_EveryRouteIsTested(t *testing.T) {
+	// 一部のテストだけ、または順番を入れ替えて実行した場合は確認できない
+	if flag.Lookup("test.run").Value.String() != "" || flag.Lookup("test.shuffle").Value.String() != "off" {
+		t.Skip("route coverage needs every test of the package in order")
+	}
+
+	s := newTestServer(t)
+	for _, route := range s.routes {
+		tested := false
+		for _, request := range requestedRoutes {
+			if request.method == route.Method && matchRoute(route.Path, request.path) {
+				tested = true
+				break
+			}
+		}
+		if !tested {
+			t.Errorf("Route %s %s has no test", route.Method, route.Path)
+		}
+	}
+}
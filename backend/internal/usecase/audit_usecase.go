@@ -0,0 +1,206 @@
+package usecase
+
+import (
+	"context"
+	"encoding/base64"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ページサイズ
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 500
+)
+
+// AuditQuery selects one page of stored events. Zero values do not filter.
+// Events are returned in the order they were stored, and the next page
+// starts after the event encoded in Cursor.
+type AuditQuery struct {
+	AggregateType string
+	AggregateID   string
+	EventTypes    []string
+	ActorID       string
+	From          *time.Time // inclusive
+	To            *time.Time // exclusive
+	Cursor        string
+	Limit         int
+}
+
+// AuditEntry is a stored event with the user who caused it. Actor is nil
+// for changes made outside of a request and for users that no longer exist.
+type AuditEntry struct {
+	Event service.StoredEvent
+	Actor *domain.User
+}
+
+// AuditPage is one page of the audit log. NextCursor is empty on the last page.
+type AuditPage struct {
+	Entries    []AuditEntry
+	NextCursor string
+}
+
+type AuditUseCase struct {
+	events   service.EventStoreDB
+	userRepo domain.UserRepository
+	access   *portfolioAccess
+	admins   map[string]bool // 管理者のユーザーID
+}
+
+// NewAuditUseCase gives the users with one of adminUserIDs access to the
+// whole audit log. The IDs are set by the operator, since anyone can sign
+// up with any email.
+func NewAuditUseCase(
+	events service.EventStoreDB,
+	userRepo domain.UserRepository,
+	portfolioRepo domain.PortfolioRepository,
+	membershipRepo domain.MembershipRepository,
+	adminUserIDs []string,
+) *AuditUseCase {
+	admins := make(map[string]bool, len(adminUserIDs))
+	for _, id := range adminUserIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			admins[id] = true
+		}
+	}
+
+	return &AuditUseCase{
+		events:   events,
+		userRepo: userRepo,
+		access:   newPortfolioAccess(portfolioRepo, membershipRepo),
+		admins:   admins,
+	}
+}
+
+// ListAuditLog returns a page of the events of all aggregates. Only admins
+// may read it.
+func (u *AuditUseCase) ListAuditLog(ctx context.Context, userID string, query AuditQuery) (*AuditPage, error) {
+	if !u.admins[userID] {
+		return nil, domain.ErrForbidden
+	}
+
+	return u.list(ctx, query)
+}
+
+// ListPortfolioHistory returns a page of the events of one portfolio to the
+// users who may manage it.
+func (u *AuditUseCase) ListPortfolioHistory(ctx context.Context, userID string, portfolioID string, query AuditQuery) (*AuditPage, error) {
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	query.AggregateType = domain.AggregatePortfolio
+	query.AggregateID = portfolio.ID().Value
+	return u.list(ctx, query)
+}
+
+func (u *AuditUseCase) list(ctx context.Context, query AuditQuery) (*AuditPage, error) {
+	filter, err := query.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	// 次のページがあるかを知るために1件多く取得する
+	filter.Limit++
+	events, err := u.events.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditPage{Entries: make([]AuditEntry, 0, len(events))}
+	if len(events) > query.limit() {
+		events = events[:query.limit()]
+		page.NextCursor = encodeAuditCursor(events[len(events)-1].ID)
+	}
+
+	actors, err := u.actors(events)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		page.Entries = append(page.Entries, AuditEntry{Event: event, Actor: actors[event.ActorID]})
+	}
+	return page, nil
+}
+
+// actors loads the users who caused the events, once each.
+func (u *AuditUseCase) actors(events []service.StoredEvent) (map[string]*domain.User, error) {
+	actors := make(map[string]*domain.User)
+	for _, event := range events {
+		if event.ActorID == "" {
+			continue
+		}
+		if _, ok := actors[event.ActorID]; ok {
+			continue
+		}
+
+		user, err := u.userRepo.FindByID(event.ActorID)
+		if err != nil && !isNotFound(err) {
+			return nil, err
+		}
+		actors[event.ActorID] = user
+	}
+	return actors, nil
+}
+
+func (q AuditQuery) limit() int {
+	if q.Limit == 0 {
+		return DefaultAuditPageSize
+	}
+	return q.Limit
+}
+
+// filter validates the query and converts it for the event store.
+func (q AuditQuery) filter() (service.EventFilter, error) {
+	filter := service.EventFilter{
+		AggregateType: q.AggregateType,
+		AggregateID:   q.AggregateID,
+		EventTypes:    q.EventTypes,
+		ActorID:       q.ActorID,
+		From:          q.From,
+		To:            q.To,
+		Limit:         q.limit(),
+	}
+
+	if filter.Limit < 1 || filter.Limit > MaxAuditPageSize {
+		return filter, domain.ErrInvalidAuditQuery
+	}
+	for _, eventType := range q.EventTypes {
+		if !service.IsEventType(eventType) {
+			return filter, domain.ErrInvalidAuditQuery
+		}
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return filter, domain.ErrInvalidAuditQuery
+	}
+
+	if q.Cursor != "" {
+		afterID, err := decodeAuditCursor(q.Cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.AfterID = afterID
+	}
+	return filter, nil
+}
+
+// カーソルは最後に返したイベントのIDで、中身に依存させないため符号化しておく
+func encodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeAuditCursor(cursor string) (int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, domain.ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil || id < 1 {
+		return 0, domain.ErrInvalidCursor
+	}
+	return id, nil
+}
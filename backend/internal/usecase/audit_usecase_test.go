@@ -0,0 +1,156 @@
+package usecase
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
+	"testing"
+	"time"
+)
+
+func TestAuditUseCase(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	userRepo := memory.NewUserRepository(db)
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+	eventStoreDB := memory.NewEventStoreDB(db)
+	outbox := service.NewOutbox(eventStoreDB, memory.NewOutboxStoreDB(db))
+
+	// IDはリポジトリが振る
+	createUser := func(name string, email string) string {
+		t.Helper()
+		user := &domain.User{Name: name, Email: email}
+		if err := userRepo.Create(user); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		return user.ID
+	}
+	owner := createUser("Owner", "owner@example.com")
+	member := createUser("Member", "member@example.com")
+	admin := createUser("Admin", "admin@example.com")
+	// 誰でも登録できるので、メールアドレスでは管理者にならない
+	impostor := createUser("Impostor", "Admin@Example.com")
+
+	portfolios := NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, memory.NewTransactionManager(db), outbox, service.NewInvestmentStrategyService())
+	audit := NewAuditUseCase(eventStoreDB, userRepo, portfolioRepo, membershipRepo, []string{" " + admin + " "})
+
+	// リクエストの操作者がイベントに記録される
+	ownerCtx := service.WithActor(ctx, service.Actor{UserID: owner, RequestID: "request-1"})
+	portfolio, err := portfolios.CreatePortfolio(ownerCtx, owner, "Savings")
+	if err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	id := portfolio.ID().Value
+	if _, err := portfolios.RenamePortfolio(ownerCtx, owner, id, "Old savings"); err != nil {
+		t.Fatalf("RenamePortfolio failed: %v", err)
+	}
+	if _, err := portfolios.DepositCash(ctx, owner, id, 1000, "JPY"); err != nil {
+		t.Fatalf("DepositCash failed: %v", err)
+	}
+	if _, err := portfolios.CreatePortfolio(service.WithActor(ctx, service.Actor{UserID: member}), member, "Other"); err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+
+	membership, _ := domain.NewPortfolioInvitation("membership-1", portfolio.ID(), "member@example.com", domain.RoleViewer, owner)
+	if err := membership.Accept(member, "member@example.com"); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if err := membershipRepo.Save(ctx, membership); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	history, err := audit.ListPortfolioHistory(ctx, owner, id, AuditQuery{})
+	if err != nil {
+		t.Fatalf("ListPortfolioHistory failed: %v", err)
+	}
+	if len(history.Entries) < 3 || history.NextCursor != "" {
+		t.Fatalf("Expected the whole history on one page, got %+v", history)
+	}
+	for _, entry := range history.Entries {
+		if entry.Event.AggregateID != id {
+			t.Errorf("Expected only events of the portfolio, got %+v", entry.Event)
+		}
+	}
+	if first := history.Entries[0]; first.Event.EventType != "PortfolioCreated" || first.Actor == nil || first.Actor.Name != "Owner" || first.Event.RequestID != "request-1" {
+		t.Errorf("Expected the creation by the owner, got %+v", first)
+	}
+	if last := history.Entries[len(history.Entries)-1]; last.Actor != nil {
+		t.Errorf("Expected no actor outside of a request, got %+v", last.Actor)
+	}
+
+	// 管理権限のないメンバーや他のユーザーは履歴を見られない
+	if _, err := audit.ListPortfolioHistory(ctx, member, id, AuditQuery{}); err != domain.ErrForbidden {
+		t.Errorf("Expected ErrForbidden for a member, got %v", err)
+	}
+	if _, err := audit.ListPortfolioHistory(ctx, "stranger", id, AuditQuery{}); err != domain.ErrPortfolioNotFound {
+		t.Errorf("Expected ErrPortfolioNotFound for a stranger, got %v", err)
+	}
+	for _, userID := range []string{owner, impostor} {
+		if _, err := audit.ListAuditLog(ctx, userID, AuditQuery{}); err != domain.ErrForbidden {
+			t.Errorf("Expected ErrForbidden for non-admin %s, got %v", userID, err)
+		}
+	}
+
+	// 管理者は全集約のイベントを絞り込んで読める
+	byMember, err := audit.ListAuditLog(ctx, admin, AuditQuery{ActorID: member})
+	if err != nil || len(byMember.Entries) == 0 {
+		t.Fatalf("Expected the events of the member, got %+v, %v", byMember, err)
+	}
+	for _, entry := range byMember.Entries {
+		if entry.Actor == nil || entry.Actor.ID != member || entry.Event.AggregateID == id {
+			t.Errorf("Expected only the events of the member, got %+v", entry)
+		}
+	}
+	renames, err := audit.ListAuditLog(ctx, admin, AuditQuery{AggregateID: id, EventTypes: []string{"PortfolioRenamed"}})
+	if err != nil || len(renames.Entries) != 2 {
+		t.Errorf("Expected the renames of the portfolio, got %+v, %v", renames, err)
+	}
+	future := time.Now().Add(time.Hour)
+	if later, err := audit.ListAuditLog(ctx, admin, AuditQuery{From: &future}); err != nil || len(later.Entries) != 0 {
+		t.Errorf("Expected no events in the future, got %+v, %v", later, err)
+	}
+
+	// カーソルでページをたどると全件を一度ずつ読める
+	all, err := audit.ListAuditLog(ctx, admin, AuditQuery{})
+	if err != nil {
+		t.Fatalf("ListAuditLog failed: %v", err)
+	}
+	var paged []AuditEntry
+	query := AuditQuery{Limit: 2}
+	for {
+		page, err := audit.ListAuditLog(ctx, admin, query)
+		if err != nil {
+			t.Fatalf("ListAuditLog failed: %v", err)
+		}
+		paged = append(paged, page.Entries...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+	if len(paged) != len(all.Entries) {
+		t.Fatalf("Expected %d entries over the pages, got %d", len(all.Entries), len(paged))
+	}
+	for i := range paged {
+		if paged[i].Event.ID != all.Entries[i].Event.ID {
+			t.Errorf("Expected event %d at %d, got %d", all.Entries[i].Event.ID, i, paged[i].Event.ID)
+		}
+	}
+
+	invalid := []AuditQuery{
+		{Limit: MaxAuditPageSize + 1},
+		{EventTypes: []string{"Unheard"}},
+		{From: &future, To: &future},
+	}
+	for _, query := range invalid {
+		if _, err := audit.ListAuditLog(ctx, admin, query); err != domain.ErrInvalidAuditQuery {
+			t.Errorf("Expected ErrInvalidAuditQuery for %+v, got %v", query, err)
+		}
+	}
+	if _, err := audit.ListAuditLog(ctx, admin, AuditQuery{Cursor: "not a cursor"}); err != domain.ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
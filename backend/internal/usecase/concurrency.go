@@ -0,0 +1,75 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"moneyget/internal/domain"
+	"time"
+)
+
+// RetryPolicy controls how use cases retry a transaction that lost an
+// optimistic concurrency race (domain.ErrConcurrentModification).
+type RetryPolicy struct {
+	MaxAttempts int           // 最初の試行を含む回数
+	Backoff     time.Duration // 最初の待ち時間（試行ごとに倍増し、ジッターを加える）
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     10 * time.Millisecond,
+}
+
+// runWithRetry runs fn in a transaction and re-runs it from scratch when it
+// fails with domain.ErrConcurrentModification. fn must therefore load the
+// aggregates it changes inside the transaction.
+func runWithRetry(
+	ctx context.Context,
+	txManager domain.TransactionManager,
+	policy RetryPolicy,
+	fn func(ctx context.Context) error,
+) error {
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := txManager.RunInTransaction(ctx, fn)
+		if err == nil || !errors.Is(err, domain.ErrConcurrentModification) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		wait := backoff
+		if backoff > 0 {
+			wait += time.Duration(rand.Int63n(int64(backoff)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion returns a context that makes use cases reject the
+// request with domain.ErrVersionMismatch unless the portfolio it targets is
+// still at one of the given versions. Handlers use it to implement If-Match;
+// with no versions every request is rejected.
+func WithExpectedVersion(ctx context.Context, versions ...int) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, versions)
+}
+
+func checkExpectedVersion(ctx context.Context, portfolio *domain.Portfolio) error {
+	expected, ok := ctx.Value(expectedVersionKey{}).([]int)
+	if !ok {
+		return nil
+	}
+	for _, version := range expected {
+		if portfolio.Version == version {
+			return nil
+		}
+	}
+	return domain.ErrVersionMismatch
+}
@@ -0,0 +1,128 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"testing"
+)
+
+// conflictingPortfolioRepository fails the first conflicts Saves with
+// domain.ErrConcurrentModification, as if another request won the race.
+type conflictingPortfolioRepository struct {
+	*mockPortfolioRepository
+	conflicts int
+	saves     int
+}
+
+func (r *conflictingPortfolioRepository) Save(ctx context.Context, portfolio *domain.Portfolio) error {
+	r.saves++
+	if r.saves <= r.conflicts {
+		return domain.ErrConcurrentModification
+	}
+	return r.mockPortfolioRepository.Save(ctx, portfolio)
+}
+
+func TestRunWithRetry(t *testing.T) {
+	ctx := context.Background()
+	policy := RetryPolicy{MaxAttempts: 3}
+
+	tests := []struct {
+		name          string
+		failures      int
+		failWith      error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"succeeds first time", 0, nil, 1, nil},
+		{"retries conflicts", 2, domain.ErrConcurrentModification, 3, nil},
+		{"gives up after max attempts", 5, domain.ErrConcurrentModification, 3, domain.ErrConcurrentModification},
+		{"does not retry other errors", 5, domain.ErrInsufficientFunds, 1, domain.ErrInsufficientFunds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := runWithRetry(ctx, &mockTransactionManager{}, policy, func(ctx context.Context) error {
+				calls++
+				if calls <= tt.failures {
+					return tt.failWith
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.expectedErr) || (tt.expectedErr == nil && err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.expectedErr, err)
+			}
+			if calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestPortfolioUseCase_RetriesConcurrentModification(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := &conflictingPortfolioRepository{mockPortfolioRepository: newMockPortfolioRepository(), conflicts: 1}
+
+	useCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+	useCase.retryPolicy = RetryPolicy{MaxAttempts: 2}
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	portfolioRepo.mockPortfolioRepository.Save(ctx, portfolio)
+
+	_, err := useCase.DepositCash(ctx, "test-user", "test-portfolio", 1000, "JPY")
+	if err != nil {
+		t.Fatalf("Expected deposit to succeed after retry, got %v", err)
+	}
+	if portfolioRepo.saves != 2 {
+		t.Errorf("Expected 2 save attempts, got %d", portfolioRepo.saves)
+	}
+
+	portfolioRepo.conflicts = portfolioRepo.saves + 2
+	if _, err := useCase.DepositCash(ctx, "test-user", "test-portfolio", 1000, "JPY"); !errors.Is(err, domain.ErrConcurrentModification) {
+		t.Errorf("Expected ErrConcurrentModification after retries are exhausted, got %v", err)
+	}
+}
+
+func TestPortfolioUseCase_ExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+
+	useCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	portfolio.Version = 3
+	portfolioRepo.Save(ctx, portfolio)
+
+	if _, err := useCase.RenamePortfolio(WithExpectedVersion(ctx, 2), "test-user", "test-portfolio", "Stale"); !errors.Is(err, domain.ErrVersionMismatch) {
+		t.Errorf("Expected ErrVersionMismatch for stale version, got %v", err)
+	}
+	if portfolio.Name != domain.DefaultPortfolioName {
+		t.Errorf("Portfolio should not be renamed, got %q", portfolio.Name)
+	}
+
+	// 権限のないユーザーにはバージョンに関係なく存在を明かさない
+	if _, err := useCase.RenamePortfolio(WithExpectedVersion(ctx, 2), "other-user", "test-portfolio", "Stale"); !errors.Is(err, domain.ErrPortfolioNotFound) {
+		t.Errorf("Expected ErrPortfolioNotFound for stranger, got %v", err)
+	}
+
+	if _, err := useCase.RenamePortfolio(WithExpectedVersion(ctx, 3), "test-user", "test-portfolio", "Current"); err != nil {
+		t.Errorf("Unexpected error with current version: %v", err)
+	}
+}
@@ -5,44 +5,55 @@ import (
 	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
 	"moneyget/internal/utils"
+	"time"
 )
 
 type InvestmentUseCase struct {
 	investmentRepo  domain.InvestmentRepository
 	portfolioRepo   domain.PortfolioRepository
 	txManager       domain.TransactionManager
-	eventPublisher  domain.DomainEventPublisher
+	outbox          domain.EventOutbox
 	strategyService *service.InvestmentStrategyService
+	access          *portfolioAccess
+	retryPolicy     RetryPolicy
 }
 
 func NewInvestmentUseCase(
 	investmentRepo domain.InvestmentRepository,
 	portfolioRepo domain.PortfolioRepository,
+	membershipRepo domain.MembershipRepository,
 	txManager domain.TransactionManager,
-	eventPublisher domain.DomainEventPublisher,
+	outbox domain.EventOutbox,
 	strategyService *service.InvestmentStrategyService,
 ) *InvestmentUseCase {
 	return &InvestmentUseCase{
 		investmentRepo:  investmentRepo,
 		portfolioRepo:   portfolioRepo,
 		txManager:       txManager,
-		eventPublisher:  eventPublisher,
+		outbox:          outbox,
 		strategyService: strategyService,
+		access:          newPortfolioAccess(portfolioRepo, membershipRepo),
+		retryPolicy:     DefaultRetryPolicy,
 	}
 }
 
-// CreateInvestmentメソッドのシグネチャを変更
+// CreateInvestment buys a new investment with the portfolio's cash and
+// returns it with the new version of the portfolio.
 func (u *InvestmentUseCase) CreateInvestment(
 	ctx context.Context,
 	userID string,
+	portfolioID string,
 	amount float64,
 	currency string,
 	investmentType string,
 	strategy string,
-) error {
-	return u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
-		// ユーザーのポートフォリオを取得
-		portfolio, err := u.portfolioRepo.FindByUserID(ctx, userID)
+) (*domain.Investment, int, error) {
+	var created *domain.Investment
+	var version int
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		// 取引権限のあるポートフォリオを取得（未指定の場合はデフォルトのポートフォリオ）
+		portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionTrade)
 		if err != nil {
 			return err
 		}
@@ -67,6 +78,15 @@ func (u *InvestmentUseCase) CreateInvestment(
 			return err
 		}
 
+		// 投資額を現金残高から引き落とす（残高不足の場合はエラー）
+		debit, err := domain.NewCashTransaction(utils.GenerateUUID(), domain.CashInvestment, money, investment.ID())
+		if err != nil {
+			return err
+		}
+		if err := portfolio.RecordCashTransaction(debit); err != nil {
+			return err
+		}
+
 		if err := portfolio.AddInvestment(investment); err != nil {
 			return err
 		}
@@ -79,23 +99,243 @@ func (u *InvestmentUseCase) CreateInvestment(
 			return err
 		}
 
-		event := domain.NewInvestmentCreatedEvent(investment.ID(), money)
-		return u.eventPublisher.Publish(event)
+		created, version = investment, portfolio.Version
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, portfolio.Events()...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return created, version, nil
+}
+
+// UpdateInvestmentAmount records a new amount (e.g. the current market
+// value) for an investment and returns it with the new version of its
+// portfolio. The cash balance is not affected.
+func (u *InvestmentUseCase) UpdateInvestmentAmount(
+	ctx context.Context,
+	userID string,
+	id string,
+	amount float64,
+	currency string,
+) (*domain.Investment, int, error) {
+	var updated *domain.Investment
+	var version int
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.loadByInvestmentID(ctx, userID, id, domain.PermissionTrade)
+		if err != nil {
+			return err
+		}
+
+		money, err := domain.NewMoney(amount, currency)
+		if err != nil {
+			return err
+		}
+
+		investmentID := domain.NewInvestmentID(id)
+		if err := portfolio.UpdateInvestmentAmount(investmentID, money); err != nil {
+			return err
+		}
+
+		// 変更後のリスク配分を検証する
+		if err := portfolio.ValidateRiskDistribution(); err != nil {
+			return err
+		}
+
+		investment, err := portfolio.GetInvestment(investmentID)
+		if err != nil {
+			return err
+		}
+
+		if err := u.investmentRepo.Save(ctx, investment); err != nil {
+			return err
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		updated, version = investment, portfolio.Version
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return updated, version, nil
+}
+
+// SellInvestment closes an investment and credits its current amount to the
+// portfolio's cash balance.
+func (u *InvestmentUseCase) SellInvestment(ctx context.Context, userID string, id string) error {
+	return runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.loadByInvestmentID(ctx, userID, id, domain.PermissionTrade)
+		if err != nil {
+			return err
+		}
+
+		investment, err := portfolio.GetInvestment(domain.NewInvestmentID(id))
+		if err != nil {
+			return err
+		}
+
+		if err := portfolio.RemoveInvestment(investment.ID()); err != nil {
+			return err
+		}
+
+		if !investment.Amount().IsZero() {
+			credit, err := domain.NewCashTransaction(utils.GenerateUUID(), domain.CashSale, investment.Amount(), investment.ID())
+			if err != nil {
+				return err
+			}
+			if err := portfolio.RecordCashTransaction(credit); err != nil {
+				return err
+			}
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		if err := u.investmentRepo.Delete(ctx, investment.ID()); err != nil {
+			return err
+		}
+
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
+	})
+}
+
+// RecordDividend credits a dividend paid by an investment to the portfolio's cash balance.
+func (u *InvestmentUseCase) RecordDividend(
+	ctx context.Context,
+	userID string,
+	id string,
+	amount float64,
+	currency string,
+) error {
+	return runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.loadByInvestmentID(ctx, userID, id, domain.PermissionTrade)
+		if err != nil {
+			return err
+		}
+
+		investment, err := portfolio.GetInvestment(domain.NewInvestmentID(id))
+		if err != nil {
+			return err
+		}
+
+		money, err := domain.NewMoney(amount, currency)
+		if err != nil {
+			return err
+		}
+
+		credit, err := domain.NewCashTransaction(utils.GenerateUUID(), domain.CashDividend, money, investment.ID())
+		if err != nil {
+			return err
+		}
+		if err := portfolio.RecordCashTransaction(credit); err != nil {
+			return err
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
 	})
 }
 
+// GetInvestment returns an investment with the version of the portfolio
+// holding it. Investments have no version of their own in the API: If-Match
+// on an investment is checked against its portfolio.
 func (u *InvestmentUseCase) GetInvestment(
 	ctx context.Context,
+	userID string,
 	id string,
-) (*domain.Investment, error) {
-	return u.investmentRepo.FindByID(ctx, domain.NewInvestmentID(id))
+) (*domain.Investment, int, error) {
+	portfolio, err := u.access.loadByInvestmentID(ctx, userID, id, domain.PermissionView)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	investment, err := portfolio.GetInvestment(domain.NewInvestmentID(id))
+	if err != nil {
+		return nil, 0, err
+	}
+	return investment, portfolio.Version, nil
 }
 
 func (u *InvestmentUseCase) GetPortfolioInvestments(
 	ctx context.Context,
+	userID string,
 	portfolioID string,
 ) ([]*domain.Investment, error) {
-	return u.investmentRepo.FindAllByPortfolioID(ctx, domain.NewPortfolioID(portfolioID))
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.investmentRepo.FindAllByPortfolioID(ctx, portfolio.ID())
+}
+
+// ListInvestments returns a page of the investments held by the portfolios
+// the user can view.
+func (u *InvestmentUseCase) ListInvestments(
+	ctx context.Context,
+	userID string,
+	query domain.InvestmentQuery,
+) (*domain.InvestmentPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	portfolios, err := u.access.listAccessible(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// 空のPortfolioIDsは全件を意味するので、閲覧できるポートフォリオがなければ検索しない
+	if len(portfolios) == 0 {
+		return query.Page(nil), nil
+	}
+
+	query.PortfolioIDs = make([]domain.PortfolioID, len(portfolios))
+	for i, portfolio := range portfolios {
+		query.PortfolioIDs[i] = portfolio.ID()
+	}
+	return u.investmentRepo.Find(ctx, query)
+}
+
+// ListPortfolioInvestments returns a page of the investments held by one portfolio.
+func (u *InvestmentUseCase) ListPortfolioInvestments(
+	ctx context.Context,
+	userID string,
+	portfolioID string,
+	query domain.InvestmentQuery,
+) (*domain.InvestmentPage, error) {
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	query.PortfolioIDs = []domain.PortfolioID{portfolio.ID()}
+	return u.investmentRepo.Find(ctx, query)
 }
 
 type InvestmentWithRisk struct {
@@ -105,14 +345,15 @@ type InvestmentWithRisk struct {
 
 func (u *InvestmentUseCase) GetInvestmentWithRiskAnalysis(
 	ctx context.Context,
+	userID string,
 	id string,
 ) (*InvestmentWithRisk, error) {
-	investment, err := u.investmentRepo.FindByID(ctx, domain.NewInvestmentID(id))
+	portfolio, err := u.access.loadByInvestmentID(ctx, userID, id, domain.PermissionAnalyze)
 	if err != nil {
 		return nil, err
 	}
 
-	portfolio, err := u.findPortfolioByInvestmentID(ctx, id)
+	investment, err := portfolio.GetInvestment(domain.NewInvestmentID(id))
 	if err != nil {
 		return nil, err
 	}
@@ -130,19 +371,13 @@ func (u *InvestmentUseCase) GetInvestmentWithRiskAnalysis(
 
 func (u *InvestmentUseCase) GetInvestmentRebalancingSuggestions(
 	ctx context.Context,
+	userID string,
 	portfolioID string,
 ) ([]service.RebalancingSuggestion, error) {
-	portfolio, err := u.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(portfolioID))
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionAnalyze)
 	if err != nil {
 		return nil, err
 	}
 
 	return u.strategyService.SuggestRebalancing(portfolio)
 }
-
-func (u *InvestmentUseCase) findPortfolioByInvestmentID(
-	ctx context.Context,
-	investmentID string,
-) (*domain.Portfolio, error) {
-	return u.portfolioRepo.FindByInvestmentID(ctx, domain.NewInvestmentID(investmentID))
-}
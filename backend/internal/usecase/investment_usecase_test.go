@@ -2,14 +2,17 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
 	"testing"
+	"time"
 )
 
 // モックの定義
 type mockInvestmentRepository struct {
 	investments map[domain.InvestmentID]*domain.Investment
+	lastQuery   domain.InvestmentQuery
 }
 
 func newMockInvestmentRepository() *mockInvestmentRepository {
@@ -56,19 +59,34 @@ func (m *mockInvestmentRepository) FindAll(ctx context.Context) ([]*domain.Inves
 	return result, nil
 }
 
+func (m *mockInvestmentRepository) Find(ctx context.Context, query domain.InvestmentQuery) (*domain.InvestmentPage, error) {
+	m.lastQuery = query
+	query, err := query.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*domain.Investment
+	for _, inv := range m.investments {
+		if query.Matches(inv) {
+			result = append(result, inv)
+		}
+	}
+	return query.Page(result), nil
+}
+
 type mockTransactionManager struct{}
 
 func (m *mockTransactionManager) RunInTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
 	return fn(ctx)
 }
 
-type mockEventPublisher struct{}
-
-func (m *mockEventPublisher) Publish(event domain.DomainEvent) error {
-	return nil
+type mockEventOutbox struct {
+	events []domain.DomainEvent
 }
 
-func (m *mockEventPublisher) Subscribe(handler func(domain.DomainEvent)) error {
+func (m *mockEventOutbox) Add(ctx context.Context, events ...domain.DomainEvent) error {
+	m.events = append(m.events, events...)
 	return nil
 }
 
@@ -77,30 +95,69 @@ func TestInvestmentUseCase_CreateInvestment(t *testing.T) {
 	investmentRepo := newMockInvestmentRepository()
 	portfolioRepo := newPortfolioRepositoryForTest()
 	txManager := &mockTransactionManager{}
-	eventPublisher := &mockEventPublisher{}
+	outbox := &mockEventOutbox{}
 	strategyService := service.NewInvestmentStrategyService()
 
 	useCase := NewInvestmentUseCase(
 		investmentRepo,
 		portfolioRepo,
+		newMockMembershipRepository(),
 		txManager,
-		eventPublisher,
+		outbox,
 		strategyService,
 	)
 
-	// ユーザーのポートフォリオを作成
+	// ユーザーのポートフォリオを作成（投資資金を入金しておく）
 	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	deposit, _ := domain.NewMoney(1500000, "JPY")
+	depositTx, _ := domain.NewCashTransaction("deposit", domain.CashDeposit, deposit, domain.InvestmentID{})
+	portfolio.RecordCashTransaction(depositTx)
 	portfolioRepo.Save(ctx, portfolio)
 
+	// 同じユーザーの別のポートフォリオ（入金済み）
+	nisa := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio-nisa"), "test-user")
+	nisa.Rename("NISA")
+	nisa.CreatedAt = portfolio.CreatedAt.Add(time.Second)
+	nisaDepositTx, _ := domain.NewCashTransaction("deposit-nisa", domain.CashDeposit, deposit, domain.InvestmentID{})
+	nisa.RecordCashTransaction(nisaDepositTx)
+	portfolioRepo.Save(ctx, nisa)
+
+	// 他のユーザーのポートフォリオ
+	other := domain.NewPortfolio(domain.NewPortfolioID("other-portfolio"), "other-user")
+	otherDepositTx, _ := domain.NewCashTransaction("deposit-other", domain.CashDeposit, deposit, domain.InvestmentID{})
+	other.RecordCashTransaction(otherDepositTx)
+	portfolioRepo.Save(ctx, other)
+
 	tests := []struct {
 		name        string
 		userID      string
+		portfolioID string
 		amount      float64
 		currency    string
 		invType     string
 		strategy    string
 		expectError bool
 	}{
+		{
+			name:        "investment into a named portfolio",
+			userID:      "test-user",
+			portfolioID: "test-portfolio-nisa",
+			amount:      200000,
+			currency:    "JPY",
+			invType:     string(domain.Bond),
+			strategy:    string(domain.Conservative),
+			expectError: false,
+		},
+		{
+			name:        "investment into another user's portfolio",
+			userID:      "test-user",
+			portfolioID: "other-portfolio",
+			amount:      200000,
+			currency:    "JPY",
+			invType:     string(domain.Bond),
+			strategy:    string(domain.Conservative),
+			expectError: true,
+		},
 		{
 			name:        "valid investment creation",
 			userID:      "test-user",
@@ -137,6 +194,15 @@ func TestInvestmentUseCase_CreateInvestment(t *testing.T) {
 			strategy:    string(domain.Conservative),
 			expectError: true,
 		},
+		{
+			name:        "insufficient funds",
+			userID:      "test-user",
+			amount:      1000000,
+			currency:    "JPY",
+			invType:     string(domain.Stock),
+			strategy:    string(domain.Conservative),
+			expectError: true,
+		},
 		{
 			name:        "portfolio not found",
 			userID:      "non-existent-user",
@@ -150,9 +216,10 @@ func TestInvestmentUseCase_CreateInvestment(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := useCase.CreateInvestment(
+			_, _, err := useCase.CreateInvestment(
 				ctx,
 				tt.userID,
+				tt.portfolioID,
 				tt.amount,
 				tt.currency,
 				tt.invType,
@@ -170,6 +237,72 @@ func TestInvestmentUseCase_CreateInvestment(t *testing.T) {
 			}
 		})
 	}
+
+	// 成功した投資の分だけ現金が減っている（ポートフォリオ未指定はデフォルトへ）
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 500000 {
+		t.Errorf("Expected remaining cash 500000, got %f", balance.Amount)
+	}
+	if balance := nisa.CashBalance("JPY"); balance.Amount != 1300000 {
+		t.Errorf("Expected remaining NISA cash 1300000, got %f", balance.Amount)
+	}
+	if balance := other.CashBalance("JPY"); balance.Amount != 1500000 {
+		t.Errorf("Expected other user's cash untouched, got %f", balance.Amount)
+	}
+}
+
+func TestInvestmentUseCase_SellInvestmentAndDividend(t *testing.T) {
+	ctx := context.Background()
+	investmentRepo := newMockInvestmentRepository()
+	portfolioRepo := newPortfolioRepositoryForTest()
+
+	useCase := NewInvestmentUseCase(
+		investmentRepo,
+		portfolioRepo,
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	money, _ := domain.NewMoney(300000, "JPY")
+	investment, _ := domain.NewInvestment(
+		domain.NewInvestmentID("test-investment"),
+		money,
+		domain.Stock,
+		domain.Conservative,
+	)
+	portfolio.AddInvestment(investment)
+	investmentRepo.Save(ctx, investment)
+	portfolioRepo.Save(ctx, portfolio)
+
+	if err := useCase.RecordDividend(ctx, "test-user", "test-investment", 5000, "JPY"); err != nil {
+		t.Fatalf("Unexpected error recording dividend: %v", err)
+	}
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 5000 {
+		t.Errorf("Expected cash 5000 after dividend, got %f", balance.Amount)
+	}
+
+	if err := useCase.SellInvestment(ctx, "test-user", "test-investment"); err != nil {
+		t.Fatalf("Unexpected error selling investment: %v", err)
+	}
+	if balance := portfolio.CashBalance("JPY"); balance.Amount != 305000 {
+		t.Errorf("Expected cash 305000 after sale, got %f", balance.Amount)
+	}
+	if len(portfolio.GetInvestments()) != 0 {
+		t.Error("Sold investment should be removed from portfolio")
+	}
+	if _, err := investmentRepo.FindByID(ctx, investment.ID()); err == nil {
+		t.Error("Sold investment should be deleted")
+	}
+	// 売却代金の入金は総額に含まれる
+	if total := portfolio.CalculateTotalAmount(); total.Amount != 305000 {
+		t.Errorf("Expected total amount 305000, got %f", total.Amount)
+	}
+
+	if err := useCase.SellInvestment(ctx, "test-user", "test-investment"); err == nil {
+		t.Error("Expected error selling an already sold investment")
+	}
 }
 
 func TestInvestmentUseCase_GetInvestment(t *testing.T) {
@@ -177,14 +310,15 @@ func TestInvestmentUseCase_GetInvestment(t *testing.T) {
 	investmentRepo := newMockInvestmentRepository()
 	portfolioRepo := newPortfolioRepositoryForTest()
 	txManager := &mockTransactionManager{}
-	eventPublisher := &mockEventPublisher{}
+	outbox := &mockEventOutbox{}
 	strategyService := service.NewInvestmentStrategyService()
 
 	useCase := NewInvestmentUseCase(
 		investmentRepo,
 		portfolioRepo,
+		newMockMembershipRepository(),
 		txManager,
-		eventPublisher,
+		outbox,
 		strategyService,
 	)
 
@@ -197,27 +331,39 @@ func TestInvestmentUseCase_GetInvestment(t *testing.T) {
 		domain.Conservative,
 	)
 	investmentRepo.Save(ctx, investment)
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	portfolio.AddInvestment(investment)
+	portfolioRepo.Save(ctx, portfolio)
 
 	tests := []struct {
 		name        string
+		userID      string
 		id          string
 		expectError bool
 	}{
 		{
 			name:        "get existing investment",
+			userID:      "test-user",
 			id:          "test-investment",
 			expectError: false,
 		},
 		{
 			name:        "get non-existent investment",
+			userID:      "test-user",
 			id:          "non-existent",
 			expectError: true,
 		},
+		{
+			name:        "get other user's investment",
+			userID:      "other-user",
+			id:          "test-investment",
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inv, err := useCase.GetInvestment(ctx, tt.id)
+			inv, version, err := useCase.GetInvestment(ctx, tt.userID, tt.id)
 
 			if tt.expectError {
 				if err == nil {
@@ -233,6 +379,10 @@ func TestInvestmentUseCase_GetInvestment(t *testing.T) {
 				if inv.ID().Value != tt.id {
 					t.Errorf("Expected investment ID %s, got %s", tt.id, inv.ID().Value)
 				}
+				// 投資のバージョンは保有するポートフォリオのバージョン
+				if version != portfolio.Version {
+					t.Errorf("Expected the portfolio version %d, got %d", portfolio.Version, version)
+				}
 			}
 		})
 	}
@@ -266,21 +416,45 @@ func (m *portfolioRepoFromTest) FindByID(ctx context.Context, id domain.Portfoli
 	return nil, domain.ErrNotFound
 }
 
-func (m *portfolioRepoFromTest) FindByUserID(ctx context.Context, userID string) (*domain.Portfolio, error) {
+func (m *portfolioRepoFromTest) FindByIDs(ctx context.Context, ids []domain.PortfolioID) ([]*domain.Portfolio, error) {
+	result := []*domain.Portfolio{}
+	for _, id := range ids {
+		if p, exists := m.portfolios[id]; exists {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *portfolioRepoFromTest) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	var result []*domain.Portfolio
 	for _, p := range m.portfolios {
 		if p.UserID == userID {
-			return p, nil
+			result = append(result, p)
 		}
 	}
-	return nil, domain.ErrNotFound
+	return result, nil
+}
+
+func (m *portfolioRepoFromTest) FindAll(ctx context.Context) ([]*domain.Portfolio, error) {
+	result := []*domain.Portfolio{}
+	for _, p := range m.portfolios {
+		result = append(result, p)
+	}
+	return result, nil
 }
 
 func (m *portfolioRepoFromTest) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
+	for _, p := range m.portfolios {
+		if _, err := p.GetInvestment(investmentID); err == nil {
+			return p, nil
+		}
+	}
 	return nil, domain.ErrNotFound
 }
 
-func (m *portfolioRepoFromTest) Delete(ctx context.Context, id domain.PortfolioID) error {
-	delete(m.portfolios, id)
+func (m *portfolioRepoFromTest) Delete(ctx context.Context, portfolio *domain.Portfolio) error {
+	delete(m.portfolios, portfolio.ID())
 	return nil
 }
 
@@ -288,3 +462,69 @@ func (m *portfolioRepoFromTest) Update(ctx context.Context, portfolio *domain.Po
 	m.portfolios[portfolio.ID()] = portfolio
 	return nil
 }
+
+func TestInvestmentUseCase_ListInvestments(t *testing.T) {
+	ctx := context.Background()
+	investmentRepo := newMockInvestmentRepository()
+	portfolioRepo := newPortfolioRepositoryForTest()
+
+	useCase := NewInvestmentUseCase(
+		investmentRepo,
+		portfolioRepo,
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	portfolioRepo.Save(ctx, portfolio)
+
+	// 呼び出し側が指定したポートフォリオは無視し、閲覧できるものに限定する
+	query := domain.InvestmentQuery{PortfolioIDs: []domain.PortfolioID{domain.NewPortfolioID("other-portfolio")}}
+	if _, err := useCase.ListInvestments(ctx, "test-user", query); err != nil {
+		t.Fatalf("ListInvestments failed: %v", err)
+	}
+	scope := investmentRepo.lastQuery.PortfolioIDs
+	if len(scope) != 1 || scope[0] != portfolio.ID() {
+		t.Errorf("Expected the query to be limited to %s, got %v", portfolio.ID().Value, scope)
+	}
+
+	if _, err := useCase.ListPortfolioInvestments(ctx, "test-user", "test-portfolio", query); err != nil {
+		t.Fatalf("ListPortfolioInvestments failed: %v", err)
+	}
+	scope = investmentRepo.lastQuery.PortfolioIDs
+	if len(scope) != 1 || scope[0] != portfolio.ID() {
+		t.Errorf("Expected the query to be limited to %s, got %v", portfolio.ID().Value, scope)
+	}
+
+	// ポートフォリオを持たないユーザーには全件ではなく空のページを返す
+	investmentRepo.lastQuery = domain.InvestmentQuery{}
+	page, err := useCase.ListInvestments(ctx, "nobody", domain.InvestmentQuery{})
+	if err != nil {
+		t.Fatalf("ListInvestments failed: %v", err)
+	}
+	if len(page.Investments) != 0 || page.NextCursor != "" {
+		t.Errorf("Expected an empty page, got %+v", page)
+	}
+	if investmentRepo.lastQuery.Limit != 0 {
+		t.Errorf("Expected the repository not to be queried")
+	}
+
+	if _, err := useCase.ListPortfolioInvestments(ctx, "other-user", "test-portfolio", domain.InvestmentQuery{}); err == nil {
+		t.Errorf("Expected an error for another user's portfolio")
+	}
+
+	// 不正な検索条件はリポジトリに渡す前に拒否する
+	invalid := domain.InvestmentQuery{Limit: domain.MaxInvestmentPageSize + 1}
+	investmentRepo.lastQuery = domain.InvestmentQuery{}
+	if _, err := useCase.ListInvestments(ctx, "test-user", invalid); !errors.Is(err, domain.ErrInvalidInvestmentQuery) {
+		t.Errorf("Expected ErrInvalidInvestmentQuery from ListInvestments, got %v", err)
+	}
+	if _, err := useCase.ListPortfolioInvestments(ctx, "test-user", "test-portfolio", invalid); !errors.Is(err, domain.ErrInvalidInvestmentQuery) {
+		t.Errorf("Expected ErrInvalidInvestmentQuery from ListPortfolioInvestments, got %v", err)
+	}
+	if investmentRepo.lastQuery.Limit != 0 {
+		t.Errorf("Expected the repository not to be queried with an invalid query")
+	}
+}
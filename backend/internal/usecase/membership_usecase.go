@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/utils"
+	"strings"
+)
+
+type MembershipUseCase struct {
+	membershipRepo domain.MembershipRepository
+	portfolioRepo  domain.PortfolioRepository
+	userRepo       domain.UserRepository
+	txManager      domain.TransactionManager
+	access         *portfolioAccess
+}
+
+func NewMembershipUseCase(
+	membershipRepo domain.MembershipRepository,
+	portfolioRepo domain.PortfolioRepository,
+	userRepo domain.UserRepository,
+	txManager domain.TransactionManager,
+) *MembershipUseCase {
+	return &MembershipUseCase{
+		membershipRepo: membershipRepo,
+		portfolioRepo:  portfolioRepo,
+		userRepo:       userRepo,
+		txManager:      txManager,
+		access:         newPortfolioAccess(portfolioRepo, membershipRepo),
+	}
+}
+
+// InviteMember creates a pending invitation for the given email. Only users
+// allowed to manage the portfolio can invite.
+func (u *MembershipUseCase) InviteMember(
+	ctx context.Context,
+	userID string,
+	portfolioID string,
+	email string,
+	role string,
+) (*domain.PortfolioMembership, error) {
+	var invitation *domain.PortfolioMembership
+
+	err := u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionManage)
+		if err != nil {
+			return err
+		}
+
+		invitation, err = domain.NewPortfolioInvitation(
+			utils.GenerateUUID(),
+			portfolio.ID(),
+			email,
+			domain.PortfolioRole(role),
+			userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		// オーナー本人や既存メンバー（招待中を含む）は招待できない
+		owner, err := u.userRepo.FindByID(portfolio.UserID)
+		if err == nil && strings.EqualFold(owner.Email, invitation.InviteeEmail) {
+			return domain.ErrAlreadyMember
+		}
+
+		memberships, err := u.membershipRepo.FindByPortfolioID(ctx, portfolio.ID())
+		if err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			if membership.InviteeEmail == invitation.InviteeEmail {
+				return domain.ErrAlreadyMember
+			}
+		}
+
+		return u.membershipRepo.Save(ctx, invitation)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (u *MembershipUseCase) ListMembers(ctx context.Context, userID string, portfolioID string) ([]*domain.PortfolioMembership, error) {
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.membershipRepo.FindByPortfolioID(ctx, portfolio.ID())
+}
+
+// RemoveMember revokes a membership or withdraws an invitation. Managers can
+// remove anyone; other members can only remove themselves.
+func (u *MembershipUseCase) RemoveMember(ctx context.Context, userID string, portfolioID string, membershipID string) error {
+	return u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView)
+		if err != nil {
+			return err
+		}
+
+		membership, err := u.membershipRepo.FindByID(ctx, membershipID)
+		if err != nil {
+			return notFoundAs(err, domain.ErrInvitationNotFound)
+		}
+		if membership.PortfolioID != portfolio.ID() {
+			return domain.ErrInvitationNotFound
+		}
+
+		if membership.UserID != userID {
+			if err := u.access.authorize(ctx, userID, portfolio, domain.PermissionManage); err != nil {
+				return err
+			}
+		}
+
+		return u.membershipRepo.Delete(ctx, membership.ID)
+	})
+}
+
+// ListInvitations returns the pending invitations addressed to the user's email.
+func (u *MembershipUseCase) ListInvitations(ctx context.Context, userID string) ([]*domain.PortfolioMembership, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrUserNotFound)
+	}
+
+	return u.membershipRepo.FindPendingByEmail(ctx, strings.ToLower(user.Email))
+}
+
+func (u *MembershipUseCase) AcceptInvitation(ctx context.Context, userID string, invitationID string) (*domain.PortfolioMembership, error) {
+	var invitation *domain.PortfolioMembership
+
+	err := u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		invitation, err = u.findInvitation(ctx, userID, invitationID)
+		if err != nil {
+			return err
+		}
+
+		user, err := u.userRepo.FindByID(userID)
+		if err != nil {
+			return notFoundAs(err, domain.ErrUserNotFound)
+		}
+
+		if err := invitation.Accept(userID, user.Email); err != nil {
+			return err
+		}
+
+		return u.membershipRepo.Save(ctx, invitation)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (u *MembershipUseCase) DeclineInvitation(ctx context.Context, userID string, invitationID string) error {
+	return u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		invitation, err := u.findInvitation(ctx, userID, invitationID)
+		if err != nil {
+			return err
+		}
+		if invitation.Status != domain.MembershipPending {
+			return domain.ErrInvitationNotPending
+		}
+
+		return u.membershipRepo.Delete(ctx, invitation.ID)
+	})
+}
+
+// findInvitation loads an invitation addressed to the user. Invitations for
+// other emails are reported as not found.
+func (u *MembershipUseCase) findInvitation(ctx context.Context, userID string, invitationID string) (*domain.PortfolioMembership, error) {
+	invitation, err := u.membershipRepo.FindByID(ctx, invitationID)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrInvitationNotFound)
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrUserNotFound)
+	}
+
+	if !strings.EqualFold(user.Email, invitation.InviteeEmail) {
+		return nil, domain.ErrInvitationNotFound
+	}
+	return invitation, nil
+}
@@ -0,0 +1,338 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockMembershipRepository struct {
+	memberships map[string]*domain.PortfolioMembership
+}
+
+func newMockMembershipRepository() *mockMembershipRepository {
+	return &mockMembershipRepository{
+		memberships: make(map[string]*domain.PortfolioMembership),
+	}
+}
+
+func (m *mockMembershipRepository) Save(ctx context.Context, membership *domain.PortfolioMembership) error {
+	m.memberships[membership.ID] = membership
+	return nil
+}
+
+func (m *mockMembershipRepository) FindByID(ctx context.Context, id string) (*domain.PortfolioMembership, error) {
+	if membership, exists := m.memberships[id]; exists {
+		return membership, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (m *mockMembershipRepository) FindByPortfolioID(ctx context.Context, portfolioID domain.PortfolioID) ([]*domain.PortfolioMembership, error) {
+	var result []*domain.PortfolioMembership
+	for _, membership := range m.memberships {
+		if membership.PortfolioID == portfolioID {
+			result = append(result, membership)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockMembershipRepository) FindActiveByUserID(ctx context.Context, userID string) ([]*domain.PortfolioMembership, error) {
+	var result []*domain.PortfolioMembership
+	for _, membership := range m.memberships {
+		if membership.IsActive() && membership.UserID == userID {
+			result = append(result, membership)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockMembershipRepository) FindPendingByEmail(ctx context.Context, email string) ([]*domain.PortfolioMembership, error) {
+	var result []*domain.PortfolioMembership
+	for _, membership := range m.memberships {
+		if membership.Status == domain.MembershipPending && membership.InviteeEmail == email {
+			result = append(result, membership)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockMembershipRepository) Delete(ctx context.Context, id string) error {
+	delete(m.memberships, id)
+	return nil
+}
+
+type mockUserRepository struct {
+	users map[string]*domain.User
+}
+
+func newMockUserRepository(users ...*domain.User) *mockUserRepository {
+	repo := &mockUserRepository{users: make(map[string]*domain.User)}
+	for _, user := range users {
+		repo.users[user.ID] = user
+	}
+	return repo
+}
+
+func (m *mockUserRepository) Create(user *domain.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) FindByID(id string) (*domain.User, error) {
+	if user, exists := m.users[id]; exists {
+		return user, nil
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindByEmail(email string) (*domain.User, error) {
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (m *mockUserRepository) Update(user *domain.User) error {
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *mockUserRepository) Delete(id string) error {
+	delete(m.users, id)
+	return nil
+}
+
+func TestMembershipUseCase_InvitationFlow(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+	membershipRepo := newMockMembershipRepository()
+	userRepo := newMockUserRepository(
+		&domain.User{ID: "owner", Email: "owner@example.com"},
+		&domain.User{ID: "spouse", Email: "spouse@example.com"},
+		&domain.User{ID: "stranger", Email: "stranger@example.com"},
+	)
+
+	useCase := NewMembershipUseCase(membershipRepo, portfolioRepo, userRepo, &mockTransactionManager{})
+	portfolioUseCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		membershipRepo,
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("family"), "owner")
+	portfolioRepo.Save(ctx, portfolio)
+
+	// オーナー以外は招待できない
+	if _, err := useCase.InviteMember(ctx, "stranger", "family", "spouse@example.com", "VIEWER"); !errors.Is(err, domain.ErrPortfolioNotFound) {
+		t.Errorf("Expected ErrPortfolioNotFound for stranger, got %v", err)
+	}
+	if _, err := useCase.InviteMember(ctx, "owner", "family", "spouse@example.com", "ADMIN"); !errors.Is(err, domain.ErrInvalidPortfolioRole) {
+		t.Errorf("Expected ErrInvalidPortfolioRole, got %v", err)
+	}
+	// 所有者はポートフォリオに記録された一人だけ
+	if _, err := useCase.InviteMember(ctx, "owner", "family", "spouse@example.com", "OWNER"); !errors.Is(err, domain.ErrInvalidPortfolioRole) {
+		t.Errorf("Expected ErrInvalidPortfolioRole for OWNER, got %v", err)
+	}
+	if _, err := useCase.InviteMember(ctx, "owner", "family", "owner@example.com", "VIEWER"); !errors.Is(err, domain.ErrAlreadyMember) {
+		t.Errorf("Expected ErrAlreadyMember when inviting the owner, got %v", err)
+	}
+
+	invitation, err := useCase.InviteMember(ctx, "owner", "family", "Spouse@Example.com", "EDITOR")
+	if err != nil {
+		t.Fatalf("Unexpected error inviting member: %v", err)
+	}
+	if _, err := useCase.InviteMember(ctx, "owner", "family", "spouse@example.com", "VIEWER"); !errors.Is(err, domain.ErrAlreadyMember) {
+		t.Errorf("Expected ErrAlreadyMember for duplicate invitation, got %v", err)
+	}
+
+	// 承認前はアクセスできない
+	if _, err := portfolioUseCase.GetPortfolio(ctx, "spouse", "family"); !errors.Is(err, domain.ErrPortfolioNotFound) {
+		t.Errorf("Expected ErrPortfolioNotFound before acceptance, got %v", err)
+	}
+
+	invitations, err := useCase.ListInvitations(ctx, "spouse")
+	if err != nil {
+		t.Fatalf("Unexpected error listing invitations: %v", err)
+	}
+	if len(invitations) != 1 || invitations[0].ID != invitation.ID {
+		t.Fatalf("Expected the pending invitation, got %v", invitations)
+	}
+
+	// 宛先以外のユーザーは承認できない
+	if _, err := useCase.AcceptInvitation(ctx, "stranger", invitation.ID); !errors.Is(err, domain.ErrInvitationNotFound) {
+		t.Errorf("Expected ErrInvitationNotFound for stranger, got %v", err)
+	}
+
+	membership, err := useCase.AcceptInvitation(ctx, "spouse", invitation.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error accepting invitation: %v", err)
+	}
+	if !membership.IsActive() || membership.UserID != "spouse" {
+		t.Errorf("Expected active membership for spouse, got %+v", membership)
+	}
+	if _, err := useCase.AcceptInvitation(ctx, "spouse", invitation.ID); !errors.Is(err, domain.ErrInvitationNotPending) {
+		t.Errorf("Expected ErrInvitationNotPending, got %v", err)
+	}
+
+	portfolios, err := portfolioUseCase.ListUserPortfolios(ctx, "spouse")
+	if err != nil {
+		t.Fatalf("Unexpected error listing portfolios: %v", err)
+	}
+	if len(portfolios) != 1 || portfolios[0].ID() != portfolio.ID() {
+		t.Errorf("Expected shared portfolio in list, got %v", portfolios)
+	}
+
+	// 編集者はメンバーを削除できないが、自分自身は脱退できる
+	if _, err := useCase.InviteMember(ctx, "owner", "family", "stranger@example.com", "VIEWER"); err != nil {
+		t.Fatalf("Unexpected error inviting member: %v", err)
+	}
+	members, err := useCase.ListMembers(ctx, "spouse", "family")
+	if err != nil {
+		t.Fatalf("Unexpected error listing members: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 memberships, got %d", len(members))
+	}
+	for _, member := range members {
+		if member.ID == membership.ID {
+			continue
+		}
+		if err := useCase.RemoveMember(ctx, "spouse", "family", member.ID); !errors.Is(err, domain.ErrForbidden) {
+			t.Errorf("Expected ErrForbidden when editor removes another member, got %v", err)
+		}
+		if err := useCase.DeclineInvitation(ctx, "stranger", member.ID); err != nil {
+			t.Errorf("Unexpected error declining invitation: %v", err)
+		}
+	}
+
+	if err := useCase.RemoveMember(ctx, "spouse", "family", membership.ID); err != nil {
+		t.Fatalf("Unexpected error leaving portfolio: %v", err)
+	}
+	if _, err := portfolioUseCase.GetPortfolio(ctx, "spouse", "family"); !errors.Is(err, domain.ErrPortfolioNotFound) {
+		t.Errorf("Expected ErrPortfolioNotFound after leaving, got %v", err)
+	}
+}
+
+func TestPortfolioAccess_RoleMatrix(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+	membershipRepo := newMockMembershipRepository()
+	investmentRepo := newMockInvestmentRepository()
+
+	portfolioUseCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		membershipRepo,
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+	investmentUseCase := NewInvestmentUseCase(
+		investmentRepo,
+		portfolioRepo,
+		membershipRepo,
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("family"), "owner")
+	deposit, _ := domain.NewMoney(5000000, "JPY")
+	depositTx, _ := domain.NewCashTransaction("deposit", domain.CashDeposit, deposit, domain.InvestmentID{})
+	portfolio.RecordCashTransaction(depositTx)
+	portfolioRepo.Save(ctx, portfolio)
+
+	now := time.Now()
+	for _, role := range []domain.PortfolioRole{domain.RoleEditor, domain.RoleViewer, domain.RoleAdvisor} {
+		userID := strings.ToLower(string(role))
+		membershipRepo.Save(ctx, &domain.PortfolioMembership{
+			ID:           "membership-" + userID,
+			PortfolioID:  portfolio.ID(),
+			InviteeEmail: userID + "@example.com",
+			UserID:       userID,
+			Role:         role,
+			Status:       domain.MembershipActive,
+			InvitedBy:    "owner",
+			CreatedAt:    now,
+			AcceptedAt:   &now,
+		})
+	}
+
+	actions := []struct {
+		name string
+		run  func(userID string) error
+	}{
+		{"view", func(userID string) error {
+			_, err := portfolioUseCase.GetPortfolio(ctx, userID, "family")
+			return err
+		}},
+		{"analyze", func(userID string) error {
+			_, err := portfolioUseCase.GetPortfolioAnalysis(ctx, userID, "family")
+			return err
+		}},
+		{"trade", func(userID string) error {
+			_, _, err := investmentUseCase.CreateInvestment(ctx, userID, "family", 10000, "JPY", "STOCK", "CONSERVATIVE")
+			return err
+		}},
+		{"manage cash", func(userID string) error {
+			_, err := portfolioUseCase.DepositCash(ctx, userID, "family", 1000, "JPY")
+			return err
+		}},
+		{"manage", func(userID string) error {
+			_, err := portfolioUseCase.RenamePortfolio(ctx, userID, "family", "Family "+userID)
+			return err
+		}},
+	}
+
+	tests := []struct {
+		userID   string
+		expected map[string]error
+	}{
+		{"owner", map[string]error{}},
+		{"editor", map[string]error{"manage": domain.ErrForbidden}},
+		{"advisor", map[string]error{
+			"trade":       domain.ErrForbidden,
+			"manage cash": domain.ErrForbidden,
+			"manage":      domain.ErrForbidden,
+		}},
+		{"viewer", map[string]error{
+			"analyze":     domain.ErrForbidden,
+			"trade":       domain.ErrForbidden,
+			"manage cash": domain.ErrForbidden,
+			"manage":      domain.ErrForbidden,
+		}},
+		{"stranger", map[string]error{
+			"view":        domain.ErrPortfolioNotFound,
+			"analyze":     domain.ErrPortfolioNotFound,
+			"trade":       domain.ErrPortfolioNotFound,
+			"manage cash": domain.ErrPortfolioNotFound,
+			"manage":      domain.ErrPortfolioNotFound,
+		}},
+	}
+
+	for _, tt := range tests {
+		for _, action := range actions {
+			t.Run(tt.userID+"/"+action.name, func(t *testing.T) {
+				err := action.run(tt.userID)
+				expected := tt.expected[action.name]
+				if expected == nil && err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				if expected != nil && !errors.Is(err, expected) {
+					t.Errorf("Expected %v, got %v", expected, err)
+				}
+			})
+		}
+	}
+}
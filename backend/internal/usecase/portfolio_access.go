@@ -0,0 +1,189 @@
+package usecase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"moneyget/internal/domain"
+)
+
+// portfolioAccess resolves what a user may do with a portfolio. The owner
+// recorded on the portfolio always has RoleOwner; everyone else needs an
+// active membership. Users without any relationship to the portfolio get
+// domain.ErrPortfolioNotFound so that its existence is not revealed, while
+// members lacking the required permission get domain.ErrForbidden.
+type portfolioAccess struct {
+	portfolioRepo  domain.PortfolioRepository
+	membershipRepo domain.MembershipRepository
+}
+
+func newPortfolioAccess(portfolioRepo domain.PortfolioRepository, membershipRepo domain.MembershipRepository) *portfolioAccess {
+	return &portfolioAccess{
+		portfolioRepo:  portfolioRepo,
+		membershipRepo: membershipRepo,
+	}
+}
+
+// role returns the user's role on the portfolio, or false if the user has no access.
+func (a *portfolioAccess) role(ctx context.Context, userID string, portfolio *domain.Portfolio) (domain.PortfolioRole, bool, error) {
+	if userID == "" {
+		return "", false, nil
+	}
+	if portfolio.UserID == userID {
+		return domain.RoleOwner, true, nil
+	}
+
+	memberships, err := a.membershipRepo.FindByPortfolioID(ctx, portfolio.ID())
+	if err != nil {
+		return "", false, err
+	}
+	for _, membership := range memberships {
+		if membership.IsActive() && membership.UserID == userID {
+			return membership.Role, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+func (a *portfolioAccess) authorize(
+	ctx context.Context,
+	userID string,
+	portfolio *domain.Portfolio,
+	permission domain.PortfolioPermission,
+) error {
+	role, ok, err := a.role(ctx, userID, portfolio)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return domain.ErrPortfolioNotFound
+	}
+	if !role.Can(permission) {
+		return domain.ErrForbidden
+	}
+	return nil
+}
+
+// load fetches a portfolio and checks the permission and any version the
+// caller expects. An empty portfolioID selects the user's default portfolio,
+// which the user always owns.
+func (a *portfolioAccess) load(
+	ctx context.Context,
+	userID string,
+	portfolioID string,
+	permission domain.PortfolioPermission,
+) (*domain.Portfolio, error) {
+	if portfolioID == "" {
+		portfolio, err := findDefaultPortfolio(ctx, a.portfolioRepo, userID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkExpectedVersion(ctx, portfolio); err != nil {
+			return nil, err
+		}
+		return portfolio, nil
+	}
+
+	portfolio, err := a.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(portfolioID))
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrPortfolioNotFound)
+	}
+
+	if err := a.authorize(ctx, userID, portfolio, permission); err != nil {
+		return nil, err
+	}
+	if err := checkExpectedVersion(ctx, portfolio); err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+// loadByInvestmentID fetches the portfolio holding the investment and checks the permission.
+func (a *portfolioAccess) loadByInvestmentID(
+	ctx context.Context,
+	userID string,
+	investmentID string,
+	permission domain.PortfolioPermission,
+) (*domain.Portfolio, error) {
+	portfolio, err := a.portfolioRepo.FindByInvestmentID(ctx, domain.NewInvestmentID(investmentID))
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrInvestmentNotFound)
+	}
+
+	if err := a.authorize(ctx, userID, portfolio, permission); err != nil {
+		if errors.Is(err, domain.ErrPortfolioNotFound) {
+			return nil, domain.ErrInvestmentNotFound
+		}
+		return nil, err
+	}
+	if err := checkExpectedVersion(ctx, portfolio); err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+// listAccessible returns the user's own portfolios followed by those shared with them.
+func (a *portfolioAccess) listAccessible(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	portfolios, err := a.portfolioRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := a.membershipRepo.FindActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(memberships) == 0 {
+		return portfolios, nil
+	}
+
+	// 共有されたポートフォリオはまとめて読み込む。削除済みのものは含まれない
+	ids := make([]domain.PortfolioID, len(memberships))
+	for i, membership := range memberships {
+		ids[i] = membership.PortfolioID
+	}
+	shared, err := a.portfolioRepo.FindByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(portfolios, shared...), nil
+}
+
+// findDefaultPortfolio returns the user's oldest portfolio that is not archived.
+func findDefaultPortfolio(ctx context.Context, repo domain.PortfolioRepository, userID string) (*domain.Portfolio, error) {
+	portfolios, err := repo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaultPortfolio *domain.Portfolio
+	for _, portfolio := range portfolios {
+		if portfolio.IsArchived() {
+			continue
+		}
+		if defaultPortfolio == nil || portfolio.CreatedAt.Before(defaultPortfolio.CreatedAt) {
+			defaultPortfolio = portfolio
+		}
+	}
+
+	if defaultPortfolio == nil {
+		return nil, domain.ErrPortfolioNotFound
+	}
+	return defaultPortfolio, nil
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) ||
+		errors.Is(err, domain.ErrNotFound) ||
+		errors.Is(err, domain.ErrPortfolioNotFound)
+}
+
+// notFoundAs replaces repository-level "no rows" errors with the given domain error.
+func notFoundAs(err error, notFound error) error {
+	if isNotFound(err) {
+		return notFound
+	}
+	return err
+}
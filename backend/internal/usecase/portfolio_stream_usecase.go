@@ -0,0 +1,171 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+)
+
+// ストリームで送るメッセージの種類
+const (
+	StreamPortfolioChanged = "portfolio-changed"
+	StreamValuationChanged = "valuation-changed"
+	StreamAlert            = "alert"
+)
+
+// StreamFromLatest opens a stream without replaying stored events.
+const StreamFromLatest = -1
+
+// StreamMessage is a message of a portfolio stream: a stored event, or an
+// alert about the state of the portfolio when Kind is StreamAlert.
+type StreamMessage struct {
+	Kind  string
+	Event *service.StoredEvent
+	Alert *domain.DomainError
+}
+
+type PortfolioStreamUseCase struct {
+	access *portfolioAccess
+	events service.EventStoreDB
+	hub    *service.StreamHub
+}
+
+func NewPortfolioStreamUseCase(
+	portfolioRepo domain.PortfolioRepository,
+	membershipRepo domain.MembershipRepository,
+	events service.EventStoreDB,
+	hub *service.StreamHub,
+) *PortfolioStreamUseCase {
+	return &PortfolioStreamUseCase{
+		access: newPortfolioAccess(portfolioRepo, membershipRepo),
+		events: events,
+		hub:    hub,
+	}
+}
+
+// PortfolioStream follows the events of one portfolio for one user. Call
+// Next once after opening and again whenever Changed signals, until Ended.
+type PortfolioStream struct {
+	usecase      *PortfolioStreamUseCase
+	userID       string
+	portfolioID  string
+	watcher      *service.StreamWatcher
+	lastSequence int
+	alert        *domain.DomainError // 最後に知らせたアラート
+	ended        bool
+}
+
+// OpenStream checks that the user may view the portfolio and starts
+// following it after afterSequence, the ID of the last event the client
+// received, or from now with StreamFromLatest.
+func (u *PortfolioStreamUseCase) OpenStream(ctx context.Context, userID string, portfolioID string, afterSequence int) (*PortfolioStream, error) {
+	if _, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView); err != nil {
+		return nil, err
+	}
+
+	// 読み込みとの間に起きた変更を逃さないよう、先に監視を始める
+	watcher := u.hub.Watch(domain.AggregatePortfolio, portfolioID)
+
+	if afterSequence == StreamFromLatest {
+		sequence, err := u.events.LastSequence(ctx, domain.AggregatePortfolio, portfolioID)
+		if err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		afterSequence = sequence
+	}
+
+	return &PortfolioStream{
+		usecase:      u,
+		userID:       userID,
+		portfolioID:  portfolioID,
+		watcher:      watcher,
+		lastSequence: afterSequence,
+	}, nil
+}
+
+// Next returns the events stored since the last call, followed by an alert
+// when the portfolio newly breaks a rule. Once the user lost access or the
+// portfolio was deleted, the stream ends.
+func (s *PortfolioStream) Next(ctx context.Context) ([]StreamMessage, error) {
+	if s.ended {
+		return nil, nil
+	}
+
+	// 閲覧できなくなった後のイベントは送らない
+	portfolio, err := s.usecase.access.load(ctx, s.userID, s.portfolioID, domain.PermissionView)
+	if errors.Is(err, domain.ErrPortfolioNotFound) || errors.Is(err, domain.ErrForbidden) {
+		s.ended = true
+		return s.deletion(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.usecase.events.ReadStream(ctx, domain.AggregatePortfolio, s.portfolioID, s.lastSequence)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]StreamMessage, 0, len(stored)+1)
+	for i := range stored {
+		messages = append(messages, StreamMessage{Kind: streamKind(stored[i].EventType), Event: &stored[i]})
+		s.lastSequence = stored[i].Sequence
+	}
+
+	var alert *domain.DomainError
+	if err := portfolio.ValidateRiskDistribution(); err != nil && !errors.As(err, &alert) {
+		return nil, err
+	}
+	if alert != nil && alert != s.alert {
+		messages = append(messages, StreamMessage{Kind: StreamAlert, Alert: alert})
+	}
+	s.alert = alert
+
+	return messages, nil
+}
+
+// deletion returns the deletion of the portfolio if that is what made it
+// disappear, so that the client learns why the stream ends.
+func (s *PortfolioStream) deletion(ctx context.Context) ([]StreamMessage, error) {
+	stored, err := s.usecase.events.ReadStream(ctx, domain.AggregatePortfolio, s.portfolioID, s.lastSequence)
+	if err != nil || len(stored) == 0 {
+		return nil, err
+	}
+
+	last := stored[len(stored)-1]
+	if last.EventType != "PortfolioDeleted" {
+		return nil, nil
+	}
+	s.lastSequence = last.Sequence
+	return []StreamMessage{{Kind: StreamPortfolioChanged, Event: &last}}, nil
+}
+
+// Changed receives a value when the portfolio may have changed.
+func (s *PortfolioStream) Changed() <-chan struct{} {
+	return s.watcher.Changed()
+}
+
+// Done is closed when the stream is closed, e.g. on shutdown.
+func (s *PortfolioStream) Done() <-chan struct{} {
+	return s.watcher.Done()
+}
+
+// Ended reports whether Next will not return anything anymore.
+func (s *PortfolioStream) Ended() bool {
+	return s.ended
+}
+
+func (s *PortfolioStream) Close() {
+	s.watcher.Close()
+}
+
+// streamKind returns the kind of message an event is sent as. Valuations are
+// notified separately, since clients only need to refresh the amounts.
+func streamKind(eventType string) string {
+	if eventType == "PortfolioUpdated" {
+		return StreamValuationChanged
+	}
+	return StreamPortfolioChanged
+}
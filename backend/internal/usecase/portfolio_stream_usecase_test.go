@@ -0,0 +1,191 @@
+package usecase
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
+	"testing"
+	"time"
+)
+
+func TestPortfolioStreamUseCase(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+	txManager := memory.NewTransactionManager(db)
+	eventStoreDB := memory.NewEventStoreDB(db)
+	outbox := service.NewOutbox(eventStoreDB, memory.NewOutboxStoreDB(db))
+	strategyService := service.NewInvestmentStrategyService()
+	hub := service.NewStreamHub()
+
+	portfolios := NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, txManager, outbox, strategyService)
+	investments := NewInvestmentUseCase(investmentRepo, portfolioRepo, membershipRepo, txManager, outbox, strategyService)
+	streams := NewPortfolioStreamUseCase(portfolioRepo, membershipRepo, eventStoreDB, hub)
+
+	// アグレッシブ投資は比率の上限内で保有している
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "owner")
+	id := portfolio.ID().Value
+	conservative := seedInvestment(t, investmentRepo, portfolio, "conservative", 500000, domain.Conservative)
+	seedInvestment(t, investmentRepo, portfolio, "aggressive", 200000, domain.Aggressive)
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := portfolios.DepositCash(ctx, "owner", id, 1000000, "JPY"); err != nil {
+		t.Fatalf("DepositCash failed: %v", err)
+	}
+
+	if _, err := streams.OpenStream(ctx, "intruder", id, StreamFromLatest); err != domain.ErrPortfolioNotFound {
+		t.Errorf("Expected ErrPortfolioNotFound for another user, got %v", err)
+	}
+
+	stream, err := streams.OpenStream(ctx, "owner", id, StreamFromLatest)
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	// 開く前のイベントは送らない
+	messages, err := stream.Next(ctx)
+	if err != nil || len(messages) != 0 {
+		t.Fatalf("Expected no messages from the latest event, got %+v, %v", messages, err)
+	}
+
+	if _, err := portfolios.WithdrawCash(ctx, "owner", id, 1000, "JPY"); err != nil {
+		t.Fatalf("WithdrawCash failed: %v", err)
+	}
+	messages, err = stream.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if len(messages) == 0 {
+		t.Fatal("Expected the new events")
+	}
+	for _, message := range messages {
+		if message.Event == nil || message.Event.EventType != "CashTransactionRecorded" && message.Kind != StreamValuationChanged {
+			t.Errorf("Expected the withdrawal, got %+v", message)
+		}
+	}
+
+	// 保守的な投資を売るとアグレッシブ投資の比率が上限を超える
+	if err := investments.SellInvestment(ctx, "owner", conservative); err != nil {
+		t.Fatalf("SellInvestment failed: %v", err)
+	}
+	messages, err = stream.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	kinds := make(map[string]int)
+	for _, message := range messages {
+		kinds[message.Kind]++
+	}
+	if kinds[StreamValuationChanged] != 1 || kinds[StreamAlert] != 1 {
+		t.Errorf("Expected a valuation change and an alert, got %v", kinds)
+	}
+	if last := messages[len(messages)-1]; last.Kind != StreamAlert || last.Alert != domain.ErrAggressiveInvestmentLimitExceeded {
+		t.Errorf("Expected the alert last, got %+v", last)
+	}
+
+	// 同じアラートは繰り返さない
+	if _, err := portfolios.RenamePortfolio(ctx, "owner", id, "Risky"); err != nil {
+		t.Fatalf("RenamePortfolio failed: %v", err)
+	}
+	messages, err = stream.Next(ctx)
+	if err != nil || len(messages) != 1 || messages[0].Event.EventType != "PortfolioRenamed" {
+		t.Errorf("Expected only the rename, got %+v, %v", messages, err)
+	}
+
+	// Last-Event-IDからの再開では、その後のイベントをすべて送る
+	resumed, err := streams.OpenStream(ctx, "owner", id, 2)
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	defer resumed.Close()
+	messages, err = resumed.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next failed: %v", err)
+	}
+	if len(messages) < 2 || messages[0].Event == nil || messages[0].Event.Sequence != 3 {
+		t.Fatalf("Expected the events after sequence 2, got %+v", messages)
+	}
+	for i := 1; i < len(messages)-1; i++ {
+		if messages[i].Event.Sequence != messages[i-1].Event.Sequence+1 {
+			t.Errorf("Expected the events in order, got %d after %d", messages[i].Event.Sequence, messages[i-1].Event.Sequence)
+		}
+	}
+
+	// ハブの通知で変更を知る
+	if err := hub.Publish(domain.NewPortfolioUpdatedEvent(portfolio.ID(), domain.Money{Currency: "JPY"}, time.Now())); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	select {
+	case <-stream.Changed():
+	default:
+		t.Error("Expected the stream to be signalled")
+	}
+}
+
+// seedInvestment stores an investment and adds it to the portfolio without the
+// checks of the use cases, and returns its ID.
+func seedInvestment(t *testing.T, repo domain.InvestmentRepository, portfolio *domain.Portfolio, id string, amount float64, strategy domain.InvestmentStrategy) string {
+	t.Helper()
+
+	money, _ := domain.NewMoney(amount, "JPY")
+	investment, err := domain.NewInvestment(domain.NewInvestmentID(id), money, domain.Stock, strategy)
+	if err != nil {
+		t.Fatalf("NewInvestment failed: %v", err)
+	}
+	if err := repo.Create(context.Background(), investment); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := portfolio.AddInvestment(investment); err != nil {
+		t.Fatalf("AddInvestment failed: %v", err)
+	}
+	return id
+}
+
+func TestPortfolioStreamUseCase_Deletion(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+	eventStoreDB := memory.NewEventStoreDB(db)
+	outbox := service.NewOutbox(eventStoreDB, memory.NewOutboxStoreDB(db))
+
+	portfolios := NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, memory.NewTransactionManager(db), outbox, service.NewInvestmentStrategyService())
+	streams := NewPortfolioStreamUseCase(portfolioRepo, membershipRepo, eventStoreDB, service.NewStreamHub())
+
+	if _, err := portfolios.CreatePortfolio(ctx, "owner", "Main"); err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	portfolio, err := portfolios.CreatePortfolio(ctx, "owner", "Spare")
+	if err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	id := portfolio.ID().Value
+
+	stream, err := streams.OpenStream(ctx, "owner", id, StreamFromLatest)
+	if err != nil {
+		t.Fatalf("OpenStream failed: %v", err)
+	}
+	defer stream.Close()
+
+	if err := portfolios.DeletePortfolio(ctx, "owner", id); err != nil {
+		t.Fatalf("DeletePortfolio failed: %v", err)
+	}
+
+	// 削除を伝えてからストリームを終える
+	messages, err := stream.Next(ctx)
+	if err != nil || len(messages) != 1 || messages[0].Event.EventType != "PortfolioDeleted" {
+		t.Fatalf("Expected the deletion, got %+v, %v", messages, err)
+	}
+	if !stream.Ended() {
+		t.Error("Expected the stream to end")
+	}
+	if messages, err := stream.Next(ctx); err != nil || len(messages) != 0 {
+		t.Errorf("Expected nothing after the end, got %+v, %v", messages, err)
+	}
+}
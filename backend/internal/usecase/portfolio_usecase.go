@@ -5,26 +5,37 @@ import (
 	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
 	"moneyget/internal/utils"
+	"sort"
+	"strings"
+	"time"
 )
 
 type PortfolioUseCase struct {
 	portfolioRepo   domain.PortfolioRepository
+	investmentRepo  domain.InvestmentRepository
 	txManager       domain.TransactionManager
-	eventPublisher  domain.DomainEventPublisher
+	outbox          domain.EventOutbox
 	strategyService *service.InvestmentStrategyService
+	access          *portfolioAccess
+	retryPolicy     RetryPolicy
 }
 
 func NewPortfolioUseCase(
 	portfolioRepo domain.PortfolioRepository,
+	investmentRepo domain.InvestmentRepository,
+	membershipRepo domain.MembershipRepository,
 	txManager domain.TransactionManager,
-	eventPublisher domain.DomainEventPublisher,
+	outbox domain.EventOutbox,
 	strategyService *service.InvestmentStrategyService,
 ) *PortfolioUseCase {
 	return &PortfolioUseCase{
 		portfolioRepo:   portfolioRepo,
+		investmentRepo:  investmentRepo,
 		txManager:       txManager,
-		eventPublisher:  eventPublisher,
+		outbox:          outbox,
 		strategyService: strategyService,
+		access:          newPortfolioAccess(portfolioRepo, membershipRepo),
+		retryPolicy:     DefaultRetryPolicy,
 	}
 }
 
@@ -36,8 +47,8 @@ type PortfolioAnalysis struct {
 	Suggestions        []service.RebalancingSuggestion
 }
 
-func (u *PortfolioUseCase) GetPortfolioAnalysis(ctx context.Context, id string) (*PortfolioAnalysis, error) {
-	portfolio, err := u.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(id))
+func (u *PortfolioUseCase) GetPortfolioAnalysis(ctx context.Context, userID string, id string) (*PortfolioAnalysis, error) {
+	portfolio, err := u.access.load(ctx, userID, id, domain.PermissionAnalyze)
 	if err != nil {
 		return nil, err
 	}
@@ -63,41 +74,54 @@ func (u *PortfolioUseCase) GetPortfolioAnalysis(ctx context.Context, id string)
 	}, nil
 }
 
-func (u *PortfolioUseCase) RebalancePortfolio(ctx context.Context, id string, changes map[domain.InvestmentID]domain.Money) error {
-	return u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
-		portfolio, err := u.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(id))
+func (u *PortfolioUseCase) RebalancePortfolio(ctx context.Context, userID string, id string, changes map[domain.InvestmentID]domain.Money) (*domain.Portfolio, error) {
+	var rebalanced *domain.Portfolio
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.load(ctx, userID, id, domain.PermissionTrade)
 		if err != nil {
 			return err
 		}
 
-		for investmentID, newAmount := range changes {
+		if err := portfolio.Rebalance(changes); err != nil {
+			return err
+		}
+
+		// 再配分後の検証
+		if err := portfolio.ValidateRiskDistribution(); err != nil {
+			return err
+		}
+
+		for investmentID := range changes {
 			investment, err := portfolio.GetInvestment(investmentID)
 			if err != nil {
 				return err
 			}
-
-			if err := investment.UpdateAmount(newAmount); err != nil {
+			if err := u.investmentRepo.Save(ctx, investment); err != nil {
 				return err
 			}
 		}
 
-		// 再配分後の検証
-		if err := portfolio.ValidateRiskDistribution(); err != nil {
-			return err
-		}
-
 		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
 			return err
 		}
 
-		event := domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount())
-		return u.eventPublisher.Publish(event)
+		rebalanced = portfolio
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rebalanced, nil
 }
 
 func (u *PortfolioUseCase) calculateStrategyAllocation(portfolio *domain.Portfolio) map[domain.InvestmentStrategy]float64 {
 	allocation := make(map[domain.InvestmentStrategy]float64)
-	totalAmount := portfolio.CalculateTotalAmount()
+	totalAmount := portfolio.CalculateInvestedAmount()
 
 	if totalAmount.Amount == 0 {
 		return allocation
@@ -112,17 +136,89 @@ func (u *PortfolioUseCase) calculateStrategyAllocation(portfolio *domain.Portfol
 	return allocation
 }
 
-func (u *PortfolioUseCase) CreatePortfolio(ctx context.Context, userID string) (*domain.Portfolio, error) {
+func (u *PortfolioUseCase) CreatePortfolio(ctx context.Context, userID string, name string) (*domain.Portfolio, error) {
 	portfolio := domain.NewPortfolio(domain.NewPortfolioID(utils.GenerateUUID()), userID)
+	if name != "" {
+		if err := portfolio.Rename(name); err != nil {
+			return nil, err
+		}
+	}
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		if err := u.ensureUniqueName(ctx, userID, portfolio); err != nil {
+			return err
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+func (u *PortfolioUseCase) RenamePortfolio(ctx context.Context, userID string, portfolioID string, name string) (*domain.Portfolio, error) {
+	var portfolio *domain.Portfolio
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		var err error
+		portfolio, err = u.access.load(ctx, userID, portfolioID, domain.PermissionManage)
+		if err != nil {
+			return err
+		}
+
+		if err := portfolio.Rename(name); err != nil {
+			return err
+		}
+
+		if err := u.ensureUniqueName(ctx, portfolio.UserID, portfolio); err != nil {
+			return err
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, portfolio.Events()...)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+func (u *PortfolioUseCase) ArchivePortfolio(ctx context.Context, userID string, portfolioID string) (*domain.Portfolio, error) {
+	var portfolio *domain.Portfolio
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		var err error
+		portfolio, err = u.access.load(ctx, userID, portfolioID, domain.PermissionManage)
+		if err != nil {
+			return err
+		}
+
+		if err := portfolio.Archive(); err != nil {
+			return err
+		}
 
-	err := u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
 		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
 			return err
 		}
 
-		totalAmount, _ := domain.NewMoney(0, "JPY")
-		event := domain.NewPortfolioUpdatedEvent(portfolio.ID(), totalAmount)
-		return u.eventPublisher.Publish(event)
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, portfolio.Events()...)
 	})
 
 	if err != nil {
@@ -132,16 +228,121 @@ func (u *PortfolioUseCase) CreatePortfolio(ctx context.Context, userID string) (
 	return portfolio, nil
 }
 
-func (u *PortfolioUseCase) GetPortfolio(ctx context.Context, id string) (*domain.Portfolio, error) {
-	return u.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(id))
+// DeletePortfolio removes an empty portfolio together with its cash ledger
+// and memberships. Investments have to be sold first.
+func (u *PortfolioUseCase) DeletePortfolio(ctx context.Context, userID string, portfolioID string) error {
+	return runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionManage)
+		if err != nil {
+			return err
+		}
+
+		if err := portfolio.Delete(); err != nil {
+			return err
+		}
+
+		// 現金台帳と共有メンバーはリポジトリがまとめて削除する
+		if err := u.portfolioRepo.Delete(ctx, portfolio); err != nil {
+			return err
+		}
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, portfolio.Events()...)
+	})
+}
+
+// ensureUniqueName rejects a name already used by another portfolio of the same owner.
+func (u *PortfolioUseCase) ensureUniqueName(ctx context.Context, ownerID string, portfolio *domain.Portfolio) error {
+	portfolios, err := u.portfolioRepo.FindByUserID(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range portfolios {
+		if other.ID() != portfolio.ID() && strings.EqualFold(other.Name, portfolio.Name) {
+			return domain.ErrDuplicatePortfolioName
+		}
+	}
+	return nil
+}
+
+func (u *PortfolioUseCase) GetPortfolio(ctx context.Context, userID string, id string) (*domain.Portfolio, error) {
+	return u.access.load(ctx, userID, id, domain.PermissionView)
 }
 
+// GetUserPortfolio returns the user's default portfolio.
 func (u *PortfolioUseCase) GetUserPortfolio(ctx context.Context, userID string) (*domain.Portfolio, error) {
-	return u.portfolioRepo.FindByUserID(ctx, userID)
+	return findDefaultPortfolio(ctx, u.portfolioRepo, userID)
+}
+
+// ListUserPortfolios returns every portfolio the user owns, including archived
+// ones, followed by the portfolios shared with the user.
+func (u *PortfolioUseCase) ListUserPortfolios(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	return u.access.listAccessible(ctx, userID)
+}
+
+// DepositCash credits cash to one of the user's portfolios (the default one
+// when portfolioID is empty) and returns the new balance of that currency.
+func (u *PortfolioUseCase) DepositCash(ctx context.Context, userID string, portfolioID string, amount float64, currency string) (domain.Money, error) {
+	return u.recordCashTransaction(ctx, userID, portfolioID, domain.CashDeposit, amount, currency)
+}
+
+// WithdrawCash debits cash from one of the user's portfolios and returns the
+// new balance of that currency. It fails with domain.ErrInsufficientFunds when
+// the balance does not cover the amount.
+func (u *PortfolioUseCase) WithdrawCash(ctx context.Context, userID string, portfolioID string, amount float64, currency string) (domain.Money, error) {
+	return u.recordCashTransaction(ctx, userID, portfolioID, domain.CashWithdrawal, amount, currency)
+}
+
+func (u *PortfolioUseCase) recordCashTransaction(
+	ctx context.Context,
+	userID string,
+	portfolioID string,
+	typeVal domain.CashTransactionType,
+	amount float64,
+	currency string,
+) (domain.Money, error) {
+	var balance domain.Money
+
+	err := runWithRetry(ctx, u.txManager, u.retryPolicy, func(ctx context.Context) error {
+		portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionManageCash)
+		if err != nil {
+			return err
+		}
+
+		money, err := domain.NewMoney(amount, currency)
+		if err != nil {
+			return err
+		}
+
+		tx, err := domain.NewCashTransaction(utils.GenerateUUID(), typeVal, money, domain.InvestmentID{})
+		if err != nil {
+			return err
+		}
+		if err := portfolio.RecordCashTransaction(tx); err != nil {
+			return err
+		}
+
+		if err := u.portfolioRepo.Save(ctx, portfolio); err != nil {
+			return err
+		}
+
+		balance = portfolio.CashBalance(currency)
+		events := append(portfolio.Events(), domain.NewPortfolioUpdatedEvent(portfolio.ID(), portfolio.CalculateTotalAmount(), time.Now()))
+
+		// 集約と同じトランザクションでアウトボックスに書き込む
+		return u.outbox.Add(ctx, events...)
+	})
+
+	if err != nil {
+		return domain.Money{}, err
+	}
+
+	return balance, nil
 }
 
-func (u *PortfolioUseCase) ValidatePortfolio(ctx context.Context, portfolioID string) error {
-	portfolio, err := u.portfolioRepo.FindByID(ctx, domain.NewPortfolioID(portfolioID))
+func (u *PortfolioUseCase) ValidatePortfolio(ctx context.Context, userID string, portfolioID string) error {
+	portfolio, err := u.access.load(ctx, userID, portfolioID, domain.PermissionView)
 	if err != nil {
 		return err
 	}
@@ -149,6 +350,105 @@ func (u *PortfolioUseCase) ValidatePortfolio(ctx context.Context, portfolioID st
 	return portfolio.ValidateRiskDistribution()
 }
 
+// PortfolioSummary is one line of the household view.
+type PortfolioSummary struct {
+	ID             string
+	Name           string
+	InvestedAmount domain.Money
+	CashBalances   []domain.Money
+	TotalAmount    domain.Money
+	RiskScore      float64
+}
+
+// HouseholdView aggregates all active portfolios of a user. Amounts are summed
+// per currency without conversion; allocation and risk are weighted by the
+// invested amount of each portfolio, like the single-portfolio analysis.
+type HouseholdView struct {
+	Portfolios         []PortfolioSummary
+	TotalAmounts       []domain.Money
+	CashBalances       []domain.Money
+	InvestedAmount     float64
+	RiskScore          float64
+	StrategyAllocation map[domain.InvestmentStrategy]float64
+}
+
+func (u *PortfolioUseCase) GetHouseholdView(ctx context.Context, userID string) (*HouseholdView, error) {
+	portfolios, err := u.portfolioRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &HouseholdView{
+		Portfolios:         make([]PortfolioSummary, 0, len(portfolios)),
+		StrategyAllocation: make(map[domain.InvestmentStrategy]float64),
+	}
+	totals := make(map[string]float64)
+	cash := make(map[string]float64)
+	strategyAmounts := make(map[domain.InvestmentStrategy]float64)
+	var weightedRisk float64
+
+	for _, portfolio := range portfolios {
+		if portfolio.IsArchived() {
+			continue
+		}
+
+		riskScore, err := u.strategyService.CalculateRiskScore(portfolio)
+		if err != nil {
+			return nil, err
+		}
+
+		invested := portfolio.CalculateInvestedAmount()
+		balances := portfolio.CashBalances()
+
+		view.Portfolios = append(view.Portfolios, PortfolioSummary{
+			ID:             portfolio.ID().Value,
+			Name:           portfolio.Name,
+			InvestedAmount: invested,
+			CashBalances:   balances,
+			TotalAmount:    portfolio.CalculateTotalAmount(),
+			RiskScore:      riskScore,
+		})
+
+		for _, investment := range portfolio.GetInvestments() {
+			totals[investment.Amount().Currency] += investment.Amount().Amount
+			strategyAmounts[investment.Strategy()] += investment.Amount().Amount
+		}
+		for _, balance := range balances {
+			totals[balance.Currency] += balance.Amount
+			cash[balance.Currency] += balance.Amount
+		}
+
+		view.InvestedAmount += invested.Amount
+		weightedRisk += riskScore * invested.Amount
+	}
+
+	view.TotalAmounts = moneyByCurrency(totals)
+	view.CashBalances = moneyByCurrency(cash)
+
+	if view.InvestedAmount > 0 {
+		view.RiskScore = weightedRisk / view.InvestedAmount
+		for strategy, amount := range strategyAmounts {
+			view.StrategyAllocation[strategy] = amount / view.InvestedAmount
+		}
+	}
+
+	return view, nil
+}
+
+func moneyByCurrency(amounts map[string]float64) []domain.Money {
+	currencies := make([]string, 0, len(amounts))
+	for currency := range amounts {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	result := make([]domain.Money, 0, len(currencies))
+	for _, currency := range currencies {
+		result = append(result, domain.Money{Amount: amounts[currency], Currency: currency})
+	}
+	return result
+}
+
 func generateUUID() string {
 	// UUIDの生成ロジックを実装
 	// 実際のプロジェクトではgithub.com/google/uuidなどのライブラリを使用することを推奨
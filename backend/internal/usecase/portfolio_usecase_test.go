@@ -2,41 +2,70 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
 	"testing"
+	"time"
 )
 
 func TestPortfolioUseCase_CreatePortfolio(t *testing.T) {
 	ctx := context.Background()
 	portfolioRepo := newMockPortfolioRepository()
 	txManager := &mockTransactionManager{}
-	eventPublisher := &mockEventPublisher{}
+	outbox := &mockEventOutbox{}
 	strategyService := service.NewInvestmentStrategyService()
 
 	useCase := NewPortfolioUseCase(
 		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
 		txManager,
-		eventPublisher,
+		outbox,
 		strategyService,
 	)
 
 	tests := []struct {
-		name        string
-		userID      string
-		expectError bool
+		name          string
+		userID        string
+		portfolioName string
+		expectedName  string
+		expectError   bool
 	}{
 		{
-			name:        "create portfolio successfully",
-			userID:      "test-user",
-			expectError: false,
+			name:          "create portfolio successfully",
+			userID:        "test-user",
+			portfolioName: "",
+			expectedName:  domain.DefaultPortfolioName,
+			expectError:   false,
+		},
+		{
+			name:          "create named portfolio",
+			userID:        "test-user",
+			portfolioName: "  Kids education ",
+			expectedName:  "Kids education",
+			expectError:   false,
+		},
+		{
+			name:          "duplicate name for the same user",
+			userID:        "test-user",
+			portfolioName: "kids EDUCATION",
+			expectError:   true,
+		},
+		{
+			name:          "same name for another user",
+			userID:        "other-user",
+			portfolioName: "Kids education",
+			expectedName:  "Kids education",
+			expectError:   false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			portfolio, err := useCase.CreatePortfolio(ctx, tt.userID)
+			portfolio, err := useCase.CreatePortfolio(ctx, tt.userID, tt.portfolioName)
 
 			if tt.expectError {
 				if err == nil {
@@ -52,6 +81,9 @@ func TestPortfolioUseCase_CreatePortfolio(t *testing.T) {
 				if portfolio.UserID != tt.userID {
 					t.Errorf("Expected user ID %s, got %s", tt.userID, portfolio.UserID)
 				}
+				if portfolio.Name != tt.expectedName {
+					t.Errorf("Expected name %q, got %q", tt.expectedName, portfolio.Name)
+				}
 				if len(portfolio.GetInvestments()) != 0 {
 					t.Error("New portfolio should have no investments")
 				}
@@ -60,17 +92,51 @@ func TestPortfolioUseCase_CreatePortfolio(t *testing.T) {
 	}
 }
 
+// staleNamesPortfolioRepository hides the existing portfolios from the name
+// check, as if another request created one with the same name meanwhile.
+type staleNamesPortfolioRepository struct {
+	domain.PortfolioRepository
+}
+
+func (r staleNamesPortfolioRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	return nil, nil
+}
+
+func TestPortfolioUseCase_CreatePortfolioWithNameTakenMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+
+	useCase := NewPortfolioUseCase(
+		staleNamesPortfolioRepository{memory.NewPortfolioRepository(db)},
+		memory.NewInvestmentRepository(db),
+		memory.NewMembershipRepository(db),
+		memory.NewTransactionManager(db),
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	if _, err := useCase.CreatePortfolio(ctx, "test-user", "Savings"); err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	// 名前の確認をすり抜けても、ストアの一意制約で重複を拒否する
+	if _, err := useCase.CreatePortfolio(ctx, "test-user", "savings"); !errors.Is(err, domain.ErrDuplicatePortfolioName) {
+		t.Errorf("Expected ErrDuplicatePortfolioName, got %v", err)
+	}
+}
+
 func TestPortfolioUseCase_GetPortfolioAnalysis(t *testing.T) {
 	ctx := context.Background()
 	portfolioRepo := newMockPortfolioRepository()
 	txManager := &mockTransactionManager{}
-	eventPublisher := &mockEventPublisher{}
+	outbox := &mockEventOutbox{}
 	strategyService := service.NewInvestmentStrategyService()
 
 	useCase := NewPortfolioUseCase(
 		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
 		txManager,
-		eventPublisher,
+		outbox,
 		strategyService,
 	)
 
@@ -119,7 +185,7 @@ func TestPortfolioUseCase_GetPortfolioAnalysis(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			analysis, err := useCase.GetPortfolioAnalysis(ctx, tt.portfolioID)
+			analysis, err := useCase.GetPortfolioAnalysis(ctx, "test-user", tt.portfolioID)
 
 			if tt.expectError {
 				if err == nil {
@@ -160,13 +226,15 @@ func TestPortfolioUseCase_RebalancePortfolio(t *testing.T) {
 	ctx := context.Background()
 	portfolioRepo := newMockPortfolioRepository()
 	txManager := &mockTransactionManager{}
-	eventPublisher := &mockEventPublisher{}
+	outbox := &mockEventOutbox{}
 	strategyService := service.NewInvestmentStrategyService()
 
 	useCase := NewPortfolioUseCase(
 		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
 		txManager,
-		eventPublisher,
+		outbox,
 		strategyService,
 	)
 
@@ -212,7 +280,7 @@ func TestPortfolioUseCase_RebalancePortfolio(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := useCase.RebalancePortfolio(ctx, tt.portfolioID, tt.changes)
+			_, err := useCase.RebalancePortfolio(ctx, "test-user", tt.portfolioID, tt.changes)
 
 			if tt.expectError {
 				if err == nil {
@@ -241,6 +309,303 @@ func TestPortfolioUseCase_RebalancePortfolio(t *testing.T) {
 	}
 }
 
+func TestPortfolioUseCase_DepositAndWithdrawCash(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+
+	useCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("test-portfolio"), "test-user")
+	portfolioRepo.Save(ctx, portfolio)
+
+	tests := []struct {
+		name            string
+		deposit         bool
+		userID          string
+		amount          float64
+		currency        string
+		expectedBalance float64
+		expectError     error
+	}{
+		{
+			name:            "deposit JPY",
+			deposit:         true,
+			userID:          "test-user",
+			amount:          100000,
+			currency:        "JPY",
+			expectedBalance: 100000,
+		},
+		{
+			name:            "deposit USD keeps separate balance",
+			deposit:         true,
+			userID:          "test-user",
+			amount:          200,
+			currency:        "USD",
+			expectedBalance: 200,
+		},
+		{
+			name:            "withdraw JPY",
+			deposit:         false,
+			userID:          "test-user",
+			amount:          40000,
+			currency:        "JPY",
+			expectedBalance: 60000,
+		},
+		{
+			name:        "withdraw more than balance",
+			deposit:     false,
+			userID:      "test-user",
+			amount:      60001,
+			currency:    "JPY",
+			expectError: domain.ErrInsufficientFunds,
+		},
+		{
+			name:        "deposit zero",
+			deposit:     true,
+			userID:      "test-user",
+			amount:      0,
+			currency:    "JPY",
+			expectError: domain.ErrInvalidCashAmount,
+		},
+		{
+			name:        "portfolio not found",
+			deposit:     true,
+			userID:      "non-existent-user",
+			amount:      1000,
+			currency:    "JPY",
+			expectError: domain.ErrPortfolioNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var balance domain.Money
+			var err error
+			if tt.deposit {
+				balance, err = useCase.DepositCash(ctx, tt.userID, "", tt.amount, tt.currency)
+			} else {
+				balance, err = useCase.WithdrawCash(ctx, tt.userID, "", tt.amount, tt.currency)
+			}
+
+			if err != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if tt.expectError == nil && balance.Amount != tt.expectedBalance {
+				t.Errorf("Expected balance %f, got %f", tt.expectedBalance, balance.Amount)
+			}
+		})
+	}
+
+	if len(portfolio.CashTransactions) != 3 {
+		t.Errorf("Expected 3 ledger entries, got %d", len(portfolio.CashTransactions))
+	}
+}
+
+func TestPortfolioUseCase_RenameAndArchivePortfolio(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+
+	useCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	main, _ := useCase.CreatePortfolio(ctx, "test-user", "")
+	nisa, _ := useCase.CreatePortfolio(ctx, "test-user", "NISA")
+
+	if _, err := useCase.RenamePortfolio(ctx, "test-user", nisa.ID().Value, "Main"); err != domain.ErrDuplicatePortfolioName {
+		t.Errorf("Expected ErrDuplicatePortfolioName, got %v", err)
+	}
+	if _, err := useCase.RenamePortfolio(ctx, "test-user", nisa.ID().Value, "   "); err != domain.ErrInvalidPortfolioName {
+		t.Errorf("Expected ErrInvalidPortfolioName, got %v", err)
+	}
+	if _, err := useCase.RenamePortfolio(ctx, "other-user", nisa.ID().Value, "Mine"); err != domain.ErrPortfolioNotFound {
+		t.Errorf("Expected ErrPortfolioNotFound for another user, got %v", err)
+	}
+
+	renamed, err := useCase.RenamePortfolio(ctx, "test-user", nisa.ID().Value, "NISA 2024")
+	if err != nil {
+		t.Fatalf("Unexpected error renaming portfolio: %v", err)
+	}
+	if renamed.Name != "NISA 2024" {
+		t.Errorf("Expected name %q, got %q", "NISA 2024", renamed.Name)
+	}
+
+	// デフォルトのポートフォリオをアーカイブすると次に古いものがデフォルトになる
+	main.CreatedAt = nisa.CreatedAt.Add(-time.Second)
+	if _, err := useCase.ArchivePortfolio(ctx, "test-user", main.ID().Value); err != nil {
+		t.Fatalf("Unexpected error archiving portfolio: %v", err)
+	}
+	if _, err := useCase.ArchivePortfolio(ctx, "test-user", main.ID().Value); err != domain.ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived, got %v", err)
+	}
+	if _, err := useCase.DepositCash(ctx, "test-user", main.ID().Value, 1000, "JPY"); err != domain.ErrPortfolioArchived {
+		t.Errorf("Expected ErrPortfolioArchived when depositing, got %v", err)
+	}
+
+	defaultPortfolio, err := useCase.GetUserPortfolio(ctx, "test-user")
+	if err != nil {
+		t.Fatalf("Unexpected error getting default portfolio: %v", err)
+	}
+	if defaultPortfolio.ID() != nisa.ID() {
+		t.Errorf("Expected default portfolio %s, got %s", nisa.ID().Value, defaultPortfolio.ID().Value)
+	}
+
+	portfolios, err := useCase.ListUserPortfolios(ctx, "test-user")
+	if err != nil {
+		t.Fatalf("Unexpected error listing portfolios: %v", err)
+	}
+	if len(portfolios) != 2 {
+		t.Errorf("Expected 2 portfolios including archived, got %d", len(portfolios))
+	}
+}
+
+func TestPortfolioUseCase_LiquidateArchivedPortfolio(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+	txManager := memory.NewTransactionManager(db)
+	outbox := service.NewOutbox(memory.NewEventStoreDB(db), memory.NewOutboxStoreDB(db))
+	strategyService := service.NewInvestmentStrategyService()
+
+	portfolios := NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, txManager, outbox, strategyService)
+	investments := NewInvestmentUseCase(investmentRepo, portfolioRepo, membershipRepo, txManager, outbox, strategyService)
+
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID("portfolio-1"), "owner")
+	id := portfolio.ID().Value
+	holding := seedInvestment(t, investmentRepo, portfolio, "holding", 50000, domain.Conservative)
+	if err := portfolioRepo.Create(ctx, portfolio); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := portfolios.ArchivePortfolio(ctx, "owner", id); err != nil {
+		t.Fatalf("ArchivePortfolio failed: %v", err)
+	}
+
+	if err := portfolios.DeletePortfolio(ctx, "owner", id); err != domain.ErrPortfolioNotEmpty {
+		t.Errorf("Expected ErrPortfolioNotEmpty with holdings, got %v", err)
+	}
+
+	// アーカイブしたままでも売却して出金すれば削除できる
+	if err := investments.SellInvestment(ctx, "owner", holding); err != nil {
+		t.Fatalf("SellInvestment failed on an archived portfolio: %v", err)
+	}
+	balance, err := portfolios.WithdrawCash(ctx, "owner", id, 50000, "JPY")
+	if err != nil {
+		t.Fatalf("WithdrawCash failed on an archived portfolio: %v", err)
+	}
+	if balance.Amount != 0 {
+		t.Errorf("Expected an empty cash balance, got %v", balance)
+	}
+	if err := portfolios.DeletePortfolio(ctx, "owner", id); err != nil {
+		t.Fatalf("DeletePortfolio failed: %v", err)
+	}
+	if _, err := portfolios.GetPortfolio(ctx, "owner", id); err != domain.ErrPortfolioNotFound {
+		t.Errorf("Expected the portfolio to be gone, got %v", err)
+	}
+}
+
+func TestPortfolioUseCase_GetHouseholdView(t *testing.T) {
+	ctx := context.Background()
+	portfolioRepo := newMockPortfolioRepository()
+
+	useCase := NewPortfolioUseCase(
+		portfolioRepo,
+		newMockInvestmentRepository(),
+		newMockMembershipRepository(),
+		&mockTransactionManager{},
+		&mockEventOutbox{},
+		service.NewInvestmentStrategyService(),
+	)
+
+	addInvestment := func(portfolio *domain.Portfolio, id string, amount float64, strategy domain.InvestmentStrategy) {
+		money, _ := domain.NewMoney(amount, "JPY")
+		investment, _ := domain.NewInvestment(domain.NewInvestmentID(id), money, domain.Stock, strategy)
+		if err := portfolio.AddInvestment(investment); err != nil {
+			t.Fatalf("Failed to add investment: %v", err)
+		}
+	}
+	deposit := func(portfolio *domain.Portfolio, id string, amount float64, currency string) {
+		money, _ := domain.NewMoney(amount, currency)
+		tx, _ := domain.NewCashTransaction(id, domain.CashDeposit, money, domain.InvestmentID{})
+		if err := portfolio.RecordCashTransaction(tx); err != nil {
+			t.Fatalf("Failed to deposit cash: %v", err)
+		}
+	}
+
+	// Conservative 1M のみ（リスク 0.2）
+	main := domain.NewPortfolio(domain.NewPortfolioID("main"), "test-user")
+	addInvestment(main, "main-1", 1000000, domain.Conservative)
+	deposit(main, "main-cash", 500000, "JPY")
+	portfolioRepo.Save(ctx, main)
+
+	// Aggressive 1M + Conservative 1M（リスク 0.6）
+	kids := domain.NewPortfolio(domain.NewPortfolioID("kids"), "test-user")
+	kids.Rename("Kids education")
+	addInvestment(kids, "kids-1", 1000000, domain.Aggressive)
+	addInvestment(kids, "kids-2", 1000000, domain.Conservative)
+	deposit(kids, "kids-cash", 100, "USD")
+	portfolioRepo.Save(ctx, kids)
+
+	// アーカイブ済みは集計しない
+	archived := domain.NewPortfolio(domain.NewPortfolioID("archived"), "test-user")
+	archived.Rename("Old")
+	addInvestment(archived, "archived-1", 5000000, domain.Aggressive)
+	archived.Archive()
+	portfolioRepo.Save(ctx, archived)
+
+	// 他のユーザーは集計しない
+	other := domain.NewPortfolio(domain.NewPortfolioID("other"), "other-user")
+	addInvestment(other, "other-1", 3000000, domain.Aggressive)
+	portfolioRepo.Save(ctx, other)
+
+	view, err := useCase.GetHouseholdView(ctx, "test-user")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(view.Portfolios) != 2 {
+		t.Fatalf("Expected 2 active portfolios, got %d", len(view.Portfolios))
+	}
+	if view.InvestedAmount != 3000000 {
+		t.Errorf("Expected invested amount 3000000, got %f", view.InvestedAmount)
+	}
+
+	expectedTotals := []domain.Money{{Amount: 3500000, Currency: "JPY"}, {Amount: 100, Currency: "USD"}}
+	if len(view.TotalAmounts) != len(expectedTotals) {
+		t.Fatalf("Expected totals %v, got %v", expectedTotals, view.TotalAmounts)
+	}
+	for i, expected := range expectedTotals {
+		if view.TotalAmounts[i] != expected {
+			t.Errorf("Expected total %v, got %v", expected, view.TotalAmounts[i])
+		}
+	}
+
+	if ratio := view.StrategyAllocation[domain.Conservative]; ratio < 0.66 || ratio > 0.67 {
+		t.Errorf("Expected conservative allocation ~0.667, got %f", ratio)
+	}
+	if ratio := view.StrategyAllocation[domain.Aggressive]; ratio < 0.33 || ratio > 0.34 {
+		t.Errorf("Expected aggressive allocation ~0.333, got %f", ratio)
+	}
+
+	// (0.2 * 1M + 0.6 * 2M) / 3M
+	if view.RiskScore < 0.466 || view.RiskScore > 0.467 {
+		t.Errorf("Expected risk score ~0.4667, got %f", view.RiskScore)
+	}
+}
+
 type mockPortfolioRepository struct {
 	portfolios map[domain.PortfolioID]*domain.Portfolio
 }
@@ -268,21 +633,40 @@ func (m *mockPortfolioRepository) FindByID(ctx context.Context, id domain.Portfo
 	return nil, domain.ErrNotFound
 }
 
-func (m *mockPortfolioRepository) FindByUserID(ctx context.Context, userID string) (*domain.Portfolio, error) {
+func (m *mockPortfolioRepository) FindByIDs(ctx context.Context, ids []domain.PortfolioID) ([]*domain.Portfolio, error) {
+	result := []*domain.Portfolio{}
+	for _, id := range ids {
+		if p, exists := m.portfolios[id]; exists {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockPortfolioRepository) FindByUserID(ctx context.Context, userID string) ([]*domain.Portfolio, error) {
+	var result []*domain.Portfolio
 	for _, p := range m.portfolios {
 		if p.UserID == userID {
-			return p, nil
+			result = append(result, p)
 		}
 	}
-	return nil, domain.ErrNotFound
+	return result, nil
+}
+
+func (m *mockPortfolioRepository) FindAll(ctx context.Context) ([]*domain.Portfolio, error) {
+	result := []*domain.Portfolio{}
+	for _, p := range m.portfolios {
+		result = append(result, p)
+	}
+	return result, nil
 }
 
 func (m *mockPortfolioRepository) FindByInvestmentID(ctx context.Context, investmentID domain.InvestmentID) (*domain.Portfolio, error) {
 	return nil, domain.ErrNotFound
 }
 
-func (m *mockPortfolioRepository) Delete(ctx context.Context, id domain.PortfolioID) error {
-	delete(m.portfolios, id)
+func (m *mockPortfolioRepository) Delete(ctx context.Context, portfolio *domain.Portfolio) error {
+	delete(m.portfolios, portfolio.ID())
 	return nil
 }
 
@@ -0,0 +1,385 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ReplayUseCase rebuilds portfolios from their event streams and compares
+// them with the state stored in the portfolios and investments tables.
+type ReplayUseCase struct {
+	portfolioRepo  domain.PortfolioRepository
+	investmentRepo domain.InvestmentRepository
+	eventStore     *service.EventStore
+	loader         *service.PortfolioLoader
+	txManager      domain.TransactionManager
+}
+
+func NewReplayUseCase(
+	portfolioRepo domain.PortfolioRepository,
+	investmentRepo domain.InvestmentRepository,
+	eventStore *service.EventStore,
+	loader *service.PortfolioLoader,
+	txManager domain.TransactionManager,
+) *ReplayUseCase {
+	return &ReplayUseCase{
+		portfolioRepo:  portfolioRepo,
+		investmentRepo: investmentRepo,
+		eventStore:     eventStore,
+		loader:         loader,
+		txManager:      txManager,
+	}
+}
+
+// Divergence is a field whose stored value differs from the value given by
+// the events of the portfolio.
+type Divergence struct {
+	PortfolioID string
+	Field       string
+	Stored      string
+	Replayed    string
+}
+
+// ReplayFailure is a portfolio whose stream could not be replayed or
+// repaired. The other portfolios are still compared.
+type ReplayFailure struct {
+	PortfolioID string
+	Err         error
+}
+
+// ReplayReport is the result of a replay.
+type ReplayReport struct {
+	Portfolios  int // 比較したポートフォリオ数
+	Divergences []Divergence
+	Repaired    []string // 書き戻したポートフォリオのID
+	Failures    []ReplayFailure
+}
+
+// 値がない側の表示
+const (
+	valueMissing = "missing"
+	valuePresent = "present"
+)
+
+// Replay compares every portfolio with its replayed stream. With apply, the
+// tables of diverging portfolios are rewritten from the events, one
+// portfolio per transaction, and portfolios without any event get their
+// stream from the stored state. Cash transactions missing from the events
+// are kept, since the ledger is append-only. A portfolio that cannot be
+// replayed or repaired is reported as a failure and the others go on.
+func (u *ReplayUseCase) Replay(ctx context.Context, apply bool) (*ReplayReport, error) {
+	streamIDs, err := u.eventStore.ListStreams(ctx, domain.AggregatePortfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolios, err := u.portfolioRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := make(map[string]*domain.Portfolio, len(portfolios))
+	ids := append([]string(nil), streamIDs...)
+	hasStream := make(map[string]bool, len(streamIDs))
+	for _, id := range streamIDs {
+		hasStream[id] = true
+	}
+	for _, portfolio := range portfolios {
+		stored[portfolio.ID().Value] = portfolio
+		if !hasStream[portfolio.ID().Value] {
+			ids = append(ids, portfolio.ID().Value)
+		}
+	}
+
+	report := &ReplayReport{Portfolios: len(ids)}
+	fail := func(id string, err error) {
+		report.Failures = append(report.Failures, ReplayFailure{PortfolioID: id, Err: err})
+	}
+	for _, id := range ids {
+		if !hasStream[id] {
+			report.Divergences = append(report.Divergences, Divergence{
+				PortfolioID: id,
+				Field:       "events",
+				Stored:      valuePresent,
+				Replayed:    valueMissing,
+			})
+			if apply {
+				if err := u.backfill(ctx, stored[id]); err != nil {
+					fail(id, err)
+					continue
+				}
+				report.Repaired = append(report.Repaired, id)
+			}
+			continue
+		}
+
+		replayed, err := u.rebuild(ctx, id)
+		if err != nil {
+			fail(id, err)
+			continue
+		}
+
+		divergences := comparePortfolios(id, stored[id], replayed)
+		if len(divergences) == 0 {
+			continue
+		}
+		report.Divergences = append(report.Divergences, divergences...)
+
+		if apply {
+			err := u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+				return u.repair(ctx, id, replayed)
+			})
+			if err != nil {
+				fail(id, err)
+				continue
+			}
+			report.Repaired = append(report.Repaired, id)
+		}
+	}
+
+	return report, nil
+}
+
+// Backfill gives every portfolio stored without events a stream describing
+// its current state, so that it can be loaded from its events. It returns
+// the IDs of the backfilled portfolios and is meant to run at startup.
+func (u *ReplayUseCase) Backfill(ctx context.Context) ([]string, error) {
+	streamIDs, err := u.eventStore.ListStreams(ctx, domain.AggregatePortfolio)
+	if err != nil {
+		return nil, err
+	}
+	hasStream := make(map[string]bool, len(streamIDs))
+	for _, id := range streamIDs {
+		hasStream[id] = true
+	}
+
+	portfolios, err := u.portfolioRepo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var backfilled []string
+	for _, portfolio := range portfolios {
+		id := portfolio.ID().Value
+		if hasStream[id] {
+			continue
+		}
+		err := u.backfill(ctx, portfolio)
+		// 別のプロセスが先に書き込んだ
+		if errors.Is(err, domain.ErrConcurrentModification) {
+			continue
+		}
+		if err != nil {
+			return backfilled, fmt.Errorf("portfolio %s: %w", id, err)
+		}
+		backfilled = append(backfilled, id)
+	}
+	return backfilled, nil
+}
+
+// backfill writes the creation events of a stored portfolio to its stream,
+// which must still be empty.
+func (u *ReplayUseCase) backfill(ctx context.Context, portfolio *domain.Portfolio) error {
+	return u.txManager.RunInTransaction(ctx, func(ctx context.Context) error {
+		_, err := u.eventStore.Append(ctx, 0, portfolio.CreationEvents()...)
+		return err
+	})
+}
+
+// rebuild replays the stream of a portfolio from its latest snapshot. A
+// deleted portfolio is nil.
+func (u *ReplayUseCase) rebuild(ctx context.Context, id string) (*domain.Portfolio, error) {
+	portfolio, _, err := u.loader.Load(ctx, id)
+	if errors.Is(err, domain.ErrPortfolioNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+// repair writes the replayed state over the stored one. It reloads the
+// stored portfolio so that the writes carry its current versions.
+func (u *ReplayUseCase) repair(ctx context.Context, id string, replayed *domain.Portfolio) error {
+	current, err := u.findStored(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if replayed == nil {
+		if current == nil {
+			return nil
+		}
+		if err := u.portfolioRepo.Delete(ctx, current); err != nil {
+			return err
+		}
+		for _, investment := range current.GetInvestments() {
+			if err := u.investmentRepo.Delete(ctx, investment.ID()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var removed []*domain.Investment
+	if current != nil {
+		replayed.Version = current.Version
+		for investmentID, investment := range current.Investments {
+			if rebuilt, ok := replayed.Investments[investmentID]; ok {
+				rebuilt.Version = investment.Version
+			} else {
+				removed = append(removed, investment)
+			}
+		}
+	}
+
+	// 投資を先に保存してから関連付けを書き換える
+	for _, investment := range replayed.GetInvestments() {
+		if err := u.investmentRepo.Save(ctx, investment); err != nil {
+			return err
+		}
+	}
+	if err := u.portfolioRepo.Save(ctx, replayed); err != nil {
+		return err
+	}
+	for _, investment := range removed {
+		if err := u.investmentRepo.Delete(ctx, investment.ID()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *ReplayUseCase) findStored(ctx context.Context, id string) (*domain.Portfolio, error) {
+	portfolios, err := u.portfolioRepo.FindByIDs(ctx, []domain.PortfolioID{domain.NewPortfolioID(id)})
+	if err != nil || len(portfolios) == 0 {
+		return nil, err
+	}
+	return portfolios[0], nil
+}
+
+// comparePortfolios lists the differences of the state kept in the tables.
+// Versions and update times are bookkeeping of the tables and not compared.
+func comparePortfolios(id string, stored *domain.Portfolio, replayed *domain.Portfolio) []Divergence {
+	var divergences []Divergence
+	diff := func(field string, storedValue string, replayedValue string) {
+		if storedValue != replayedValue {
+			divergences = append(divergences, Divergence{
+				PortfolioID: id,
+				Field:       field,
+				Stored:      storedValue,
+				Replayed:    replayedValue,
+			})
+		}
+	}
+
+	if stored == nil || replayed == nil {
+		diff("portfolio", presence(stored != nil), presence(replayed != nil))
+		return divergences
+	}
+
+	diff("user_id", stored.UserID, replayed.UserID)
+	diff("name", stored.Name, replayed.Name)
+	diff("archived_at", formatTimePtr(stored.ArchivedAt), formatTimePtr(replayed.ArchivedAt))
+
+	for _, investmentID := range investmentIDs(stored, replayed) {
+		field := "investments[" + investmentID.Value + "]"
+		storedInvestment, inStored := stored.Investments[investmentID]
+		replayedInvestment, inReplayed := replayed.Investments[investmentID]
+		if !inStored || !inReplayed {
+			diff(field, presence(inStored), presence(inReplayed))
+			continue
+		}
+
+		diff(field+".amount", formatMoney(storedInvestment.Amount()), formatMoney(replayedInvestment.Amount()))
+		diff(field+".type", string(storedInvestment.Type()), string(replayedInvestment.Type()))
+		diff(field+".strategy", string(storedInvestment.Strategy()), string(replayedInvestment.Strategy()))
+	}
+
+	storedCash := cashTransactionsByID(stored)
+	replayedCash := cashTransactionsByID(replayed)
+	for _, txID := range cashTransactionIDs(storedCash, replayedCash) {
+		diff("cash_transactions["+txID+"]", formatCashTransaction(storedCash[txID]), formatCashTransaction(replayedCash[txID]))
+	}
+
+	return divergences
+}
+
+func investmentIDs(portfolios ...*domain.Portfolio) []domain.InvestmentID {
+	seen := make(map[domain.InvestmentID]bool)
+	var ids []domain.InvestmentID
+	for _, portfolio := range portfolios {
+		for id := range portfolio.Investments {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Value < ids[j].Value })
+	return ids
+}
+
+func cashTransactionsByID(portfolio *domain.Portfolio) map[string]*domain.CashTransaction {
+	byID := make(map[string]*domain.CashTransaction, len(portfolio.CashTransactions))
+	for _, tx := range portfolio.CashTransactions {
+		byID[tx.ID] = tx
+	}
+	return byID
+}
+
+func cashTransactionIDs(ledgers ...map[string]*domain.CashTransaction) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, ledger := range ledgers {
+		for id := range ledger {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func presence(ok bool) string {
+	if ok {
+		return valuePresent
+	}
+	return valueMissing
+}
+
+func formatMoney(m domain.Money) string {
+	return strconv.FormatFloat(m.Amount, 'f', -1, 64) + " " + m.Currency
+}
+
+// formatTime uses the microsecond precision of the backends.
+func formatTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return formatTime(*t)
+}
+
+func formatCashTransaction(tx *domain.CashTransaction) string {
+	if tx == nil {
+		return valueMissing
+	}
+	s := string(tx.Type) + " " + formatMoney(tx.Amount) + " at " + formatTime(tx.OccurredAt)
+	if tx.InvestmentID.Value != "" {
+		s += " for " + tx.InvestmentID.Value
+	}
+	return s
+}
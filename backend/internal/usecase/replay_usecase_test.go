@@ -0,0 +1,225 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
+	"testing"
+	"time"
+)
+
+func TestReplayUseCase_Replay(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	membershipRepo := memory.NewMembershipRepository(db)
+	txManager := memory.NewTransactionManager(db)
+	eventStoreDB := memory.NewEventStoreDB(db)
+	eventStore := service.NewEventStore(eventStoreDB)
+	outbox := service.NewOutbox(eventStoreDB, memory.NewOutboxStoreDB(db))
+	strategyService := service.NewInvestmentStrategyService()
+
+	portfolios := NewPortfolioUseCase(portfolioRepo, investmentRepo, membershipRepo, txManager, outbox, strategyService)
+	investments := NewInvestmentUseCase(investmentRepo, portfolioRepo, membershipRepo, txManager, outbox, strategyService)
+	loader := service.NewPortfolioLoader(eventStore, memory.NewSnapshotStoreDB(db), 3)
+	replay := NewReplayUseCase(portfolioRepo, investmentRepo, eventStore, loader, txManager)
+
+	// あらゆる種類の変更を経たポートフォリオを用意する
+	portfolio, err := portfolios.CreatePortfolio(ctx, "test-user", "Savings")
+	if err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	id := portfolio.ID().Value
+	if _, err := portfolios.DepositCash(ctx, "test-user", id, 1000000, "JPY"); err != nil {
+		t.Fatalf("DepositCash failed: %v", err)
+	}
+	kept, _, err := investments.CreateInvestment(ctx, "test-user", id, 300000, "JPY", string(domain.Bond), string(domain.Conservative))
+	if err != nil {
+		t.Fatalf("CreateInvestment failed: %v", err)
+	}
+	sold, _, err := investments.CreateInvestment(ctx, "test-user", id, 200000, "JPY", string(domain.Stock), string(domain.Moderate))
+	if err != nil {
+		t.Fatalf("CreateInvestment failed: %v", err)
+	}
+	if _, _, err := investments.UpdateInvestmentAmount(ctx, "test-user", sold.ID().Value, 250000, "JPY"); err != nil {
+		t.Fatalf("UpdateInvestmentAmount failed: %v", err)
+	}
+	if err := investments.SellInvestment(ctx, "test-user", sold.ID().Value); err != nil {
+		t.Fatalf("SellInvestment failed: %v", err)
+	}
+	if _, err := portfolios.RebalancePortfolio(ctx, "test-user", id, map[domain.InvestmentID]domain.Money{
+		kept.ID(): {Amount: 350000, Currency: "JPY"},
+	}); err != nil {
+		t.Fatalf("RebalancePortfolio failed: %v", err)
+	}
+	if _, err := portfolios.RenamePortfolio(ctx, "test-user", id, "Old savings"); err != nil {
+		t.Fatalf("RenamePortfolio failed: %v", err)
+	}
+	if _, err := portfolios.ArchivePortfolio(ctx, "test-user", id); err != nil {
+		t.Fatalf("ArchivePortfolio failed: %v", err)
+	}
+
+	deleted, err := portfolios.CreatePortfolio(ctx, "test-user", "Temporary")
+	if err != nil {
+		t.Fatalf("CreatePortfolio failed: %v", err)
+	}
+	if err := portfolios.DeletePortfolio(ctx, "test-user", deleted.ID().Value); err != nil {
+		t.Fatalf("DeletePortfolio failed: %v", err)
+	}
+
+	report, err := replay.Replay(ctx, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if report.Portfolios != 2 || len(report.Divergences) != 0 {
+		t.Fatalf("Expected 2 matching portfolios, got %d with %+v", report.Portfolios, report.Divergences)
+	}
+
+	// テーブルだけを書き換えて食い違いを作る
+	stored, _ := portfolioRepo.FindByID(ctx, portfolio.ID())
+	stored.Name = "Tampered"
+	if err := portfolioRepo.Save(ctx, stored); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	investment, _ := investmentRepo.FindByID(ctx, kept.ID())
+	investment.UpdateAmount(domain.Money{Amount: 1, Currency: "JPY"})
+	if err := investmentRepo.Save(ctx, investment); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	report, err = replay.Replay(ctx, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	want := []Divergence{
+		{PortfolioID: id, Field: "name", Stored: "Tampered", Replayed: "Old savings"},
+		{PortfolioID: id, Field: "investments[" + kept.ID().Value + "].amount", Stored: "1 JPY", Replayed: "350000 JPY"},
+	}
+	if len(report.Divergences) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, report.Divergences)
+	}
+	for i := range want {
+		if report.Divergences[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], report.Divergences[i])
+		}
+	}
+	if len(report.Repaired) != 0 {
+		t.Errorf("Expected nothing repaired without apply, got %v", report.Repaired)
+	}
+
+	report, err = replay.Replay(ctx, true)
+	if err != nil {
+		t.Fatalf("Replay with apply failed: %v", err)
+	}
+	if len(report.Repaired) != 1 || report.Repaired[0] != id {
+		t.Errorf("Expected %s to be repaired, got %v", id, report.Repaired)
+	}
+
+	report, err = replay.Replay(ctx, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(report.Divergences) != 0 {
+		t.Errorf("Expected no divergence after apply, got %+v", report.Divergences)
+	}
+
+	// イベントのないポートフォリオには保存済みの状態からストリームを作る
+	legacy := domain.NewPortfolio(domain.NewPortfolioID("legacy"), "test-user")
+	if err := portfolioRepo.Create(ctx, legacy); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	report, err = replay.Replay(ctx, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(report.Divergences) != 1 || report.Divergences[0].Field != "events" || len(report.Repaired) != 0 {
+		t.Errorf("Expected the portfolio without events to be reported, got %+v", report)
+	}
+	report, err = replay.Replay(ctx, true)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(report.Repaired) != 1 || report.Repaired[0] != "legacy" {
+		t.Errorf("Expected the stream of legacy to be written, got %+v", report)
+	}
+	if _, _, err := loader.Load(ctx, "legacy"); err != nil {
+		t.Errorf("Expected legacy to load from its events, got %v", err)
+	}
+
+	// 作成で始まらないストリームは失敗として残し、他のポートフォリオは比較を続ける
+	if _, err := eventStore.Append(ctx, 0, domain.NewPortfolioRenamedEvent(domain.NewPortfolioID("broken"), "Broken", time.Now())); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	stored, _ = portfolioRepo.FindByID(ctx, portfolio.ID())
+	stored.Name = "Tampered again"
+	if err := portfolioRepo.Save(ctx, stored); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	report, err = replay.Replay(ctx, true)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].PortfolioID != "broken" || !errors.Is(report.Failures[0].Err, domain.ErrInvalidEventStream) {
+		t.Errorf("Expected broken to fail, got %+v", report.Failures)
+	}
+	if len(report.Repaired) != 1 || report.Repaired[0] != id {
+		t.Errorf("Expected %s to be repaired despite the failure, got %v", id, report.Repaired)
+	}
+}
+
+func TestReplayUseCase_Backfill(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDB()
+	portfolioRepo := memory.NewPortfolioRepository(db)
+	investmentRepo := memory.NewInvestmentRepository(db)
+	eventStore := service.NewEventStore(memory.NewEventStoreDB(db))
+	loader := service.NewPortfolioLoader(eventStore, memory.NewSnapshotStoreDB(db), 3)
+	replay := NewReplayUseCase(portfolioRepo, investmentRepo, eventStore, loader, memory.NewTransactionManager(db))
+
+	// イベントを記録する前から保存されていたポートフォリオ
+	investment, _ := domain.NewInvestment(domain.NewInvestmentID("legacy-investment"), domain.Money{Amount: 1000, Currency: "JPY"}, domain.Stock, domain.Moderate)
+	if err := investmentRepo.Create(ctx, investment); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	legacy := domain.ReconstitutePortfolio(domain.PortfolioState{
+		ID:          domain.NewPortfolioID("legacy"),
+		UserID:      "test-user",
+		Name:        "Legacy",
+		Investments: []*domain.Investment{investment},
+		CreatedAt:   time.Now(),
+	})
+	if err := portfolioRepo.Create(ctx, legacy); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	backfilled, err := replay.Backfill(ctx)
+	if err != nil {
+		t.Fatalf("Backfill failed: %v", err)
+	}
+	if len(backfilled) != 1 || backfilled[0] != "legacy" {
+		t.Fatalf("Expected legacy to be backfilled, got %v", backfilled)
+	}
+
+	rebuilt, _, err := loader.Load(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if rebuilt.UserID != "test-user" || rebuilt.Name != "Legacy" || len(rebuilt.Investments) != 1 {
+		t.Errorf("Unexpected rebuilt portfolio %+v", rebuilt)
+	}
+
+	// 2回目は何も書かず、比較しても食い違わない
+	if backfilled, err := replay.Backfill(ctx); err != nil || len(backfilled) != 0 {
+		t.Errorf("Expected nothing to backfill, got %v, %v", backfilled, err)
+	}
+	report, err := replay.Replay(ctx, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(report.Divergences) != 0 || len(report.Failures) != 0 {
+		t.Errorf("Expected the backfilled portfolio to match, got %+v", report)
+	}
+}
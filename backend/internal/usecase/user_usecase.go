@@ -9,7 +9,7 @@ import (
 type UserUsecase interface {
 	Register(name, email, password string) error
 	Login(email, password string) (*domain.User, error)
-	GetUserByID(id string) (*domain.User, error)
+	GetUserByID(actorID string, id string) (*domain.User, error)
 }
 
 type userUsecase struct {
@@ -51,6 +51,16 @@ func (u *userUsecase) Login(email, password string) (*domain.User, error) {
 	return user, nil
 }
 
-func (u *userUsecase) GetUserByID(id string) (*domain.User, error) {
-	return u.userRepo.FindByID(id)
+// GetUserByID returns a user's profile. Users can only read their own
+// profile; other users' records are reported as not found.
+func (u *userUsecase) GetUserByID(actorID string, id string) (*domain.User, error) {
+	if actorID == "" || actorID != id {
+		return nil, domain.ErrUserNotFound
+	}
+
+	user, err := u.userRepo.FindByID(id)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrUserNotFound)
+	}
+	return user, nil
 }
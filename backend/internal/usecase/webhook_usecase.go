@@ -0,0 +1,109 @@
+package usecase
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/utils"
+	"time"
+)
+
+// 配信履歴として返す件数
+const webhookDeliveryLimit = 100
+
+type WebhookUseCase struct {
+	webhookRepo domain.WebhookRepository
+	now         func() time.Time
+}
+
+func NewWebhookUseCase(webhookRepo domain.WebhookRepository) *WebhookUseCase {
+	return &WebhookUseCase{
+		webhookRepo: webhookRepo,
+		now:         time.Now,
+	}
+}
+
+// CreateWebhook subscribes a URL to events of the user's portfolios. A
+// secret is generated when none is given.
+func (u *WebhookUseCase) CreateWebhook(ctx context.Context, userID string, url string, eventTypes []string, secret string) (*domain.WebhookSubscription, error) {
+	for _, eventType := range eventTypes {
+		if !service.IsEventType(eventType) {
+			return nil, domain.ErrInvalidWebhookEventType
+		}
+	}
+
+	if secret == "" {
+		generated, err := service.NewWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	subscription, err := domain.NewWebhookSubscription(utils.GenerateUUID(), userID, url, eventTypes, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.webhookRepo.SaveSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return subscription, nil
+}
+
+func (u *WebhookUseCase) ListWebhooks(ctx context.Context, userID string) ([]*domain.WebhookSubscription, error) {
+	return u.webhookRepo.FindSubscriptionsByUserID(ctx, userID)
+}
+
+func (u *WebhookUseCase) DeleteWebhook(ctx context.Context, userID string, webhookID string) error {
+	subscription, err := u.load(ctx, userID, webhookID)
+	if err != nil {
+		return err
+	}
+	return u.webhookRepo.DeleteSubscription(ctx, subscription.ID)
+}
+
+// ListDeliveries returns the latest deliveries of a webhook, newest first.
+func (u *WebhookUseCase) ListDeliveries(ctx context.Context, userID string, webhookID string) ([]*domain.WebhookDelivery, error) {
+	subscription, err := u.load(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	return u.webhookRepo.FindDeliveriesBySubscriptionID(ctx, subscription.ID, webhookDeliveryLimit)
+}
+
+// Redeliver queues a delivery again, whatever its state, with the same
+// payload.
+func (u *WebhookUseCase) Redeliver(ctx context.Context, userID string, webhookID string, deliveryID string) (*domain.WebhookDelivery, error) {
+	subscription, err := u.load(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := u.webhookRepo.FindDeliveryByID(ctx, deliveryID)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrWebhookDeliveryNotFound)
+	}
+	if delivery.SubscriptionID != subscription.ID {
+		return nil, domain.ErrWebhookDeliveryNotFound
+	}
+
+	delivery.Redeliver(u.now().UTC())
+	if err := u.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// load returns a webhook of the user. Those of other users are reported as
+// not found, so that their IDs are not disclosed.
+func (u *WebhookUseCase) load(ctx context.Context, userID string, webhookID string) (*domain.WebhookSubscription, error) {
+	subscription, err := u.webhookRepo.FindSubscriptionByID(ctx, webhookID)
+	if err != nil {
+		return nil, notFoundAs(err, domain.ErrWebhookNotFound)
+	}
+	if subscription.UserID != userID {
+		return nil, domain.ErrWebhookNotFound
+	}
+	return subscription, nil
+}
@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"moneyget/internal/domain"
+	"moneyget/internal/infrastructure/memory"
+	"testing"
+	"time"
+)
+
+func TestWebhookUseCase(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewWebhookRepository(memory.NewDB())
+	webhooks := NewWebhookUseCase(repo)
+
+	if _, err := webhooks.CreateWebhook(ctx, "owner", "https://example.com", []string{"Unheard"}, ""); err != domain.ErrInvalidWebhookEventType {
+		t.Errorf("Expected ErrInvalidWebhookEventType, got %v", err)
+	}
+	if _, err := webhooks.CreateWebhook(ctx, "owner", "example.com", []string{"PortfolioCreated"}, ""); err != domain.ErrInvalidWebhookURL {
+		t.Errorf("Expected ErrInvalidWebhookURL, got %v", err)
+	}
+
+	webhook, err := webhooks.CreateWebhook(ctx, "owner", "https://example.com/hooks", []string{"PortfolioCreated", "InvestmentCreated"}, "")
+	if err != nil {
+		t.Fatalf("CreateWebhook failed: %v", err)
+	}
+	// 秘密鍵を省略すると生成される
+	if len(webhook.Secret) != 64 {
+		t.Errorf("Expected a generated secret, got %q", webhook.Secret)
+	}
+	if given, err := webhooks.CreateWebhook(ctx, "owner", "https://example.org", []string{"PortfolioDeleted"}, "my secret"); err != nil || given.Secret != "my secret" {
+		t.Errorf("Expected the given secret to be kept, got %+v, %v", given, err)
+	}
+
+	listed, err := webhooks.ListWebhooks(ctx, "owner")
+	if err != nil || len(listed) != 2 {
+		t.Errorf("Expected 2 webhooks, got %d (err: %v)", len(listed), err)
+	}
+
+	// 配信を諦めた記録を再配信する
+	delivery := domain.NewWebhookDelivery("delivery-1", webhook.ID, "PortfolioCreated", []byte(`{}`), time.Now())
+	delivery.Fail(500, "server error", nil, time.Now())
+	if err := repo.SaveDelivery(ctx, delivery); err != nil {
+		t.Fatalf("SaveDelivery failed: %v", err)
+	}
+
+	redelivered, err := webhooks.Redeliver(ctx, "owner", webhook.ID, "delivery-1")
+	if err != nil {
+		t.Fatalf("Redeliver failed: %v", err)
+	}
+	if redelivered.Status != domain.WebhookDeliveryPending || redelivered.Attempts != 0 {
+		t.Errorf("Expected the delivery to be queued again, got %+v", redelivered)
+	}
+	deliveries, err := webhooks.ListDeliveries(ctx, "owner", webhook.ID)
+	if err != nil || len(deliveries) != 1 || deliveries[0].Status != domain.WebhookDeliveryPending {
+		t.Errorf("Expected the pending delivery in the log, got %+v, %v", deliveries, err)
+	}
+	if _, err := webhooks.Redeliver(ctx, "owner", webhook.ID, "missing"); err != domain.ErrWebhookDeliveryNotFound {
+		t.Errorf("Expected ErrWebhookDeliveryNotFound, got %v", err)
+	}
+
+	// 他のユーザーのWebhookは存在しないものとして扱う
+	if _, err := webhooks.ListDeliveries(ctx, "intruder", webhook.ID); err != domain.ErrWebhookNotFound {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	if _, err := webhooks.Redeliver(ctx, "intruder", webhook.ID, "delivery-1"); err != domain.ErrWebhookNotFound {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+	if err := webhooks.DeleteWebhook(ctx, "intruder", webhook.ID); err != domain.ErrWebhookNotFound {
+		t.Errorf("Expected ErrWebhookNotFound, got %v", err)
+	}
+
+	if err := webhooks.DeleteWebhook(ctx, "owner", webhook.ID); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	if err := webhooks.DeleteWebhook(ctx, "owner", webhook.ID); err != domain.ErrWebhookNotFound {
+		t.Errorf("Expected ErrWebhookNotFound after delete, got %v", err)
+	}
+}
@@ -2,18 +2,17 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
 	"log"
 	"moneyget/internal/domain"
 	"moneyget/internal/domain/service"
-	"moneyget/internal/infrastructure/sqlite"
 	"moneyget/internal/interface/handler"
 	"moneyget/internal/interface/router"
 	"moneyget/internal/usecase"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"syscall"
 	"time"
 
@@ -21,54 +20,114 @@ import (
 )
 
 func main() {
-	db, err := initDB()
+	cfg, args, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		migrateMain(cfg, args[1:])
+		return
+	}
+
+	if len(args) > 0 && args[0] == "replay" {
+		replayMain(cfg, args[1:])
+		return
+	}
+
+	if len(args) > 0 && args[0] == "snapshot" {
+		snapshotMain(cfg, args[1:])
+		return
+	}
+
+	store, err := initStore(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer func() {
-		if err := db.Close(); err != nil {
+		if err := store.Close(); err != nil {
 			log.Printf("Error closing database: %v\n", err)
 		}
 	}()
 
 	// Domain Services
 	eventDispatcher := service.NewEventDispatcher()
-	eventStore := service.NewEventStore(sqlite.NewEventStoreDB(db))
+	outbox := service.NewOutbox(store.eventStoreDB, store.outboxDB)
 	strategyService := service.NewInvestmentStrategyService()
 	passwordService, jwtService := initServices()
 
 	// Event Handlers
-	setupEventHandlers(eventDispatcher, eventStore)
+	setupEventHandlers(eventDispatcher, store.portfolioLoader(cfg.SnapshotEvery))
+	setupWebhooks(eventDispatcher, service.NewWebhookNotifier(store.webhookRepo, store.eventStoreDB))
+	streamHub := setupStreams(eventDispatcher)
+
+	// コミット済みのイベントをアウトボックスから購読者に配信する
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+		service.NewOutboxRelay(store.outboxDB, eventDispatcher, service.DefaultRelayPolicy).Run(relayCtx)
+	}()
+
+	// 配信待ちのWebhookを送信する
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		service.NewWebhookDeliverer(store.webhookRepo, nil, service.DefaultWebhookPolicy).Run(relayCtx)
+	}()
 
 	// Infrastructure Layer
-	txManager := sqlite.NewTransactionManager(db)
-	userRepo := sqlite.NewUserRepository(db)
-	investmentRepo := sqlite.NewInvestmentRepository(db)
-	portfolioRepo := sqlite.NewPortfolioRepository(db)
+	txManager := store.txManager
+	userRepo := store.userRepo
+	investmentRepo := store.investmentRepo
+	portfolioRepo := store.portfolioRepo
+	membershipRepo := store.membershipRepo
+	webhookRepo := store.webhookRepo
 
 	// Application Layer (Use Cases)
 	userUsecase := usecase.NewUserUsecase(userRepo, passwordService)
 	investmentUsecase := usecase.NewInvestmentUseCase(
 		investmentRepo,
 		portfolioRepo,
+		membershipRepo,
 		txManager,
-		eventDispatcher,
+		outbox,
 		strategyService,
 	)
 	portfolioUsecase := usecase.NewPortfolioUseCase(
 		portfolioRepo,
+		investmentRepo,
+		membershipRepo,
 		txManager,
-		eventDispatcher,
+		outbox,
 		strategyService,
 	)
+	membershipUsecase := usecase.NewMembershipUseCase(
+		membershipRepo,
+		portfolioRepo,
+		userRepo,
+		txManager,
+	)
+	webhookUsecase := usecase.NewWebhookUseCase(webhookRepo)
+	streamUsecase := usecase.NewPortfolioStreamUseCase(portfolioRepo, membershipRepo, store.eventStoreDB, streamHub)
+	auditUsecase := usecase.NewAuditUseCase(store.eventStoreDB, userRepo, portfolioRepo, membershipRepo, cfg.AdminUserIDs)
 
 	// Interface Layer (Handlers)
 	userHandler := handler.NewUserHandler(userUsecase, jwtService)
 	investmentHandler := handler.NewInvestmentHandler(investmentUsecase)
 	portfolioHandler := handler.NewPortfolioHandler(portfolioUsecase)
+	membershipHandler := handler.NewMembershipHandler(membershipUsecase)
+	webhookHandler := handler.NewWebhookHandler(webhookUsecase)
+	streamHandler := handler.NewStreamHandler(streamUsecase)
+	auditHandler := handler.NewAuditHandler(auditUsecase)
 
 	// Setup and start server
-	srv := setupServer(userHandler, investmentHandler, portfolioHandler, jwtService)
+	srv := setupServer(userHandler, investmentHandler, portfolioHandler, membershipHandler, webhookHandler, streamHandler, auditHandler, jwtService)
+	// 開いているイベントストリームを閉じないとShutdownが終わらない
+	srv.RegisterOnShutdown(streamHub.Close)
 
 	// Start the server
 	go func() {
@@ -79,46 +138,109 @@ func main() {
 
 	log.Println("Server started on :8080")
 	gracefulShutdown(srv)
+
+	// 配信中のメッセージを終えてから止める（未配信のものは次回の起動で配信される）
+	stopRelay()
+	<-relayDone
+	<-webhooksDone
+
+	// 購読者のキューに残ったイベントを処理し終えるまで待つ
+	// （終わらなかったイベントはアウトボックスに残り、次回の起動で配信される）
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := eventDispatcher.Close(ctx); err != nil {
+		log.Printf("Event subscribers did not finish: %v\n", err)
+	}
 }
 
-func setupEventHandlers(dispatcher *service.EventDispatcher, store *service.EventStore) {
-	// Investment Created Event Handler
-	dispatcher.Subscribe(func(event domain.DomainEvent) {
-		if err := store.SaveEvent(event); err != nil {
-			log.Printf("Failed to store InvestmentCreated event: %v\n", err)
-		}
-	})
+func setupEventHandlers(dispatcher *service.EventDispatcher, loader *service.PortfolioLoader) {
+	// イベントはアウトボックスと同じトランザクションでストリームに保存済み。
+	// 読み込みの際に、イベントが溜まっていればスナップショットが作られる
+	dispatcher.SubscribeWith(
+		service.Subscription{Name: "snapshots", Workers: 4},
+		func(event domain.DomainEvent) bool {
+			return event.AggregateType() == domain.AggregatePortfolio
+		},
+		func(event domain.DomainEvent) error {
+			_, _, err := loader.Load(context.Background(), event.AggregateID())
+			if errors.Is(err, domain.ErrPortfolioNotFound) {
+				return nil
+			}
+			return err
+		},
+	)
+}
 
-	// Portfolio Updated Event Handler
-	dispatcher.Subscribe(func(event domain.DomainEvent) {
-		if err := store.SaveEvent(event); err != nil {
-			log.Printf("Failed to store PortfolioUpdated event: %v\n", err)
-		}
-	})
+func setupWebhooks(dispatcher *service.EventDispatcher, notifier *service.WebhookNotifier) {
+	// 購読者ごとの配信記録を作り、送信はWebhookDelivererに任せる
+	dispatcher.SubscribeWith(
+		service.Subscription{Name: "webhooks"},
+		nil,
+		func(event domain.DomainEvent) error {
+			return notifier.Notify(context.Background(), event)
+		},
+	)
+}
+
+func setupStreams(dispatcher *service.EventDispatcher) *service.StreamHub {
+	// 接続ごとの購読は作らず、ハブが監視中の接続に知らせる
+	hub := service.NewStreamHub()
+	dispatcher.SubscribeWith(
+		service.Subscription{Name: "streams"},
+		func(event domain.DomainEvent) bool {
+			return event.AggregateType() == domain.AggregatePortfolio
+		},
+		hub.Publish,
+	)
+	return hub
 }
 
-// 既存の関数は維持
-func initDB() (*sql.DB, error) {
-	dbPath := filepath.Join(".", "moneyget.db")
-	db, err := sql.Open("sqlite3", dbPath)
+// initStore opens the configured database and applies pending migrations.
+func initStore(cfg config) (*store, error) {
+	store, err := openStore(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// コネクションプールの設定
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	// メモリ上のストアはマイグレーションの代わりにデモデータを投入する
+	if cfg.Storage == storageMemory {
+		if err := seedDemoData(context.Background(), store); err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
 
-	if err := db.Ping(); err != nil {
+	// 起動時に未適用のマイグレーションを適用する
+	migrator, err := store.migrator()
+	if err == nil {
+		_, err = migrator.Up(context.Background())
+	}
+	if err != nil {
+		store.Close()
 		return nil, err
 	}
 
-	if err := sqlite.RunMigrations(db); err != nil {
+	// 形式の変わったスナップショットは使えないので破棄する
+	invalidated, err := store.portfolioLoader(cfg.SnapshotEvery).InvalidateSnapshots(context.Background())
+	if err != nil {
+		store.Close()
 		return nil, err
 	}
+	if invalidated > 0 {
+		log.Printf("Removed %d snapshots of an older schema\n", invalidated)
+	}
+
+	// イベントを記録する前からあるポートフォリオは、保存済みの状態からストリームを作る
+	backfilled, err := store.replayUseCase(cfg.SnapshotEvery).Backfill(context.Background())
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if len(backfilled) > 0 {
+		log.Printf("Recorded the creation events of %d portfolios stored without events\n", len(backfilled))
+	}
 
-	return db, nil
+	return store, nil
 }
 
 func initServices() (service.PasswordService, service.JWTService) {
@@ -131,6 +253,10 @@ func setupServer(
 	userHandler *handler.UserHandler,
 	investmentHandler *handler.InvestmentHandler,
 	portfolioHandler *handler.PortfolioHandler,
+	membershipHandler *handler.MembershipHandler,
+	webhookHandler *handler.WebhookHandler,
+	streamHandler *handler.StreamHandler,
+	auditHandler *handler.AuditHandler,
 	jwtService service.JWTService,
 ) *http.Server {
 	return &http.Server{
@@ -139,6 +265,10 @@ func setupServer(
 			userHandler,
 			investmentHandler,
 			portfolioHandler,
+			membershipHandler,
+			webhookHandler,
+			streamHandler,
+			auditHandler,
 			jwtService,
 		),
 	}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"moneyget/internal/infrastructure/migration"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: moneyget [flags] migrate <command>
+
+commands:
+  up      apply all pending migrations
+  down    roll back the most recent migration
+  redo    roll back the most recent migration and apply it again
+  status  list migrations and whether they are applied
+`
+
+// runMigrateCommand implements `moneyget migrate <command>`.
+func runMigrateCommand(migrator *migration.Migrator, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%s", migrateUsage)
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "database is up to date")
+		}
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+	case "redo":
+		migration, err := migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "redone   %04d_%s\n", migration.Version, migration.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(out, statuses)
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+
+	return nil
+}
+
+func printMigrationStatus(out io.Writer, statuses []migration.Status) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Missing:
+			state = "applied (missing from binary)"
+		case status.ChecksumMismatch:
+			state = "applied (checksum mismatch)"
+		case status.Applied:
+			state = "applied"
+		}
+
+		appliedAt := "-"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Local().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+
+	w.Flush()
+}
+
+// migrateMain runs the migrate subcommand and exits on failure.
+func migrateMain(cfg config, args []string) {
+	store, err := openStore(cfg)
+	if err == nil {
+		var migrator *migration.Migrator
+		migrator, err = store.migrator()
+		if err == nil {
+			err = runMigrateCommand(migrator, args, os.Stdout)
+		}
+		store.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"moneyget/internal/usecase"
+	"os"
+	"text/tabwriter"
+)
+
+const replayUsage = `usage: moneyget [flags] replay [-apply]
+
+Rebuilds every portfolio from its events and reports where the portfolios
+and investments tables differ. With -apply the diverging portfolios are
+rewritten from their events, and portfolios without events get them from
+their stored state. Portfolios that cannot be replayed are listed and make
+the command fail once the others are done.
+`
+
+// errDivergent makes the command fail when divergences remain.
+var errDivergent = errors.New("the tables diverge from the events; run `moneyget replay -apply` to rebuild them")
+
+// runReplayCommand implements `moneyget replay [-apply]`.
+func runReplayCommand(replay *usecase.ReplayUseCase, args []string, out io.Writer) error {
+	apply := false
+	switch {
+	case len(args) == 1 && args[0] == "-apply":
+		apply = true
+	case len(args) != 0:
+		return fmt.Errorf("%s", replayUsage)
+	}
+
+	report, err := replay.Replay(context.Background(), apply)
+	if err != nil {
+		return err
+	}
+
+	printReplayReport(out, report)
+
+	if len(report.Failures) > 0 {
+		return fmt.Errorf("%d portfolios could not be replayed", len(report.Failures))
+	}
+	if len(report.Divergences) > 0 && !apply {
+		return errDivergent
+	}
+	return nil
+}
+
+func printReplayReport(out io.Writer, report *usecase.ReplayReport) {
+	for _, failure := range report.Failures {
+		fmt.Fprintf(out, "failed   %s: %v\n", failure.PortfolioID, failure.Err)
+	}
+	if len(report.Divergences) == 0 {
+		fmt.Fprintf(out, "%d portfolios match their events\n", report.Portfolios-len(report.Failures))
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORTFOLIO\tFIELD\tSTORED\tREPLAYED")
+	for _, divergence := range report.Divergences {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", divergence.PortfolioID, divergence.Field, divergence.Stored, divergence.Replayed)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "%d divergences in %d portfolios\n", len(report.Divergences), report.Portfolios)
+	for _, id := range report.Repaired {
+		fmt.Fprintf(out, "rebuilt  %s\n", id)
+	}
+}
+
+// replayMain runs the replay subcommand and exits on failure.
+func replayMain(cfg config, args []string) {
+	store, err := initStore(cfg)
+	if err == nil {
+		err = runReplayCommand(store.replayUseCase(cfg.SnapshotEvery), args, os.Stdout)
+		store.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
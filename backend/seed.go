@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"log"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/utils"
+)
+
+// demoPassword is the password of every seeded user.
+const demoPassword = "password123"
+
+type demoInvestment struct {
+	amount   float64
+	kind     domain.InvestmentType
+	strategy domain.InvestmentStrategy
+}
+
+type demoPortfolio struct {
+	name        string
+	deposit     float64
+	investments []demoInvestment
+}
+
+type demoUser struct {
+	name       string
+	email      string
+	portfolios []demoPortfolio
+}
+
+var demoUsers = []demoUser{
+	{
+		name:  "Demo User",
+		email: "demo@example.com",
+		portfolios: []demoPortfolio{
+			{
+				name:    "Main",
+				deposit: 3000000,
+				investments: []demoInvestment{
+					{1000000, domain.Stock, domain.Moderate},
+					{800000, domain.Bond, domain.Conservative},
+					{300000, domain.RealEstate, domain.Moderate},
+				},
+			},
+			{
+				name:    "NISA",
+				deposit: 1200000,
+				investments: []demoInvestment{
+					{500000, domain.Stock, domain.Aggressive},
+				},
+			},
+		},
+	},
+	{
+		name:  "Partner User",
+		email: "partner@example.com",
+		portfolios: []demoPortfolio{
+			{
+				name:    "Main",
+				deposit: 500000,
+				investments: []demoInvestment{
+					{200000, domain.Bond, domain.Conservative},
+				},
+			},
+		},
+	},
+}
+
+// seedDemoData fills an empty store with sample users and portfolios. The
+// partner can view the demo user's main portfolio.
+func seedDemoData(ctx context.Context, s *store) error {
+	passwordService := service.NewPasswordService()
+	hashedPassword, err := passwordService.HashPassword(demoPassword)
+	if err != nil {
+		return err
+	}
+
+	var users []*domain.User
+	var mainPortfolio *domain.Portfolio
+
+	for _, demo := range demoUsers {
+		user := &domain.User{Name: demo.name, Email: demo.email, Password: hashedPassword}
+		if err := s.userRepo.Create(user); err != nil {
+			return err
+		}
+		users = append(users, user)
+
+		for _, demoPortfolio := range demo.portfolios {
+			portfolio, err := seedPortfolio(ctx, s, user.ID, demoPortfolio)
+			if err != nil {
+				return err
+			}
+			if mainPortfolio == nil {
+				mainPortfolio = portfolio
+			}
+		}
+
+		log.Printf("Demo user: %s / %s\n", demo.email, demoPassword)
+	}
+
+	partner := users[1]
+	membership, err := domain.NewPortfolioInvitation(utils.GenerateUUID(), mainPortfolio.ID(), partner.Email, domain.RoleViewer, users[0].ID)
+	if err != nil {
+		return err
+	}
+	if err := membership.Accept(partner.ID, partner.Email); err != nil {
+		return err
+	}
+	return s.membershipRepo.Save(ctx, membership)
+}
+
+func seedPortfolio(ctx context.Context, s *store, userID string, demo demoPortfolio) (*domain.Portfolio, error) {
+	portfolio := domain.NewPortfolio(domain.NewPortfolioID(utils.GenerateUUID()), userID)
+	if err := portfolio.Rename(demo.name); err != nil {
+		return nil, err
+	}
+
+	deposit, err := newCashTransaction(domain.CashDeposit, demo.deposit, domain.InvestmentID{})
+	if err != nil {
+		return nil, err
+	}
+	if err := portfolio.RecordCashTransaction(deposit); err != nil {
+		return nil, err
+	}
+
+	for _, demoInvestment := range demo.investments {
+		money, err := domain.NewMoney(demoInvestment.amount, "JPY")
+		if err != nil {
+			return nil, err
+		}
+
+		investment, err := domain.NewInvestment(
+			domain.NewInvestmentID(utils.GenerateUUID()),
+			money,
+			demoInvestment.kind,
+			demoInvestment.strategy,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		debit, err := newCashTransaction(domain.CashInvestment, demoInvestment.amount, investment.ID())
+		if err != nil {
+			return nil, err
+		}
+		if err := portfolio.RecordCashTransaction(debit); err != nil {
+			return nil, err
+		}
+		if err := portfolio.AddInvestment(investment); err != nil {
+			return nil, err
+		}
+		if err := s.investmentRepo.Create(ctx, investment); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.portfolioRepo.Create(ctx, portfolio); err != nil {
+		return nil, err
+	}
+
+	// 作成までの経緯をポートフォリオのストリームに記録する
+	if _, err := service.NewEventStore(s.eventStoreDB).Append(ctx, 0, portfolio.Events()...); err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+func newCashTransaction(kind domain.CashTransactionType, amount float64, investmentID domain.InvestmentID) (*domain.CashTransaction, error) {
+	money, err := domain.NewMoney(amount, "JPY")
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewCashTransaction(utils.GenerateUUID(), kind, money, investmentID)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"os"
+)
+
+// runSnapshotCommand implements `moneyget snapshot [portfolio-id...]`. It
+// snapshots the given portfolios, or every portfolio with events.
+func runSnapshotCommand(loader *service.PortfolioLoader, events *service.EventStore, args []string, out io.Writer) error {
+	ctx := context.Background()
+
+	ids := args
+	if len(ids) == 0 {
+		streams, err := events.ListStreams(ctx, domain.AggregatePortfolio)
+		if err != nil {
+			return err
+		}
+		ids = streams
+	}
+
+	for _, id := range ids {
+		version, err := loader.TakeSnapshot(ctx, id)
+		if errors.Is(err, domain.ErrPortfolioNotFound) && len(args) == 0 {
+			// 削除済みのポートフォリオは対象外
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("portfolio %s: %w", id, err)
+		}
+		fmt.Fprintf(out, "snapshot %s at version %d\n", id, version)
+	}
+	return nil
+}
+
+// snapshotMain runs the snapshot subcommand and exits on failure.
+func snapshotMain(cfg config, args []string) {
+	store, err := initStore(cfg)
+	if err == nil {
+		err = runSnapshotCommand(
+			store.portfolioLoader(cfg.SnapshotEvery),
+			service.NewEventStore(store.eventStoreDB),
+			args,
+			os.Stdout,
+		)
+		store.Close()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
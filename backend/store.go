@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"moneyget/internal/domain"
+	"moneyget/internal/domain/service"
+	"moneyget/internal/infrastructure/memory"
+	"moneyget/internal/infrastructure/migration"
+	"moneyget/internal/infrastructure/postgres"
+	"moneyget/internal/infrastructure/sqlite"
+	"moneyget/internal/usecase"
+	"time"
+)
+
+// store is the persistence layer selected by configuration. db and
+// newMigrator are nil for the in-memory store.
+type store struct {
+	db             *sql.DB
+	txManager      domain.TransactionManager
+	userRepo       domain.UserRepository
+	investmentRepo domain.InvestmentRepository
+	portfolioRepo  domain.PortfolioRepository
+	membershipRepo domain.MembershipRepository
+	webhookRepo    domain.WebhookRepository
+	eventStoreDB   service.EventStoreDB
+	snapshotDB     service.SnapshotStoreDB
+	outboxDB       service.OutboxStoreDB
+	newMigrator    func(db *sql.DB) (*migration.Migrator, error)
+}
+
+// openStore connects to the configured database without migrating it.
+func openStore(cfg config) (*store, error) {
+	if cfg.Storage == storageMemory {
+		db := memory.NewDB()
+
+		return &store{
+			txManager:      memory.NewTransactionManager(db),
+			userRepo:       memory.NewUserRepository(db),
+			investmentRepo: memory.NewInvestmentRepository(db),
+			portfolioRepo:  memory.NewPortfolioRepository(db),
+			membershipRepo: memory.NewMembershipRepository(db),
+			webhookRepo:    memory.NewWebhookRepository(db),
+			eventStoreDB:   memory.NewEventStoreDB(db),
+			snapshotDB:     memory.NewSnapshotStoreDB(db),
+			outboxDB:       memory.NewOutboxStoreDB(db),
+		}, nil
+	}
+
+	if cfg.Storage == storagePostgres {
+		db, err := postgres.Open(cfg.DatabaseURL)
+		if err != nil {
+			return nil, err
+		}
+
+		return &store{
+			db:             db,
+			txManager:      postgres.NewTransactionManager(db),
+			userRepo:       postgres.NewUserRepository(db),
+			investmentRepo: postgres.NewInvestmentRepository(db),
+			portfolioRepo:  postgres.NewPortfolioRepository(db),
+			membershipRepo: postgres.NewMembershipRepository(db),
+			webhookRepo:    postgres.NewWebhookRepository(db),
+			eventStoreDB:   postgres.NewEventStoreDB(db),
+			snapshotDB:     postgres.NewSnapshotStoreDB(db),
+			outboxDB:       postgres.NewOutboxStoreDB(db),
+			newMigrator:    postgres.NewMigrator,
+		}, nil
+	}
+
+	db, err := sql.Open("sqlite3", cfg.SQLitePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// コネクションプールの設定
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &store{
+		db:             db,
+		txManager:      sqlite.NewTransactionManager(db),
+		userRepo:       sqlite.NewUserRepository(db),
+		investmentRepo: sqlite.NewInvestmentRepository(db),
+		portfolioRepo:  sqlite.NewPortfolioRepository(db),
+		membershipRepo: sqlite.NewMembershipRepository(db),
+		webhookRepo:    sqlite.NewWebhookRepository(db),
+		eventStoreDB:   sqlite.NewEventStoreDB(db),
+		snapshotDB:     sqlite.NewSnapshotStoreDB(db),
+		outboxDB:       sqlite.NewOutboxStoreDB(db),
+		newMigrator:    sqlite.NewMigrator,
+	}, nil
+}
+
+// portfolioLoader loads portfolios from the events of the store, taking a
+// snapshot every snapshotEvery events.
+func (s *store) portfolioLoader(snapshotEvery int) *service.PortfolioLoader {
+	return service.NewPortfolioLoader(service.NewEventStore(s.eventStoreDB), s.snapshotDB, snapshotEvery)
+}
+
+func (s *store) replayUseCase(snapshotEvery int) *usecase.ReplayUseCase {
+	return usecase.NewReplayUseCase(
+		s.portfolioRepo,
+		s.investmentRepo,
+		service.NewEventStore(s.eventStoreDB),
+		s.portfolioLoader(snapshotEvery),
+		s.txManager,
+	)
+}
+
+func (s *store) migrator() (*migration.Migrator, error) {
+	if s.newMigrator == nil {
+		return nil, errors.New("the in-memory store has no migrations")
+	}
+	return s.newMigrator(s.db)
+}
+
+func (s *store) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}